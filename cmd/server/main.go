@@ -1,22 +1,34 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
-	"path/filepath"
-	"strings"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"github.com/labstack/gommon/log"
 
+	site "tiktok-oauth"
 	"tiktok-oauth/internal/config"
 	"tiktok-oauth/internal/domain/oauth"
+	"tiktok-oauth/internal/infrastructure/oidc"
 	"tiktok-oauth/internal/infrastructure/store"
 	"tiktok-oauth/internal/infrastructure/tiktok"
+	"tiktok-oauth/internal/infrastructure/webhook"
 	httpiface "tiktok-oauth/internal/interface/http"
+	"tiktok-oauth/internal/pkg/httpx"
+	"tiktok-oauth/internal/pkg/i18n"
 	"tiktok-oauth/internal/pkg/logging"
+	"tiktok-oauth/internal/pkg/metrics"
+	"tiktok-oauth/internal/pkg/static"
+	"tiktok-oauth/internal/pkg/tracing"
 )
 
 func main() {
@@ -24,11 +36,47 @@ func main() {
 
 	e := echo.New()
 	e.HideBanner = true
-	// Split stdout/stderr: Info/Warn/Debug -> stdout, Error/Fatal/Panic -> stderr
-	e.Logger = logging.NewSplitLogger()
-	e.Logger.SetLevel(log.INFO)
+	// JSON logs through log/slog: Debug/Info/Warn -> stdout, Error -> stderr.
+	logger := logging.New(slog.LevelInfo)
+	slog.SetDefault(logger)
+	e.Logger = logging.NewEchoLogger(logger, os.Stdout)
+	e.StdLogger = slog.NewLogLogger(logger.Handler(), slog.LevelError)
+	// The client IP, which rate limits key on, is the peer of the
+	// connection unless it is one of TRUSTED_PROXIES; X-Forwarded-For is
+	// believed only from those, as anyone can send it.
+	proxies, err := cfg.TrustedProxyRanges()
+	if err != nil {
+		fatal("TRUSTED_PROXIES", err)
+	}
+	e.IPExtractor = echo.ExtractIPDirect()
+	if len(proxies) > 0 {
+		trust := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+		for _, n := range proxies {
+			trust = append(trust, echo.TrustIPRange(n))
+		}
+		e.IPExtractor = echo.ExtractIPFromXFFHeader(trust...)
+	}
 	e.Use(middleware.Recover())
-	// Structured access logs to stdout; 5xx only go to stderr via Errorj
+	// Every response carries X-Request-Id, which also appears in logs and
+	// in problem+json error bodies.
+	e.Use(middleware.RequestID())
+	e.HTTPErrorHandler = httpx.ErrorHandler
+	// Prometheus metrics, served on /metrics. Requests are labelled with
+	// their route template, never the raw URL.
+	meter := metrics.New()
+	e.Use(meter.Middleware())
+	// OpenTelemetry spans for requests, use cases and TikTok calls;
+	// traceparent headers are continued and passed on to TikTok.
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracesExporter, os.Stderr)
+	if err != nil {
+		fatal("OTEL_TRACES_EXPORTER", err)
+	}
+	e.Use(tracing.Middleware())
+	// Each request carries a logger tagged with its request_id (and trace
+	// ID); handlers add the open_id once known, and the use case and TikTok
+	// client log through it.
+	e.Use(httpx.Logger(logger))
+	// Structured access logs to stdout; responses >= 400 go to stderr
 	e.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
 		LogStatus:        true,
 		LogURI:           true,
@@ -37,140 +85,253 @@ func main() {
 		LogUserAgent:     true,
 		LogHost:          true,
 		LogLatency:       true,
-		LogRequestID:     true,
 		LogContentLength: true,
 		LogResponseSize:  true,
 		HandleError:      false,
 		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
-			// parse content-length to int when possible
-			var bytesIn int64
-			if v.ContentLength != "" {
-				// best-effort parse; ignore errors
-				for i := 0; i < len(v.ContentLength); i++ {
-					if v.ContentLength[i] < '0' || v.ContentLength[i] > '9' {
-						bytesIn = 0
-						break
-					}
-				}
-			}
-			m := log.JSON{
-				"id":            v.RequestID,
-				"remote_ip":     v.RemoteIP,
-				"host":          v.Host,
-				"method":        v.Method,
-				"uri":           v.URI,
-				"user_agent":    v.UserAgent,
-				"status":        v.Status,
-				"latency":       v.Latency.Nanoseconds(),
-				"latency_human": v.Latency.String(),
-				"bytes_in":      bytesIn,
-				"bytes_out":     v.ResponseSize,
+			// best-effort; a missing or malformed Content-Length counts as 0
+			bytesIn, _ := strconv.ParseInt(v.ContentLength, 10, 64)
+			attrs := []slog.Attr{
+				slog.String("remote_ip", v.RemoteIP),
+				slog.String("host", v.Host),
+				slog.String("method", v.Method),
+				slog.String("uri", v.URI),
+				slog.String("user_agent", v.UserAgent),
+				slog.Int("status", v.Status),
+				slog.Int64("latency", v.Latency.Nanoseconds()),
+				slog.String("latency_human", v.Latency.String()),
+				slog.Int64("bytes_in", bytesIn),
+				slog.Int64("bytes_out", v.ResponseSize),
 			}
+			level := slog.LevelInfo
 			if v.Status >= 400 {
-				m["level"] = "ERROR"
+				level = slog.LevelError
 				if v.Error != nil {
-					m["error"] = v.Error.Error()
+					attrs = append(attrs, slog.String("error", v.Error.Error()))
 				}
-				c.Logger().Errorj(m)
-			} else {
-				m["level"] = "INFO"
-				// Do not include error field for 4xx to avoid platform error classification
-				c.Logger().Infoj(m)
 			}
+			httpx.Log(c).LogAttrs(c.Request().Context(), level, "request", attrs...)
 			return nil
 		},
 	}))
 
-	// Top page (read from contents/index.html)
-	e.GET("/", func(c echo.Context) error {
-		path := filepath.Join("contents", "index.html")
-		b, err := os.ReadFile(path)
-		if err != nil {
-			c.Logger().Errorf("failed to read index.html: %v", err)
-			return c.String(http.StatusInternalServerError, "index.html not found")
-		}
-		return c.HTML(http.StatusOK, string(b))
-	})
+	// Pages and documents are embedded; STATIC_DIR serves them from disk
+	// for local editing. HTML revalidates with its ETag on every visit.
+	files := static.New(site.Files, cfg.StaticDir)
+	if err := files.Preload("contents", "docs"); err != nil {
+		fatal("static files", err)
+	}
+	// Every request gets a language from ?lang=, the lang cookie or
+	// Accept-Language; pages and JSON errors are rendered in it.
+	catalog, err := i18n.Load(files.FS(), "contents/i18n", cfg.DefaultLang)
+	if err != nil {
+		fatal("i18n", err)
+	}
+	e.Use(catalog.Middleware(cfg.SecureCookies()))
+	// HTML templates share contents/layout.html and are parsed up front,
+	// once per language; with STATIC_DIR they are re-parsed when a file
+	// changes.
+	views, err := httpiface.NewTemplates(files.FS(), "contents", catalog)
+	if err != nil {
+		fatal("templates", err)
+	}
+	e.Renderer = views
+	if files.Dev() {
+		go views.Watch(context.Background(), time.Second, func(err error) {
+			slog.Error("reload templates", "err", err)
+		})
+	}
+	e.GET("/", views.Page("index"))
+
+	// Error types referenced by problem+json bodies
+	e.GET("/problems/:code", httpiface.ProblemType)
 
 	// Healthz
 	e.GET("/healthz", func(c echo.Context) error { return c.String(http.StatusOK, "ok") })
+	e.GET("/metrics", meter.Handler())
+
+	// Insights dashboard (static HTML demo page)
+	e.GET("/insights", views.Page("insights"))
 
-	// Terms of Service (read from contents/terms_of_service.txt)
-	e.GET("/terms-of-service", func(c echo.Context) error {
-		path := filepath.Join("contents", "terms_of_service.txt")
-		b, err := os.ReadFile(path)
+	// Serve mock response samples (for demo / recorder)
+	e.GET("/docs/*", files.DirHandler("docs", "public, max-age=3600"))
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	client := &tiktok.Client{ClientKey: cfg.ClientKey, ClientSecret: cfg.ClientSecret, HTTP: httpClient, Observer: meter}
+	client.Uploader = &tiktok.Uploader{
+		HTTP:     &http.Client{Timeout: 5 * time.Minute},
+		Observer: meter,
+		OnProgress: func(p tiktok.UploadProgress) {
+			slog.Info("upload progress", "publish_id", p.PublishID, "chunk", p.Chunk, "total_chunks", p.TotalChunks, "sent_bytes", p.SentBytes, "total_bytes", p.TotalBytes)
+		},
+	}
+	mem, err := store.Open(cfg.StorePath)
+	if err != nil {
+		fatal("open store", err)
+	}
+	mem.SetObserver(meter)
+	meter.ActiveSessions(func() int { return mem.ActiveSessions(time.Now()) })
+	uc := oauth.NewUseCase(client, mem)
+	uc.SetRefreshObserver(meter)
+
+	// OAuth providers; TikTok is the default for the legacy /auth routes.
+	providers := oauth.NewRegistry(oauth.Registration{Provider: client, RedirectURI: cfg.RedirectURI, Scope: cfg.Scope, ScopeSep: ","})
+	if err := registerConfiguredProviders(providers, cfg, httpClient); err != nil {
+		fatal("oauth providers", err)
+	}
+	auth := oauth.NewAuth(providers, mem, mem, mem, mem)
+	returnTo, err := oauth.NewReturnToPolicy(cfg.ReturnToAllowList)
+	if err != nil {
+		fatal("RETURN_TO_ALLOWLIST", err)
+	}
+	auth.SetReturnToPolicy(returnTo)
+	auth.SetQRLoginStore(mem)
+	auth.SetScheduleStore(mem)
+	// Legal documents are contents/legal/<kind>/<effective date>.txt;
+	// logins after a newer version takes effect ask for acceptance.
+	legal, err := oauth.LoadLegalDocuments(files.FS(), "contents/legal")
+	if err != nil {
+		fatal("legal documents", err)
+	}
+	auth.SetLegal(legal, mem)
+	if raw, err := cfg.ClientConfigJSON(); err != nil {
+		fatal("OAUTH_CLIENTS", err)
+	} else if raw != nil {
+		clients, err := oauth.ParseAppClients(raw)
 		if err != nil {
-			c.Logger().Errorf("failed to read terms: %v", err)
-			return c.String(http.StatusInternalServerError, "terms_of_service.txt not found")
+			fatal("OAUTH_CLIENTS", err)
 		}
-		return c.String(http.StatusOK, string(b))
-	})
+		auth.SetAppClients(clients, mem)
+		auth.SetDeviceStore(mem)
+	}
 
-	// Privacy Policy (read from contents/privacy_policy.txt)
-	e.GET("/privacy-policy", func(c echo.Context) error {
-		path := filepath.Join("contents", "privacy_policy.txt")
-		b, err := os.ReadFile(path)
-		if err != nil {
-			c.Logger().Errorf("failed to read privacy policy: %v", err)
-			return c.String(http.StatusInternalServerError, "privacy_policy.txt not found")
+	var notifier oauth.Notifier
+	if len(cfg.PublishWebhookURLs) > 0 {
+		wn := &webhook.Notifier{URLs: cfg.PublishWebhookURLs, Secret: cfg.PublishWebhookSecret, HTTP: httpClient}
+		if err := wn.Validate(); err != nil {
+			fatal("PUBLISH_WEBHOOK_SECRET", err)
+		}
+		notifier = wn
+	}
+	tracker := oauth.NewPublishTracker(client, mem, notifier)
+	go runEvery(context.Background(), cfg.PublishPollInterval, func(ctx context.Context) {
+		if err := tracker.Poll(ctx); err != nil {
+			slog.Error("publish tracker", "err", err)
 		}
-		return c.String(http.StatusOK, string(b))
 	})
 
-	// Insights dashboard (static HTML demo page)
-	e.GET("/insights", func(c echo.Context) error {
-		path := filepath.Join("contents", "insights.html")
-		b, err := os.ReadFile(path)
-		if err != nil {
-			c.Logger().Errorf("failed to read insights.html: %v", err)
-			return c.String(http.StatusInternalServerError, "insights.html not found")
+	scheduler := oauth.NewScheduler(uc, mem, tracker)
+	go runEvery(context.Background(), cfg.SchedulerInterval, func(ctx context.Context) {
+		if err := scheduler.RunDue(ctx); err != nil {
+			slog.Error("scheduler", "err", err)
 		}
-		return c.HTML(http.StatusOK, string(b))
 	})
 
-	// Serve mock response samples (for demo / recorder)
-	e.Static("/docs", "docs")
+	h := &httpiface.Handler{
+		UC:            uc,
+		Auth:          auth,
+		Tracker:       tracker,
+		Scheduler:     scheduler,
+		Popup:         httpiface.PopupConfig{TargetOrigin: cfg.PopupTargetOrigin, Secret: cfg.PopupSigningSecret},
+		Legal:         legal,
+		Verification:  oauth.NewVerificationFiles(mem),
+		AdminToken:    cfg.AdminToken,
+		SecureCookies: cfg.SecureCookies(),
+		PublicBaseURL: cfg.PublicBaseURL,
+	}
+	if err := h.Popup.Validate(); err != nil {
+		fatal("POPUP_TARGET_ORIGIN", err)
+	}
+	h.Routes(e)
 
-	// (removed) specific TikTok sign route; now served by "/:filename"
+	// Domain-verification files (TikTok, Google, Apple, Android) answer
+	// paths no route matched, so they never shadow top-level routes.
+	e.RouteNotFound("/*", h.VerificationFile(files, "contents/signature"))
 
-	httpClient := &http.Client{Timeout: 10 * time.Second}
-	client := &tiktok.Client{ClientKey: cfg.ClientKey, ClientSecret: cfg.ClientSecret, HTTP: httpClient}
-	mem := &store.Memory{}
-	uc := oauth.NewUseCase(client, mem, cfg.Scope)
-
-	h := &httpiface.Handler{UC: uc, RedirectURI: cfg.RedirectURI}
-	e.GET("/auth/login", h.Login)
-	e.GET("/auth/callback", h.Callback)
-
-	// Dynamic file serving: GET /:filename -> contents/signature/:filename
-	e.GET("/:filename", func(c echo.Context) error {
-		name := c.Param("filename")
-		if name == "" || strings.Contains(name, "..") || strings.ContainsAny(name, "/\\") {
-			return c.String(http.StatusBadRequest, "invalid filename")
-		}
-		path := filepath.Join("contents", "signature", name)
-		b, err := os.ReadFile(path)
-		if err != nil {
-			c.Logger().Warnf("file not found in contents: %s", name)
-			return c.String(http.StatusNotFound, "file not found")
-		}
-		ct := "application/octet-stream"
-		lower := strings.ToLower(name)
-		switch {
-		case strings.HasSuffix(lower, ".txt"):
-			ct = "text/plain; charset=utf-8"
-		case strings.HasSuffix(lower, ".html"):
-			ct = "text/html; charset=utf-8"
-		}
-		return c.Blob(http.StatusOK, ct, b)
-	})
+	// OpenAPI document of every route, built from the handler types. A
+	// route registered without documentation, or documented without a
+	// route, fails the start.
+	apiDoc := httpiface.APIDocument()
+	openAPI, err := httpiface.OpenAPI(apiDoc)
+	if err != nil {
+		fatal("openapi", err)
+	}
+	e.GET("/openapi.json", openAPI)
+	if missing := httpiface.Undocumented(apiDoc, e.Routes()); len(missing) > 0 {
+		slog.Error("routes missing from the OpenAPI document", "routes", missing)
+		os.Exit(1)
+	}
+	if stale := httpiface.Unrouted(apiDoc, e.Routes()); len(stale) > 0 {
+		slog.Error("documented operations without a route", "operations", stale)
+		os.Exit(1)
+	}
 
 	addr := ":3000"
 	if p := os.Getenv("PORT"); p != "" {
 		addr = ":" + p
 	}
-	e.Logger.Infof("starting server on %s", addr)
-	if err := e.Start(addr); err != nil {
-		e.Logger.Fatalf("server error: %v", err)
+	// SIGINT/SIGTERM drain requests and flush pending spans.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		slog.Info("starting server", "addr", addr)
+		if err := e.Start(addr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("server error", err)
+		}
+	}()
+	<-ctx.Done()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		slog.Error("shutdown", "err", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("flush traces", "err", err)
+	}
+}
+
+// fatal logs a startup failure and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+// registerConfiguredProviders adds the generic OAuth2/OIDC providers from
+// OAUTH_PROVIDERS(_FILE). Discovery runs here so bad config fails at start.
+func registerConfiguredProviders(reg *oauth.Registry, cfg config.Config, hc *http.Client) error {
+	raw, err := cfg.ProviderConfigJSON()
+	if err != nil || raw == nil {
+		return err
+	}
+	cfgs, err := oidc.ParseConfigs(raw)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, pc := range cfgs {
+		p, err := oidc.New(ctx, pc, hc)
+		if err != nil {
+			return err
+		}
+		if _, err := reg.Lookup(p.Name()); err == nil {
+			return fmt.Errorf("provider %s is registered twice", p.Name())
+		}
+		reg.Register(p.Registration())
+	}
+	return nil
+}
+
+// runEvery calls fn every interval until ctx is done.
+func runEvery(ctx context.Context, interval time.Duration, fn func(context.Context)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			fn(ctx)
+		}
 	}
 }
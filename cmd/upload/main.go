@@ -0,0 +1,116 @@
+// Command upload posts a local video to TikTok through the FILE_UPLOAD
+// source. Progress is checkpointed next to the video so an interrupted
+// upload continues from the last acknowledged chunk when run again.
+//
+//	TIKTOK_ACCESS_TOKEN=... go run ./cmd/upload -file clip.mp4 -title "hello"
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"tiktok-oauth/internal/config"
+	"tiktok-oauth/internal/domain/oauth"
+	"tiktok-oauth/internal/infrastructure/store"
+	"tiktok-oauth/internal/infrastructure/tiktok"
+)
+
+func main() {
+	var (
+		file       = flag.String("file", "", "path of the video to upload (required)")
+		token      = flag.String("token", os.Getenv("TIKTOK_ACCESS_TOKEN"), "TikTok access token with video.publish scope")
+		title      = flag.String("title", "", "post title")
+		privacy    = flag.String("privacy", "SELF_ONLY", "privacy_level; must be offered by creator_info")
+		chunkMB    = flag.Int64("chunk-mb", 0, "chunk size in MiB (5-64); 0 picks a default")
+		checkpoint = flag.String("checkpoint", "", "checkpoint file (default: <file>.upload.json)")
+		wait       = flag.Duration("wait", 2*time.Minute, "how long to wait for the post to settle")
+	)
+	flag.Parse()
+	if *file == "" || *token == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *checkpoint == "" {
+		*checkpoint = *file + ".upload.json"
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("open video: %v", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		log.Fatalf("stat video: %v", err)
+	}
+
+	cfg := config.Load()
+	client := &tiktok.Client{ClientKey: cfg.ClientKey, ClientSecret: cfg.ClientSecret, HTTP: &http.Client{Timeout: 10 * time.Second}}
+	uc := oauth.NewUseCase(client, &store.Memory{})
+
+	st, err := tiktok.LoadCheckpoint(*checkpoint)
+	switch {
+	case err == nil:
+		if st.Plan.VideoSize != fi.Size() {
+			log.Fatalf("checkpoint %s does not match %s (size %d != %d)", *checkpoint, *file, st.Plan.VideoSize, fi.Size())
+		}
+		log.Printf("resuming publish_id=%s at chunk %d/%d", st.PublishID, st.NextChunk+1, st.Plan.TotalChunkCount)
+	case errors.Is(err, os.ErrNotExist):
+		plan, err := tiktok.PlanChunks(fi.Size(), *chunkMB<<20)
+		if err != nil {
+			log.Fatalf("plan chunks: %v", err)
+		}
+		info := oauth.PostInfo{Title: *title, PrivacyLevel: *privacy}
+		src := oauth.VideoSource{
+			Source:          oauth.SourceFileUpload,
+			VideoSize:       plan.VideoSize,
+			ChunkSize:       plan.ChunkSize,
+			TotalChunkCount: plan.TotalChunkCount,
+		}
+		init, err := uc.PublishVideo(ctx, *token, info, src)
+		if err != nil {
+			log.Fatalf("init post: %v", err)
+		}
+		st = tiktok.UploadState{PublishID: init.PublishID, UploadURL: init.UploadURL, ContentType: tiktok.ContentTypeFor(*file), Plan: plan}
+		if err := tiktok.SaveCheckpoint(*checkpoint, st); err != nil {
+			log.Fatalf("save checkpoint: %v", err)
+		}
+		log.Printf("initialized publish_id=%s chunks=%d chunk_size=%d", st.PublishID, plan.TotalChunkCount, plan.ChunkSize)
+	default:
+		log.Fatalf("load checkpoint: %v", err)
+	}
+
+	up := &tiktok.Uploader{
+		HTTP: &http.Client{Timeout: 5 * time.Minute},
+		OnCheckpoint: func(s tiktok.UploadState) error {
+			return tiktok.SaveCheckpoint(*checkpoint, s)
+		},
+		OnProgress: func(p tiktok.UploadProgress) {
+			fmt.Fprintf(os.Stderr, "\rchunk %d/%d  %d/%d bytes", p.Chunk, p.TotalChunks, p.SentBytes, p.TotalBytes)
+		},
+	}
+	if _, err := up.Upload(ctx, st, f); err != nil {
+		fmt.Fprintln(os.Stderr)
+		log.Fatalf("upload interrupted (rerun to resume): %v", err)
+	}
+	fmt.Fprintln(os.Stderr)
+	_ = os.Remove(*checkpoint)
+
+	waitCtx, cancel := context.WithTimeout(ctx, *wait)
+	defer cancel()
+	status, err := uc.WaitPublishStatus(waitCtx, *token, st.PublishID)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		log.Fatalf("fetch publish status: %v", err)
+	}
+	log.Printf("publish_id=%s status=%s fail_reason=%s post_ids=%v", st.PublishID, status.Status, status.FailReason, status.PostIDs)
+}
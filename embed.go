@@ -0,0 +1,10 @@
+// Package site embeds the pages, templates and documents that cmd/server
+// serves, so the binary does not depend on its working directory.
+package site
+
+import "embed"
+
+// Files holds contents/ and docs/.
+//
+//go:embed contents docs
+var Files embed.FS
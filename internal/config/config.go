@@ -1,7 +1,12 @@
 package config
 
 import (
+    "fmt"
+    "net"
+    "net/url"
     "os"
+    "strings"
+    "time"
 )
 
 type Config struct {
@@ -9,6 +14,49 @@ type Config struct {
     ClientSecret string
     RedirectURI  string
     Scope        string
+    // PublicBaseURL is the URL clients reach the server at; it defaults to
+    // the origin of RedirectURI. Cookies are Secure when it is https, also
+    // behind a proxy that terminates TLS.
+    PublicBaseURL string
+    // StorePath is the JSON snapshot file of the store; empty keeps
+    // everything in memory only.
+    StorePath string
+    // PublishPollInterval is how often tracked posts are polled.
+    PublishPollInterval time.Duration
+    // PublishWebhookURLs receive HMAC-signed events when a post settles.
+    PublishWebhookURLs   []string
+    PublishWebhookSecret string
+    // SchedulerInterval is how often due scheduled posts are executed.
+    SchedulerInterval time.Duration
+    // OAuthProviders is a JSON array of additional OAuth2/OIDC providers;
+    // OAuthProvidersFile names a file holding the same array.
+    OAuthProviders     string
+    OAuthProvidersFile string
+    // ReturnToAllowList lists the paths and origins return_to may point
+    // to after login; defaults to any path on this site.
+    ReturnToAllowList []string
+    // PopupTargetOrigin is the only origin popup logins post results to;
+    // PopupSigningSecret signs them. Popup mode needs both.
+    PopupTargetOrigin  string
+    PopupSigningSecret string
+    // OAuthClients is a JSON array of mobile app clients and their redirect
+    // URIs; OAuthClientsFile names a file holding the same array.
+    OAuthClients     string
+    OAuthClientsFile string
+    // StaticDir, when set, serves contents/ and docs/ from this directory
+    // instead of the copies embedded in the binary (for local editing).
+    StaticDir string
+    // DefaultLang is the language used when a request asks for none of
+    // the catalogs under contents/i18n.
+    DefaultLang string
+    // AdminToken is the bearer token of the /admin API; empty disables it.
+    AdminToken string
+    // TracesExporter selects where spans go: "otlp", "stdout" or none.
+    TracesExporter string
+    // TrustedProxies lists the CIDR ranges of the reverse proxies whose
+    // X-Forwarded-For names the client; without them the client is the
+    // peer of the connection.
+    TrustedProxies []string
 }
 
 // Load reads environment variables and applies defaults.
@@ -17,11 +65,105 @@ func Load() Config {
     if scope == "" {
         scope = "user.info.basic"
     }
+    lang := os.Getenv("DEFAULT_LANG")
+    if lang == "" {
+        lang = "ja"
+    }
+    redirectURI := os.Getenv("OAUTH_REDIRECT_URI")
+    baseURL := os.Getenv("PUBLIC_BASE_URL")
+    if u, err := url.Parse(redirectURI); baseURL == "" && err == nil && u.Host != "" {
+        baseURL = u.Scheme + "://" + u.Host
+    }
+    returnTo := listEnv("RETURN_TO_ALLOWLIST")
+    if len(returnTo) == 0 {
+        returnTo = []string{"/"}
+    }
     return Config{
-        ClientKey:    os.Getenv("TIKTOK_CLIENT_KEY"),
-        ClientSecret: os.Getenv("TIKTOK_CLIENT_SECRET"),
-        RedirectURI:  os.Getenv("OAUTH_REDIRECT_URI"),
-        Scope:        scope,
+        ClientKey:            os.Getenv("TIKTOK_CLIENT_KEY"),
+        ClientSecret:         os.Getenv("TIKTOK_CLIENT_SECRET"),
+        RedirectURI:          redirectURI,
+        Scope:                scope,
+        PublicBaseURL:        baseURL,
+        StorePath:            os.Getenv("STORE_PATH"),
+        PublishPollInterval:  durationEnv("PUBLISH_POLL_INTERVAL", 10*time.Second),
+        PublishWebhookURLs:   listEnv("PUBLISH_WEBHOOK_URLS"),
+        PublishWebhookSecret: os.Getenv("PUBLISH_WEBHOOK_SECRET"),
+        SchedulerInterval:    durationEnv("SCHEDULER_INTERVAL", 15*time.Second),
+        OAuthProviders:       os.Getenv("OAUTH_PROVIDERS"),
+        OAuthProvidersFile:   os.Getenv("OAUTH_PROVIDERS_FILE"),
+        ReturnToAllowList:    returnTo,
+        PopupTargetOrigin:    os.Getenv("POPUP_TARGET_ORIGIN"),
+        PopupSigningSecret:   os.Getenv("POPUP_SIGNING_SECRET"),
+        OAuthClients:         os.Getenv("OAUTH_CLIENTS"),
+        OAuthClientsFile:     os.Getenv("OAUTH_CLIENTS_FILE"),
+        StaticDir:            os.Getenv("STATIC_DIR"),
+        DefaultLang:          lang,
+        AdminToken:           os.Getenv("ADMIN_TOKEN"),
+        TracesExporter:       os.Getenv("OTEL_TRACES_EXPORTER"),
+        TrustedProxies:       listEnv("TRUSTED_PROXIES"),
     }
 }
 
+// SecureCookies reports whether cookies must be sent over HTTPS only.
+func (c Config) SecureCookies() bool {
+    u, err := url.Parse(c.PublicBaseURL)
+    return err == nil && strings.EqualFold(u.Scheme, "https")
+}
+
+// TrustedProxyRanges parses TrustedProxies.
+func (c Config) TrustedProxyRanges() ([]*net.IPNet, error) {
+    var ranges []*net.IPNet
+    for _, cidr := range c.TrustedProxies {
+        _, n, err := net.ParseCIDR(cidr)
+        if err != nil {
+            return nil, fmt.Errorf("trusted proxy %q: %w", cidr, err)
+        }
+        ranges = append(ranges, n)
+    }
+    return ranges, nil
+}
+
+// ProviderConfigJSON returns the raw provider config array, preferring
+// the file; nil means no additional providers.
+func (c Config) ProviderConfigJSON() ([]byte, error) {
+    if c.OAuthProvidersFile != "" {
+        return os.ReadFile(c.OAuthProvidersFile)
+    }
+    if strings.TrimSpace(c.OAuthProviders) == "" {
+        return nil, nil
+    }
+    return []byte(c.OAuthProviders), nil
+}
+
+// ClientConfigJSON returns the raw app client array, preferring the file;
+// nil means no app clients.
+func (c Config) ClientConfigJSON() ([]byte, error) {
+    if c.OAuthClientsFile != "" {
+        return os.ReadFile(c.OAuthClientsFile)
+    }
+    if strings.TrimSpace(c.OAuthClients) == "" {
+        return nil, nil
+    }
+    return []byte(c.OAuthClients), nil
+}
+
+// durationEnv parses a time.Duration (e.g. "30s"), falling back to def.
+func durationEnv(key string, def time.Duration) time.Duration {
+    if v := os.Getenv(key); v != "" {
+        if d, err := time.ParseDuration(v); err == nil && d > 0 {
+            return d
+        }
+    }
+    return def
+}
+
+// listEnv splits a comma separated variable, dropping empty items.
+func listEnv(key string) []string {
+    var out []string
+    for _, v := range strings.Split(os.Getenv(key), ",") {
+        if v = strings.TrimSpace(v); v != "" {
+            out = append(out, v)
+        }
+    }
+    return out
+}
@@ -0,0 +1,140 @@
+package oauth
+
+import (
+    "context"
+    "errors"
+    "fmt"
+)
+
+var (
+    // ErrAlreadyLinked is returned when linking an account that belongs
+    // to another user.
+    ErrAlreadyLinked = errors.New("account is linked to another user")
+    // ErrLastConnection is returned when unlinking would leave a user
+    // without any way to sign in.
+    ErrLastConnection = errors.New("cannot unlink the last connection")
+)
+
+// AccountStore persists users and their connections.
+type AccountStore interface {
+    SaveUser(ctx context.Context, u User) error
+    GetUser(ctx context.Context, id string) (User, error)
+    SaveConnection(ctx context.Context, c Connection) error
+    GetConnection(ctx context.Context, id string) (Connection, error)
+    ConnectionFor(ctx context.Context, provider, subject string) (Connection, error)
+    ListConnections(ctx context.Context, userID string) ([]Connection, error)
+    DeleteConnection(ctx context.Context, id string) error
+}
+
+// connect returns the connection of the signed-in account with the fresh
+// profile applied. Unknown accounts get a new connection owned by
+// linkUserID, or by a new user when this is a plain sign-in.
+func (a *Auth) connect(ctx context.Context, linkUserID string, tok Token, prof Profile) (Connection, error) {
+    now := a.now()
+    conn, err := a.accounts.ConnectionFor(ctx, prof.Provider, prof.Subject)
+    switch {
+    case err == nil:
+        if linkUserID != "" && conn.UserID != linkUserID {
+            return Connection{}, ErrAlreadyLinked
+        }
+    case errors.Is(err, ErrNotFound):
+        userID := linkUserID
+        if userID == "" {
+            u := User{ID: newID(), CreatedAt: now}
+            if err := a.accounts.SaveUser(ctx, u); err != nil {
+                return Connection{}, err
+            }
+            userID = u.ID
+        }
+        conn = Connection{ID: newID(), UserID: userID, Provider: prof.Provider, Subject: prof.Subject, CreatedAt: now}
+    default:
+        return Connection{}, err
+    }
+    // Keep the last known name and avatar when the profile was unavailable.
+    if prof.DisplayName != "" || prof.AvatarURL != "" {
+        conn.DisplayName, conn.AvatarURL = prof.DisplayName, prof.AvatarURL
+    }
+    conn.Scopes = MergeScopes(conn.Scopes, ParseScopes(tok.Scope))
+    conn.UpdatedAt = now
+    return conn, nil
+}
+
+// User returns the signed-in user and their connections.
+func (a *Auth) User(ctx context.Context, sessionID string) (User, []Connection, error) {
+    s, err := a.Session(ctx, sessionID)
+    if err != nil {
+        return User{}, nil, err
+    }
+    u, err := a.accounts.GetUser(ctx, s.UserID)
+    if err != nil {
+        return User{}, nil, err
+    }
+    conns, err := a.accounts.ListConnections(ctx, u.ID)
+    return u, conns, err
+}
+
+// Connection returns one of the signed-in user's connections; connections
+// of other users are reported as ErrNotFound.
+func (a *Auth) Connection(ctx context.Context, sessionID, connID string) (Connection, error) {
+    s, err := a.Session(ctx, sessionID)
+    if err != nil {
+        return Connection{}, err
+    }
+    conn, err := a.accounts.GetConnection(ctx, connID)
+    if err != nil {
+        return Connection{}, err
+    }
+    if conn.UserID != s.UserID {
+        return Connection{}, ErrNotFound
+    }
+    return conn, nil
+}
+
+// SetScheduleStore lets Unlink cancel the scheduled posts of a TikTok
+// connection; without one they stay queued and fail when they run.
+func (a *Auth) SetScheduleStore(s ScheduleStore) {
+    a.schedule = s
+}
+
+// Unlink removes a connection and its stored token, canceling the posts
+// still scheduled for a TikTok account. With revoke the token is revoked
+// at the provider first.
+func (a *Auth) Unlink(ctx context.Context, sessionID, connID string, revoke bool) error {
+    conn, err := a.Connection(ctx, sessionID, connID)
+    if err != nil {
+        return err
+    }
+    conns, err := a.accounts.ListConnections(ctx, conn.UserID)
+    if err != nil {
+        return err
+    }
+    if len(conns) <= 1 {
+        return ErrLastConnection
+    }
+    if revoke {
+        reg, err := a.providers.Lookup(conn.Provider)
+        if err != nil {
+            return err
+        }
+        if tok, err := a.tokens.TokenFor(ctx, conn.Provider, conn.Subject); err == nil && tok.AccessToken != "" {
+            if err := reg.Provider.Revoke(ctx, tok.AccessToken); err != nil {
+                return fmt.Errorf("%w: %v", ErrRevokeFailed, err)
+            }
+        }
+    }
+    if err := a.dropToken(ctx, conn.Provider, conn.Subject); err != nil {
+        return err
+    }
+    return a.accounts.DeleteConnection(ctx, conn.ID)
+}
+
+// dropToken deletes the stored token of an account, canceling the posts
+// still scheduled for it first since they could no longer run.
+func (a *Auth) dropToken(ctx context.Context, provider, subject string) error {
+    if a.schedule != nil && provider == ProviderTikTok {
+        if _, err := a.schedule.CancelScheduledFor(ctx, subject, a.now()); err != nil {
+            return err
+        }
+    }
+    return a.tokens.DeleteToken(ctx, provider, subject)
+}
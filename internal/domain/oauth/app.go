@@ -0,0 +1,188 @@
+package oauth
+
+import (
+    "context"
+    "crypto/subtle"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/url"
+    "strings"
+    "time"
+)
+
+// appCodeTTL is the lifetime of the one-time codes handed to apps.
+const appCodeTTL = time.Minute
+
+var (
+    // ErrInvalidClient is returned for unknown app clients and
+    // unregistered redirect URIs.
+    ErrInvalidClient = errors.New("invalid client")
+    // ErrInvalidGrant is returned for unknown, expired, reused or
+    // mismatching authorization codes and PKCE verifiers.
+    ErrInvalidGrant = errors.New("invalid grant")
+)
+
+// AppClient is a registered mobile app. Its redirect URIs are custom
+// schemes (myapp://oauth) or universal/app links (https://...), matched
+// exactly.
+type AppClient struct {
+    ID           string   `json:"client_id"`
+    RedirectURIs []string `json:"redirect_uris"`
+    // DeviceFlow allows the client to use the device authorization grant;
+    // such clients need no redirect URIs.
+    DeviceFlow bool `json:"device_flow,omitempty"`
+}
+
+// ParseAppClients decodes a JSON array of app clients and checks their
+// redirect URIs: absolute, without a fragment, and not a scheme a browser
+// would run as script.
+func ParseAppClients(raw []byte) ([]AppClient, error) {
+    var clients []AppClient
+    if err := json.Unmarshal(raw, &clients); err != nil {
+        return nil, err
+    }
+    seen := map[string]bool{}
+    for _, c := range clients {
+        if c.ID == "" || seen[c.ID] {
+            return nil, fmt.Errorf("app client ids must be unique and non-empty: %q", c.ID)
+        }
+        seen[c.ID] = true
+        if len(c.RedirectURIs) == 0 && !c.DeviceFlow {
+            return nil, fmt.Errorf("app client %s has no redirect_uris", c.ID)
+        }
+        for _, raw := range c.RedirectURIs {
+            u, err := url.Parse(raw)
+            if err != nil || u.Scheme == "" || u.Fragment != "" {
+                return nil, fmt.Errorf("app client %s: invalid redirect uri %q", c.ID, raw)
+            }
+            switch strings.ToLower(u.Scheme) {
+            case "javascript", "data", "vbscript", "file":
+                return nil, fmt.Errorf("app client %s: scheme of %q is not allowed", c.ID, raw)
+            case "http":
+                return nil, fmt.Errorf("app client %s: %q must use https or a custom scheme", c.ID, raw)
+            }
+        }
+    }
+    return clients, nil
+}
+
+// AppRequest is an app's authorization request to this server. The app
+// proves possession of the PKCE verifier when it redeems the code.
+type AppRequest struct {
+    ClientID      string `json:"client_id"`
+    RedirectURI   string `json:"redirect_uri"`
+    State         string `json:"state,omitempty"`
+    CodeChallenge string `json:"code_challenge"`
+    // CodeChallengeMethod must be S256; plain challenges are refused.
+    CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+// AppCode is a one-time code that an app exchanges for a session.
+type AppCode struct {
+    Code          string    `json:"code"`
+    ClientID      string    `json:"client_id"`
+    RedirectURI   string    `json:"redirect_uri"`
+    CodeChallenge string    `json:"code_challenge"`
+    SessionID     string    `json:"session_id"`
+    ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// AppCodeStore keeps issued app codes.
+type AppCodeStore interface {
+    SaveAppCode(ctx context.Context, c AppCode) error
+    // TakeAppCode returns and deletes a code so it can be used only once.
+    TakeAppCode(ctx context.Context, code string) (AppCode, error)
+}
+
+// SetAppClients enables the app broker flow for the given clients.
+func (a *Auth) SetAppClients(clients []AppClient, codes AppCodeStore) {
+    a.apps = make(map[string]AppClient, len(clients))
+    for _, c := range clients {
+        a.apps[c.ID] = c
+    }
+    a.codes = codes
+}
+
+// validateApp checks an app request against the registered clients.
+func (a *Auth) validateApp(r *AppRequest) error {
+    client, ok := a.apps[r.ClientID]
+    if !ok || a.codes == nil {
+        return ErrInvalidClient
+    }
+    registered := false
+    for _, u := range client.RedirectURIs {
+        if u == r.RedirectURI {
+            registered = true
+            break
+        }
+    }
+    if !registered {
+        return fmt.Errorf("%w: redirect_uri is not registered", ErrInvalidClient)
+    }
+    // 43 characters is the length of an S256 challenge (RFC 7636 4.2).
+    if r.CodeChallengeMethod != "S256" || len(r.CodeChallenge) != 43 {
+        return fmt.Errorf("%w: an S256 code_challenge is required", ErrInvalidLoginRequest)
+    }
+    return nil
+}
+
+// issueAppCode stores a code for session and returns the app redirect.
+func (a *Auth) issueAppCode(ctx context.Context, r *AppRequest, s Session) (string, error) {
+    code := AppCode{
+        Code:          newToken(32),
+        ClientID:      r.ClientID,
+        RedirectURI:   r.RedirectURI,
+        CodeChallenge: r.CodeChallenge,
+        SessionID:     s.ID,
+        ExpiresAt:     a.now().Add(appCodeTTL),
+    }
+    if err := a.codes.SaveAppCode(ctx, code); err != nil {
+        return "", err
+    }
+    return AppRedirect(r, url.Values{"code": {code.Code}}), nil
+}
+
+// AppRedirect appends params and the app's state to its redirect URI.
+func AppRedirect(r *AppRequest, params url.Values) string {
+    u, err := url.Parse(r.RedirectURI)
+    if err != nil {
+        return r.RedirectURI
+    }
+    q := u.Query()
+    for k, v := range params {
+        q[k] = v
+    }
+    if r.State != "" {
+        q.Set("state", r.State)
+    }
+    u.RawQuery = q.Encode()
+    return u.String()
+}
+
+// ExchangeAppCode redeems a one-time code for the session it was issued
+// with. The client, redirect URI and PKCE verifier must match the
+// original request.
+func (a *Auth) ExchangeAppCode(ctx context.Context, clientID, code, redirectURI, verifier string) (Session, error) {
+    if _, ok := a.apps[clientID]; !ok || a.codes == nil {
+        return Session{}, ErrInvalidClient
+    }
+    c, err := a.codes.TakeAppCode(ctx, code)
+    if errors.Is(err, ErrNotFound) {
+        return Session{}, ErrInvalidGrant
+    }
+    if err != nil {
+        return Session{}, err
+    }
+    if c.ClientID != clientID || c.RedirectURI != redirectURI || a.now().After(c.ExpiresAt) {
+        return Session{}, ErrInvalidGrant
+    }
+    if subtle.ConstantTimeCompare([]byte(codeChallengeS256(verifier)), []byte(c.CodeChallenge)) != 1 {
+        return Session{}, fmt.Errorf("%w: code_verifier does not match", ErrInvalidGrant)
+    }
+    s, err := a.Session(ctx, c.SessionID)
+    if errors.Is(err, ErrNotSignedIn) {
+        return Session{}, ErrInvalidGrant
+    }
+    return s, err
+}
@@ -0,0 +1,108 @@
+package oauth
+
+import (
+    "context"
+    "errors"
+    "net/url"
+    "testing"
+)
+
+type memCodeStore map[string]AppCode
+
+func (m memCodeStore) SaveAppCode(ctx context.Context, c AppCode) error {
+    m[c.Code] = c
+    return nil
+}
+
+func (m memCodeStore) TakeAppCode(ctx context.Context, code string) (AppCode, error) {
+    c, ok := m[code]
+    if !ok {
+        return AppCode{}, ErrNotFound
+    }
+    delete(m, code)
+    return c, nil
+}
+
+func TestParseAppClients(t *testing.T) {
+    ok := `[{"client_id":"ios","redirect_uris":["myapp://oauth/cb","https://app.example.com/cb"]}]`
+    if cs, err := ParseAppClients([]byte(ok)); err != nil || len(cs) != 1 || len(cs[0].RedirectURIs) != 2 {
+        t.Fatalf("unexpected clients %#v err=%v", cs, err)
+    }
+    for _, bad := range []string{
+        `[{"client_id":"ios","redirect_uris":[]}]`,
+        `[{"client_id":"ios","redirect_uris":["/relative"]}]`,
+        `[{"client_id":"ios","redirect_uris":["javascript:alert(1)"]}]`,
+        `[{"client_id":"ios","redirect_uris":["http://app.example.com/cb"]}]`,
+        `[{"client_id":"ios","redirect_uris":["myapp://cb#frag"]}]`,
+        `[{"client_id":"a","redirect_uris":["myapp://cb"]},{"client_id":"a","redirect_uris":["myapp://cb"]}]`,
+    } {
+        if _, err := ParseAppClients([]byte(bad)); err == nil {
+            t.Errorf("expected %s to be rejected", bad)
+        }
+    }
+}
+
+func TestAuth_AppLogin(t *testing.T) {
+    mc := &mockClient{token: Token{AccessToken: "a", OpenID: "o"}, profile: Profile{Subject: "o"}}
+    a, as := newTestAuth(mc, &mockStore{tokens: map[string]Token{}})
+    codes := memCodeStore{}
+    a.SetAppClients([]AppClient{{ID: "ios", RedirectURIs: []string{"myapp://oauth/cb"}}}, codes)
+    ctx := context.Background()
+
+    verifier := newToken(32)
+    app := AppRequest{ClientID: "ios", RedirectURI: "myapp://oauth/cb", State: "app-state", CodeChallenge: codeChallengeS256(verifier), CodeChallengeMethod: "S256"}
+
+    bad := app
+    bad.RedirectURI = "evil://cb"
+    if _, err := a.Begin(ctx, ProviderTikTok, BeginOptions{App: &bad}); !errors.Is(err, ErrInvalidClient) {
+        t.Fatalf("expected ErrInvalidClient, got %v", err)
+    }
+    bad = app
+    bad.CodeChallengeMethod = "plain"
+    if _, err := a.Begin(ctx, ProviderTikTok, BeginOptions{App: &bad}); !errors.Is(err, ErrInvalidLoginRequest) {
+        t.Fatalf("expected ErrInvalidLoginRequest, got %v", err)
+    }
+
+    if _, err := a.Begin(ctx, ProviderTikTok, BeginOptions{App: &app}); err != nil {
+        t.Fatal(err)
+    }
+    st := onlyState(t, as)
+    if st.Mode != LoginModeApp {
+        t.Fatalf("unexpected mode %q", st.Mode)
+    }
+    res, err := a.Complete(ctx, ProviderTikTok, st.State, "code")
+    if err != nil {
+        t.Fatal(err)
+    }
+    u, err := url.Parse(res.AppRedirect)
+    if err != nil || u.Scheme != "myapp" || u.Query().Get("state") != "app-state" {
+        t.Fatalf("unexpected app redirect %q", res.AppRedirect)
+    }
+    code := u.Query().Get("code")
+    if code == "" || code == mc.token.AccessToken {
+        t.Fatalf("app must get a one-time code, got %q", code)
+    }
+
+    if _, err := a.ExchangeAppCode(ctx, "ios", code, app.RedirectURI, "wrong"); !errors.Is(err, ErrInvalidGrant) {
+        t.Fatalf("expected ErrInvalidGrant for a bad verifier, got %v", err)
+    }
+    // A failed attempt burns the code.
+    if _, err := a.ExchangeAppCode(ctx, "ios", code, app.RedirectURI, verifier); !errors.Is(err, ErrInvalidGrant) {
+        t.Fatalf("expected the code to be used up, got %v", err)
+    }
+
+    a.Begin(ctx, ProviderTikTok, BeginOptions{App: &app})
+    res, _ = a.Complete(ctx, ProviderTikTok, onlyState(t, as).State, "code")
+    u, _ = url.Parse(res.AppRedirect)
+    code = u.Query().Get("code")
+    if _, err := a.ExchangeAppCode(ctx, "android", code, app.RedirectURI, verifier); !errors.Is(err, ErrInvalidClient) {
+        t.Fatalf("expected ErrInvalidClient, got %v", err)
+    }
+    s, err := a.ExchangeAppCode(ctx, "ios", code, app.RedirectURI, verifier)
+    if err != nil || s.ID != res.Session.ID {
+        t.Fatalf("exchange: %#v err=%v", s, err)
+    }
+    if _, err := a.ExchangeAppCode(ctx, "ios", code, app.RedirectURI, verifier); !errors.Is(err, ErrInvalidGrant) {
+        t.Fatalf("codes must be single use, got %v", err)
+    }
+}
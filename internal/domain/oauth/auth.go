@@ -0,0 +1,404 @@
+package oauth
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+)
+
+var (
+    // ErrInvalidState is returned when a callback carries an unknown,
+    // expired, reused or foreign state parameter.
+    ErrInvalidState = errors.New("invalid or expired state")
+    // ErrNotSignedIn is returned for missing, unknown or expired sessions.
+    ErrNotSignedIn = errors.New("not signed in")
+    // ErrRevokeFailed wraps provider errors while revoking a token.
+    ErrRevokeFailed = errors.New("revoke token")
+)
+
+// Lifetimes of pending logins and sessions.
+const (
+    stateTTL   = 10 * time.Minute
+    sessionTTL = 7 * 24 * time.Hour
+)
+
+// StateStore keeps pending authorization requests.
+type StateStore interface {
+    SaveState(ctx context.Context, s AuthState) error
+    // TakeState returns and deletes a state so it can be used only once.
+    TakeState(ctx context.Context, state string) (AuthState, error)
+}
+
+// SessionStore keeps signed-in sessions.
+type SessionStore interface {
+    SaveSession(ctx context.Context, s Session) error
+    GetSession(ctx context.Context, id string) (Session, error)
+    DeleteSession(ctx context.Context, id string) error
+}
+
+// LoginResult is the outcome of a completed login. ProfileErr is set when
+// the provider issued a token but the profile could not be fetched; the
+// session then only carries the token's subject. Linked reports that the
+// account was attached to an already signed-in user, in which case no
+// new Session is opened. DeniedScopes were requested but the connection
+// still lacks them after merging this grant. Request is the consumed
+// authorization request (return_to, mode); it is also set when a step
+// after the state check fails. AppRedirect carries the one-time code for
+// app logins. LegalPending lists the legal documents the user has to
+// accept again before going on.
+type LoginResult struct {
+    AppRedirect  string
+    LegalPending []LegalDocument
+    Request      AuthState
+    Session      Session
+    Connection   Connection
+    Linked       bool
+    DeniedScopes []string
+    Token        Token
+    Profile      Profile
+    ProfileErr   error
+}
+
+// Auth runs the authorization code flow for every registered provider:
+// it binds each request to a single-use state (and PKCE verifier),
+// exchanges the code, normalizes the profile, attaches the account to a
+// User and opens a session.
+type Auth struct {
+    providers   *Registry
+    states      StateStore
+    sessions    SessionStore
+    tokens      Store
+    accounts    AccountStore
+    returnTo    *ReturnToPolicy
+    apps        map[string]AppClient
+    codes       AppCodeStore
+    devices     DeviceStore
+    qrLogins    QRLoginStore
+    schedule    ScheduleStore
+    legal       *LegalLibrary
+    acceptances LegalAcceptanceStore
+    now         func() time.Time
+}
+
+func NewAuth(r *Registry, states StateStore, sessions SessionStore, tokens Store, accounts AccountStore) *Auth {
+    return &Auth{providers: r, states: states, sessions: sessions, tokens: tokens, accounts: accounts, now: time.Now}
+}
+
+// SetReturnToPolicy sets the allow-list for BeginOptions.ReturnTo; without
+// one every return_to is rejected.
+func (a *Auth) SetReturnToPolicy(p *ReturnToPolicy) { a.returnTo = p }
+
+// Providers lists the registered provider names.
+func (a *Auth) Providers() []string { return a.providers.Names() }
+
+// BeginOptions customize a single authorization request.
+type BeginOptions struct {
+    // Scopes are requested on top of the provider's configured scope,
+    // for incremental authorization.
+    Scopes []string
+    // ReturnTo is where the browser goes after the callback; it must pass
+    // the ReturnToPolicy.
+    ReturnTo string
+    // Mode selects how the callback answers; see LoginMode.
+    Mode LoginMode
+    // Nonce is echoed back in popup results so the opener can match them.
+    Nonce string
+    // App makes this a broker login for a registered mobile app, which
+    // gets a one-time code on its redirect URI (Mode is then LoginModeApp).
+    App *AppRequest
+
+    // deviceCode marks the login that approves a device (BeginDevice).
+    deviceCode string
+    // qrLoginID marks the phone login of a QR login (BeginQRLogin).
+    qrLoginID string
+}
+
+// LoginMode selects how the callback hands the result to the client.
+type LoginMode string
+
+const (
+    // LoginModeRedirect renders the callback page or redirects to
+    // return_to (the default).
+    LoginModeRedirect LoginMode = ""
+    // LoginModePopup posts the result to window.opener and closes.
+    LoginModePopup LoginMode = "popup"
+    // LoginModeApp redirects to a mobile app with a one-time code.
+    LoginModeApp LoginMode = "app"
+    // LoginModeDevice approves a device authorization grant.
+    LoginModeDevice LoginMode = "device"
+    // LoginModeQR signs in the screen that showed a QR code.
+    LoginModeQR LoginMode = "qr"
+)
+
+// maxNonceLen bounds BeginOptions.Nonce.
+const maxNonceLen = 128
+
+// ErrInvalidLoginRequest is returned for an unknown mode or bad nonce.
+var ErrInvalidLoginRequest = errors.New("invalid login request")
+
+// Begin records a new state for provider and returns the URL to send the
+// browser to.
+func (a *Auth) Begin(ctx context.Context, provider string, opts BeginOptions) (string, error) {
+    return a.begin(ctx, provider, "", opts)
+}
+
+// BeginLink is Begin for a signed-in user adding another account, or
+// re-authorizing a linked one with more scopes.
+func (a *Auth) BeginLink(ctx context.Context, sessionID, provider string, opts BeginOptions) (string, error) {
+    s, err := a.Session(ctx, sessionID)
+    if err != nil {
+        return "", err
+    }
+    return a.begin(ctx, provider, s.UserID, opts)
+}
+
+func (a *Auth) begin(ctx context.Context, provider, linkUserID string, opts BeginOptions) (string, error) {
+    reg, err := a.providers.Lookup(provider)
+    if err != nil {
+        return "", err
+    }
+    if err := validateScopes(opts.Scopes); err != nil {
+        return "", err
+    }
+    switch opts.Mode {
+    case LoginModeRedirect, LoginModePopup:
+    default:
+        return "", fmt.Errorf("%w: unknown mode %q", ErrInvalidLoginRequest, opts.Mode)
+    }
+    if len(opts.Nonce) > maxNonceLen {
+        return "", fmt.Errorf("%w: nonce is too long", ErrInvalidLoginRequest)
+    }
+    if opts.App != nil {
+        if linkUserID != "" || opts.Mode != LoginModeRedirect || opts.ReturnTo != "" {
+            return "", fmt.Errorf("%w: app logins cannot link, use popups or return_to", ErrInvalidLoginRequest)
+        }
+        if err := a.validateApp(opts.App); err != nil {
+            return "", err
+        }
+        opts.Mode = LoginModeApp
+    }
+    if opts.deviceCode != "" {
+        opts.Mode = LoginModeDevice
+    }
+    if opts.qrLoginID != "" {
+        opts.Mode = LoginModeQR
+    }
+    var returnTo string
+    if opts.ReturnTo != "" {
+        if returnTo, err = a.returnTo.Check(opts.ReturnTo); err != nil {
+            return "", err
+        }
+    }
+    st := AuthState{
+        State:      newToken(16),
+        Provider:   provider,
+        LinkUserID: linkUserID,
+        Scopes:     MergeScopes(ParseScopes(reg.Scope), opts.Scopes),
+        ReturnTo:   returnTo,
+        Mode:       opts.Mode,
+        Nonce:      opts.Nonce,
+        App:        opts.App,
+        DeviceCode: opts.deviceCode,
+        QRLoginID:  opts.qrLoginID,
+        ExpiresAt:  a.now().Add(stateTTL),
+    }
+    params := AuthParams{State: st.State, RedirectURI: reg.RedirectURI, Scope: strings.Join(st.Scopes, reg.scopeSep())}
+    if reg.UsePKCE {
+        st.CodeVerifier = newToken(32)
+        params.CodeChallenge = codeChallengeS256(st.CodeVerifier)
+    }
+    if err := a.states.SaveState(ctx, st); err != nil {
+        return "", err
+    }
+    return reg.Provider.AuthURL(params), nil
+}
+
+// Complete validates state, exchanges code and either opens a session for
+// the account's user (creating the user on first sign-in) or, for a link
+// request, attaches the account to the requesting user.
+func (a *Auth) Complete(ctx context.Context, provider, state, code string) (LoginResult, error) {
+    reg, err := a.providers.Lookup(provider)
+    if err != nil {
+        return LoginResult{}, err
+    }
+    st, err := a.takeState(ctx, provider, state)
+    if err != nil {
+        return LoginResult{}, err
+    }
+    res, err := a.complete(ctx, reg, st, code)
+    res.Request = st
+    return res, err
+}
+
+func (a *Auth) complete(ctx context.Context, reg Registration, st AuthState, code string) (LoginResult, error) {
+    provider := st.Provider
+    tok, err := reg.Provider.Exchange(ctx, ExchangeParams{Code: code, RedirectURI: reg.RedirectURI, CodeVerifier: st.CodeVerifier})
+    if err != nil {
+        return LoginResult{}, fmt.Errorf("exchange code: %w", err)
+    }
+    tok.Provider = provider
+    if tok.Scope == "" {
+        // RFC 6749 5.1: an omitted scope means the requested one.
+        tok.Scope = strings.Join(st.Scopes, reg.scopeSep())
+    }
+
+    res := LoginResult{Token: tok}
+    res.Profile, res.ProfileErr = reg.Provider.UserInfo(ctx, tok.AccessToken)
+    if res.ProfileErr != nil {
+        if tok.OpenID == "" {
+            return LoginResult{}, fmt.Errorf("fetch profile: %w", res.ProfileErr)
+        }
+        res.Profile = Profile{Subject: tok.OpenID}
+    }
+    res.Profile.Provider = provider
+    if res.Token.OpenID == "" {
+        res.Token.OpenID = res.Profile.Subject
+    }
+
+    res.Connection, err = a.connect(ctx, st.LinkUserID, res.Token, res.Profile)
+    if err != nil {
+        return LoginResult{}, err
+    }
+    // Scopes granted by an earlier authorization of the same connection
+    // still hold, so only what the connection lacks was denied.
+    res.DeniedScopes = NewScopeSet(res.Connection.Scopes...).Missing(st.Scopes...)
+    if err := a.tokens.Save(ctx, res.Token); err != nil {
+        return LoginResult{}, err
+    }
+    if err := a.accounts.SaveConnection(ctx, res.Connection); err != nil {
+        return LoginResult{}, err
+    }
+    if st.LinkUserID != "" {
+        res.Linked = true
+        return res, nil
+    }
+
+    now := a.now()
+    res.Session = Session{
+        ID:        newToken(32),
+        UserID:    res.Connection.UserID,
+        Provider:  provider,
+        Subject:   res.Profile.Subject,
+        Profile:   res.Profile,
+        CreatedAt: now,
+        ExpiresAt: now.Add(sessionTTL),
+    }
+    if err := a.sessions.SaveSession(ctx, res.Session); err != nil {
+        return LoginResult{}, err
+    }
+    if res.LegalPending, err = a.legalOnLogin(ctx, res.Session.UserID); err != nil {
+        return LoginResult{}, err
+    }
+    if st.App != nil {
+        if res.AppRedirect, err = a.issueAppCode(ctx, st.App, res.Session); err != nil {
+            return LoginResult{}, err
+        }
+    }
+    if st.DeviceCode != "" {
+        if err := a.approveDevice(ctx, st.DeviceCode, res.Session); err != nil {
+            return LoginResult{}, err
+        }
+    }
+    if st.QRLoginID != "" {
+        if err := a.setQRStatus(ctx, st.QRLoginID, QRApproved, res.Session.ID); err != nil {
+            return LoginResult{}, err
+        }
+    }
+    return res, nil
+}
+
+// Abort consumes the state of a callback that carries a provider error
+// (e.g. access_denied) and returns it, so the caller can still honour
+// ReturnTo.
+func (a *Auth) Abort(ctx context.Context, provider, state string) (AuthState, error) {
+    st, err := a.takeState(ctx, provider, state)
+    if err == nil && st.DeviceCode != "" {
+        err = a.denyDevice(ctx, st.DeviceCode)
+    }
+    if err == nil && st.QRLoginID != "" {
+        err = a.setQRStatus(ctx, st.QRLoginID, QRDenied, "")
+    }
+    return st, err
+}
+
+// takeState consumes a state issued for provider that has not expired.
+func (a *Auth) takeState(ctx context.Context, provider, state string) (AuthState, error) {
+    st, err := a.states.TakeState(ctx, state)
+    if errors.Is(err, ErrNotFound) {
+        return AuthState{}, ErrInvalidState
+    }
+    if err != nil {
+        return AuthState{}, err
+    }
+    if st.Provider != provider || a.now().After(st.ExpiresAt) {
+        return AuthState{}, ErrInvalidState
+    }
+    return st, nil
+}
+
+// Session returns a live session. Unknown and expired sessions, and
+// sessions opened before users existed, are reported as ErrNotSignedIn.
+func (a *Auth) Session(ctx context.Context, id string) (Session, error) {
+    if id == "" {
+        return Session{}, ErrNotSignedIn
+    }
+    s, err := a.sessions.GetSession(ctx, id)
+    if errors.Is(err, ErrNotFound) {
+        return Session{}, ErrNotSignedIn
+    }
+    if err != nil {
+        return Session{}, err
+    }
+    if a.now().After(s.ExpiresAt) || s.UserID == "" {
+        _ = a.sessions.DeleteSession(ctx, id)
+        return Session{}, ErrNotSignedIn
+    }
+    return s, nil
+}
+
+// Logout deletes the session. With revoke the stored token of the
+// signed-in account is also revoked at the provider and deleted, and the
+// posts still scheduled for it are canceled, as Unlink does. When the
+// revocation fails the token and its scheduled posts are kept.
+func (a *Auth) Logout(ctx context.Context, id string, revoke bool) error {
+    s, err := a.Session(ctx, id)
+    if err != nil {
+        return err
+    }
+    var revokeErr error
+    if reg, err := a.providers.Lookup(s.Provider); revoke && err == nil {
+        if tok, err := a.tokens.TokenFor(ctx, s.Provider, s.Subject); err == nil && tok.AccessToken != "" {
+            revokeErr = reg.Provider.Revoke(ctx, tok.AccessToken)
+        }
+        if revokeErr == nil {
+            if err := a.dropToken(ctx, s.Provider, s.Subject); err != nil {
+                return err
+            }
+        }
+    }
+    if err := a.sessions.DeleteSession(ctx, id); err != nil {
+        return err
+    }
+    if revokeErr != nil {
+        return fmt.Errorf("%w: %v", ErrRevokeFailed, revokeErr)
+    }
+    return nil
+}
+
+// codeChallengeS256 derives the RFC 7636 S256 code challenge.
+func codeChallengeS256(verifier string) string {
+    sum := sha256.Sum256([]byte(verifier))
+    return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// newToken returns n random bytes as unpadded base64url.
+func newToken(n int) string {
+    b := make([]byte, n)
+    _, _ = rand.Read(b)
+    return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,337 @@
+package oauth
+
+import (
+    "context"
+    "errors"
+    "reflect"
+    "testing"
+)
+
+type memAuthStore struct {
+    states   map[string]AuthState
+    sessions map[string]Session
+    users    map[string]User
+    conns    map[string]Connection
+}
+
+func newMemAuthStore() *memAuthStore {
+    return &memAuthStore{
+        states:   map[string]AuthState{},
+        sessions: map[string]Session{},
+        users:    map[string]User{},
+        conns:    map[string]Connection{},
+    }
+}
+
+func (m *memAuthStore) SaveState(ctx context.Context, s AuthState) error {
+    m.states[s.State] = s
+    return nil
+}
+
+func (m *memAuthStore) TakeState(ctx context.Context, state string) (AuthState, error) {
+    s, ok := m.states[state]
+    if !ok {
+        return AuthState{}, ErrNotFound
+    }
+    delete(m.states, state)
+    return s, nil
+}
+
+func (m *memAuthStore) SaveSession(ctx context.Context, s Session) error {
+    m.sessions[s.ID] = s
+    return nil
+}
+
+func (m *memAuthStore) GetSession(ctx context.Context, id string) (Session, error) {
+    s, ok := m.sessions[id]
+    if !ok {
+        return Session{}, ErrNotFound
+    }
+    return s, nil
+}
+
+func (m *memAuthStore) DeleteSession(ctx context.Context, id string) error {
+    delete(m.sessions, id)
+    return nil
+}
+
+func (m *memAuthStore) SaveUser(ctx context.Context, u User) error {
+    m.users[u.ID] = u
+    return nil
+}
+
+func (m *memAuthStore) GetUser(ctx context.Context, id string) (User, error) {
+    u, ok := m.users[id]
+    if !ok {
+        return User{}, ErrNotFound
+    }
+    return u, nil
+}
+
+func (m *memAuthStore) SaveConnection(ctx context.Context, c Connection) error {
+    m.conns[c.ID] = c
+    return nil
+}
+
+func (m *memAuthStore) GetConnection(ctx context.Context, id string) (Connection, error) {
+    c, ok := m.conns[id]
+    if !ok {
+        return Connection{}, ErrNotFound
+    }
+    return c, nil
+}
+
+func (m *memAuthStore) ConnectionFor(ctx context.Context, provider, subject string) (Connection, error) {
+    for _, c := range m.conns {
+        if c.Provider == provider && c.Subject == subject {
+            return c, nil
+        }
+    }
+    return Connection{}, ErrNotFound
+}
+
+func (m *memAuthStore) ListConnections(ctx context.Context, userID string) ([]Connection, error) {
+    var out []Connection
+    for _, c := range m.conns {
+        if c.UserID == userID {
+            out = append(out, c)
+        }
+    }
+    return out, nil
+}
+
+func (m *memAuthStore) DeleteConnection(ctx context.Context, id string) error {
+    delete(m.conns, id)
+    return nil
+}
+
+func newTestAuth(mc *mockClient, ms *mockStore) (*Auth, *memAuthStore) {
+    as := newMemAuthStore()
+    reg := NewRegistry(Registration{Provider: mc, RedirectURI: "https://cb", Scope: "user.info.basic", UsePKCE: true, ScopeSep: ","})
+    return NewAuth(reg, as, as, ms, as), as
+}
+
+// onlyState returns the single pending state.
+func onlyState(t *testing.T, as *memAuthStore) AuthState {
+    t.Helper()
+    if len(as.states) != 1 {
+        t.Fatalf("expected one pending state, got %d", len(as.states))
+    }
+    for _, s := range as.states {
+        return s
+    }
+    return AuthState{}
+}
+
+func TestAuth_Begin(t *testing.T) {
+    mc := &mockClient{authURL: "https://example/auth?x=y"}
+    a, as := newTestAuth(mc, &mockStore{})
+    got, err := a.Begin(context.Background(), ProviderTikTok, BeginOptions{})
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if got != mc.authURL {
+        t.Fatalf("unexpected auth URL: got=%s want=%s", got, mc.authURL)
+    }
+    st := onlyState(t, as)
+    req := mc.authReqs[0]
+    if req.State != st.State || req.RedirectURI != "https://cb" || req.Scope != "user.info.basic" {
+        t.Fatalf("unexpected auth params: %#v", req)
+    }
+    if st.CodeVerifier == "" || req.CodeChallenge != codeChallengeS256(st.CodeVerifier) {
+        t.Fatalf("code challenge does not match the stored verifier")
+    }
+    if _, err := a.Begin(context.Background(), "nope", BeginOptions{}); !errors.Is(err, ErrUnknownProvider) {
+        t.Fatalf("expected ErrUnknownProvider, got %v", err)
+    }
+}
+
+func TestAuth_Complete_Success(t *testing.T) {
+    want := Token{AccessToken: "a", RefreshToken: "r", OpenID: "o", Scope: "s", TokenType: "Bearer", ExpiresIn: 1}
+    mc := &mockClient{token: want, profile: Profile{Subject: "o", DisplayName: "Alice"}}
+    ms := &mockStore{tokens: map[string]Token{}}
+    a, as := newTestAuth(mc, ms)
+    ctx := context.Background()
+    if _, err := a.Begin(ctx, ProviderTikTok, BeginOptions{}); err != nil {
+        t.Fatal(err)
+    }
+    st := onlyState(t, as)
+
+    res, err := a.Complete(ctx, ProviderTikTok, st.State, "code")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    want.Provider = ProviderTikTok
+    if !reflect.DeepEqual(res.Token, want) || !reflect.DeepEqual(ms.tokens["o"], want) {
+        t.Fatalf("unexpected token: %#v", res.Token)
+    }
+    if mc.exchanges[0].CodeVerifier != st.CodeVerifier || mc.exchanges[0].Code != "code" {
+        t.Fatalf("unexpected exchange params: %#v", mc.exchanges[0])
+    }
+    s, err := a.Session(ctx, res.Session.ID)
+    if err != nil || s.Subject != "o" || s.Profile.DisplayName != "Alice" || s.Profile.Provider != ProviderTikTok {
+        t.Fatalf("unexpected session: %#v err=%v", s, err)
+    }
+
+    // States are single use.
+    if _, err := a.Complete(ctx, ProviderTikTok, st.State, "code"); !errors.Is(err, ErrInvalidState) {
+        t.Fatalf("expected ErrInvalidState on reuse, got %v", err)
+    }
+
+    ss := &memScheduleStore{posts: map[string]ScheduledPost{"queued": {ID: "queued", OpenID: "o", State: ScheduleScheduled}}}
+    a.SetScheduleStore(ss)
+    if err := a.Logout(ctx, res.Session.ID, true); err != nil {
+        t.Fatalf("logout: %v", err)
+    }
+    if _, err := a.Session(ctx, res.Session.ID); !errors.Is(err, ErrNotSignedIn) {
+        t.Fatalf("session must be gone after logout, got %v", err)
+    }
+    if !reflect.DeepEqual(mc.revoked, []string{"a"}) {
+        t.Fatalf("expected the token to be revoked, got %v", mc.revoked)
+    }
+    if _, ok := ms.tokens["o"]; ok {
+        t.Fatalf("revoked token must be deleted")
+    }
+    if got := ss.posts["queued"].State; got != ScheduleCanceled {
+        t.Fatalf("expected the scheduled post to be canceled, got %s", got)
+    }
+}
+
+func TestAuth_Complete_Error(t *testing.T) {
+    mc := &mockClient{exchErr: errors.New("boom")}
+    a, as := newTestAuth(mc, &mockStore{})
+    ctx := context.Background()
+    if _, err := a.Begin(ctx, ProviderTikTok, BeginOptions{}); err != nil {
+        t.Fatal(err)
+    }
+    st := onlyState(t, as)
+    if _, err := a.Complete(ctx, ProviderTikTok, st.State, "code"); err == nil || errors.Is(err, ErrInvalidState) {
+        t.Fatalf("expected exchange error, got %v", err)
+    }
+    if _, err := a.Complete(ctx, ProviderTikTok, "forged", "code"); !errors.Is(err, ErrInvalidState) {
+        t.Fatalf("expected ErrInvalidState, got %v", err)
+    }
+}
+
+// login runs Begin and Complete for the account mc currently returns.
+func login(t *testing.T, a *Auth, as *memAuthStore, sessionID string) (LoginResult, error) {
+    t.Helper()
+    ctx := context.Background()
+    var err error
+    if sessionID == "" {
+        _, err = a.Begin(ctx, ProviderTikTok, BeginOptions{})
+    } else {
+        _, err = a.BeginLink(ctx, sessionID, ProviderTikTok, BeginOptions{})
+    }
+    if err != nil {
+        t.Fatalf("begin: %v", err)
+    }
+    return a.Complete(ctx, ProviderTikTok, onlyState(t, as).State, "code")
+}
+
+func TestAuth_LinkAndUnlink(t *testing.T) {
+    mc := &mockClient{}
+    ms := &mockStore{tokens: map[string]Token{}}
+    a, as := newTestAuth(mc, ms)
+    ctx := context.Background()
+
+    mc.token, mc.profile = Token{AccessToken: "a1", OpenID: "o1"}, Profile{Subject: "o1"}
+    first, err := login(t, a, as, "")
+    if err != nil {
+        t.Fatalf("login: %v", err)
+    }
+    sid := first.Session.ID
+    if _, err := a.BeginLink(ctx, "nope", ProviderTikTok, BeginOptions{}); !errors.Is(err, ErrNotSignedIn) {
+        t.Fatalf("expected ErrNotSignedIn, got %v", err)
+    }
+
+    mc.token, mc.profile = Token{AccessToken: "a2", OpenID: "o2"}, Profile{Subject: "o2", DisplayName: "Second"}
+    linked, err := login(t, a, as, sid)
+    if err != nil || !linked.Linked || linked.Session.ID != "" {
+        t.Fatalf("link: %#v err=%v", linked, err)
+    }
+    if linked.Connection.UserID != first.Connection.UserID {
+        t.Fatalf("linked account belongs to another user: %#v", linked.Connection)
+    }
+    _, conns, err := a.User(ctx, sid)
+    if err != nil || len(conns) != 2 {
+        t.Fatalf("expected two connections, got %d err=%v", len(conns), err)
+    }
+
+    // Signing in with the linked account reaches the same user.
+    second, err := login(t, a, as, "")
+    if err != nil || second.Session.UserID != first.Session.UserID {
+        t.Fatalf("sign-in with linked account: %#v err=%v", second.Session, err)
+    }
+
+    // An account owned by someone else cannot be linked.
+    mc.token, mc.profile = Token{AccessToken: "b1", OpenID: "ob"}, Profile{Subject: "ob"}
+    other, err := login(t, a, as, "")
+    if err != nil {
+        t.Fatalf("other login: %v", err)
+    }
+    mc.token, mc.profile = Token{AccessToken: "a2", OpenID: "o2"}, Profile{Subject: "o2"}
+    if _, err := login(t, a, as, other.Session.ID); !errors.Is(err, ErrAlreadyLinked) {
+        t.Fatalf("expected ErrAlreadyLinked, got %v", err)
+    }
+    if _, err := a.Connection(ctx, other.Session.ID, linked.Connection.ID); !errors.Is(err, ErrNotFound) {
+        t.Fatalf("foreign connection must be hidden, got %v", err)
+    }
+
+    ss := &memScheduleStore{posts: map[string]ScheduledPost{
+        "queued":  {ID: "queued", OpenID: "o2", State: ScheduleScheduled},
+        "running": {ID: "running", OpenID: "o2", State: ScheduleRunning},
+        "kept":    {ID: "kept", OpenID: "o1", State: ScheduleScheduled},
+    }}
+    a.SetScheduleStore(ss)
+    if err := a.Unlink(ctx, sid, linked.Connection.ID, false); err != nil {
+        t.Fatalf("unlink: %v", err)
+    }
+    if _, ok := ms.tokens["o2"]; ok {
+        t.Fatalf("token of the unlinked account must be deleted")
+    }
+    for id, want := range map[string]string{"queued": ScheduleCanceled, "running": ScheduleRunning, "kept": ScheduleScheduled} {
+        if got := ss.posts[id].State; got != want {
+            t.Fatalf("post %s: expected %s after unlink, got %s", id, want, got)
+        }
+    }
+    if err := a.Unlink(ctx, sid, first.Connection.ID, false); !errors.Is(err, ErrLastConnection) {
+        t.Fatalf("expected ErrLastConnection, got %v", err)
+    }
+}
+
+func TestAuth_IncrementalScopes(t *testing.T) {
+    mc := &mockClient{}
+    ms := &mockStore{tokens: map[string]Token{}}
+    a, as := newTestAuth(mc, ms)
+    ctx := context.Background()
+
+    mc.token, mc.profile = Token{AccessToken: "a1", OpenID: "o1", Scope: "user.info.basic"}, Profile{Subject: "o1"}
+    first, err := login(t, a, as, "")
+    if err != nil {
+        t.Fatalf("login: %v", err)
+    }
+
+    if _, err := a.BeginLink(ctx, first.Session.ID, ProviderTikTok, BeginOptions{Scopes: []string{"video.list", "video.publish"}}); err != nil {
+        t.Fatalf("begin: %v", err)
+    }
+    if got := mc.authReqs[len(mc.authReqs)-1].Scope; got != "user.info.basic,video.list,video.publish" {
+        t.Fatalf("unexpected requested scope: %s", got)
+    }
+    // The user unticked video.publish.
+    mc.token = Token{AccessToken: "a2", OpenID: "o1", Scope: "video.list"}
+    res, err := a.Complete(ctx, ProviderTikTok, onlyState(t, as).State, "code")
+    if err != nil {
+        t.Fatalf("complete: %v", err)
+    }
+    if res.Connection.ID != first.Connection.ID || !reflect.DeepEqual(res.Connection.Scopes, []string{"user.info.basic", "video.list"}) {
+        t.Fatalf("unexpected connection: %#v", res.Connection)
+    }
+    if !reflect.DeepEqual(res.DeniedScopes, []string{"video.publish"}) {
+        t.Fatalf("unexpected denied scopes: %v", res.DeniedScopes)
+    }
+
+    if _, err := a.Begin(ctx, ProviderTikTok, BeginOptions{Scopes: []string{"bad\"scope"}}); !errors.Is(err, ErrInvalidScope) {
+        t.Fatalf("expected ErrInvalidScope, got %v", err)
+    }
+}
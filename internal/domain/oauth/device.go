@@ -0,0 +1,221 @@
+package oauth
+
+import (
+    "context"
+    "crypto/rand"
+    "errors"
+    "strings"
+    "time"
+)
+
+const (
+    // deviceTTL is how long a device has to get its user code approved.
+    deviceTTL = 10 * time.Minute
+    // deviceInterval is the minimum polling interval; slow_down adds
+    // another one (RFC 8628 3.5).
+    deviceInterval = 5 * time.Second
+    // userCodeAlphabet has no vowels or look-alike characters.
+    userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+    userCodeLen      = 8
+)
+
+// Device grant errors, named after the RFC 8628 token endpoint errors.
+var (
+    ErrAuthorizationPending = errors.New("authorization pending")
+    ErrSlowDown             = errors.New("slow down")
+    ErrAccessDenied         = errors.New("access denied")
+    ErrExpiredToken         = errors.New("device code expired")
+    // ErrInvalidUserCode is returned for unknown, used or expired user codes.
+    ErrInvalidUserCode = errors.New("invalid user code")
+)
+
+// DeviceStatus is the state of a device grant.
+type DeviceStatus string
+
+const (
+    DevicePending  DeviceStatus = "pending"
+    DeviceApproved DeviceStatus = "approved"
+    DeviceDenied   DeviceStatus = "denied"
+)
+
+// DeviceGrant is a pending device authorization (RFC 8628). The device
+// polls with DeviceCode while the user enters UserCode in a browser.
+type DeviceGrant struct {
+    DeviceCode   string        `json:"device_code"`
+    UserCode     string        `json:"user_code"`
+    ClientID     string        `json:"client_id"`
+    Scopes       []string      `json:"scopes,omitempty"`
+    Status       DeviceStatus  `json:"status"`
+    SessionID    string        `json:"session_id,omitempty"`
+    Interval     time.Duration `json:"interval"`
+    LastPolledAt time.Time     `json:"last_polled_at"`
+    ExpiresAt    time.Time     `json:"expires_at"`
+}
+
+// DisplayUserCode formats the user code as XXXX-XXXX.
+func (g DeviceGrant) DisplayUserCode() string {
+    return g.UserCode[:userCodeLen/2] + "-" + g.UserCode[userCodeLen/2:]
+}
+
+// DeviceStore keeps device grants. Every change to a saved grant is a
+// single conditional step, so a poll never undoes an approval and an
+// approved grant is handed out once.
+type DeviceStore interface {
+    SaveDeviceGrant(ctx context.Context, g DeviceGrant) error
+    DeviceGrantByUserCode(ctx context.Context, userCode string) (DeviceGrant, error)
+    // ResolveDeviceGrant moves a pending grant that has not expired at now
+    // to status, recording sessionID for approvals. It returns
+    // ErrInvalidUserCode when the grant was already resolved or expired.
+    ResolveDeviceGrant(ctx context.Context, deviceCode string, status DeviceStatus, sessionID string, now time.Time) error
+    // PollDeviceGrant records a poll of clientID's grant and returns it.
+    // For a pending grant polled sooner than its interval after the
+    // previous poll, the interval grows by backoff and slowDown is set.
+    // Grants of other clients are ErrNotFound.
+    PollDeviceGrant(ctx context.Context, clientID, deviceCode string, now time.Time, backoff time.Duration) (g DeviceGrant, slowDown bool, err error)
+    // TakeApprovedDeviceGrant returns and deletes an approved grant; any
+    // other grant is ErrNotFound.
+    TakeApprovedDeviceGrant(ctx context.Context, deviceCode string) (DeviceGrant, error)
+}
+
+// SetDeviceStore enables the device authorization grant for app clients
+// registered with device_flow.
+func (a *Auth) SetDeviceStore(s DeviceStore) {
+    a.devices = s
+}
+
+// StartDevice issues a device and user code for a device client.
+func (a *Auth) StartDevice(ctx context.Context, clientID string, scopes []string) (DeviceGrant, error) {
+    client, ok := a.apps[clientID]
+    if !ok || !client.DeviceFlow || a.devices == nil {
+        return DeviceGrant{}, ErrInvalidClient
+    }
+    if err := validateScopes(scopes); err != nil {
+        return DeviceGrant{}, err
+    }
+    g := DeviceGrant{
+        DeviceCode: newToken(32),
+        UserCode:   newUserCode(),
+        ClientID:   clientID,
+        Scopes:     scopes,
+        Status:     DevicePending,
+        Interval:   deviceInterval,
+        ExpiresAt:  a.now().Add(deviceTTL),
+    }
+    if err := a.devices.SaveDeviceGrant(ctx, g); err != nil {
+        return DeviceGrant{}, err
+    }
+    return g, nil
+}
+
+// DeviceByUserCode returns the pending grant a user typed the code of.
+// Case, spaces and dashes are ignored.
+func (a *Auth) DeviceByUserCode(ctx context.Context, userCode string) (DeviceGrant, error) {
+    if a.devices == nil {
+        return DeviceGrant{}, ErrInvalidUserCode
+    }
+    g, err := a.devices.DeviceGrantByUserCode(ctx, NormalizeUserCode(userCode))
+    if errors.Is(err, ErrNotFound) {
+        return DeviceGrant{}, ErrInvalidUserCode
+    }
+    if err != nil {
+        return DeviceGrant{}, err
+    }
+    if g.Status != DevicePending || a.now().After(g.ExpiresAt) {
+        return DeviceGrant{}, ErrInvalidUserCode
+    }
+    return g, nil
+}
+
+// BeginDevice starts the TikTok login that approves a device. The browser
+// running it is not signed in; the session goes to the polling device.
+func (a *Auth) BeginDevice(ctx context.Context, userCode string) (string, error) {
+    g, err := a.DeviceByUserCode(ctx, userCode)
+    if err != nil {
+        return "", err
+    }
+    return a.begin(ctx, ProviderTikTok, "", BeginOptions{Scopes: g.Scopes, deviceCode: g.DeviceCode})
+}
+
+// approveDevice hands session to the device that is waiting for it.
+func (a *Auth) approveDevice(ctx context.Context, deviceCode string, s Session) error {
+    err := a.devices.ResolveDeviceGrant(ctx, deviceCode, DeviceApproved, s.ID, a.now())
+    if errors.Is(err, ErrNotFound) {
+        return ErrInvalidUserCode
+    }
+    return err
+}
+
+// denyDevice records that the user refused the login for a device. A
+// grant that was already resolved keeps its status.
+func (a *Auth) denyDevice(ctx context.Context, deviceCode string) error {
+    err := a.devices.ResolveDeviceGrant(ctx, deviceCode, DeviceDenied, "", a.now())
+    if errors.Is(err, ErrInvalidUserCode) {
+        return nil
+    }
+    return err
+}
+
+// PollDevice is the device's token request. It returns the session once
+// the user approved, and the RFC 8628 errors until then. A session is
+// handed out only once.
+func (a *Auth) PollDevice(ctx context.Context, clientID, deviceCode string) (Session, error) {
+    if _, ok := a.apps[clientID]; !ok || a.devices == nil {
+        return Session{}, ErrInvalidClient
+    }
+    now := a.now()
+    g, slowDown, err := a.devices.PollDeviceGrant(ctx, clientID, deviceCode, now, deviceInterval)
+    if errors.Is(err, ErrNotFound) {
+        return Session{}, ErrInvalidGrant
+    }
+    if err != nil {
+        return Session{}, err
+    }
+    if now.After(g.ExpiresAt) {
+        return Session{}, ErrExpiredToken
+    }
+    switch g.Status {
+    case DeviceDenied:
+        return Session{}, ErrAccessDenied
+    case DeviceApproved:
+        // Concurrent polls both see the approval; only one takes it.
+        g, err := a.devices.TakeApprovedDeviceGrant(ctx, deviceCode)
+        if errors.Is(err, ErrNotFound) {
+            return Session{}, ErrInvalidGrant
+        }
+        if err != nil {
+            return Session{}, err
+        }
+        s, err := a.Session(ctx, g.SessionID)
+        if errors.Is(err, ErrNotSignedIn) {
+            return Session{}, ErrExpiredToken
+        }
+        return s, err
+    }
+    if slowDown {
+        return Session{}, ErrSlowDown
+    }
+    return Session{}, ErrAuthorizationPending
+}
+
+// NormalizeUserCode upper-cases a typed user code and drops separators.
+func NormalizeUserCode(s string) string {
+    return strings.Map(func(r rune) rune {
+        switch {
+        case r == '-' || r == ' ':
+            return -1
+        case r >= 'a' && r <= 'z':
+            return r - 'a' + 'A'
+        }
+        return r
+    }, s)
+}
+
+func newUserCode() string {
+    b := make([]byte, userCodeLen)
+    _, _ = rand.Read(b)
+    for i := range b {
+        // 256 % 20 != 0, but the bias is negligible for a short-lived code.
+        b[i] = userCodeAlphabet[int(b[i])%len(userCodeAlphabet)]
+    }
+    return string(b)
+}
@@ -0,0 +1,155 @@
+package oauth
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+)
+
+type memDeviceStore map[string]DeviceGrant
+
+func (m memDeviceStore) SaveDeviceGrant(ctx context.Context, g DeviceGrant) error {
+    m[g.DeviceCode] = g
+    return nil
+}
+
+func (m memDeviceStore) DeviceGrantByUserCode(ctx context.Context, userCode string) (DeviceGrant, error) {
+    for _, g := range m {
+        if g.UserCode == userCode {
+            return g, nil
+        }
+    }
+    return DeviceGrant{}, ErrNotFound
+}
+
+func (m memDeviceStore) ResolveDeviceGrant(ctx context.Context, deviceCode string, status DeviceStatus, sessionID string, now time.Time) error {
+    g, ok := m[deviceCode]
+    if !ok {
+        return ErrNotFound
+    }
+    if g.Status != DevicePending || now.After(g.ExpiresAt) {
+        return ErrInvalidUserCode
+    }
+    g.Status, g.SessionID = status, sessionID
+    m[deviceCode] = g
+    return nil
+}
+
+func (m memDeviceStore) PollDeviceGrant(ctx context.Context, clientID, deviceCode string, now time.Time, backoff time.Duration) (DeviceGrant, bool, error) {
+    g, ok := m[deviceCode]
+    if !ok || g.ClientID != clientID {
+        return DeviceGrant{}, false, ErrNotFound
+    }
+    if g.Status != DevicePending {
+        return g, false, nil
+    }
+    slowDown := now.Sub(g.LastPolledAt) < g.Interval
+    if slowDown {
+        g.Interval += backoff
+    }
+    g.LastPolledAt = now
+    m[deviceCode] = g
+    return g, slowDown, nil
+}
+
+func (m memDeviceStore) TakeApprovedDeviceGrant(ctx context.Context, deviceCode string) (DeviceGrant, error) {
+    g, ok := m[deviceCode]
+    if !ok || g.Status != DeviceApproved {
+        return DeviceGrant{}, ErrNotFound
+    }
+    delete(m, deviceCode)
+    return g, nil
+}
+
+func newDeviceAuth(t *testing.T) (*Auth, *memAuthStore, *time.Time) {
+    t.Helper()
+    mc := &mockClient{token: Token{AccessToken: "a", OpenID: "o"}, profile: Profile{Subject: "o"}}
+    a, as := newTestAuth(mc, &mockStore{tokens: map[string]Token{}})
+    a.SetAppClients([]AppClient{{ID: "cli", DeviceFlow: true}, {ID: "ios", RedirectURIs: []string{"myapp://cb"}}}, memCodeStore{})
+    a.SetDeviceStore(memDeviceStore{})
+    now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+    a.now = func() time.Time { return now }
+    return a, as, &now
+}
+
+func TestAuth_DeviceFlow(t *testing.T) {
+    a, as, now := newDeviceAuth(t)
+    ctx := context.Background()
+
+    if _, err := a.StartDevice(ctx, "ios", nil); !errors.Is(err, ErrInvalidClient) {
+        t.Fatalf("clients without device_flow must be refused, got %v", err)
+    }
+    g, err := a.StartDevice(ctx, "cli", []string{ScopeVideoPublish})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(g.DisplayUserCode()) != 9 {
+        t.Fatalf("unexpected user code %q", g.DisplayUserCode())
+    }
+
+    if _, err := a.PollDevice(ctx, "cli", g.DeviceCode); !errors.Is(err, ErrAuthorizationPending) {
+        t.Fatalf("expected ErrAuthorizationPending, got %v", err)
+    }
+    *now = now.Add(time.Second)
+    if _, err := a.PollDevice(ctx, "cli", g.DeviceCode); !errors.Is(err, ErrSlowDown) {
+        t.Fatalf("expected ErrSlowDown, got %v", err)
+    }
+    if _, err := a.PollDevice(ctx, "ios", g.DeviceCode); !errors.Is(err, ErrInvalidGrant) {
+        t.Fatalf("another client must not poll the grant, got %v", err)
+    }
+
+    if _, err := a.BeginDevice(ctx, "nope-nope"); !errors.Is(err, ErrInvalidUserCode) {
+        t.Fatalf("expected ErrInvalidUserCode, got %v", err)
+    }
+    // Users may type the code in lower case and without the dash.
+    if _, err := a.BeginDevice(ctx, strings.ToLower(g.UserCode[:4])+" "+g.UserCode[4:]); err != nil {
+        t.Fatal(err)
+    }
+    st := onlyState(t, as)
+    if st.Mode != LoginModeDevice || len(st.Scopes) != 2 {
+        t.Fatalf("unexpected state %#v", st)
+    }
+    res, err := a.Complete(ctx, ProviderTikTok, st.State, "code")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := a.BeginDevice(ctx, g.UserCode); !errors.Is(err, ErrInvalidUserCode) {
+        t.Fatalf("an approved code must not be reusable, got %v", err)
+    }
+
+    *now = now.Add(time.Minute)
+    s, err := a.PollDevice(ctx, "cli", g.DeviceCode)
+    if err != nil || s.ID != res.Session.ID {
+        t.Fatalf("poll: %#v err=%v", s, err)
+    }
+    if _, err := a.PollDevice(ctx, "cli", g.DeviceCode); !errors.Is(err, ErrInvalidGrant) {
+        t.Fatalf("the session must be handed out once, got %v", err)
+    }
+}
+
+func TestAuth_DeviceDeniedAndExpired(t *testing.T) {
+    a, as, now := newDeviceAuth(t)
+    ctx := context.Background()
+
+    g, _ := a.StartDevice(ctx, "cli", nil)
+    if _, err := a.BeginDevice(ctx, g.UserCode); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := a.Abort(ctx, ProviderTikTok, onlyState(t, as).State); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := a.PollDevice(ctx, "cli", g.DeviceCode); !errors.Is(err, ErrAccessDenied) {
+        t.Fatalf("expected ErrAccessDenied, got %v", err)
+    }
+
+    g, _ = a.StartDevice(ctx, "cli", nil)
+    *now = now.Add(deviceTTL + time.Second)
+    if _, err := a.PollDevice(ctx, "cli", g.DeviceCode); !errors.Is(err, ErrExpiredToken) {
+        t.Fatalf("expected ErrExpiredToken, got %v", err)
+    }
+    if _, err := a.BeginDevice(ctx, g.UserCode); !errors.Is(err, ErrInvalidUserCode) {
+        t.Fatalf("expired codes must be refused, got %v", err)
+    }
+}
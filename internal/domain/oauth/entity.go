@@ -1,5 +1,7 @@
 package oauth
 
+import "time"
+
 type Token struct {
     AccessToken  string
     RefreshToken string
@@ -7,5 +9,254 @@ type Token struct {
     TokenType    string
     Scope        string
     OpenID       string
+    // ExpiresAt is derived from ExpiresIn when the token is issued.
+    ExpiresAt    time.Time
+    // Provider that issued the token; OpenID holds its subject.
+    Provider     string
+}
+
+// Expired reports whether the access token expires within leeway.
+// Tokens without a known expiry are treated as valid.
+func (t Token) Expired(now time.Time, leeway time.Duration) bool {
+    return !t.ExpiresAt.IsZero() && now.Add(leeway).After(t.ExpiresAt)
+}
+
+// Source values accepted by the Content Posting API.
+const (
+    SourcePullFromURL = "PULL_FROM_URL"
+    SourceFileUpload  = "FILE_UPLOAD"
+)
+
+// Media types of a post.
+const (
+    MediaTypeVideo = "VIDEO"
+    MediaTypePhoto = "PHOTO"
+)
+
+// Publish statuses reported by /v2/post/publish/status/fetch/.
+const (
+    StatusProcessingUpload   = "PROCESSING_UPLOAD"
+    StatusProcessingDownload = "PROCESSING_DOWNLOAD"
+    StatusPublishComplete    = "PUBLISH_COMPLETE"
+    StatusFailed             = "FAILED"
+)
+
+// CreatorInfo is what TikTok allows the creator to post right now.
+type CreatorInfo struct {
+    AvatarURL               string   `json:"creator_avatar_url"`
+    Username                string   `json:"creator_username"`
+    Nickname                string   `json:"creator_nickname"`
+    PrivacyLevelOptions     []string `json:"privacy_level_options"`
+    CommentDisabled         bool     `json:"comment_disabled"`
+    DuetDisabled            bool     `json:"duet_disabled"`
+    StitchDisabled          bool     `json:"stitch_disabled"`
+    MaxVideoPostDurationSec int      `json:"max_video_post_duration_sec"`
+}
+
+// PostInfo carries the user-facing settings of a post.
+type PostInfo struct {
+    Title                 string `json:"title,omitempty"`
+    PrivacyLevel          string `json:"privacy_level"`
+    DisableDuet           bool   `json:"disable_duet"`
+    DisableComment        bool   `json:"disable_comment"`
+    DisableStitch         bool   `json:"disable_stitch"`
+    VideoCoverTimestampMs int64  `json:"video_cover_timestamp_ms,omitempty"`
+}
+
+// VideoSource describes where TikTok gets the video bytes from.
+type VideoSource struct {
+    Source          string `json:"source"`
+    VideoURL        string `json:"video_url,omitempty"`
+    VideoSize       int64  `json:"video_size,omitempty"`
+    ChunkSize       int64  `json:"chunk_size,omitempty"`
+    TotalChunkCount int    `json:"total_chunk_count,omitempty"`
+}
+
+// PostInit is the result of initializing a post.
+// UploadURL is only set for FILE_UPLOAD, as is the chunking declared at
+// init, which the upload must follow.
+type PostInit struct {
+    PublishID       string `json:"publish_id"`
+    UploadURL       string `json:"upload_url,omitempty"`
+    ChunkSize       int64  `json:"-"`
+    TotalChunkCount int    `json:"-"`
+}
+
+// PublishStatus is a snapshot of a post's processing state.
+type PublishStatus struct {
+    PublishID       string   `json:"publish_id"`
+    Status          string   `json:"status"`
+    FailReason      string   `json:"fail_reason,omitempty"`
+    PostIDs         []string `json:"post_ids,omitempty"`
+    UploadedBytes   int64    `json:"uploaded_bytes,omitempty"`
+    DownloadedBytes int64    `json:"downloaded_bytes,omitempty"`
+}
+
+// Settled reports whether the status will not change anymore.
+func (s PublishStatus) Settled() bool {
+    return s.Status == StatusPublishComplete || s.Status == StatusFailed
+}
+
+// PhotoPost is a photo (carousel) post pulled from image URLs.
+// Duet and stitch settings are validated against creator_info like for
+// videos but TikTok ignores them for photos.
+type PhotoPost struct {
+    PostInfo
+    Description     string   `json:"description,omitempty"`
+    AutoAddMusic    bool     `json:"auto_add_music"`
+    PhotoImages     []string `json:"photo_images"`
+    PhotoCoverIndex int      `json:"photo_cover_index"`
+}
+
+// StatusTransition is one observed change of a post's status.
+type StatusTransition struct {
+    Status string    `json:"status"`
+    At     time.Time `json:"at"`
 }
 
+// PublishRecord is a post tracked until it settles and its completion
+// has been delivered to the configured callbacks.
+type PublishRecord struct {
+    PublishID    string             `json:"publish_id"`
+    MediaType    string             `json:"media_type"`
+    OpenID       string             `json:"open_id,omitempty"`
+    AccessToken  string             `json:"access_token"`
+    Status       string             `json:"status"`
+    FailReason   string             `json:"fail_reason,omitempty"`
+    PostIDs      []string           `json:"post_ids,omitempty"`
+    Transitions  []StatusTransition `json:"transitions"`
+    PollErrors   int                `json:"poll_errors"`
+    Notified     bool               `json:"notified"`
+    NotifyTries  int                `json:"notify_tries"`
+    // DeliveredTo lists the receivers that accepted the event, so retries
+    // skip them; NotifyFailed is set once delivery is given up.
+    DeliveredTo  []string           `json:"delivered_to,omitempty"`
+    NotifyFailed bool               `json:"notify_failed,omitempty"`
+    CreatedAt    time.Time          `json:"created_at"`
+    UpdatedAt    time.Time          `json:"updated_at"`
+}
+
+// Settled reports whether the record reached a terminal status.
+func (r PublishRecord) Settled() bool {
+    return PublishStatus{Status: r.Status}.Settled()
+}
+
+// Pending reports whether the tracker still has work on the record: it
+// has not settled, or its event is neither delivered nor given up.
+func (r PublishRecord) Pending() bool {
+    return !r.Settled() || !r.Notified && !r.NotifyFailed
+}
+
+// PublishEvent is delivered to outbound callbacks once a post settles.
+type PublishEvent struct {
+    Event       string             `json:"event"`
+    PublishID   string             `json:"publish_id"`
+    MediaType   string             `json:"media_type"`
+    Status      string             `json:"status"`
+    FailReason  string             `json:"fail_reason,omitempty"`
+    PostIDs     []string           `json:"post_ids,omitempty"`
+    Transitions []StatusTransition `json:"transitions"`
+    OccurredAt  time.Time          `json:"occurred_at"`
+}
+
+// States of a scheduled post.
+const (
+    ScheduleScheduled = "scheduled"
+    ScheduleRunning   = "running"
+    SchedulePublished = "published"
+    ScheduleFailed    = "failed"
+    ScheduleCanceled  = "canceled"
+)
+
+// ScheduledVideo is a PULL_FROM_URL video post to publish later.
+type ScheduledVideo struct {
+    PostInfo
+    VideoURL string `json:"video_url"`
+}
+
+// ScheduledPost is a post queued for publication at ScheduledAt on behalf
+// of the owner identified by OpenID. Exactly one of Video and Photo is set.
+type ScheduledPost struct {
+    ID             string          `json:"id"`
+    IdempotencyKey string          `json:"idempotency_key"`
+    OpenID         string          `json:"open_id"`
+    MediaType      string          `json:"media_type"`
+    Video          *ScheduledVideo `json:"video,omitempty"`
+    Photo          *PhotoPost      `json:"photo,omitempty"`
+    ScheduledAt    time.Time       `json:"scheduled_at"`
+    State          string          `json:"state"`
+    Attempts       int             `json:"attempts"`
+    NextAttemptAt  time.Time       `json:"next_attempt_at,omitempty"`
+    LeaseUntil     time.Time       `json:"lease_until,omitempty"`
+    PublishID      string          `json:"publish_id,omitempty"`
+    LastError      string          `json:"last_error,omitempty"`
+    CreatedAt      time.Time       `json:"created_at"`
+    UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// Due reports whether the post should be (re)claimed by the scheduler at now.
+func (p ScheduledPost) Due(now time.Time) bool {
+    switch p.State {
+    case ScheduleScheduled:
+        return !now.Before(p.ScheduledAt) && !now.Before(p.NextAttemptAt)
+    case ScheduleRunning:
+        return now.After(p.LeaseUntil)
+    default:
+        return false
+    }
+}
+
+// AuthState is the server-side record of a pending authorization request,
+// looked up by the state parameter when the provider redirects back.
+type AuthState struct {
+    State        string      `json:"state"`
+    Provider     string      `json:"provider"`
+    CodeVerifier string      `json:"code_verifier,omitempty"`
+    // LinkUserID is set when a signed-in user links another account; the
+    // callback then attaches the account instead of signing in.
+    LinkUserID   string      `json:"link_user_id,omitempty"`
+    // Scopes is everything requested, including incremental scopes.
+    Scopes       []string    `json:"scopes,omitempty"`
+    ReturnTo     string      `json:"return_to,omitempty"`
+    Mode         LoginMode   `json:"mode,omitempty"`
+    Nonce        string      `json:"nonce,omitempty"`
+    App          *AppRequest `json:"app,omitempty"`
+    DeviceCode   string      `json:"device_code,omitempty"`
+    QRLoginID    string      `json:"qr_login_id,omitempty"`
+    ExpiresAt    time.Time   `json:"expires_at"`
+}
+
+// Session is a signed-in browser, identified by an opaque cookie value.
+// Provider, Subject and Profile describe the account used to sign in.
+type Session struct {
+    ID        string    `json:"id"`
+    UserID    string    `json:"user_id"`
+    Provider  string    `json:"provider"`
+    Subject   string    `json:"subject"`
+    Profile   Profile   `json:"profile"`
+    CreatedAt time.Time `json:"created_at"`
+    ExpiresAt time.Time `json:"expires_at"`
+}
+
+// User is an internal account. It owns one or more connections and signs
+// in through any of them.
+type User struct {
+    ID        string    `json:"id"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// Connection links a provider account (for TikTok, an open_id) to a User.
+// The account's token is kept in the token Store under Provider and
+// Subject.
+type Connection struct {
+    ID          string    `json:"id"`
+    UserID      string    `json:"user_id"`
+    Provider    string    `json:"provider"`
+    Subject     string    `json:"subject"`
+    DisplayName string    `json:"display_name"`
+    AvatarURL   string    `json:"avatar_url,omitempty"`
+    // Scopes accumulates every scope granted to this connection.
+    Scopes      []string  `json:"scopes,omitempty"`
+    CreatedAt   time.Time `json:"created_at"`
+    UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,253 @@
+package oauth
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io/fs"
+    "path"
+    "sort"
+    "strings"
+    "time"
+)
+
+// Kinds of legal documents.
+const (
+    LegalTerms   = "terms"
+    LegalPrivacy = "privacy"
+)
+
+// ErrLegalVersionMismatch is returned when accepting a version that is not
+// the one currently in effect, e.g. because a newer one was published
+// while the acceptance page was open.
+var ErrLegalVersionMismatch = errors.New("not the current version of the document")
+
+// legalZone is the time zone of the effective dates in document names.
+var legalZone = time.FixedZone("JST", 9*60*60)
+
+// LegalDocument is one published version of a legal document. The version
+// is the effective date (2006-01-02); the first line of the text is the
+// title.
+type LegalDocument struct {
+    Kind        string    `json:"kind"`
+    Version     string    `json:"version"`
+    EffectiveAt time.Time `json:"effective_at"`
+    Title       string    `json:"title"`
+    Text        string    `json:"-"`
+}
+
+// Paragraphs splits the text after the title at blank lines.
+func (d LegalDocument) Paragraphs() []string {
+    _, body, _ := strings.Cut(d.Text, "\n")
+    var out []string
+    for _, p := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n\n") {
+        if p = strings.TrimSpace(p); p != "" {
+            out = append(out, p)
+        }
+    }
+    return out
+}
+
+// LegalLibrary holds every version of every legal document.
+type LegalLibrary struct {
+    docs map[string][]LegalDocument // by kind, oldest first
+}
+
+// LoadLegalDocuments reads dir/<kind>/<version>.txt from fsys. Versions
+// may be published ahead of their effective date.
+func LoadLegalDocuments(fsys fs.FS, dir string) (*LegalLibrary, error) {
+    names, err := fs.Glob(fsys, path.Join(dir, "*", "*.txt"))
+    if err != nil {
+        return nil, err
+    }
+    l := &LegalLibrary{docs: map[string][]LegalDocument{}}
+    for _, name := range names {
+        version := strings.TrimSuffix(path.Base(name), ".txt")
+        at, err := time.ParseInLocation("2006-01-02", version, legalZone)
+        if err != nil {
+            return nil, fmt.Errorf("legal document %s: the name must be its effective date: %w", name, err)
+        }
+        b, err := fs.ReadFile(fsys, name)
+        if err != nil {
+            return nil, err
+        }
+        text := string(b)
+        title, _, _ := strings.Cut(text, "\n")
+        kind := path.Base(path.Dir(name))
+        l.docs[kind] = append(l.docs[kind], LegalDocument{
+            Kind:        kind,
+            Version:     version,
+            EffectiveAt: at,
+            Title:       strings.TrimSpace(title),
+            Text:        text,
+        })
+    }
+    for _, docs := range l.docs {
+        sort.Slice(docs, func(i, j int) bool { return docs[i].EffectiveAt.Before(docs[j].EffectiveAt) })
+    }
+    return l, nil
+}
+
+// Kinds lists the document kinds in alphabetical order.
+func (l *LegalLibrary) Kinds() []string {
+    kinds := make([]string, 0, len(l.docs))
+    for k := range l.docs {
+        kinds = append(kinds, k)
+    }
+    sort.Strings(kinds)
+    return kinds
+}
+
+// Current returns the latest version of kind in effect at now.
+func (l *LegalLibrary) Current(kind string, now time.Time) (LegalDocument, error) {
+    docs := l.docs[kind]
+    for i := len(docs) - 1; i >= 0; i-- {
+        if !now.Before(docs[i].EffectiveAt) {
+            return docs[i], nil
+        }
+    }
+    return LegalDocument{}, ErrNotFound
+}
+
+// Version returns a specific version of kind, including future ones.
+func (l *LegalLibrary) Version(kind, version string) (LegalDocument, error) {
+    for _, d := range l.docs[kind] {
+        if d.Version == version {
+            return d, nil
+        }
+    }
+    return LegalDocument{}, ErrNotFound
+}
+
+// Versions lists all versions of kind, oldest first.
+func (l *LegalLibrary) Versions(kind string) []LegalDocument {
+    return l.docs[kind]
+}
+
+// LegalAcceptance records that a user agreed to a version of a document.
+// Implicit acceptances come from signing in for the first time, which the
+// login page states counts as agreement.
+type LegalAcceptance struct {
+    UserID     string    `json:"user_id"`
+    Kind       string    `json:"kind"`
+    Version    string    `json:"version"`
+    AcceptedAt time.Time `json:"accepted_at"`
+    Implicit   bool      `json:"implicit,omitempty"`
+}
+
+// LegalAcceptanceStore keeps every acceptance of every user.
+type LegalAcceptanceStore interface {
+    SaveLegalAcceptance(ctx context.Context, a LegalAcceptance) error
+    // LegalAcceptances returns the acceptances of a user, oldest first.
+    LegalAcceptances(ctx context.Context, userID string) ([]LegalAcceptance, error)
+}
+
+// SetLegal enables acceptance tracking of the documents in lib; without
+// it no login asks for acceptance.
+func (a *Auth) SetLegal(lib *LegalLibrary, acceptances LegalAcceptanceStore) {
+    a.legal, a.acceptances = lib, acceptances
+}
+
+// CurrentLegal returns the version in effect of every document kind.
+func (a *Auth) CurrentLegal() []LegalDocument {
+    if a.legal == nil {
+        return nil
+    }
+    var out []LegalDocument
+    now := a.now()
+    for _, kind := range a.legal.Kinds() {
+        if d, err := a.legal.Current(kind, now); err == nil {
+            out = append(out, d)
+        }
+    }
+    return out
+}
+
+// LegalStatus returns the acceptances of the signed-in user and the
+// current documents they have not accepted yet.
+func (a *Auth) LegalStatus(ctx context.Context, sessionID string) ([]LegalAcceptance, []LegalDocument, error) {
+    s, err := a.Session(ctx, sessionID)
+    if err != nil {
+        return nil, nil, err
+    }
+    if a.legal == nil {
+        return []LegalAcceptance{}, nil, nil
+    }
+    accepted, err := a.acceptances.LegalAcceptances(ctx, s.UserID)
+    if err != nil {
+        return nil, nil, err
+    }
+    return accepted, pendingLegal(a.CurrentLegal(), accepted), nil
+}
+
+// AcceptLegal records the signed-in user's acceptance of versions (kind
+// to version), which must be the versions currently in effect.
+func (a *Auth) AcceptLegal(ctx context.Context, sessionID string, versions map[string]string) error {
+    s, err := a.Session(ctx, sessionID)
+    if err != nil {
+        return err
+    }
+    if a.legal == nil {
+        return nil
+    }
+    now := a.now()
+    for kind, version := range versions {
+        cur, err := a.legal.Current(kind, now)
+        if err != nil || cur.Version != version {
+            return fmt.Errorf("%w: %s %s", ErrLegalVersionMismatch, kind, version)
+        }
+    }
+    for kind, version := range versions {
+        if err := a.acceptances.SaveLegalAcceptance(ctx, LegalAcceptance{UserID: s.UserID, Kind: kind, Version: version, AcceptedAt: now}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// legalOnLogin records implicit acceptance of the documents a user has
+// never accepted and returns those that changed since they last did.
+func (a *Auth) legalOnLogin(ctx context.Context, userID string) ([]LegalDocument, error) {
+    if a.legal == nil {
+        return nil, nil
+    }
+    accepted, err := a.acceptances.LegalAcceptances(ctx, userID)
+    if err != nil {
+        return nil, err
+    }
+    seen := map[string]bool{}
+    for _, acc := range accepted {
+        seen[acc.Kind] = true
+    }
+    current := a.CurrentLegal()
+    for _, d := range current {
+        if seen[d.Kind] {
+            continue
+        }
+        acc := LegalAcceptance{UserID: userID, Kind: d.Kind, Version: d.Version, AcceptedAt: a.now(), Implicit: true}
+        if err := a.acceptances.SaveLegalAcceptance(ctx, acc); err != nil {
+            return nil, err
+        }
+        accepted = append(accepted, acc)
+    }
+    return pendingLegal(current, accepted), nil
+}
+
+// pendingLegal returns the documents of current without an acceptance of
+// that exact version.
+func pendingLegal(current []LegalDocument, accepted []LegalAcceptance) []LegalDocument {
+    var out []LegalDocument
+    for _, d := range current {
+        ok := false
+        for _, acc := range accepted {
+            if acc.Kind == d.Kind && acc.Version == d.Version {
+                ok = true
+                break
+            }
+        }
+        if !ok {
+            out = append(out, d)
+        }
+    }
+    return out
+}
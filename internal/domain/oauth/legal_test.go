@@ -0,0 +1,111 @@
+package oauth
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "testing/fstest"
+    "time"
+)
+
+type memAcceptanceStore map[string][]LegalAcceptance
+
+func (m memAcceptanceStore) SaveLegalAcceptance(ctx context.Context, a LegalAcceptance) error {
+    m[a.UserID] = append(m[a.UserID], a)
+    return nil
+}
+
+func (m memAcceptanceStore) LegalAcceptances(ctx context.Context, userID string) ([]LegalAcceptance, error) {
+    return m[userID], nil
+}
+
+func TestLoadLegalDocuments(t *testing.T) {
+    lib, err := LoadLegalDocuments(fstest.MapFS{
+        "legal/terms/2025-10-01.txt":   {Data: []byte("利用規約\n\n第1条\n本文\n\n第2条\n")},
+        "legal/terms/2026-04-01.txt":   {Data: []byte("利用規約\n\n改定版\n")},
+        "legal/privacy/2025-10-01.txt": {Data: []byte("プライバシーポリシー\n")},
+    }, "legal")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if kinds := lib.Kinds(); len(kinds) != 2 || kinds[0] != LegalPrivacy || kinds[1] != LegalTerms {
+        t.Fatalf("unexpected kinds %v", kinds)
+    }
+    // The new version takes effect at midnight in Japan.
+    before := time.Date(2026, 3, 31, 14, 59, 0, 0, time.UTC)
+    if d, _ := lib.Current(LegalTerms, before); d.Version != "2025-10-01" {
+        t.Fatalf("expected the old version before the effective date, got %s", d.Version)
+    }
+    if d, _ := lib.Current(LegalTerms, before.Add(time.Minute)); d.Version != "2026-04-01" {
+        t.Fatalf("expected the new version, got %s", d.Version)
+    }
+    if _, err := lib.Current(LegalTerms, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)); !errors.Is(err, ErrNotFound) {
+        t.Fatalf("nothing is in effect before the first version, got %v", err)
+    }
+    d, err := lib.Version(LegalTerms, "2025-10-01")
+    if err != nil || d.Title != "利用規約" {
+        t.Fatalf("unexpected document %#v err=%v", d, err)
+    }
+    if p := d.Paragraphs(); len(p) != 2 || p[0] != "第1条\n本文" {
+        t.Fatalf("unexpected paragraphs %q", p)
+    }
+
+    if _, err := LoadLegalDocuments(fstest.MapFS{"legal/terms/v2.txt": {Data: []byte("x")}}, "legal"); err == nil {
+        t.Fatalf("names that are not dates must be rejected")
+    }
+}
+
+func TestAuth_LegalReacceptance(t *testing.T) {
+    lib, err := LoadLegalDocuments(fstest.MapFS{
+        "legal/terms/2025-10-01.txt":   {Data: []byte("Terms v1\n")},
+        "legal/terms/2026-04-01.txt":   {Data: []byte("Terms v2\n")},
+        "legal/privacy/2025-10-01.txt": {Data: []byte("Privacy v1\n")},
+    }, "legal")
+    if err != nil {
+        t.Fatal(err)
+    }
+    mc := &mockClient{token: Token{AccessToken: "a", OpenID: "o"}, profile: Profile{Subject: "o"}}
+    a, as := newTestAuth(mc, &mockStore{tokens: map[string]Token{}})
+    acc := memAcceptanceStore{}
+    a.SetLegal(lib, acc)
+    now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+    a.now = func() time.Time { return now }
+    ctx := context.Background()
+
+    // The first sign-in counts as agreement to the versions in effect.
+    res, err := login(t, a, as, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(res.LegalPending) != 0 {
+        t.Fatalf("nothing to re-accept on the first login, got %v", res.LegalPending)
+    }
+    userID := res.Session.UserID
+    if got := acc[userID]; len(got) != 2 || !got[0].Implicit {
+        t.Fatalf("expected implicit acceptances, got %#v", got)
+    }
+
+    // The new terms take effect: the next login asks for them.
+    now = time.Date(2026, 4, 2, 0, 0, 0, 0, time.UTC)
+    res, err = login(t, a, as, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(res.LegalPending) != 1 || res.LegalPending[0].Version != "2026-04-01" {
+        t.Fatalf("expected the new terms to be pending, got %v", res.LegalPending)
+    }
+    sid := res.Session.ID
+    if err := a.AcceptLegal(ctx, sid, map[string]string{LegalTerms: "2025-10-01"}); !errors.Is(err, ErrLegalVersionMismatch) {
+        t.Fatalf("accepting an old version must fail, got %v", err)
+    }
+    if err := a.AcceptLegal(ctx, sid, map[string]string{LegalTerms: "2026-04-01"}); err != nil {
+        t.Fatal(err)
+    }
+    accepted, pending, err := a.LegalStatus(ctx, sid)
+    if err != nil || len(pending) != 0 || len(accepted) != 3 || accepted[2].Implicit {
+        t.Fatalf("unexpected status accepted=%#v pending=%v err=%v", accepted, pending, err)
+    }
+    if _, _, err := a.LegalStatus(ctx, "nope"); !errors.Is(err, ErrNotSignedIn) {
+        t.Fatalf("expected ErrNotSignedIn, got %v", err)
+    }
+}
@@ -0,0 +1,104 @@
+package oauth
+
+import (
+    "context"
+    "errors"
+    "sort"
+)
+
+// ProviderTikTok is the registry name of the TikTok provider.
+const ProviderTikTok = "tiktok"
+
+// ErrUnknownProvider is returned for provider names that are not registered.
+var ErrUnknownProvider = errors.New("unknown provider")
+
+// Profile is the provider-independent view of a signed-in account.
+type Profile struct {
+    Provider    string         `json:"provider"`
+    Subject     string         `json:"subject"`
+    DisplayName string         `json:"display_name"`
+    AvatarURL   string         `json:"avatar_url,omitempty"`
+    Email       string         `json:"email,omitempty"`
+    Raw         map[string]any `json:"raw,omitempty"`
+}
+
+// AuthParams are the inputs of an authorization request.
+type AuthParams struct {
+    State         string
+    RedirectURI   string
+    Scope         string
+    CodeChallenge string
+}
+
+// ExchangeParams are the inputs of an authorization code exchange.
+type ExchangeParams struct {
+    Code         string
+    RedirectURI  string
+    CodeVerifier string
+}
+
+// Provider is an OAuth2 identity provider.
+type Provider interface {
+    Name() string
+    AuthURL(p AuthParams) string
+    Exchange(ctx context.Context, p ExchangeParams) (Token, error)
+    Refresh(ctx context.Context, refreshToken string) (Token, error)
+    Revoke(ctx context.Context, token string) error
+    UserInfo(ctx context.Context, accessToken string) (Profile, error)
+}
+
+// Registration binds a Provider to our client settings for it.
+type Registration struct {
+    Provider    Provider
+    RedirectURI string
+    Scope       string
+    // UsePKCE sends an S256 code_challenge and the matching verifier.
+    UsePKCE bool
+    // ScopeSep joins requested scopes; TikTok uses ",", the default is " ".
+    ScopeSep string
+}
+
+func (r Registration) scopeSep() string {
+    if r.ScopeSep == "" {
+        return " "
+    }
+    return r.ScopeSep
+}
+
+// Registry holds the configured providers by name.
+type Registry struct {
+    regs map[string]Registration
+}
+
+// NewRegistry returns a registry with the given registrations.
+func NewRegistry(regs ...Registration) *Registry {
+    r := &Registry{regs: map[string]Registration{}}
+    for _, reg := range regs {
+        r.Register(reg)
+    }
+    return r
+}
+
+// Register adds or replaces a provider.
+func (r *Registry) Register(reg Registration) {
+    r.regs[reg.Provider.Name()] = reg
+}
+
+// Lookup returns the registration of a provider.
+func (r *Registry) Lookup(name string) (Registration, error) {
+    reg, ok := r.regs[name]
+    if !ok {
+        return Registration{}, ErrUnknownProvider
+    }
+    return reg, nil
+}
+
+// Names lists the registered providers in alphabetical order.
+func (r *Registry) Names() []string {
+    names := make([]string, 0, len(r.regs))
+    for n := range r.regs {
+        names = append(names, n)
+    }
+    sort.Strings(names)
+    return names
+}
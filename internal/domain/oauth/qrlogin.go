@@ -0,0 +1,173 @@
+package oauth
+
+import (
+    "context"
+    "crypto/subtle"
+    "errors"
+    "time"
+)
+
+const (
+    // qrLoginTTL is how long a QR code stays valid on the shared screen.
+    qrLoginTTL = 2 * time.Minute
+    // qrPollInterval is how often WaitQRLogin re-reads the store.
+    qrPollInterval = 500 * time.Millisecond
+)
+
+var (
+    // ErrInvalidQRLogin is returned for unknown or used QR logins and for
+    // polls without the browser's secret.
+    ErrInvalidQRLogin = errors.New("invalid qr login")
+    // ErrQRLoginExpired is returned once a QR login's TTL has passed.
+    ErrQRLoginExpired = errors.New("qr login expired")
+    // ErrInvalidQRSeen is returned for polls that claim to have seen a
+    // status other than pending or scanned.
+    ErrInvalidQRSeen = errors.New("seen must be pending or scanned")
+)
+
+// QRStatus is the state of a QR login.
+type QRStatus string
+
+const (
+    QRPending  QRStatus = "pending"
+    QRScanned  QRStatus = "scanned"
+    QRApproved QRStatus = "approved"
+    QRDenied   QRStatus = "denied"
+)
+
+// QRLogin is a pending login shown as a QR code on one screen (a kiosk or
+// desktop) and completed on a phone. Only the browser that holds the
+// secret can pick up the session; the QR code carries just the ID.
+type QRLogin struct {
+    ID         string    `json:"id"`
+    SecretHash string    `json:"secret_hash"`
+    Status     QRStatus  `json:"status"`
+    SessionID  string    `json:"session_id,omitempty"`
+    ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// QRLoginStore keeps QR logins. Status changes are conditional on the
+// current status, so a late scan never overwrites an approval.
+type QRLoginStore interface {
+    SaveQRLogin(ctx context.Context, l QRLogin) error
+    GetQRLogin(ctx context.Context, id string) (QRLogin, error)
+    // SetQRLoginStatus moves a login whose status is one of from to
+    // status, recording sessionID. It returns ErrQRLoginExpired after the
+    // TTL and ErrInvalidQRLogin when the status is not in from.
+    SetQRLoginStatus(ctx context.Context, id string, from []QRStatus, status QRStatus, sessionID string, now time.Time) error
+    // TakeApprovedQRLogin returns and deletes an approved login; any
+    // other login is ErrNotFound.
+    TakeApprovedQRLogin(ctx context.Context, id string) (QRLogin, error)
+}
+
+// SetQRLoginStore enables QR code logins.
+func (a *Auth) SetQRLoginStore(s QRLoginStore) {
+    a.qrLogins = s
+}
+
+// StartQRLogin creates a QR login and returns it with the secret the
+// displaying browser must present when it polls.
+func (a *Auth) StartQRLogin(ctx context.Context) (QRLogin, string, error) {
+    if a.qrLogins == nil {
+        return QRLogin{}, "", ErrInvalidQRLogin
+    }
+    secret := newToken(32)
+    l := QRLogin{
+        ID:         newToken(16),
+        SecretHash: codeChallengeS256(secret),
+        Status:     QRPending,
+        ExpiresAt:  a.now().Add(qrLoginTTL),
+    }
+    if err := a.qrLogins.SaveQRLogin(ctx, l); err != nil {
+        return QRLogin{}, "", err
+    }
+    return l, secret, nil
+}
+
+// QRLogin returns a live QR login.
+func (a *Auth) QRLogin(ctx context.Context, id string) (QRLogin, error) {
+    if a.qrLogins == nil || id == "" {
+        return QRLogin{}, ErrInvalidQRLogin
+    }
+    l, err := a.qrLogins.GetQRLogin(ctx, id)
+    if errors.Is(err, ErrNotFound) {
+        return QRLogin{}, ErrInvalidQRLogin
+    }
+    if err != nil {
+        return QRLogin{}, err
+    }
+    if a.now().After(l.ExpiresAt) {
+        return QRLogin{}, ErrQRLoginExpired
+    }
+    return l, nil
+}
+
+// BeginQRLogin starts the TikTok login on the phone that scanned the code.
+// Scanning again (e.g. after backing out) is allowed until it is approved.
+func (a *Auth) BeginQRLogin(ctx context.Context, id string) (string, error) {
+    if err := a.moveQRLogin(ctx, id, []QRStatus{QRPending, QRScanned}, QRScanned, ""); err != nil {
+        return "", err
+    }
+    return a.begin(ctx, ProviderTikTok, "", BeginOptions{qrLoginID: id})
+}
+
+// setQRStatus records the outcome of the phone's login.
+func (a *Auth) setQRStatus(ctx context.Context, id string, status QRStatus, sessionID string) error {
+    return a.moveQRLogin(ctx, id, []QRStatus{QRScanned}, status, sessionID)
+}
+
+// moveQRLogin changes the status of a live QR login that is in one of
+// from.
+func (a *Auth) moveQRLogin(ctx context.Context, id string, from []QRStatus, status QRStatus, sessionID string) error {
+    if a.qrLogins == nil || id == "" {
+        return ErrInvalidQRLogin
+    }
+    err := a.qrLogins.SetQRLoginStatus(ctx, id, from, status, sessionID, a.now())
+    if errors.Is(err, ErrNotFound) {
+        return ErrInvalidQRLogin
+    }
+    return err
+}
+
+// WaitQRLogin long-polls a QR login for the browser holding secret. It
+// returns as soon as the status differs from seen, which must be pending
+// or scanned, or with the unchanged login when ctx is done. An approved
+// login is returned once, with its SessionID, and then deleted.
+func (a *Auth) WaitQRLogin(ctx context.Context, id, secret string, seen QRStatus) (QRLogin, error) {
+    if seen != QRPending && seen != QRScanned {
+        return QRLogin{}, ErrInvalidQRSeen
+    }
+    l, err := a.QRLogin(ctx, id)
+    if err != nil {
+        return QRLogin{}, err
+    }
+    if subtle.ConstantTimeCompare([]byte(codeChallengeS256(secret)), []byte(l.SecretHash)) != 1 {
+        return QRLogin{}, ErrInvalidQRLogin
+    }
+    t := time.NewTicker(qrPollInterval)
+    defer t.Stop()
+wait:
+    for l.Status == seen {
+        select {
+        case <-ctx.Done():
+            break wait
+        case <-t.C:
+        }
+        if l, err = a.QRLogin(ctx, id); err != nil {
+            return QRLogin{}, err
+        }
+    }
+    if l.Status == QRApproved {
+        // Concurrent polls both see the approval; only one takes it. A
+        // poll that timed out takes it too, so an approved login is never
+        // returned without being taken.
+        l, err = a.qrLogins.TakeApprovedQRLogin(context.WithoutCancel(ctx), id)
+        if errors.Is(err, ErrNotFound) {
+            return QRLogin{}, ErrInvalidQRLogin
+        }
+        if err != nil {
+            return QRLogin{}, err
+        }
+    }
+    return l, nil
+}
@@ -0,0 +1,175 @@
+package oauth
+
+import (
+    "context"
+    "errors"
+    "slices"
+    "testing"
+    "time"
+)
+
+type memQRStore map[string]QRLogin
+
+func (m memQRStore) SaveQRLogin(ctx context.Context, l QRLogin) error {
+    m[l.ID] = l
+    return nil
+}
+
+func (m memQRStore) GetQRLogin(ctx context.Context, id string) (QRLogin, error) {
+    l, ok := m[id]
+    if !ok {
+        return QRLogin{}, ErrNotFound
+    }
+    return l, nil
+}
+
+func (m memQRStore) SetQRLoginStatus(ctx context.Context, id string, from []QRStatus, status QRStatus, sessionID string, now time.Time) error {
+    l, ok := m[id]
+    switch {
+    case !ok:
+        return ErrNotFound
+    case now.After(l.ExpiresAt):
+        return ErrQRLoginExpired
+    case !slices.Contains(from, l.Status):
+        return ErrInvalidQRLogin
+    }
+    l.Status, l.SessionID = status, sessionID
+    m[id] = l
+    return nil
+}
+
+func (m memQRStore) TakeApprovedQRLogin(ctx context.Context, id string) (QRLogin, error) {
+    l, ok := m[id]
+    if !ok || l.Status != QRApproved {
+        return QRLogin{}, ErrNotFound
+    }
+    delete(m, id)
+    return l, nil
+}
+
+func TestAuth_QRLogin(t *testing.T) {
+    mc := &mockClient{token: Token{AccessToken: "a", OpenID: "o"}, profile: Profile{Subject: "o"}}
+    a, as := newTestAuth(mc, &mockStore{tokens: map[string]Token{}})
+    a.SetQRLoginStore(memQRStore{})
+    ctx := context.Background()
+
+    l, secret, err := a.StartQRLogin(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Nothing happened yet: the poll returns unchanged when it times out.
+    waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+    got, err := a.WaitQRLogin(waitCtx, l.ID, secret, QRPending)
+    cancel()
+    if err != nil || got.Status != QRPending {
+        t.Fatalf("unexpected poll %#v err=%v", got, err)
+    }
+    if _, err := a.WaitQRLogin(ctx, l.ID, "someone-else", QRPending); !errors.Is(err, ErrInvalidQRLogin) {
+        t.Fatalf("polls need the secret, got %v", err)
+    }
+
+    if _, err := a.BeginQRLogin(ctx, l.ID); err != nil {
+        t.Fatal(err)
+    }
+    if got, _ := a.WaitQRLogin(ctx, l.ID, secret, QRPending); got.Status != QRScanned {
+        t.Fatalf("expected scanned, got %q", got.Status)
+    }
+    st := onlyState(t, as)
+    if st.Mode != LoginModeQR {
+        t.Fatalf("unexpected mode %q", st.Mode)
+    }
+    res, err := a.Complete(ctx, ProviderTikTok, st.State, "code")
+    if err != nil {
+        t.Fatal(err)
+    }
+    got, err = a.WaitQRLogin(ctx, l.ID, secret, QRScanned)
+    if err != nil || got.Status != QRApproved || got.SessionID != res.Session.ID {
+        t.Fatalf("unexpected approval %#v err=%v", got, err)
+    }
+    if _, err := a.WaitQRLogin(ctx, l.ID, secret, QRScanned); !errors.Is(err, ErrInvalidQRLogin) {
+        t.Fatalf("the session must be picked up once, got %v", err)
+    }
+}
+
+func TestAuth_QRLoginSeenApproved(t *testing.T) {
+    mc := &mockClient{token: Token{AccessToken: "a", OpenID: "o"}, profile: Profile{Subject: "o"}}
+    a, as := newTestAuth(mc, &mockStore{tokens: map[string]Token{}})
+    a.SetQRLoginStore(memQRStore{})
+    ctx := context.Background()
+
+    l, secret, _ := a.StartQRLogin(ctx)
+    if _, err := a.BeginQRLogin(ctx, l.ID); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := a.Complete(ctx, ProviderTikTok, onlyState(t, as).State, "code"); err != nil {
+        t.Fatal(err)
+    }
+    // Claiming to have seen the approval would wait it out without taking
+    // it, and hand the session out on every poll.
+    for i := 0; i < 2; i++ {
+        waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+        _, err := a.WaitQRLogin(waitCtx, l.ID, secret, QRApproved)
+        cancel()
+        if !errors.Is(err, ErrInvalidQRSeen) {
+            t.Fatalf("poll %d: expected ErrInvalidQRSeen, got %v", i+1, err)
+        }
+    }
+    if got, err := a.WaitQRLogin(ctx, l.ID, secret, QRScanned); err != nil || got.Status != QRApproved {
+        t.Fatalf("unexpected approval %#v err=%v", got, err)
+    }
+    if _, err := a.WaitQRLogin(ctx, l.ID, secret, QRScanned); !errors.Is(err, ErrInvalidQRLogin) {
+        t.Fatalf("the session must be picked up once, got %v", err)
+    }
+}
+
+func TestAuth_QRLoginScanAfterApproval(t *testing.T) {
+    mc := &mockClient{token: Token{AccessToken: "a", OpenID: "o"}, profile: Profile{Subject: "o"}}
+    a, as := newTestAuth(mc, &mockStore{tokens: map[string]Token{}})
+    a.SetQRLoginStore(memQRStore{})
+    ctx := context.Background()
+
+    l, secret, _ := a.StartQRLogin(ctx)
+    if _, err := a.BeginQRLogin(ctx, l.ID); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := a.Complete(ctx, ProviderTikTok, onlyState(t, as).State, "code"); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := a.BeginQRLogin(ctx, l.ID); !errors.Is(err, ErrInvalidQRLogin) {
+        t.Fatalf("a scan after the approval must be refused, got %v", err)
+    }
+    if got, err := a.WaitQRLogin(ctx, l.ID, secret, QRScanned); err != nil || got.Status != QRApproved {
+        t.Fatalf("the approval must survive a late scan: %#v err=%v", got, err)
+    }
+}
+
+func TestAuth_QRLoginDeniedAndExpired(t *testing.T) {
+    a, as := newTestAuth(&mockClient{}, &mockStore{})
+    a.SetQRLoginStore(memQRStore{})
+    now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+    a.now = func() time.Time { return now }
+    ctx := context.Background()
+
+    l, secret, _ := a.StartQRLogin(ctx)
+    if _, err := a.BeginQRLogin(ctx, l.ID); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := a.Abort(ctx, ProviderTikTok, onlyState(t, as).State); err != nil {
+        t.Fatal(err)
+    }
+    if got, _ := a.WaitQRLogin(ctx, l.ID, secret, QRScanned); got.Status != QRDenied {
+        t.Fatalf("expected denied, got %q", got.Status)
+    }
+    if _, err := a.BeginQRLogin(ctx, l.ID); !errors.Is(err, ErrInvalidQRLogin) {
+        t.Fatalf("a denied login cannot be scanned again, got %v", err)
+    }
+
+    l, secret, _ = a.StartQRLogin(ctx)
+    now = now.Add(qrLoginTTL + time.Second)
+    if _, err := a.BeginQRLogin(ctx, l.ID); !errors.Is(err, ErrQRLoginExpired) {
+        t.Fatalf("expected ErrQRLoginExpired, got %v", err)
+    }
+    if _, err := a.WaitQRLogin(ctx, l.ID, secret, QRPending); !errors.Is(err, ErrQRLoginExpired) {
+        t.Fatalf("expected ErrQRLoginExpired, got %v", err)
+    }
+}
@@ -0,0 +1,98 @@
+package oauth
+
+import (
+    "errors"
+    "fmt"
+    "net/url"
+    "path"
+    "strings"
+)
+
+// ErrInvalidReturnTo is returned for return_to targets outside the
+// allow-list.
+var ErrInvalidReturnTo = errors.New("return_to is not allowed")
+
+// ReturnToPolicy decides where the browser may be sent after login, so
+// that return_to cannot be used as an open redirect.
+//
+// Entries are either paths on this site ("/app") or absolute URLs
+// ("https://app.example.com" or "https://app.example.com/dashboard").
+// A target matches when it has the entry's origin (if any) and its path
+// equals the entry's path or continues it after a "/".
+type ReturnToPolicy struct {
+    entries []*url.URL
+}
+
+// NewReturnToPolicy parses the allow-list entries.
+func NewReturnToPolicy(entries []string) (*ReturnToPolicy, error) {
+    p := &ReturnToPolicy{}
+    for _, e := range entries {
+        u, err := url.Parse(e)
+        if err != nil {
+            return nil, fmt.Errorf("return_to allow-list entry %q: %w", e, err)
+        }
+        switch {
+        case u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/"):
+        case (u.Scheme == "https" || u.Scheme == "http") && u.Host != "" && u.User == nil:
+        default:
+            return nil, fmt.Errorf("return_to allow-list entry %q must be a path or an http(s) origin", e)
+        }
+        if u.RawQuery != "" || u.Fragment != "" {
+            return nil, fmt.Errorf("return_to allow-list entry %q must not have a query or fragment", e)
+        }
+        p.entries = append(p.entries, u)
+    }
+    return p, nil
+}
+
+// Check returns the normalized target if it is allowed.
+func (p *ReturnToPolicy) Check(target string) (string, error) {
+    if p == nil || target == "" || strings.ContainsAny(target, "\\\r\n\t") {
+        return "", ErrInvalidReturnTo
+    }
+    u, err := url.Parse(target)
+    if err != nil || u.User != nil || u.Opaque != "" {
+        return "", ErrInvalidReturnTo
+    }
+    relative := u.Scheme == "" && u.Host == ""
+    // "//evil.example" is protocol-relative, not a path.
+    if relative && (!strings.HasPrefix(u.Path, "/") || strings.HasPrefix(target, "//")) {
+        return "", ErrInvalidReturnTo
+    }
+    if !relative && u.Scheme != "https" && u.Scheme != "http" {
+        return "", ErrInvalidReturnTo
+    }
+    // Dot segments could climb out of an allowed path.
+    if u.Path != "" {
+        if clean := path.Clean(u.Path); clean != u.Path && clean+"/" != u.Path {
+            return "", ErrInvalidReturnTo
+        }
+    }
+    for _, e := range p.entries {
+        if e.Host == "" != relative {
+            continue
+        }
+        if !relative && (!strings.EqualFold(e.Scheme, u.Scheme) || !strings.EqualFold(e.Host, u.Host)) {
+            continue
+        }
+        if pathWithin(u.Path, e.Path) {
+            return u.String(), nil
+        }
+    }
+    return "", ErrInvalidReturnTo
+}
+
+// pathWithin reports whether p is prefix or lies below it.
+func pathWithin(p, prefix string) bool {
+    prefix = strings.TrimSuffix(prefix, "/")
+    if prefix == "" || p == prefix {
+        return true
+    }
+    return strings.HasPrefix(p, prefix+"/")
+}
+
+// CheckReturnTo checks a target against the policy of SetReturnToPolicy,
+// for redirects that happen after the login itself.
+func (a *Auth) CheckReturnTo(target string) (string, error) {
+    return a.returnTo.Check(target)
+}
@@ -0,0 +1,82 @@
+package oauth
+
+import (
+    "context"
+    "errors"
+    "testing"
+)
+
+func TestReturnToPolicy(t *testing.T) {
+    p, err := NewReturnToPolicy([]string{"/app", "https://dash.example.com", "https://www.example.com/admin/"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    allowed := []string{
+        "/app",
+        "/app/posts?id=1#top",
+        "https://dash.example.com/anything",
+        "https://DASH.example.com",
+        "https://www.example.com/admin/users",
+    }
+    for _, target := range allowed {
+        if _, err := p.Check(target); err != nil {
+            t.Errorf("%s: expected allowed, got %v", target, err)
+        }
+    }
+    denied := []string{
+        "",
+        "/apple",
+        "/",
+        "//evil.example/app",
+        "/\\evil.example",
+        "https://evil.example/app",
+        "http://dash.example.com",
+        "https://dash.example.com.evil.example",
+        "https://user@dash.example.com",
+        "https://www.example.com/administrator",
+        "/app/../admin",
+        "javascript:alert(1)",
+        "app",
+    }
+    for _, target := range denied {
+        if _, err := p.Check(target); !errors.Is(err, ErrInvalidReturnTo) {
+            t.Errorf("%s: expected ErrInvalidReturnTo, got %v", target, err)
+        }
+    }
+
+    for _, bad := range []string{"app", "ftp://x", "https://x/?a=b"} {
+        if _, err := NewReturnToPolicy([]string{bad}); err == nil {
+            t.Errorf("%s: expected invalid entry", bad)
+        }
+    }
+}
+
+func TestAuth_ReturnToBoundToState(t *testing.T) {
+    mc := &mockClient{token: Token{AccessToken: "a", OpenID: "o"}, profile: Profile{Subject: "o"}}
+    a, as := newTestAuth(mc, &mockStore{tokens: map[string]Token{}})
+    ctx := context.Background()
+
+    if _, err := a.Begin(ctx, ProviderTikTok, BeginOptions{ReturnTo: "/app"}); !errors.Is(err, ErrInvalidReturnTo) {
+        t.Fatalf("without a policy return_to must be rejected, got %v", err)
+    }
+    p, _ := NewReturnToPolicy([]string{"/app"})
+    a.SetReturnToPolicy(p)
+    if _, err := a.Begin(ctx, ProviderTikTok, BeginOptions{ReturnTo: "https://evil.example/"}); !errors.Is(err, ErrInvalidReturnTo) {
+        t.Fatalf("expected ErrInvalidReturnTo, got %v", err)
+    }
+    if _, err := a.Begin(ctx, ProviderTikTok, BeginOptions{ReturnTo: "/app/x"}); err != nil {
+        t.Fatal(err)
+    }
+    res, err := a.Complete(ctx, ProviderTikTok, onlyState(t, as).State, "code")
+    if err != nil || res.Request.ReturnTo != "/app/x" {
+        t.Fatalf("unexpected return_to %q err=%v", res.Request.ReturnTo, err)
+    }
+
+    if _, err := a.Begin(ctx, ProviderTikTok, BeginOptions{ReturnTo: "/app/denied"}); err != nil {
+        t.Fatal(err)
+    }
+    st, err := a.Abort(ctx, ProviderTikTok, onlyState(t, as).State)
+    if err != nil || st.ReturnTo != "/app/denied" || len(as.states) != 0 {
+        t.Fatalf("abort: %#v err=%v", st, err)
+    }
+}
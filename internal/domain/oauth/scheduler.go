@@ -0,0 +1,244 @@
+package oauth
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "time"
+
+    "tiktok-oauth/internal/pkg/logging"
+)
+
+var (
+    // ErrNotCancelable is returned when canceling a post that already ran.
+    ErrNotCancelable = errors.New("scheduled post can no longer be canceled")
+    // ErrClaimLost is returned by stores when a run finishes after its
+    // lease expired and the post was claimed again.
+    ErrClaimLost = errors.New("scheduled post claim lost")
+)
+
+// Scheduler limits.
+const (
+    scheduleLease       = 2 * time.Minute
+    maxScheduleAttempts = 5
+    scheduleRetryBase   = 30 * time.Second
+)
+
+// ScheduleStore persists the scheduled-post queue.
+type ScheduleStore interface {
+    // CreateScheduled inserts p unless the same owner already used the
+    // idempotency key; created is false when the existing post is returned.
+    CreateScheduled(ctx context.Context, p ScheduledPost) (saved ScheduledPost, created bool, err error)
+    GetScheduled(ctx context.Context, id string) (ScheduledPost, error)
+    ListScheduled(ctx context.Context, openID string) ([]ScheduledPost, error)
+    // ClaimDueScheduled atomically moves due posts to running with a lease
+    // and counts the attempt. Posts whose lease expired after their last
+    // allowed attempt are failed instead of claimed again.
+    ClaimDueScheduled(ctx context.Context, now time.Time, lease time.Duration, maxAttempts int) ([]ScheduledPost, error)
+    // CancelScheduled atomically moves the owner's post to canceled, only
+    // from scheduled; it returns ErrNotCancelable once the post was
+    // claimed. Canceling a canceled post succeeds.
+    CancelScheduled(ctx context.Context, id, openID string, now time.Time) (ScheduledPost, error)
+    // CancelScheduledFor cancels every post of openID that is still
+    // scheduled and reports how many were canceled.
+    CancelScheduledFor(ctx context.Context, openID string, now time.Time) (int, error)
+    // FinishScheduled stores the outcome of a run, only while the post is
+    // still held by the claim p came from (same LeaseUntil); otherwise it
+    // returns ErrClaimLost. The lease is cleared.
+    FinishScheduled(ctx context.Context, p ScheduledPost) error
+}
+
+// Scheduler publishes queued posts at their scheduled time.
+//
+// Delivery is at-least-once: a post is claimed with a lease before it is
+// executed and a claim whose lease expired (the process died mid-run) is
+// executed again. The publish_id is persisted in the same write that marks
+// the post published, and published posts are never claimed again, so a
+// restart does not double-post. Posts are keyed by the owner's
+// idempotency key, so client retries of Schedule do not queue duplicates.
+// The only remaining window is a crash between TikTok accepting the init
+// and that single store write.
+type Scheduler struct {
+    uc      *UseCase
+    store   ScheduleStore
+    tracker *PublishTracker
+    now     func() time.Time
+}
+
+// NewScheduler wires a scheduler. tracker may be nil.
+func NewScheduler(uc *UseCase, s ScheduleStore, t *PublishTracker) *Scheduler {
+    return &Scheduler{uc: uc, store: s, tracker: t, now: time.Now}
+}
+
+// Schedule queues p for the owner of accessToken. Retrying with the same
+// IdempotencyKey returns the originally queued post with created=false.
+func (s *Scheduler) Schedule(ctx context.Context, accessToken string, p ScheduledPost) (ScheduledPost, bool, error) {
+    owner, err := s.uc.OwnerOf(ctx, accessToken)
+    if err != nil {
+        return ScheduledPost{}, false, err
+    }
+    if err := validateScheduled(p); err != nil {
+        return ScheduledPost{}, false, err
+    }
+    p.MediaType = MediaTypeVideo
+    if p.Photo != nil {
+        p.MediaType = MediaTypePhoto
+    }
+    now := s.now()
+    p.ID = newID()
+    p.OpenID = owner.OpenID
+    p.State = ScheduleScheduled
+    p.Attempts = 0
+    p.PublishID, p.LastError = "", ""
+    p.NextAttemptAt, p.LeaseUntil = time.Time{}, time.Time{}
+    p.CreatedAt, p.UpdatedAt = now, now
+    return s.store.CreateScheduled(ctx, p)
+}
+
+// List returns the owner's scheduled posts.
+func (s *Scheduler) List(ctx context.Context, accessToken string) ([]ScheduledPost, error) {
+    owner, err := s.uc.OwnerOf(ctx, accessToken)
+    if err != nil {
+        return nil, err
+    }
+    return s.store.ListScheduled(ctx, owner.OpenID)
+}
+
+// Get returns one of the owner's scheduled posts.
+func (s *Scheduler) Get(ctx context.Context, accessToken, id string) (ScheduledPost, error) {
+    owner, err := s.uc.OwnerOf(ctx, accessToken)
+    if err != nil {
+        return ScheduledPost{}, err
+    }
+    p, err := s.store.GetScheduled(ctx, id)
+    if err != nil {
+        return ScheduledPost{}, err
+    }
+    if p.OpenID != owner.OpenID {
+        return ScheduledPost{}, ErrNotFound
+    }
+    return p, nil
+}
+
+// Cancel cancels a post that has not started running. The store checks
+// and changes the state in one step, so a post is never both canceled and
+// published by a concurrent run.
+func (s *Scheduler) Cancel(ctx context.Context, accessToken, id string) (ScheduledPost, error) {
+    owner, err := s.uc.OwnerOf(ctx, accessToken)
+    if err != nil {
+        return ScheduledPost{}, err
+    }
+    return s.store.CancelScheduled(ctx, id, owner.OpenID, s.now())
+}
+
+// RunDue claims and executes every due post once.
+func (s *Scheduler) RunDue(ctx context.Context) error {
+    due, err := s.store.ClaimDueScheduled(ctx, s.now(), scheduleLease, maxScheduleAttempts)
+    if err != nil {
+        return err
+    }
+    var errs []error
+    for _, p := range due {
+        if ctx.Err() != nil {
+            return ctx.Err()
+        }
+        if err := s.execute(logging.With(ctx, "scheduled_post_id", p.ID, "open_id", p.OpenID), p); err != nil {
+            errs = append(errs, fmt.Errorf("scheduled post %s: %w", p.ID, err))
+        }
+    }
+    return errors.Join(errs...)
+}
+
+// execute runs a claimed post; the claim already counted the attempt.
+func (s *Scheduler) execute(ctx context.Context, p ScheduledPost) error {
+    tok, err := s.uc.FreshToken(ctx, p.OpenID)
+    if err != nil {
+        return s.retryOrFail(ctx, p, err)
+    }
+
+    var (
+        init      PostInit
+        mediaType string
+    )
+    switch {
+    case p.Video != nil:
+        mediaType = MediaTypeVideo
+        init, err = s.uc.PublishVideo(ctx, tok.AccessToken, p.Video.PostInfo, VideoSource{Source: SourcePullFromURL, VideoURL: p.Video.VideoURL})
+    case p.Photo != nil:
+        mediaType = MediaTypePhoto
+        init, err = s.uc.PublishPhotos(ctx, tok.AccessToken, *p.Photo)
+    default:
+        err = fmt.Errorf("%w: nothing to publish", ErrInvalidPost)
+    }
+    if err != nil {
+        // Retrying cannot fix the post or grant a missing scope.
+        if errors.Is(err, ErrInvalidPost) || errors.Is(err, ErrInsufficientScope) {
+            p.State = ScheduleFailed
+            p.LastError = err.Error()
+            return errors.Join(err, s.save(ctx, p))
+        }
+        return s.retryOrFail(ctx, p, err)
+    }
+
+    p.State = SchedulePublished
+    p.PublishID = init.PublishID
+    p.LastError = ""
+    if err := s.save(ctx, p); err != nil {
+        return err
+    }
+    if s.tracker != nil {
+        return s.tracker.Track(ctx, tok, mediaType, init)
+    }
+    return nil
+}
+
+// retryOrFail puts p back in the queue with exponential backoff, or fails
+// it after maxScheduleAttempts.
+func (s *Scheduler) retryOrFail(ctx context.Context, p ScheduledPost, cause error) error {
+    p.LastError = cause.Error()
+    if p.Attempts >= maxScheduleAttempts {
+        p.State = ScheduleFailed
+    } else {
+        p.State = ScheduleScheduled
+        p.NextAttemptAt = s.now().Add(scheduleRetryBase << (p.Attempts - 1))
+    }
+    return errors.Join(cause, s.save(ctx, p))
+}
+
+// save records the outcome of a run under the claim of p.
+func (s *Scheduler) save(ctx context.Context, p ScheduledPost) error {
+    p.UpdatedAt = s.now()
+    return s.store.FinishScheduled(ctx, p)
+}
+
+func validateScheduled(p ScheduledPost) error {
+    if p.IdempotencyKey == "" {
+        return fmt.Errorf("%w: idempotency_key is required", ErrInvalidPost)
+    }
+    if p.ScheduledAt.IsZero() {
+        return fmt.Errorf("%w: scheduled_at is required", ErrInvalidPost)
+    }
+    switch {
+    case p.Video != nil && p.Photo != nil:
+        return fmt.Errorf("%w: set either video or photo", ErrInvalidPost)
+    case p.Video != nil:
+        if p.Video.VideoURL == "" || p.Video.PrivacyLevel == "" {
+            return fmt.Errorf("%w: video.video_url and video.privacy_level are required", ErrInvalidPost)
+        }
+    case p.Photo != nil:
+        if len(p.Photo.PhotoImages) == 0 || p.Photo.PrivacyLevel == "" {
+            return fmt.Errorf("%w: photo.photo_images and photo.privacy_level are required", ErrInvalidPost)
+        }
+    default:
+        return fmt.Errorf("%w: video or photo is required", ErrInvalidPost)
+    }
+    return nil
+}
+
+func newID() string {
+    b := make([]byte, 12)
+    _, _ = rand.Read(b)
+    return hex.EncodeToString(b)
+}
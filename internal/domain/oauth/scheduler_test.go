@@ -0,0 +1,157 @@
+package oauth
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+)
+
+type memScheduleStore struct {
+    posts map[string]ScheduledPost
+}
+
+func (m *memScheduleStore) CreateScheduled(ctx context.Context, p ScheduledPost) (ScheduledPost, bool, error) {
+    for _, existing := range m.posts {
+        if existing.OpenID == p.OpenID && existing.IdempotencyKey == p.IdempotencyKey {
+            return existing, false, nil
+        }
+    }
+    m.posts[p.ID] = p
+    return p, true, nil
+}
+
+func (m *memScheduleStore) CancelScheduled(ctx context.Context, id, openID string, now time.Time) (ScheduledPost, error) {
+    p, ok := m.posts[id]
+    if !ok || p.OpenID != openID {
+        return ScheduledPost{}, ErrNotFound
+    }
+    if p.State != ScheduleScheduled {
+        return p, ErrNotCancelable
+    }
+    p.State = ScheduleCanceled
+    m.posts[id] = p
+    return p, nil
+}
+
+func (m *memScheduleStore) CancelScheduledFor(ctx context.Context, openID string, now time.Time) (int, error) {
+    n := 0
+    for id, p := range m.posts {
+        if p.OpenID == openID && p.State == ScheduleScheduled {
+            p.State = ScheduleCanceled
+            m.posts[id] = p
+            n++
+        }
+    }
+    return n, nil
+}
+
+func (m *memScheduleStore) FinishScheduled(ctx context.Context, p ScheduledPost) error {
+    if cur := m.posts[p.ID]; cur.State != ScheduleRunning || !cur.LeaseUntil.Equal(p.LeaseUntil) {
+        return ErrClaimLost
+    }
+    p.LeaseUntil = time.Time{}
+    m.posts[p.ID] = p
+    return nil
+}
+
+func (m *memScheduleStore) GetScheduled(ctx context.Context, id string) (ScheduledPost, error) {
+    p, ok := m.posts[id]
+    if !ok {
+        return ScheduledPost{}, ErrNotFound
+    }
+    return p, nil
+}
+
+func (m *memScheduleStore) ListScheduled(ctx context.Context, openID string) ([]ScheduledPost, error) {
+    var out []ScheduledPost
+    for _, p := range m.posts {
+        if p.OpenID == openID {
+            out = append(out, p)
+        }
+    }
+    return out, nil
+}
+
+func (m *memScheduleStore) ClaimDueScheduled(ctx context.Context, now time.Time, lease time.Duration, maxAttempts int) ([]ScheduledPost, error) {
+    var out []ScheduledPost
+    for id, p := range m.posts {
+        if p.Due(now) && p.Attempts < maxAttempts {
+            p.State = ScheduleRunning
+            p.LeaseUntil = now.Add(lease)
+            p.Attempts++
+            m.posts[id] = p
+            out = append(out, p)
+        }
+    }
+    return out, nil
+}
+
+func TestScheduler_RunDue(t *testing.T) {
+    now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+    mc := &mockClient{info: CreatorInfo{PrivacyLevelOptions: []string{"SELF_ONLY"}}}
+    ms := &mockStore{tokens: map[string]Token{
+        "alice": {OpenID: "alice", AccessToken: "old", RefreshToken: "r1", ExpiresAt: now.Add(time.Minute)},
+    }}
+    uc := NewUseCase(mc, ms)
+    uc.now = func() time.Time { return now }
+    ss := &memScheduleStore{posts: map[string]ScheduledPost{}}
+    s := NewScheduler(uc, ss, nil)
+    s.now = func() time.Time { return now }
+    ctx := context.Background()
+
+    req := ScheduledPost{
+        IdempotencyKey: "k1",
+        ScheduledAt:    now.Add(time.Hour),
+        Video:          &ScheduledVideo{PostInfo: PostInfo{PrivacyLevel: "SELF_ONLY"}, VideoURL: "https://example.com/v.mp4"},
+    }
+    first, created, err := s.Schedule(ctx, "old", req)
+    if err != nil || !created {
+        t.Fatalf("schedule: created=%v err=%v", created, err)
+    }
+    again, created, err := s.Schedule(ctx, "old", req)
+    if err != nil || created || again.ID != first.ID {
+        t.Fatalf("idempotent schedule: created=%v id=%s err=%v", created, again.ID, err)
+    }
+    if _, _, err := s.Schedule(ctx, "stranger", req); !errors.Is(err, ErrUnknownToken) {
+        t.Fatalf("expected ErrUnknownToken, got %v", err)
+    }
+
+    // Not due yet.
+    if err := s.RunDue(ctx); err != nil || len(mc.inits) != 0 {
+        t.Fatalf("ran too early: inits=%d err=%v", len(mc.inits), err)
+    }
+
+    now = now.Add(time.Hour)
+    if err := s.RunDue(ctx); err != nil {
+        t.Fatalf("run: %v", err)
+    }
+    got, _ := ss.GetScheduled(ctx, first.ID)
+    if got.State != SchedulePublished || got.PublishID != "p1" {
+        t.Fatalf("unexpected post: %#v", got)
+    }
+    if mc.refreshed != 1 {
+        t.Fatalf("expected the expired token to be refreshed once, got %d", mc.refreshed)
+    }
+
+    // A restart (or a second loop) must not publish again.
+    now = now.Add(time.Hour)
+    if err := s.RunDue(ctx); err != nil || len(mc.inits) != 1 {
+        t.Fatalf("double post: inits=%d err=%v", len(mc.inits), err)
+    }
+    if _, err := s.Cancel(ctx, "fresh-r1", first.ID); !errors.Is(err, ErrNotCancelable) {
+        t.Fatalf("expected ErrNotCancelable, got %v", err)
+    }
+}
+
+func TestScheduler_ExpiredLeaseIsReclaimed(t *testing.T) {
+    now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+    p := ScheduledPost{ID: "x", State: ScheduleRunning, LeaseUntil: now.Add(-time.Second)}
+    if !p.Due(now) {
+        t.Fatalf("expired lease must be due")
+    }
+    p.LeaseUntil = now.Add(time.Second)
+    if p.Due(now) {
+        t.Fatalf("active lease must not be due")
+    }
+}
@@ -0,0 +1,101 @@
+package oauth
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// TikTok scopes used by this service.
+const (
+    ScopeUserInfoBasic = "user.info.basic"
+    ScopeVideoPublish  = "video.publish"
+    ScopeVideoUpload   = "video.upload"
+    ScopeVideoList     = "video.list"
+)
+
+var (
+    // ErrInvalidScope is returned for malformed requested scopes.
+    ErrInvalidScope = errors.New("invalid scope")
+    // ErrInsufficientScope is matched by provider errors caused by a
+    // scope the user did not grant.
+    ErrInsufficientScope = errors.New("insufficient scope")
+)
+
+// ParseScopes splits a scope string on commas (TikTok) or spaces (RFC
+// 6749) into a sorted list without duplicates.
+func ParseScopes(s string) []string {
+    fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+    return MergeScopes(fields)
+}
+
+// MergeScopes returns the sorted union of the given scope lists.
+func MergeScopes(lists ...[]string) []string {
+    seen := map[string]bool{}
+    var out []string
+    for _, list := range lists {
+        for _, s := range list {
+            if s != "" && !seen[s] {
+                seen[s] = true
+                out = append(out, s)
+            }
+        }
+    }
+    sort.Strings(out)
+    return out
+}
+
+// ScopeSet is a set of scopes, typically those granted to a token.
+type ScopeSet map[string]bool
+
+// NewScopeSet returns a set of the given scopes.
+func NewScopeSet(scopes ...string) ScopeSet {
+    s := make(ScopeSet, len(scopes))
+    for _, sc := range scopes {
+        s[sc] = true
+    }
+    return s
+}
+
+// Has reports whether scope is in the set.
+func (s ScopeSet) Has(scope string) bool { return s[scope] }
+
+// Missing returns the required scopes that are not in the set.
+func (s ScopeSet) Missing(required ...string) []string {
+    var out []string
+    for _, r := range required {
+        if !s[r] {
+            out = append(out, r)
+        }
+    }
+    return out
+}
+
+// List returns the scopes in alphabetical order.
+func (s ScopeSet) List() []string {
+    out := make([]string, 0, len(s))
+    for sc := range s {
+        out = append(out, sc)
+    }
+    sort.Strings(out)
+    return out
+}
+
+// Granted parses the token's scope string. TikTok reports only the scopes
+// the user left ticked on the consent screen.
+func (t Token) Granted() ScopeSet {
+    return NewScopeSet(ParseScopes(t.Scope)...)
+}
+
+// validateScopes checks scopes against the RFC 6749 scope-token syntax.
+func validateScopes(scopes []string) error {
+    for _, s := range scopes {
+        for _, r := range s {
+            if r < 0x21 || r > 0x7e || r == '"' || r == '\\' || r == ',' {
+                return fmt.Errorf("%w: %q", ErrInvalidScope, s)
+            }
+        }
+    }
+    return nil
+}
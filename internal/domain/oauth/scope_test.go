@@ -0,0 +1,23 @@
+package oauth
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestToken_Granted(t *testing.T) {
+    tok := Token{Scope: "video.publish,user.info.basic, video.list"}
+    got := tok.Granted()
+    if !reflect.DeepEqual(got.List(), []string{"user.info.basic", "video.list", "video.publish"}) {
+        t.Fatalf("unexpected scopes: %v", got.List())
+    }
+    if !got.Has(ScopeVideoPublish) || got.Has(ScopeVideoUpload) {
+        t.Fatalf("unexpected Has results")
+    }
+    if m := got.Missing(ScopeVideoPublish, ScopeVideoUpload); !reflect.DeepEqual(m, []string{ScopeVideoUpload}) {
+        t.Fatalf("unexpected missing scopes: %v", m)
+    }
+    if !reflect.DeepEqual(ParseScopes("openid email  openid"), []string{"email", "openid"}) {
+        t.Fatalf("space separated scopes must be parsed too")
+    }
+}
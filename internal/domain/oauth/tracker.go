@@ -0,0 +1,171 @@
+package oauth
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "tiktok-oauth/internal/pkg/logging"
+)
+
+// ErrNotFound is returned by stores when a record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Tracker limits: after maxPollErrors consecutive failures (e.g. the
+// access token expired) a post is marked FAILED with
+// FailReasonStatusUnavailable, and delivery is given up after
+// maxNotifyTries.
+const (
+    maxPollErrors  = 20
+    maxNotifyTries = 10
+)
+
+// FailReasonStatusUnavailable is the fail_reason of posts whose status
+// could not be fetched maxPollErrors times in a row.
+const FailReasonStatusUnavailable = "status_unavailable"
+
+// PublishStore persists tracked posts.
+type PublishStore interface {
+    SavePublish(ctx context.Context, r PublishRecord) error
+    GetPublish(ctx context.Context, publishID string) (PublishRecord, error)
+    // PendingPublishes returns records that are not settled yet or whose
+    // completion has not been delivered.
+    PendingPublishes(ctx context.Context) ([]PublishRecord, error)
+}
+
+// Notifier delivers completion events to our own services. Receivers are
+// identified by strings (the webhook URLs): Notify skips those listed in
+// delivered and returns every receiver that has the event so far, also
+// on error, so a retry only goes to the ones that failed.
+type Notifier interface {
+    Notify(ctx context.Context, ev PublishEvent, delivered []string) ([]string, error)
+}
+
+// PublishTracker follows every initialized post through status/fetch and
+// fires a PublishEvent once it settles. Poll is meant to be called
+// periodically by a background loop.
+type PublishTracker struct {
+    client   TikTokClient
+    store    PublishStore
+    notifier Notifier
+    now      func() time.Time
+}
+
+// NewPublishTracker wires a tracker. notifier may be nil to only record
+// transitions.
+func NewPublishTracker(c TikTokClient, s PublishStore, n Notifier) *PublishTracker {
+    return &PublishTracker{client: c, store: s, notifier: n, now: time.Now}
+}
+
+// Track starts following a post freshly initialized with tok.
+func (t *PublishTracker) Track(ctx context.Context, tok Token, mediaType string, init PostInit) error {
+    now := t.now()
+    return t.store.SavePublish(ctx, PublishRecord{
+        PublishID:   init.PublishID,
+        MediaType:   mediaType,
+        OpenID:      tok.OpenID,
+        AccessToken: tok.AccessToken,
+        CreatedAt:   now,
+        UpdatedAt:   now,
+    })
+}
+
+// Get returns the tracked state of a post.
+func (t *PublishTracker) Get(ctx context.Context, publishID string) (PublishRecord, error) {
+    return t.store.GetPublish(ctx, publishID)
+}
+
+// Poll runs one pass over pending records: fetches status for unsettled
+// ones, records transitions and delivers completion events. Errors of
+// individual records are collected and do not stop the pass.
+func (t *PublishTracker) Poll(ctx context.Context) error {
+    pending, err := t.store.PendingPublishes(ctx)
+    if err != nil {
+        return err
+    }
+    var errs []error
+    for _, r := range pending {
+        if ctx.Err() != nil {
+            return ctx.Err()
+        }
+        if !r.Pending() {
+            continue
+        }
+        if err := t.step(logging.With(ctx, "publish_id", r.PublishID), r); err != nil {
+            errs = append(errs, fmt.Errorf("publish_id=%s: %w", r.PublishID, err))
+        }
+    }
+    return errors.Join(errs...)
+}
+
+func (t *PublishTracker) step(ctx context.Context, r PublishRecord) error {
+    var stepErr error
+    if !r.Settled() {
+        st, err := t.client.FetchPublishStatus(ctx, r.AccessToken, r.PublishID)
+        if err != nil {
+            r.PollErrors++
+            stepErr = err
+            if r.PollErrors >= maxPollErrors {
+                logging.FromContext(ctx).Warn("publish status unavailable, marking the post failed", "poll_errors", r.PollErrors)
+                t.apply(&r, PublishStatus{Status: StatusFailed, FailReason: FailReasonStatusUnavailable})
+            }
+        } else {
+            r.PollErrors = 0
+            t.apply(&r, st)
+        }
+    }
+    if r.Settled() && !r.Notified && !r.NotifyFailed {
+        if err := t.notify(ctx, &r); err != nil {
+            stepErr = errors.Join(stepErr, err)
+        }
+    }
+    r.UpdatedAt = t.now()
+    if err := t.store.SavePublish(ctx, r); err != nil {
+        return errors.Join(stepErr, err)
+    }
+    return stepErr
+}
+
+func (t *PublishTracker) apply(r *PublishRecord, st PublishStatus) {
+    if st.Status != r.Status {
+        r.Transitions = append(r.Transitions, StatusTransition{Status: st.Status, At: t.now()})
+    }
+    r.Status = st.Status
+    r.FailReason = st.FailReason
+    if len(st.PostIDs) > 0 {
+        r.PostIDs = st.PostIDs
+    }
+}
+
+func (t *PublishTracker) notify(ctx context.Context, r *PublishRecord) error {
+    if t.notifier == nil {
+        r.Notified = true
+        return nil
+    }
+    event := "publish.completed"
+    if r.Status == StatusFailed {
+        event = "publish.failed"
+    }
+    r.NotifyTries++
+    delivered, err := t.notifier.Notify(ctx, PublishEvent{
+        Event:       event,
+        PublishID:   r.PublishID,
+        MediaType:   r.MediaType,
+        Status:      r.Status,
+        FailReason:  r.FailReason,
+        PostIDs:     r.PostIDs,
+        Transitions: r.Transitions,
+        OccurredAt:  t.now(),
+    }, r.DeliveredTo)
+    r.DeliveredTo = delivered
+    if err != nil {
+        if r.NotifyTries >= maxNotifyTries {
+            logging.FromContext(ctx).Warn("giving up publish event delivery", "notify_tries", r.NotifyTries, "err", err)
+            r.NotifyFailed = true
+        }
+        return fmt.Errorf("notify: %w", err)
+    }
+    r.Notified = true
+    return nil
+}
@@ -0,0 +1,113 @@
+package oauth
+
+import (
+    "context"
+    "errors"
+    "testing"
+)
+
+type memPublishStore struct {
+    records map[string]PublishRecord
+}
+
+func (m *memPublishStore) SavePublish(ctx context.Context, r PublishRecord) error {
+    m.records[r.PublishID] = r
+    return nil
+}
+
+func (m *memPublishStore) GetPublish(ctx context.Context, id string) (PublishRecord, error) {
+    r, ok := m.records[id]
+    if !ok {
+        return PublishRecord{}, ErrNotFound
+    }
+    return r, nil
+}
+
+func (m *memPublishStore) PendingPublishes(ctx context.Context) ([]PublishRecord, error) {
+    var out []PublishRecord
+    for _, r := range m.records {
+        if r.Pending() {
+            out = append(out, r)
+        }
+    }
+    return out, nil
+}
+
+type recordingNotifier struct {
+    events []PublishEvent
+    err    error
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, ev PublishEvent, delivered []string) ([]string, error) {
+    if n.err != nil {
+        return delivered, n.err
+    }
+    n.events = append(n.events, ev)
+    return append(delivered, "receiver"), nil
+}
+
+func TestPublishTracker_Poll(t *testing.T) {
+    mc := &mockClient{statuses: []PublishStatus{
+        {Status: StatusProcessingDownload},
+        {Status: StatusProcessingDownload},
+        {Status: StatusPublishComplete, PostIDs: []string{"42"}},
+    }}
+    st := &memPublishStore{records: map[string]PublishRecord{}}
+    n := &recordingNotifier{err: errors.New("down")}
+    tr := NewPublishTracker(mc, st, n)
+    ctx := context.Background()
+
+    if err := tr.Track(ctx, Token{OpenID: "alice", AccessToken: "tok"}, MediaTypeVideo, PostInit{PublishID: "p1"}); err != nil {
+        t.Fatalf("track: %v", err)
+    }
+    for i := 0; i < 2; i++ {
+        if err := tr.Poll(ctx); err != nil {
+            t.Fatalf("poll %d: %v", i, err)
+        }
+    }
+    // Settles on the third poll but the callback receiver is down.
+    if err := tr.Poll(ctx); err == nil {
+        t.Fatalf("expected notify error")
+    }
+    rec, _ := tr.Get(ctx, "p1")
+    if rec.Status != StatusPublishComplete || rec.Notified || len(rec.Transitions) != 2 {
+        t.Fatalf("unexpected record: %#v", rec)
+    }
+
+    n.err = nil
+    if err := tr.Poll(ctx); err != nil {
+        t.Fatalf("poll: %v", err)
+    }
+    rec, _ = tr.Get(ctx, "p1")
+    if !rec.Notified || len(n.events) != 1 || n.events[0].Event != "publish.completed" || n.events[0].PostIDs[0] != "42" {
+        t.Fatalf("unexpected delivery: %#v %#v", rec, n.events)
+    }
+    if pending, _ := st.PendingPublishes(ctx); len(pending) != 0 {
+        t.Fatalf("record still pending")
+    }
+}
+
+func TestPublishTracker_GivesUp(t *testing.T) {
+    mc := &mockClient{statusErr: errors.New("access_token_invalid")}
+    st := &memPublishStore{records: map[string]PublishRecord{}}
+    n := &recordingNotifier{err: errors.New("down")}
+    tr := NewPublishTracker(mc, st, n)
+    ctx := context.Background()
+    if err := tr.Track(ctx, Token{OpenID: "alice", AccessToken: "tok"}, MediaTypeVideo, PostInit{PublishID: "p1"}); err != nil {
+        t.Fatalf("track: %v", err)
+    }
+
+    for i := 0; i < maxPollErrors+maxNotifyTries; i++ {
+        _ = tr.Poll(ctx)
+    }
+    rec, _ := tr.Get(ctx, "p1")
+    if rec.Status != StatusFailed || rec.FailReason != FailReasonStatusUnavailable {
+        t.Fatalf("post not marked failed: %#v", rec)
+    }
+    if !rec.NotifyFailed || rec.NotifyTries != maxNotifyTries {
+        t.Fatalf("delivery not given up: %#v", rec)
+    }
+    if pending, _ := st.PendingPublishes(ctx); len(pending) != 0 {
+        t.Fatalf("record still pending")
+    }
+}
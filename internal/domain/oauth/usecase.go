@@ -1,42 +1,324 @@
 package oauth
 
-import "context"
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net/url"
+    "time"
 
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/trace"
+
+    "tiktok-oauth/internal/pkg/logging"
+)
+
+// ErrInvalidPost is returned when a post request does not satisfy
+// TikTok's rules or the creator's current limits.
+var ErrInvalidPost = errors.New("invalid post")
+
+// ErrUnknownToken is returned when an access token was not issued through
+// our login, so there is no stored owner or refresh token for it.
+var ErrUnknownToken = errors.New("unknown access token")
+
+// Photo post limits of the Content Posting API.
+const (
+    maxPhotoImages     = 35
+    maxPhotoTitleRunes = 90
+    maxPhotoDescRunes  = 4000
+    maxVideoTitleRunes = 2200
+)
+
+// Store keeps the latest token per provider account.
 type Store interface {
     Save(ctx context.Context, t Token) error
+    TokenFor(ctx context.Context, provider, subject string) (Token, error)
+    // TokenByAccessToken finds the token of provider whose access token
+    // is accessToken.
+    TokenByAccessToken(ctx context.Context, provider, accessToken string) (Token, error)
+    DeleteToken(ctx context.Context, provider, subject string) error
 }
 
+// TikTokClient is the TikTok-specific API surface beyond login, which
+// goes through Provider.
 type TikTokClient interface {
-    AuthURL(state, redirectURI, scope string) string
-    Exchange(ctx context.Context, code, redirectURI string) (Token, error)
-    GetUserInfo(ctx context.Context, accessToken string, fields []string) (map[string]any, error)
+    Refresh(ctx context.Context, refreshToken string) (Token, error)
+    QueryCreatorInfo(ctx context.Context, accessToken string) (CreatorInfo, error)
+    InitVideoPost(ctx context.Context, accessToken string, info PostInfo, src VideoSource) (PostInit, error)
+    FetchPublishStatus(ctx context.Context, accessToken, publishID string) (PublishStatus, error)
+    UploadVideo(ctx context.Context, init PostInit, src VideoSource, r io.ReaderAt) error
+    InitPhotoPost(ctx context.Context, accessToken string, post PhotoPost) (PostInit, error)
 }
 
-type UseCase struct {
-    client TikTokClient
-    store  Store
-    scope  string
+// tracer names the spans of the use case methods.
+var tracer = otel.Tracer("tiktok-oauth/internal/domain/oauth")
+
+// endSpan marks span failed when err is set and ends it.
+func endSpan(span trace.Span, err error) {
+    if err != nil {
+        span.RecordError(err)
+        span.SetStatus(codes.Error, err.Error())
+    }
+    span.End()
 }
 
-func NewUseCase(c TikTokClient, s Store, scope string) *UseCase {
-    return &UseCase{client: c, store: s, scope: scope}
+// refreshLeeway refreshes access tokens this long before they expire.
+const refreshLeeway = 5 * time.Minute
+
+// Outcomes of a token refresh reported to a RefreshObserver.
+const (
+    RefreshOK             = "ok"
+    RefreshNoRefreshToken = "no_refresh_token"
+    RefreshFailed         = "failed"
+    RefreshSaveFailed     = "save_failed"
+)
+
+// RefreshObserver is told how each refresh of an expired token ended.
+type RefreshObserver interface {
+    ObserveRefresh(outcome string)
+}
+
+type UseCase struct {
+    client       TikTokClient
+    store        Store
+    pollInterval time.Duration
+    now          func() time.Time
+    refreshes    RefreshObserver
 }
 
-func (u *UseCase) LoginURL(state, redirectURI string) string {
-    return u.client.AuthURL(state, redirectURI, u.scope)
+func NewUseCase(c TikTokClient, s Store) *UseCase {
+    return &UseCase{client: c, store: s, pollInterval: 3 * time.Second, now: time.Now}
 }
 
-func (u *UseCase) Callback(ctx context.Context, code, redirectURI string) (Token, error) {
-    tok, err := u.client.Exchange(ctx, code, redirectURI)
+// SetRefreshObserver reports the outcome of every token refresh to o.
+func (u *UseCase) SetRefreshObserver(o RefreshObserver) { u.refreshes = o }
+
+// FreshToken returns the stored token of openID, refreshing and saving
+// it first when the access token is about to expire.
+func (u *UseCase) FreshToken(ctx context.Context, openID string) (_ Token, err error) {
+    ctx, span := tracer.Start(ctx, "UseCase.FreshToken", trace.WithAttributes(attribute.String("open_id", openID)))
+    defer func() { endSpan(span, err) }()
+    tok, err := u.store.TokenFor(ctx, ProviderTikTok, openID)
+    if err != nil {
+        return Token{}, err
+    }
+    if !tok.Expired(u.now(), refreshLeeway) {
+        return tok, nil
+    }
+    log := logging.FromContext(ctx)
+    if tok.RefreshToken == "" {
+        u.observeRefresh(ctx, RefreshNoRefreshToken)
+        log.Warn("access token expired without a refresh token")
+        return Token{}, fmt.Errorf("token of %s expired and has no refresh token", openID)
+    }
+    fresh, err := u.client.Refresh(ctx, tok.RefreshToken)
     if err != nil {
+        u.observeRefresh(ctx, RefreshFailed)
+        log.Warn("token refresh failed", "err", err)
+        return Token{}, fmt.Errorf("refresh token: %w", err)
+    }
+    if fresh.OpenID == "" {
+        fresh.OpenID = openID
+    }
+    fresh.Provider = ProviderTikTok
+    if err := u.store.Save(ctx, fresh); err != nil {
+        u.observeRefresh(ctx, RefreshSaveFailed)
+        log.Error("save refreshed token", "err", err)
         return Token{}, err
     }
-    _ = u.store.Save(ctx, tok)
-    return tok, nil
+    u.observeRefresh(ctx, RefreshOK)
+    log.Info("access token refreshed", "expires_at", fresh.ExpiresAt)
+    return fresh, nil
+}
+
+func (u *UseCase) observeRefresh(ctx context.Context, outcome string) {
+    trace.SpanFromContext(ctx).SetAttributes(attribute.String("token.refresh", outcome))
+    if u.refreshes != nil {
+        u.refreshes.ObserveRefresh(outcome)
+    }
+}
+
+// OwnerOf resolves the stored TikTok token (and so the open_id) an access
+// token was issued with. Only tokens obtained through our login are known;
+// access tokens of other providers never match.
+func (u *UseCase) OwnerOf(ctx context.Context, accessToken string) (_ Token, err error) {
+    ctx, span := tracer.Start(ctx, "UseCase.OwnerOf")
+    defer func() { endSpan(span, err) }()
+    tok, err := u.store.TokenByAccessToken(ctx, ProviderTikTok, accessToken)
+    if errors.Is(err, ErrNotFound) {
+        return Token{}, ErrUnknownToken
+    }
+    return tok, err
 }
 
-// Optional convenience to fetch user info via UseCase.
-func (u *UseCase) GetUserInfo(ctx context.Context, accessToken string, fields []string) (map[string]any, error) {
-    return u.client.GetUserInfo(ctx, accessToken, fields)
+// CreatorInfo returns the creator's current posting limits.
+func (u *UseCase) CreatorInfo(ctx context.Context, accessToken string) (_ CreatorInfo, err error) {
+    ctx, span := tracer.Start(ctx, "UseCase.CreatorInfo")
+    defer func() { endSpan(span, err) }()
+    return u.client.QueryCreatorInfo(ctx, accessToken)
 }
 
+// PublishVideo validates the post against creator_info and initializes it.
+// For PULL_FROM_URL TikTok starts downloading right away; for FILE_UPLOAD
+// the caller must upload the bytes to the returned UploadURL.
+func (u *UseCase) PublishVideo(ctx context.Context, accessToken string, info PostInfo, src VideoSource) (_ PostInit, err error) {
+    ctx, span := tracer.Start(ctx, "UseCase.PublishVideo", trace.WithAttributes(attribute.String("source", src.Source)))
+    defer func() { endSpan(span, err) }()
+    if err := validateVideoSource(src); err != nil {
+        return PostInit{}, err
+    }
+
+    creator, err := u.client.QueryCreatorInfo(ctx, accessToken)
+    if err != nil {
+        return PostInit{}, err
+    }
+    if err := validatePostInfo(info, creator); err != nil {
+        return PostInit{}, err
+    }
+    if len([]rune(info.Title)) > maxVideoTitleRunes {
+        return PostInit{}, fmt.Errorf("%w: title exceeds %d characters", ErrInvalidPost, maxVideoTitleRunes)
+    }
+    init, err := u.client.InitVideoPost(ctx, accessToken, info, src)
+    if err != nil {
+        return PostInit{}, err
+    }
+    logging.FromContext(ctx).Info("video post initialized", "publish_id", init.PublishID, "source", src.Source)
+    return init, nil
+}
+
+// PublishPhotos validates a photo post against TikTok's limits and
+// creator_info, then initializes it. Track it with WaitPublishStatus.
+func (u *UseCase) PublishPhotos(ctx context.Context, accessToken string, post PhotoPost) (_ PostInit, err error) {
+    ctx, span := tracer.Start(ctx, "UseCase.PublishPhotos", trace.WithAttributes(attribute.Int("photo_images", len(post.PhotoImages))))
+    defer func() { endSpan(span, err) }()
+    if n := len(post.PhotoImages); n == 0 || n > maxPhotoImages {
+        return PostInit{}, fmt.Errorf("%w: photo_images must contain 1 to %d URLs", ErrInvalidPost, maxPhotoImages)
+    }
+    for i, raw := range post.PhotoImages {
+        pu, err := url.Parse(raw)
+        if err != nil || (pu.Scheme != "https" && pu.Scheme != "http") || pu.Host == "" {
+            return PostInit{}, fmt.Errorf("%w: photo_images[%d] is not an http(s) URL", ErrInvalidPost, i)
+        }
+    }
+    if post.PhotoCoverIndex < 0 || post.PhotoCoverIndex >= len(post.PhotoImages) {
+        return PostInit{}, fmt.Errorf("%w: photo_cover_index out of range", ErrInvalidPost)
+    }
+    if len([]rune(post.Title)) > maxPhotoTitleRunes {
+        return PostInit{}, fmt.Errorf("%w: title exceeds %d characters", ErrInvalidPost, maxPhotoTitleRunes)
+    }
+    if len([]rune(post.Description)) > maxPhotoDescRunes {
+        return PostInit{}, fmt.Errorf("%w: description exceeds %d characters", ErrInvalidPost, maxPhotoDescRunes)
+    }
+
+    creator, err := u.client.QueryCreatorInfo(ctx, accessToken)
+    if err != nil {
+        return PostInit{}, err
+    }
+    if err := validatePostInfo(post.PostInfo, creator); err != nil {
+        return PostInit{}, err
+    }
+    init, err := u.client.InitPhotoPost(ctx, accessToken, post)
+    if err != nil {
+        return PostInit{}, err
+    }
+    logging.FromContext(ctx).Info("photo post initialized", "publish_id", init.PublishID, "photo_images", len(post.PhotoImages))
+    return init, nil
+}
+
+// UploadVideo initializes a FILE_UPLOAD post for a video of size bytes and
+// uploads it in chunks. The returned PostInit is valid even when the upload
+// fails, so callers can report the publish_id.
+func (u *UseCase) UploadVideo(ctx context.Context, accessToken string, info PostInfo, r io.ReaderAt, size int64) (_ PostInit, err error) {
+    ctx, span := tracer.Start(ctx, "UseCase.UploadVideo", trace.WithAttributes(attribute.Int64("video_size", size)))
+    defer func() { endSpan(span, err) }()
+    src := VideoSource{Source: SourceFileUpload, VideoSize: size}
+    init, err := u.PublishVideo(ctx, accessToken, info, src)
+    if err != nil {
+        return PostInit{}, err
+    }
+    if err := u.client.UploadVideo(ctx, init, src, r); err != nil {
+        return init, fmt.Errorf("upload video: %w", err)
+    }
+    return init, nil
+}
+
+// PublishStatus fetches the current status of a post once.
+func (u *UseCase) PublishStatus(ctx context.Context, accessToken, publishID string) (_ PublishStatus, err error) {
+    ctx, span := tracer.Start(ctx, "UseCase.PublishStatus", trace.WithAttributes(attribute.String("publish_id", publishID)))
+    defer func() { endSpan(span, err) }()
+    return u.client.FetchPublishStatus(ctx, accessToken, publishID)
+}
+
+// WaitPublishStatus polls status/fetch until the post settles or ctx is done.
+// On ctx expiry the last observed status is returned together with ctx.Err().
+func (u *UseCase) WaitPublishStatus(ctx context.Context, accessToken, publishID string) (_ PublishStatus, err error) {
+    ctx, span := tracer.Start(ctx, "UseCase.WaitPublishStatus", trace.WithAttributes(attribute.String("publish_id", publishID)))
+    defer func() { endSpan(span, err) }()
+    ticker := time.NewTicker(u.pollInterval)
+    defer ticker.Stop()
+    for {
+        st, err := u.client.FetchPublishStatus(ctx, accessToken, publishID)
+        if err != nil {
+            return st, err
+        }
+        if st.Settled() {
+            return st, nil
+        }
+        select {
+        case <-ctx.Done():
+            return st, ctx.Err()
+        case <-ticker.C:
+        }
+    }
+}
+
+func validateVideoSource(src VideoSource) error {
+    switch src.Source {
+    case SourcePullFromURL:
+        if src.VideoURL == "" {
+            return fmt.Errorf("%w: video_url is required for %s", ErrInvalidPost, src.Source)
+        }
+    case SourceFileUpload:
+        if src.VideoSize <= 0 {
+            return fmt.Errorf("%w: video_size is required for %s", ErrInvalidPost, src.Source)
+        }
+        if src.ChunkSize < 0 || src.TotalChunkCount < 0 {
+            return fmt.Errorf("%w: chunk_size and total_chunk_count must not be negative", ErrInvalidPost)
+        }
+        if src.TotalChunkCount > 0 && src.ChunkSize == 0 {
+            return fmt.Errorf("%w: total_chunk_count requires chunk_size", ErrInvalidPost)
+        }
+    default:
+        return fmt.Errorf("%w: unsupported source %q", ErrInvalidPost, src.Source)
+    }
+    return nil
+}
+
+func validatePostInfo(info PostInfo, creator CreatorInfo) error {
+    if info.PrivacyLevel == "" {
+        return fmt.Errorf("%w: privacy_level is required", ErrInvalidPost)
+    }
+    allowed := false
+    for _, p := range creator.PrivacyLevelOptions {
+        if p == info.PrivacyLevel {
+            allowed = true
+            break
+        }
+    }
+    if !allowed {
+        return fmt.Errorf("%w: privacy_level %q not in %v", ErrInvalidPost, info.PrivacyLevel, creator.PrivacyLevelOptions)
+    }
+    if creator.CommentDisabled && !info.DisableComment {
+        return fmt.Errorf("%w: creator has comments disabled", ErrInvalidPost)
+    }
+    if creator.DuetDisabled && !info.DisableDuet {
+        return fmt.Errorf("%w: creator has duet disabled", ErrInvalidPost)
+    }
+    if creator.StitchDisabled && !info.DisableStitch {
+        return fmt.Errorf("%w: creator has stitch disabled", ErrInvalidPost)
+    }
+    return nil
+}
@@ -3,51 +3,212 @@ package oauth
 import (
     "context"
     "errors"
-    "reflect"
+    "io"
     "testing"
+    "time"
 )
 
 type mockClient struct{
     authURL   string
     token     Token
     exchErr   error
+    authReqs  []AuthParams
+    exchanges []ExchangeParams
+    profile   Profile
+    revoked   []string
+    info      CreatorInfo
+    inits     []VideoSource
+    photos    []PhotoPost
+    refreshed int
+    statuses  []PublishStatus
+    statusErr error
 }
 
-func (m *mockClient) AuthURL(state, redirectURI, scope string) string { return m.authURL }
-func (m *mockClient) Exchange(ctx context.Context, code, redirectURI string) (Token, error) { return m.token, m.exchErr }
-func (m *mockClient) GetUserInfo(ctx context.Context, accessToken string, fields []string) (map[string]any, error) { return map[string]any{"ok": true}, nil }
+func (m *mockClient) Name() string { return ProviderTikTok }
+func (m *mockClient) AuthURL(p AuthParams) string {
+    m.authReqs = append(m.authReqs, p)
+    return m.authURL
+}
+func (m *mockClient) Exchange(ctx context.Context, p ExchangeParams) (Token, error) {
+    m.exchanges = append(m.exchanges, p)
+    return m.token, m.exchErr
+}
+func (m *mockClient) Revoke(ctx context.Context, token string) error {
+    m.revoked = append(m.revoked, token)
+    return nil
+}
+func (m *mockClient) UserInfo(ctx context.Context, accessToken string) (Profile, error) { return m.profile, nil }
+func (m *mockClient) Refresh(ctx context.Context, refreshToken string) (Token, error) {
+    m.refreshed++
+    return Token{AccessToken: "fresh-" + refreshToken, RefreshToken: refreshToken}, nil
+}
+func (m *mockClient) QueryCreatorInfo(ctx context.Context, accessToken string) (CreatorInfo, error) { return m.info, nil }
+func (m *mockClient) InitVideoPost(ctx context.Context, accessToken string, info PostInfo, src VideoSource) (PostInit, error) {
+    m.inits = append(m.inits, src)
+    return PostInit{PublishID: "p1"}, nil
+}
+func (m *mockClient) UploadVideo(ctx context.Context, init PostInit, src VideoSource, r io.ReaderAt) error { return nil }
+func (m *mockClient) InitPhotoPost(ctx context.Context, accessToken string, post PhotoPost) (PostInit, error) {
+    m.photos = append(m.photos, post)
+    return PostInit{PublishID: "p2"}, nil
+}
+func (m *mockClient) FetchPublishStatus(ctx context.Context, accessToken, publishID string) (PublishStatus, error) {
+    if m.statusErr != nil {
+        return PublishStatus{}, m.statusErr
+    }
+    st := m.statuses[0]
+    if len(m.statuses) > 1 {
+        m.statuses = m.statuses[1:]
+    }
+    st.PublishID = publishID
+    return st, nil
+}
+
+type mockStore struct{
+    tokens map[string]Token
+}
+func (m *mockStore) Save(ctx context.Context, t Token) error {
+    if m.tokens != nil {
+        m.tokens[t.OpenID] = t
+    }
+    return nil
+}
+func (m *mockStore) TokenFor(ctx context.Context, provider, subject string) (Token, error) {
+    t, ok := m.tokens[subject]
+    if !ok {
+        return Token{}, ErrNotFound
+    }
+    return t, nil
+}
+func (m *mockStore) DeleteToken(ctx context.Context, provider, subject string) error {
+    delete(m.tokens, subject)
+    return nil
+}
+func (m *mockStore) TokenByAccessToken(ctx context.Context, provider, accessToken string) (Token, error) {
+    for _, t := range m.tokens {
+        if t.AccessToken == accessToken && (t.Provider == provider || t.Provider == "" && provider == ProviderTikTok) {
+            return t, nil
+        }
+    }
+    return Token{}, ErrNotFound
+}
 
-type mockStore struct{}
-func (m *mockStore) Save(ctx context.Context, t Token) error { return nil }
+func TestUseCase_PublishVideo_Validation(t *testing.T) {
+    mc := &mockClient{info: CreatorInfo{PrivacyLevelOptions: []string{"SELF_ONLY"}, DuetDisabled: true}}
+    uc := NewUseCase(mc, &mockStore{})
+    src := VideoSource{Source: SourcePullFromURL, VideoURL: "https://example/v.mp4"}
 
-func TestUseCase_LoginURL(t *testing.T) {
-    mc := &mockClient{authURL: "https://example/auth?x=y"}
-    uc := NewUseCase(mc, &mockStore{}, "user.info.basic")
-    got := uc.LoginURL("state", "https://cb")
-    if got != mc.authURL {
-        t.Fatalf("unexpected LoginURL: got=%s want=%s", got, mc.authURL)
+    cases := []struct {
+        name string
+        info PostInfo
+        src  VideoSource
+    }{
+        {"missing privacy", PostInfo{}, src},
+        {"privacy not offered", PostInfo{PrivacyLevel: "PUBLIC_TO_EVERYONE", DisableDuet: true}, src},
+        {"duet disabled by creator", PostInfo{PrivacyLevel: "SELF_ONLY"}, src},
+        {"missing video_url", PostInfo{PrivacyLevel: "SELF_ONLY", DisableDuet: true}, VideoSource{Source: SourcePullFromURL}},
+        {"unknown source", PostInfo{PrivacyLevel: "SELF_ONLY", DisableDuet: true}, VideoSource{Source: "FTP"}},
+        {"negative chunk_size", PostInfo{PrivacyLevel: "SELF_ONLY", DisableDuet: true}, VideoSource{Source: SourceFileUpload, VideoSize: 1024, ChunkSize: -1}},
+        {"count without chunk_size", PostInfo{PrivacyLevel: "SELF_ONLY", DisableDuet: true}, VideoSource{Source: SourceFileUpload, VideoSize: 1024, TotalChunkCount: 2}},
+    }
+    for _, tc := range cases {
+        if _, err := uc.PublishVideo(context.Background(), "tok", tc.info, tc.src); !errors.Is(err, ErrInvalidPost) {
+            t.Errorf("%s: expected ErrInvalidPost, got %v", tc.name, err)
+        }
+    }
+    if len(mc.inits) != 0 {
+        t.Fatalf("init must not be called for invalid posts")
+    }
+
+    if _, err := uc.PublishVideo(context.Background(), "tok", PostInfo{PrivacyLevel: "SELF_ONLY", DisableDuet: true}, src); err != nil {
+        t.Fatalf("unexpected error: %v", err)
     }
 }
 
-func TestUseCase_Callback_Success(t *testing.T) {
-    want := Token{AccessToken: "a", RefreshToken: "r", OpenID: "o", Scope: "s", TokenType: "Bearer", ExpiresIn: 1}
-    mc := &mockClient{token: want}
-    uc := NewUseCase(mc, &mockStore{}, "user.info.basic")
-    got, err := uc.Callback(context.Background(), "code", "https://cb")
+func TestUseCase_WaitPublishStatus(t *testing.T) {
+    mc := &mockClient{statuses: []PublishStatus{
+        {Status: StatusProcessingDownload},
+        {Status: StatusProcessingDownload},
+        {Status: StatusPublishComplete, PostIDs: []string{"123"}},
+    }}
+    uc := NewUseCase(mc, &mockStore{})
+    uc.pollInterval = time.Millisecond
+    st, err := uc.WaitPublishStatus(context.Background(), "tok", "p1")
     if err != nil {
         t.Fatalf("unexpected error: %v", err)
     }
-    if !reflect.DeepEqual(got, want) {
-        t.Fatalf("unexpected token: %#v", got)
+    if st.Status != StatusPublishComplete || st.PublishID != "p1" {
+        t.Fatalf("unexpected status: %#v", st)
     }
 }
 
-func TestUseCase_Callback_Error(t *testing.T) {
-    mc := &mockClient{exchErr: errors.New("boom")}
-    uc := NewUseCase(mc, &mockStore{}, "user.info.basic")
-    _, err := uc.Callback(context.Background(), "code", "https://cb")
-    if err == nil {
-        t.Fatalf("expected error")
+func TestUseCase_PublishPhotos_Validation(t *testing.T) {
+    mc := &mockClient{info: CreatorInfo{PrivacyLevelOptions: []string{"SELF_ONLY"}, CommentDisabled: true}}
+    uc := NewUseCase(mc, &mockStore{})
+    valid := PhotoPost{
+        PostInfo:    PostInfo{PrivacyLevel: "SELF_ONLY", DisableComment: true},
+        PhotoImages: []string{"https://example.com/1.jpg", "https://example.com/2.jpg"},
+    }
+
+    invalid := []func(p *PhotoPost){
+        func(p *PhotoPost) { p.PhotoImages = nil },
+        func(p *PhotoPost) { p.PhotoImages = []string{"ftp://example.com/1.jpg"} },
+        func(p *PhotoPost) { p.PhotoCoverIndex = 2 },
+        func(p *PhotoPost) { p.Title = string(make([]rune, 91)) },
+        func(p *PhotoPost) { p.DisableComment = false },
+    }
+    for i, mutate := range invalid {
+        p := valid
+        p.PhotoImages = append([]string(nil), valid.PhotoImages...)
+        mutate(&p)
+        if _, err := uc.PublishPhotos(context.Background(), "tok", p); !errors.Is(err, ErrInvalidPost) {
+            t.Errorf("case %d: expected ErrInvalidPost, got %v", i, err)
+        }
+    }
+    if len(mc.photos) != 0 {
+        t.Fatalf("init must not be called for invalid posts")
+    }
+
+    init, err := uc.PublishPhotos(context.Background(), "tok", valid)
+    if err != nil || init.PublishID != "p2" {
+        t.Fatalf("unexpected result: %#v %v", init, err)
     }
 }
 
+type refreshOutcomes []string
+
+func (r *refreshOutcomes) ObserveRefresh(outcome string) { *r = append(*r, outcome) }
+
+func TestUseCase_FreshToken_ObservesRefresh(t *testing.T) {
+    now := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+    st := &mockStore{tokens: map[string]Token{
+        "live":    {OpenID: "live", AccessToken: "a", ExpiresAt: now.Add(time.Hour)},
+        "expired": {OpenID: "expired", AccessToken: "b", RefreshToken: "r", ExpiresAt: now.Add(time.Minute)},
+        "stuck":   {OpenID: "stuck", AccessToken: "c", ExpiresAt: now.Add(-time.Minute)},
+    }}
+    uc := NewUseCase(&mockClient{}, st)
+    uc.now = func() time.Time { return now }
+    var got refreshOutcomes
+    uc.SetRefreshObserver(&got)
+
+    for _, id := range []string{"live", "expired", "stuck"} {
+        uc.FreshToken(context.Background(), id)
+    }
+    if len(got) != 2 || got[0] != RefreshOK || got[1] != RefreshNoRefreshToken {
+        t.Fatalf("unexpected refresh outcomes %v", got)
+    }
+}
+
+func TestUseCase_OwnerOf_OnlyTikTok(t *testing.T) {
+    ms := &mockStore{tokens: map[string]Token{
+        "alice": {OpenID: "alice", AccessToken: "act.tiktok"},
+        "bob":   {Provider: "google", OpenID: "bob", AccessToken: "ya29.google"},
+    }}
+    uc := NewUseCase(&mockClient{}, ms)
+    if tok, err := uc.OwnerOf(context.Background(), "act.tiktok"); err != nil || tok.OpenID != "alice" {
+        t.Fatalf("tiktok token: %v %v", tok, err)
+    }
+    if _, err := uc.OwnerOf(context.Background(), "ya29.google"); !errors.Is(err, ErrUnknownToken) {
+        t.Fatalf("expected ErrUnknownToken for another provider's token, got %v", err)
+    }
+}
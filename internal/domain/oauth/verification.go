@@ -0,0 +1,156 @@
+package oauth
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+)
+
+// ErrInvalidVerificationFile is returned for paths and contents that match
+// none of the supported verification formats.
+var ErrInvalidVerificationFile = errors.New("invalid verification file")
+
+// maxVerificationFileSize bounds uploaded verification files.
+const maxVerificationFileSize = 64 << 10
+
+// VerificationFile is a domain-verification file served at Path, such as
+// "/tiktokXXXX.txt" or "/.well-known/apple-app-site-association".
+type VerificationFile struct {
+    Path        string    `json:"path"`
+    Format      string    `json:"format"`
+    ContentType string    `json:"content_type"`
+    Content     string    `json:"content"`
+    UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// verificationFormat is one kind of verification file.
+type verificationFormat struct {
+    name        string
+    path        *regexp.Regexp
+    contentType string
+    // check validates the content for the path.
+    check func(path, content string) error
+}
+
+var verificationFormats = []verificationFormat{
+    {
+        // TikTok: https://developers.tiktok.com URL prefix verification.
+        name:        "tiktok",
+        path:        regexp.MustCompile(`^/tiktok([A-Za-z0-9]+)\.txt$`),
+        contentType: "text/plain; charset=utf-8",
+        check: func(path, content string) error {
+            token := strings.TrimSuffix(strings.TrimPrefix(path, "/tiktok"), ".txt")
+            if strings.TrimSpace(content) != "tiktok-developers-site-verification="+token {
+                return fmt.Errorf("content must be tiktok-developers-site-verification=%s", token)
+            }
+            return nil
+        },
+    },
+    {
+        // Google Search Console HTML file verification.
+        name:        "google",
+        path:        regexp.MustCompile(`^/google[0-9a-f]+\.html$`),
+        contentType: "text/html; charset=utf-8",
+        check: func(path, content string) error {
+            if strings.TrimSpace(content) != "google-site-verification: "+path[1:] {
+                return fmt.Errorf("content must be google-site-verification: %s", path[1:])
+            }
+            return nil
+        },
+    },
+    {
+        // Apple universal links and shared web credentials.
+        name:        "apple-app-site-association",
+        path:        regexp.MustCompile(`^/(\.well-known/)?apple-app-site-association$`),
+        contentType: "application/json",
+        check:       jsonOf[map[string]any],
+    },
+    {
+        // Android App Links (Digital Asset Links).
+        name:        "assetlinks",
+        path:        regexp.MustCompile(`^/\.well-known/assetlinks\.json$`),
+        contentType: "application/json",
+        check:       jsonOf[[]any],
+    },
+}
+
+// jsonOf checks that content is a JSON value of type T.
+func jsonOf[T any](_, content string) error {
+    var v T
+    if err := json.Unmarshal([]byte(content), &v); err != nil {
+        return fmt.Errorf("content must be JSON: %v", err)
+    }
+    return nil
+}
+
+// ParseVerificationFile validates a file for path and fills in its format
+// and content type.
+func ParseVerificationFile(path, content string) (VerificationFile, error) {
+    if len(content) > maxVerificationFileSize {
+        return VerificationFile{}, fmt.Errorf("%w: larger than %d bytes", ErrInvalidVerificationFile, maxVerificationFileSize)
+    }
+    for _, f := range verificationFormats {
+        if !f.path.MatchString(path) {
+            continue
+        }
+        if err := f.check(path, content); err != nil {
+            return VerificationFile{}, fmt.Errorf("%w: %v", ErrInvalidVerificationFile, err)
+        }
+        return VerificationFile{Path: path, Format: f.name, ContentType: f.contentType, Content: content}, nil
+    }
+    return VerificationFile{}, fmt.Errorf("%w: unsupported path %q", ErrInvalidVerificationFile, path)
+}
+
+// VerificationStore persists verification files by path.
+type VerificationStore interface {
+    SaveVerificationFile(ctx context.Context, f VerificationFile) error
+    GetVerificationFile(ctx context.Context, path string) (VerificationFile, error)
+    ListVerificationFiles(ctx context.Context) ([]VerificationFile, error)
+    DeleteVerificationFile(ctx context.Context, path string) error
+}
+
+// VerificationFiles manages the domain-verification files that are
+// uploaded at runtime instead of being deployed with the site.
+type VerificationFiles struct {
+    store VerificationStore
+    now   func() time.Time
+}
+
+func NewVerificationFiles(store VerificationStore) *VerificationFiles {
+    return &VerificationFiles{store: store, now: time.Now}
+}
+
+// Put validates and stores a file, replacing the one at the same path.
+func (v *VerificationFiles) Put(ctx context.Context, path, content string) (VerificationFile, error) {
+    f, err := ParseVerificationFile(path, content)
+    if err != nil {
+        return VerificationFile{}, err
+    }
+    f.UpdatedAt = v.now()
+    return f, v.store.SaveVerificationFile(ctx, f)
+}
+
+// Get returns the file at path or ErrNotFound.
+func (v *VerificationFiles) Get(ctx context.Context, path string) (VerificationFile, error) {
+    return v.store.GetVerificationFile(ctx, path)
+}
+
+// List returns all files ordered by path.
+func (v *VerificationFiles) List(ctx context.Context) ([]VerificationFile, error) {
+    files, err := v.store.ListVerificationFiles(ctx)
+    if err != nil {
+        return nil, err
+    }
+    sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+    return files, nil
+}
+
+// Delete removes the file at path; unknown paths are ErrNotFound.
+func (v *VerificationFiles) Delete(ctx context.Context, path string) error {
+    return v.store.DeleteVerificationFile(ctx, path)
+}
@@ -0,0 +1,39 @@
+package oauth
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestParseVerificationFile(t *testing.T) {
+    cases := []struct {
+        path, content, format string
+    }{
+        {"/tiktokAbC123.txt", "tiktok-developers-site-verification=AbC123\n", "tiktok"},
+        {"/google0123abcd.html", "google-site-verification: google0123abcd.html", "google"},
+        {"/.well-known/apple-app-site-association", `{"applinks": {"details": []}}`, "apple-app-site-association"},
+        {"/apple-app-site-association", `{"webcredentials": {"apps": []}}`, "apple-app-site-association"},
+        {"/.well-known/assetlinks.json", `[{"relation": ["delegate_permission/common.handle_all_urls"]}]`, "assetlinks"},
+    }
+    for _, tc := range cases {
+        f, err := ParseVerificationFile(tc.path, tc.content)
+        if err != nil || f.Format != tc.format {
+            t.Errorf("%s: format=%q err=%v", tc.path, f.Format, err)
+        }
+    }
+
+    bad := []struct{ path, content string }{
+        {"/tiktokAbC123.txt", "tiktok-developers-site-verification=Other"},
+        {"/google0123abcd.html", "<html>"},
+        {"/.well-known/apple-app-site-association", `[]`},
+        {"/.well-known/assetlinks.json", `{}`},
+        {"/insights", "x"},
+        {"/tiktok../x.txt", "x"},
+        {"/.well-known/security.txt", "x"},
+    }
+    for _, tc := range bad {
+        if _, err := ParseVerificationFile(tc.path, tc.content); !errors.Is(err, ErrInvalidVerificationFile) {
+            t.Errorf("%s %q: expected ErrInvalidVerificationFile, got %v", tc.path, tc.content, err)
+        }
+    }
+}
@@ -0,0 +1,378 @@
+// Package oidc implements oauth.Provider for any standards-compliant
+// OAuth2 or OpenID Connect server described by configuration.
+package oidc
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+    "time"
+
+    doauth "tiktok-oauth/internal/domain/oauth"
+)
+
+// Auth styles for presenting client credentials at the token endpoint.
+const (
+    AuthStyleBasic = "basic" // client_secret_basic (default)
+    AuthStylePost  = "post"  // client_secret_post
+)
+
+// ErrRevokeUnsupported is returned by Revoke when no revocation endpoint
+// is configured or discovered.
+var ErrRevokeUnsupported = errors.New("provider has no revocation endpoint")
+
+// Config describes one provider. Endpoints set explicitly override the
+// ones found through DiscoveryURL.
+type Config struct {
+    Name         string   `json:"name"`
+    ClientID     string   `json:"client_id"`
+    ClientSecret string   `json:"client_secret"`
+    RedirectURI  string   `json:"redirect_uri"`
+    Scopes       []string `json:"scopes"`
+    // DiscoveryURL is an OIDC .well-known/openid-configuration URL.
+    DiscoveryURL string `json:"discovery_url"`
+    AuthURL      string `json:"auth_url"`
+    TokenURL     string `json:"token_url"`
+    UserInfoURL  string `json:"userinfo_url"`
+    RevokeURL    string `json:"revoke_url"`
+    // AuthStyle is "basic" or "post".
+    AuthStyle string `json:"auth_style"`
+    PKCE      bool   `json:"pkce"`
+    // Claims maps profile fields to userinfo claims; dotted paths reach
+    // into nested objects. Unset fields use the OIDC standard claims.
+    Claims ClaimMap `json:"claims"`
+}
+
+// ClaimMap names the userinfo claim of each profile field.
+type ClaimMap struct {
+    Subject     string `json:"subject"`
+    DisplayName string `json:"display_name"`
+    AvatarURL   string `json:"avatar_url"`
+    Email       string `json:"email"`
+}
+
+// standardClaims are the OIDC claims used when the mapping is empty.
+var standardClaims = ClaimMap{Subject: "sub", DisplayName: "name", AvatarURL: "picture", Email: "email"}
+
+// ParseConfigs decodes a JSON array of provider configs. Client
+// credentials may reference environment variables as ${NAME}.
+func ParseConfigs(b []byte) ([]Config, error) {
+    var cfgs []Config
+    if err := json.Unmarshal(b, &cfgs); err != nil {
+        return nil, fmt.Errorf("decode provider configs: %w", err)
+    }
+    for i := range cfgs {
+        cfgs[i].ClientID = os.ExpandEnv(cfgs[i].ClientID)
+        cfgs[i].ClientSecret = os.ExpandEnv(cfgs[i].ClientSecret)
+    }
+    return cfgs, nil
+}
+
+// Provider is a config-driven oauth.Provider.
+type Provider struct {
+    cfg  Config
+    http *http.Client
+}
+
+// New validates cfg and resolves its endpoints, fetching the discovery
+// document when DiscoveryURL is set. hc may be nil.
+func New(ctx context.Context, cfg Config, hc *http.Client) (*Provider, error) {
+    if hc == nil {
+        hc = &http.Client{Timeout: 10 * time.Second}
+    }
+    p := &Provider{cfg: cfg, http: hc}
+    if cfg.Name == "" || cfg.Name == doauth.ProviderTikTok {
+        return nil, fmt.Errorf("provider name %q is empty or reserved", cfg.Name)
+    }
+    if cfg.DiscoveryURL != "" {
+        if err := p.discover(ctx); err != nil {
+            return nil, fmt.Errorf("provider %s: %w", cfg.Name, err)
+        }
+    }
+    switch p.cfg.AuthStyle {
+    case "":
+        p.cfg.AuthStyle = AuthStyleBasic
+    case AuthStyleBasic, AuthStylePost:
+    default:
+        return nil, fmt.Errorf("provider %s: unknown auth_style %q", cfg.Name, cfg.AuthStyle)
+    }
+    if p.cfg.ClientID == "" || p.cfg.RedirectURI == "" {
+        return nil, fmt.Errorf("provider %s: client_id and redirect_uri are required", cfg.Name)
+    }
+    if p.cfg.AuthURL == "" || p.cfg.TokenURL == "" || p.cfg.UserInfoURL == "" {
+        return nil, fmt.Errorf("provider %s: auth_url, token_url and userinfo_url are required", cfg.Name)
+    }
+    p.cfg.Claims = p.cfg.Claims.withDefaults()
+    return p, nil
+}
+
+// Registration returns the registry entry for p.
+func (p *Provider) Registration() doauth.Registration {
+    return doauth.Registration{
+        Provider:    p,
+        RedirectURI: p.cfg.RedirectURI,
+        Scope:       strings.Join(p.cfg.Scopes, " "),
+        UsePKCE:     p.cfg.PKCE,
+    }
+}
+
+func (p *Provider) Name() string { return p.cfg.Name }
+
+func (p *Provider) AuthURL(ap doauth.AuthParams) string {
+    v := url.Values{}
+    v.Set("client_id", p.cfg.ClientID)
+    v.Set("response_type", "code")
+    v.Set("redirect_uri", ap.RedirectURI)
+    if ap.Scope != "" {
+        v.Set("scope", ap.Scope)
+    }
+    if ap.State != "" {
+        v.Set("state", ap.State)
+    }
+    if ap.CodeChallenge != "" {
+        v.Set("code_challenge", ap.CodeChallenge)
+        v.Set("code_challenge_method", "S256")
+    }
+    sep := "?"
+    if strings.Contains(p.cfg.AuthURL, "?") {
+        sep = "&"
+    }
+    return p.cfg.AuthURL + sep + v.Encode()
+}
+
+func (p *Provider) Exchange(ctx context.Context, ep doauth.ExchangeParams) (doauth.Token, error) {
+    form := url.Values{}
+    form.Set("grant_type", "authorization_code")
+    form.Set("code", ep.Code)
+    form.Set("redirect_uri", ep.RedirectURI)
+    if ep.CodeVerifier != "" {
+        form.Set("code_verifier", ep.CodeVerifier)
+    }
+    return p.tokenRequest(ctx, form)
+}
+
+func (p *Provider) Refresh(ctx context.Context, refreshToken string) (doauth.Token, error) {
+    form := url.Values{}
+    form.Set("grant_type", "refresh_token")
+    form.Set("refresh_token", refreshToken)
+    tok, err := p.tokenRequest(ctx, form)
+    if err == nil && tok.RefreshToken == "" {
+        // Servers may keep the refresh token unchanged without echoing it.
+        tok.RefreshToken = refreshToken
+    }
+    return tok, err
+}
+
+// Revoke revokes a token per RFC 7009.
+func (p *Provider) Revoke(ctx context.Context, token string) error {
+    if p.cfg.RevokeURL == "" {
+        return ErrRevokeUnsupported
+    }
+    form := url.Values{}
+    form.Set("token", token)
+    _, err := p.post(ctx, p.cfg.RevokeURL, form)
+    return err
+}
+
+// UserInfo fetches the userinfo endpoint and applies the claim mapping.
+func (p *Provider) UserInfo(ctx context.Context, accessToken string) (doauth.Profile, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.UserInfoURL, nil)
+    if err != nil {
+        return doauth.Profile{}, err
+    }
+    req.Header.Set("Authorization", "Bearer "+accessToken)
+    req.Header.Set("Accept", "application/json")
+    body, err := p.do(req)
+    if err != nil {
+        return doauth.Profile{}, fmt.Errorf("userinfo: %w", err)
+    }
+    claims, err := decodeObject(body)
+    if err != nil {
+        return doauth.Profile{}, fmt.Errorf("decode userinfo: %w", err)
+    }
+    prof := doauth.Profile{
+        Provider:    p.cfg.Name,
+        Subject:     claimString(claims, p.cfg.Claims.Subject),
+        DisplayName: claimString(claims, p.cfg.Claims.DisplayName),
+        AvatarURL:   claimString(claims, p.cfg.Claims.AvatarURL),
+        Email:       claimString(claims, p.cfg.Claims.Email),
+        Raw:         claims,
+    }
+    if prof.Subject == "" {
+        return doauth.Profile{}, fmt.Errorf("userinfo has no %q claim", p.cfg.Claims.Subject)
+    }
+    return prof, nil
+}
+
+func (p *Provider) tokenRequest(ctx context.Context, form url.Values) (doauth.Token, error) {
+    body, err := p.post(ctx, p.cfg.TokenURL, form)
+    if err != nil {
+        return doauth.Token{}, fmt.Errorf("token request: %w", err)
+    }
+    var raw struct {
+        AccessToken  string      `json:"access_token"`
+        RefreshToken string      `json:"refresh_token"`
+        TokenType    string      `json:"token_type"`
+        Scope        string      `json:"scope"`
+        ExpiresIn    json.Number `json:"expires_in"`
+        Error        string      `json:"error"`
+        ErrorDesc    string      `json:"error_description"`
+    }
+    if err := json.Unmarshal(body, &raw); err != nil {
+        return doauth.Token{}, fmt.Errorf("decode token response: %w", err)
+    }
+    // Some servers (GitHub) report errors with status 200.
+    if raw.Error != "" {
+        return doauth.Token{}, fmt.Errorf("token request: %s: %s", raw.Error, raw.ErrorDesc)
+    }
+    if raw.AccessToken == "" {
+        return doauth.Token{}, errors.New("token response has no access_token")
+    }
+    tok := doauth.Token{
+        AccessToken:  raw.AccessToken,
+        RefreshToken: raw.RefreshToken,
+        TokenType:    raw.TokenType,
+        Scope:        raw.Scope,
+        Provider:     p.cfg.Name,
+    }
+    if n, err := raw.ExpiresIn.Int64(); err == nil && n > 0 {
+        tok.ExpiresIn = n
+        tok.ExpiresAt = time.Now().Add(time.Duration(n) * time.Second)
+    }
+    return tok, nil
+}
+
+// post sends a form with the client credentials in the configured style.
+func (p *Provider) post(ctx context.Context, endpoint string, form url.Values) ([]byte, error) {
+    if p.cfg.AuthStyle == AuthStylePost {
+        form.Set("client_id", p.cfg.ClientID)
+        if p.cfg.ClientSecret != "" {
+            form.Set("client_secret", p.cfg.ClientSecret)
+        }
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    req.Header.Set("Accept", "application/json")
+    if p.cfg.AuthStyle == AuthStyleBasic {
+        // RFC 6749 2.3.1: credentials are form-encoded before basic auth.
+        req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+    }
+    return p.do(req)
+}
+
+func (p *Provider) do(req *http.Request) ([]byte, error) {
+    resp, err := p.http.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+    if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+        return nil, fmt.Errorf("status=%d body=%s", resp.StatusCode, trunc(body, 2048))
+    }
+    return body, nil
+}
+
+// discover fills unset endpoints from the OIDC discovery document.
+func (p *Provider) discover(ctx context.Context) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.DiscoveryURL, nil)
+    if err != nil {
+        return err
+    }
+    body, err := p.do(req)
+    if err != nil {
+        return fmt.Errorf("discovery: %w", err)
+    }
+    var doc struct {
+        AuthorizationEndpoint string   `json:"authorization_endpoint"`
+        TokenEndpoint         string   `json:"token_endpoint"`
+        UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+        RevocationEndpoint    string   `json:"revocation_endpoint"`
+        TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+    }
+    if err := json.Unmarshal(body, &doc); err != nil {
+        return fmt.Errorf("decode discovery document: %w", err)
+    }
+    setDefault(&p.cfg.AuthURL, doc.AuthorizationEndpoint)
+    setDefault(&p.cfg.TokenURL, doc.TokenEndpoint)
+    setDefault(&p.cfg.UserInfoURL, doc.UserinfoEndpoint)
+    setDefault(&p.cfg.RevokeURL, doc.RevocationEndpoint)
+    // Without an explicit style, follow the server when it only accepts post.
+    if p.cfg.AuthStyle == "" && len(doc.TokenAuthMethods) > 0 && !contains(doc.TokenAuthMethods, "client_secret_basic") && contains(doc.TokenAuthMethods, "client_secret_post") {
+        p.cfg.AuthStyle = AuthStylePost
+    }
+    return nil
+}
+
+func (m ClaimMap) withDefaults() ClaimMap {
+    setDefault(&m.Subject, standardClaims.Subject)
+    setDefault(&m.DisplayName, standardClaims.DisplayName)
+    setDefault(&m.AvatarURL, standardClaims.AvatarURL)
+    setDefault(&m.Email, standardClaims.Email)
+    return m
+}
+
+func decodeObject(b []byte) (map[string]any, error) {
+    dec := json.NewDecoder(bytes.NewReader(b))
+    // Keep numeric IDs (GitHub "id") exact.
+    dec.UseNumber()
+    var m map[string]any
+    if err := dec.Decode(&m); err != nil {
+        return nil, err
+    }
+    return m, nil
+}
+
+// claimString resolves a dotted path and renders scalars as strings.
+func claimString(claims map[string]any, path string) string {
+    var v any = claims
+    for _, key := range strings.Split(path, ".") {
+        m, ok := v.(map[string]any)
+        if !ok {
+            return ""
+        }
+        v = m[key]
+    }
+    switch t := v.(type) {
+    case string:
+        return t
+    case json.Number:
+        return t.String()
+    case bool:
+        return fmt.Sprint(t)
+    default:
+        return ""
+    }
+}
+
+func setDefault(dst *string, v string) {
+    if *dst == "" {
+        *dst = v
+    }
+}
+
+func contains(list []string, s string) bool {
+    for _, v := range list {
+        if v == s {
+            return true
+        }
+    }
+    return false
+}
+
+func trunc(b []byte, n int) string {
+    if len(b) <= n {
+        return string(b)
+    }
+    return string(b[:n]) + "..."
+}
@@ -0,0 +1,134 @@
+package oidc
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+
+    doauth "tiktok-oauth/internal/domain/oauth"
+)
+
+func TestProvider_DiscoveryExchangeUserInfo(t *testing.T) {
+    var srv *httptest.Server
+    srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/.well-known/openid-configuration":
+            json.NewEncoder(w).Encode(map[string]any{
+                "authorization_endpoint": srv.URL + "/authorize",
+                "token_endpoint":         srv.URL + "/token",
+                "userinfo_endpoint":      srv.URL + "/userinfo",
+            })
+        case "/token":
+            user, pass, ok := r.BasicAuth()
+            if !ok || user != "cid" || pass != "sec" {
+                w.WriteHeader(http.StatusUnauthorized)
+                return
+            }
+            r.ParseForm()
+            if r.Form.Get("code") != "c1" || r.Form.Get("code_verifier") != "v1" || r.Form.Get("client_secret") != "" {
+                json.NewEncoder(w).Encode(map[string]any{"error": "invalid_grant"})
+                return
+            }
+            json.NewEncoder(w).Encode(map[string]any{"access_token": "at", "refresh_token": "rt", "token_type": "Bearer", "expires_in": 3600})
+        case "/userinfo":
+            if r.Header.Get("Authorization") != "Bearer at" {
+                w.WriteHeader(http.StatusUnauthorized)
+                return
+            }
+            w.Write([]byte(`{"id": 12345678901, "login": "octo", "profile": {"avatar": "https://a/x.png"}}`))
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    defer srv.Close()
+
+    ctx := context.Background()
+    p, err := New(ctx, Config{
+        Name:         "github",
+        ClientID:     "cid",
+        ClientSecret: "sec",
+        RedirectURI:  "https://app/cb",
+        Scopes:       []string{"read:user", "user:email"},
+        DiscoveryURL: srv.URL + "/.well-known/openid-configuration",
+        PKCE:         true,
+        Claims:       ClaimMap{Subject: "id", DisplayName: "login", AvatarURL: "profile.avatar"},
+    }, srv.Client())
+    if err != nil {
+        t.Fatalf("new: %v", err)
+    }
+
+    reg := p.Registration()
+    if reg.Scope != "read:user user:email" || !reg.UsePKCE {
+        t.Fatalf("unexpected registration: %#v", reg)
+    }
+    u, _ := url.Parse(p.AuthURL(doauth.AuthParams{State: "s", RedirectURI: reg.RedirectURI, Scope: reg.Scope, CodeChallenge: "ch"}))
+    q := u.Query()
+    if !strings.HasSuffix(u.Path, "/authorize") || q.Get("client_id") != "cid" || q.Get("code_challenge_method") != "S256" || q.Get("state") != "s" {
+        t.Fatalf("unexpected auth URL: %s", u)
+    }
+
+    tok, err := p.Exchange(ctx, doauth.ExchangeParams{Code: "c1", RedirectURI: reg.RedirectURI, CodeVerifier: "v1"})
+    if err != nil {
+        t.Fatalf("exchange: %v", err)
+    }
+    if tok.AccessToken != "at" || tok.ExpiresIn != 3600 || tok.ExpiresAt.IsZero() || tok.Provider != "github" {
+        t.Fatalf("unexpected token: %#v", tok)
+    }
+    if _, err := p.Exchange(ctx, doauth.ExchangeParams{Code: "bad"}); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+        t.Fatalf("expected invalid_grant, got %v", err)
+    }
+
+    prof, err := p.UserInfo(ctx, tok.AccessToken)
+    if err != nil {
+        t.Fatalf("userinfo: %v", err)
+    }
+    if prof.Subject != "12345678901" || prof.DisplayName != "octo" || prof.AvatarURL != "https://a/x.png" || prof.Provider != "github" {
+        t.Fatalf("unexpected profile: %#v", prof)
+    }
+
+    if err := p.Revoke(ctx, "at"); err != ErrRevokeUnsupported {
+        t.Fatalf("expected ErrRevokeUnsupported, got %v", err)
+    }
+}
+
+func TestProvider_AuthStylePost(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        r.ParseForm()
+        if _, _, ok := r.BasicAuth(); ok || r.PostForm.Get("client_id") != "cid" || r.PostForm.Get("client_secret") != "sec" {
+            w.WriteHeader(http.StatusUnauthorized)
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]any{"access_token": "at2"})
+    }))
+    defer srv.Close()
+
+    p, err := New(context.Background(), Config{
+        Name: "idp", ClientID: "cid", ClientSecret: "sec", RedirectURI: "https://app/cb",
+        AuthURL: srv.URL, TokenURL: srv.URL, UserInfoURL: srv.URL, AuthStyle: AuthStylePost,
+    }, srv.Client())
+    if err != nil {
+        t.Fatalf("new: %v", err)
+    }
+    tok, err := p.Refresh(context.Background(), "rt")
+    if err != nil || tok.AccessToken != "at2" || tok.RefreshToken != "rt" {
+        t.Fatalf("unexpected refresh: %#v err=%v", tok, err)
+    }
+}
+
+func TestNew_Validation(t *testing.T) {
+    cases := []Config{
+        {Name: "tiktok", ClientID: "c", RedirectURI: "r", AuthURL: "a", TokenURL: "t", UserInfoURL: "u"},
+        {Name: "x", RedirectURI: "r", AuthURL: "a", TokenURL: "t", UserInfoURL: "u"},
+        {Name: "x", ClientID: "c", RedirectURI: "r", AuthURL: "a", TokenURL: "t"},
+        {Name: "x", ClientID: "c", RedirectURI: "r", AuthURL: "a", TokenURL: "t", UserInfoURL: "u", AuthStyle: "jwt"},
+    }
+    for i, cfg := range cases {
+        if _, err := New(context.Background(), cfg, nil); err == nil {
+            t.Errorf("case %d: expected error", i)
+        }
+    }
+}
@@ -2,20 +2,771 @@ package store
 
 import (
     "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "slices"
+    "sort"
     "sync"
+    "time"
 
     doauth "tiktok-oauth/internal/domain/oauth"
 )
 
+// Memory keeps everything in process memory. When opened with Open it
+// also writes a JSON snapshot after every mutation and reloads it on
+// start, which is enough persistence for a single instance.
 type Memory struct {
-    mu    sync.Mutex
-    token doauth.Token
+    mu        sync.Mutex
+    tokens    map[string]doauth.Token
+    publishes map[string]doauth.PublishRecord
+    scheduled map[string]doauth.ScheduledPost
+    states    map[string]doauth.AuthState
+    sessions  map[string]doauth.Session
+    users     map[string]doauth.User
+    conns     map[string]doauth.Connection
+    appCodes  map[string]doauth.AppCode
+    devices   map[string]doauth.DeviceGrant
+    qrLogins  map[string]doauth.QRLogin
+    legal     map[string][]doauth.LegalAcceptance // by user ID
+    verify    map[string]doauth.VerificationFile  // by path
+    path      string
+    observer  Observer
 }
 
+// Observer receives the duration of every store operation, named after
+// the Memory method ("Save", "GetSession"), lock wait and snapshot write
+// included.
+type Observer interface {
+    ObserveStore(op string, d time.Duration)
+}
+
+// snapshot is the on-disk layout of a persisted Memory.
+type snapshot struct {
+    Tokens    map[string]doauth.Token             `json:"tokens"`
+    Publishes map[string]doauth.PublishRecord     `json:"publishes"`
+    Scheduled map[string]doauth.ScheduledPost     `json:"scheduled"`
+    States    map[string]doauth.AuthState         `json:"states"`
+    Sessions  map[string]doauth.Session           `json:"sessions"`
+    Users     map[string]doauth.User              `json:"users"`
+    Conns     map[string]doauth.Connection        `json:"connections"`
+    AppCodes  map[string]doauth.AppCode           `json:"app_codes"`
+    Devices   map[string]doauth.DeviceGrant       `json:"device_grants"`
+    QRLogins  map[string]doauth.QRLogin           `json:"qr_logins"`
+    Legal     map[string][]doauth.LegalAcceptance `json:"legal_acceptances"`
+    Verify    map[string]doauth.VerificationFile  `json:"verification_files"`
+}
+
+// Open returns a Memory persisted to path, loading an existing snapshot.
+// An empty path yields a purely in-memory store.
+func Open(path string) (*Memory, error) {
+    m := &Memory{path: path}
+    if path == "" {
+        return m, nil
+    }
+    b, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return m, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    var snap snapshot
+    if err := json.Unmarshal(b, &snap); err != nil {
+        return nil, fmt.Errorf("decode store snapshot %s: %w", path, err)
+    }
+    // Older snapshots keyed tokens by open_id only.
+    m.tokens = make(map[string]doauth.Token, len(snap.Tokens))
+    for _, t := range snap.Tokens {
+        m.tokens[tokenKey(t.Provider, t.OpenID)] = t
+    }
+    m.publishes = snap.Publishes
+    m.scheduled = snap.Scheduled
+    m.states = snap.States
+    m.sessions = snap.Sessions
+    m.users = snap.Users
+    m.conns = snap.Conns
+    m.appCodes = snap.AppCodes
+    m.devices = snap.Devices
+    m.qrLogins = snap.QRLogins
+    m.legal = snap.Legal
+    m.verify = snap.Verify
+    return m, nil
+}
+
+// SetObserver reports the duration of every operation to o; call it
+// before the store is shared.
+func (m *Memory) SetObserver(o Observer) { m.observer = o }
+
+func (m *Memory) observe(op string, start time.Time) {
+    if m.observer != nil {
+        m.observer.ObserveStore(op, time.Since(start))
+    }
+}
+
+// tokenKey identifies a token by provider and subject; tokens saved before
+// providers existed belong to TikTok.
+func tokenKey(provider, subject string) string {
+    if provider == "" {
+        provider = doauth.ProviderTikTok
+    }
+    return provider + "|" + subject
+}
+
+// Save stores the token of its owner (provider and open_id), replacing
+// older ones.
 func (m *Memory) Save(ctx context.Context, t doauth.Token) error {
+    defer m.observe("Save", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.tokens == nil {
+        m.tokens = map[string]doauth.Token{}
+    }
+    m.tokens[tokenKey(t.Provider, t.OpenID)] = t
+    return m.flushLocked()
+}
+
+func (m *Memory) TokenFor(ctx context.Context, provider, subject string) (doauth.Token, error) {
+    defer m.observe("TokenFor", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    t, ok := m.tokens[tokenKey(provider, subject)]
+    if !ok {
+        return doauth.Token{}, doauth.ErrNotFound
+    }
+    return t, nil
+}
+
+func (m *Memory) TokenByAccessToken(ctx context.Context, provider, accessToken string) (doauth.Token, error) {
+    defer m.observe("TokenByAccessToken", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    for k, t := range m.tokens {
+        if accessToken != "" && t.AccessToken == accessToken && k == tokenKey(provider, t.OpenID) {
+            return t, nil
+        }
+    }
+    return doauth.Token{}, doauth.ErrNotFound
+}
+
+func (m *Memory) DeleteToken(ctx context.Context, provider, subject string) error {
+    defer m.observe("DeleteToken", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    key := tokenKey(provider, subject)
+    if _, ok := m.tokens[key]; !ok {
+        return nil
+    }
+    delete(m.tokens, key)
+    return m.flushLocked()
+}
+
+func (m *Memory) SavePublish(ctx context.Context, r doauth.PublishRecord) error {
+    defer m.observe("SavePublish", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.publishes == nil {
+        m.publishes = map[string]doauth.PublishRecord{}
+    }
+    m.publishes[r.PublishID] = r
+    return m.flushLocked()
+}
+
+func (m *Memory) GetPublish(ctx context.Context, publishID string) (doauth.PublishRecord, error) {
+    defer m.observe("GetPublish", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    r, ok := m.publishes[publishID]
+    if !ok {
+        return doauth.PublishRecord{}, doauth.ErrNotFound
+    }
+    return r, nil
+}
+
+func (m *Memory) PendingPublishes(ctx context.Context) ([]doauth.PublishRecord, error) {
+    defer m.observe("PendingPublishes", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    var out []doauth.PublishRecord
+    for _, r := range m.publishes {
+        if r.Pending() {
+            out = append(out, r)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+    return out, nil
+}
+
+// CreateScheduled inserts p unless the owner already has a post with the
+// same idempotency key, in which case the existing post is returned.
+func (m *Memory) CreateScheduled(ctx context.Context, p doauth.ScheduledPost) (doauth.ScheduledPost, bool, error) {
+    defer m.observe("CreateScheduled", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    for _, existing := range m.scheduled {
+        if existing.OpenID == p.OpenID && existing.IdempotencyKey == p.IdempotencyKey {
+            return existing, false, nil
+        }
+    }
+    if m.scheduled == nil {
+        m.scheduled = map[string]doauth.ScheduledPost{}
+    }
+    m.scheduled[p.ID] = p
+    return p, true, m.flushLocked()
+}
+
+// CancelScheduled cancels the owner's post if it is still scheduled.
+func (m *Memory) CancelScheduled(ctx context.Context, id, openID string, now time.Time) (doauth.ScheduledPost, error) {
+    defer m.observe("CancelScheduled", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    p, ok := m.scheduled[id]
+    if !ok || p.OpenID != openID {
+        return doauth.ScheduledPost{}, doauth.ErrNotFound
+    }
+    switch p.State {
+    case doauth.ScheduleCanceled:
+        return p, nil
+    case doauth.ScheduleScheduled:
+    default:
+        return p, doauth.ErrNotCancelable
+    }
+    p.State = doauth.ScheduleCanceled
+    p.UpdatedAt = now
+    m.scheduled[id] = p
+    return p, m.flushLocked()
+}
+
+// CancelScheduledFor cancels the scheduled posts of openID, leaving
+// claimed and settled ones alone.
+func (m *Memory) CancelScheduledFor(ctx context.Context, openID string, now time.Time) (int, error) {
+    defer m.observe("CancelScheduledFor", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    n := 0
+    for id, p := range m.scheduled {
+        if p.OpenID != openID || p.State != doauth.ScheduleScheduled {
+            continue
+        }
+        p.State = doauth.ScheduleCanceled
+        p.UpdatedAt = now
+        m.scheduled[id] = p
+        n++
+    }
+    if n == 0 {
+        return 0, nil
+    }
+    return n, m.flushLocked()
+}
+
+// FinishScheduled stores p if the post is still running under the lease
+// p was claimed with.
+func (m *Memory) FinishScheduled(ctx context.Context, p doauth.ScheduledPost) error {
+    defer m.observe("FinishScheduled", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    cur, ok := m.scheduled[p.ID]
+    if !ok {
+        return doauth.ErrNotFound
+    }
+    if cur.State != doauth.ScheduleRunning || !cur.LeaseUntil.Equal(p.LeaseUntil) {
+        return doauth.ErrClaimLost
+    }
+    p.LeaseUntil = time.Time{}
+    m.scheduled[p.ID] = p
+    return m.flushLocked()
+}
+
+func (m *Memory) GetScheduled(ctx context.Context, id string) (doauth.ScheduledPost, error) {
+    defer m.observe("GetScheduled", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    p, ok := m.scheduled[id]
+    if !ok {
+        return doauth.ScheduledPost{}, doauth.ErrNotFound
+    }
+    return p, nil
+}
+
+func (m *Memory) ListScheduled(ctx context.Context, openID string) ([]doauth.ScheduledPost, error) {
+    defer m.observe("ListScheduled", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    out := []doauth.ScheduledPost{}
+    for _, p := range m.scheduled {
+        if p.OpenID == openID {
+            out = append(out, p)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].ScheduledAt.Before(out[j].ScheduledAt) })
+    return out, nil
+}
+
+// ClaimDueScheduled marks due posts as running with a lease, counts the
+// attempt and returns them. Running posts whose lease expired (the process
+// died mid-run) are claimed again, or failed once maxAttempts is used up.
+func (m *Memory) ClaimDueScheduled(ctx context.Context, now time.Time, lease time.Duration, maxAttempts int) ([]doauth.ScheduledPost, error) {
+    defer m.observe("ClaimDueScheduled", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    var out []doauth.ScheduledPost
+    changed := false
+    for id, p := range m.scheduled {
+        if !p.Due(now) {
+            continue
+        }
+        changed = true
+        p.UpdatedAt = now
+        if p.Attempts >= maxAttempts {
+            p.State = doauth.ScheduleFailed
+            p.LeaseUntil = time.Time{}
+            p.LastError = "lease expired on the last attempt"
+            m.scheduled[id] = p
+            continue
+        }
+        p.State = doauth.ScheduleRunning
+        p.LeaseUntil = now.Add(lease)
+        p.Attempts++
+        m.scheduled[id] = p
+        out = append(out, p)
+    }
+    if !changed {
+        return nil, nil
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].ScheduledAt.Before(out[j].ScheduledAt) })
+    return out, m.flushLocked()
+}
+
+func (m *Memory) SaveState(ctx context.Context, st doauth.AuthState) error {
+    defer m.observe("SaveState", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.states == nil {
+        m.states = map[string]doauth.AuthState{}
+    }
+    // Drop abandoned logins so the map does not grow without bound.
+    now := time.Now()
+    for k, old := range m.states {
+        if now.After(old.ExpiresAt) {
+            delete(m.states, k)
+        }
+    }
+    m.states[st.State] = st
+    return m.flushLocked()
+}
+
+// TakeState returns and deletes a pending state.
+func (m *Memory) TakeState(ctx context.Context, state string) (doauth.AuthState, error) {
+    defer m.observe("TakeState", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    st, ok := m.states[state]
+    if !ok {
+        return doauth.AuthState{}, doauth.ErrNotFound
+    }
+    delete(m.states, state)
+    return st, m.flushLocked()
+}
+
+func (m *Memory) SaveAppCode(ctx context.Context, c doauth.AppCode) error {
+    defer m.observe("SaveAppCode", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.appCodes == nil {
+        m.appCodes = map[string]doauth.AppCode{}
+    }
+    now := time.Now()
+    for k, old := range m.appCodes {
+        if now.After(old.ExpiresAt) {
+            delete(m.appCodes, k)
+        }
+    }
+    m.appCodes[c.Code] = c
+    return m.flushLocked()
+}
+
+// TakeAppCode returns and deletes an app code.
+func (m *Memory) TakeAppCode(ctx context.Context, code string) (doauth.AppCode, error) {
+    defer m.observe("TakeAppCode", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    c, ok := m.appCodes[code]
+    if !ok {
+        return doauth.AppCode{}, doauth.ErrNotFound
+    }
+    delete(m.appCodes, code)
+    return c, m.flushLocked()
+}
+
+func (m *Memory) SaveDeviceGrant(ctx context.Context, g doauth.DeviceGrant) error {
+    defer m.observe("SaveDeviceGrant", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.devices == nil {
+        m.devices = map[string]doauth.DeviceGrant{}
+    }
+    now := time.Now()
+    for k, old := range m.devices {
+        if now.After(old.ExpiresAt) {
+            delete(m.devices, k)
+        }
+    }
+    m.devices[g.DeviceCode] = g
+    return m.flushLocked()
+}
+
+func (m *Memory) DeviceGrantByUserCode(ctx context.Context, userCode string) (doauth.DeviceGrant, error) {
+    defer m.observe("DeviceGrantByUserCode", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    for _, g := range m.devices {
+        if g.UserCode == userCode {
+            return g, nil
+        }
+    }
+    return doauth.DeviceGrant{}, doauth.ErrNotFound
+}
+
+// ResolveDeviceGrant approves or denies a pending, unexpired grant.
+func (m *Memory) ResolveDeviceGrant(ctx context.Context, deviceCode string, status doauth.DeviceStatus, sessionID string, now time.Time) error {
+    defer m.observe("ResolveDeviceGrant", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    g, ok := m.devices[deviceCode]
+    if !ok {
+        return doauth.ErrNotFound
+    }
+    if g.Status != doauth.DevicePending || now.After(g.ExpiresAt) {
+        return doauth.ErrInvalidUserCode
+    }
+    g.Status = status
+    g.SessionID = sessionID
+    m.devices[deviceCode] = g
+    return m.flushLocked()
+}
+
+// PollDeviceGrant records a poll of a pending grant and grows its
+// interval when the device polls too fast.
+func (m *Memory) PollDeviceGrant(ctx context.Context, clientID, deviceCode string, now time.Time, backoff time.Duration) (doauth.DeviceGrant, bool, error) {
+    defer m.observe("PollDeviceGrant", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    g, ok := m.devices[deviceCode]
+    if !ok || g.ClientID != clientID {
+        return doauth.DeviceGrant{}, false, doauth.ErrNotFound
+    }
+    if g.Status != doauth.DevicePending {
+        return g, false, nil
+    }
+    slowDown := now.Sub(g.LastPolledAt) < g.Interval
+    if slowDown {
+        g.Interval += backoff
+    }
+    g.LastPolledAt = now
+    m.devices[deviceCode] = g
+    return g, slowDown, m.flushLocked()
+}
+
+// TakeApprovedDeviceGrant returns and deletes an approved grant.
+func (m *Memory) TakeApprovedDeviceGrant(ctx context.Context, deviceCode string) (doauth.DeviceGrant, error) {
+    defer m.observe("TakeApprovedDeviceGrant", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    g, ok := m.devices[deviceCode]
+    if !ok || g.Status != doauth.DeviceApproved {
+        return doauth.DeviceGrant{}, doauth.ErrNotFound
+    }
+    delete(m.devices, deviceCode)
+    return g, m.flushLocked()
+}
+
+func (m *Memory) SaveQRLogin(ctx context.Context, l doauth.QRLogin) error {
+    defer m.observe("SaveQRLogin", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.qrLogins == nil {
+        m.qrLogins = map[string]doauth.QRLogin{}
+    }
+    now := time.Now()
+    for k, old := range m.qrLogins {
+        if now.After(old.ExpiresAt) {
+            delete(m.qrLogins, k)
+        }
+    }
+    m.qrLogins[l.ID] = l
+    return m.flushLocked()
+}
+
+func (m *Memory) GetQRLogin(ctx context.Context, id string) (doauth.QRLogin, error) {
+    defer m.observe("GetQRLogin", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    l, ok := m.qrLogins[id]
+    if !ok {
+        return doauth.QRLogin{}, doauth.ErrNotFound
+    }
+    return l, nil
+}
+
+// SetQRLoginStatus changes the status of a live QR login whose status is
+// one of from.
+func (m *Memory) SetQRLoginStatus(ctx context.Context, id string, from []doauth.QRStatus, status doauth.QRStatus, sessionID string, now time.Time) error {
+    defer m.observe("SetQRLoginStatus", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    l, ok := m.qrLogins[id]
+    switch {
+    case !ok:
+        return doauth.ErrNotFound
+    case now.After(l.ExpiresAt):
+        return doauth.ErrQRLoginExpired
+    case !slices.Contains(from, l.Status):
+        return doauth.ErrInvalidQRLogin
+    }
+    l.Status = status
+    l.SessionID = sessionID
+    m.qrLogins[id] = l
+    return m.flushLocked()
+}
+
+// TakeApprovedQRLogin returns and deletes an approved QR login.
+func (m *Memory) TakeApprovedQRLogin(ctx context.Context, id string) (doauth.QRLogin, error) {
+    defer m.observe("TakeApprovedQRLogin", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    l, ok := m.qrLogins[id]
+    if !ok || l.Status != doauth.QRApproved {
+        return doauth.QRLogin{}, doauth.ErrNotFound
+    }
+    delete(m.qrLogins, id)
+    return l, m.flushLocked()
+}
+
+func (m *Memory) SaveLegalAcceptance(ctx context.Context, a doauth.LegalAcceptance) error {
+    defer m.observe("SaveLegalAcceptance", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.legal == nil {
+        m.legal = map[string][]doauth.LegalAcceptance{}
+    }
+    m.legal[a.UserID] = append(m.legal[a.UserID], a)
+    return m.flushLocked()
+}
+
+func (m *Memory) LegalAcceptances(ctx context.Context, userID string) ([]doauth.LegalAcceptance, error) {
+    defer m.observe("LegalAcceptances", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return append([]doauth.LegalAcceptance{}, m.legal[userID]...), nil
+}
+
+func (m *Memory) SaveVerificationFile(ctx context.Context, f doauth.VerificationFile) error {
+    defer m.observe("SaveVerificationFile", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.verify == nil {
+        m.verify = map[string]doauth.VerificationFile{}
+    }
+    m.verify[f.Path] = f
+    return m.flushLocked()
+}
+
+func (m *Memory) GetVerificationFile(ctx context.Context, path string) (doauth.VerificationFile, error) {
+    defer m.observe("GetVerificationFile", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    f, ok := m.verify[path]
+    if !ok {
+        return doauth.VerificationFile{}, doauth.ErrNotFound
+    }
+    return f, nil
+}
+
+func (m *Memory) ListVerificationFiles(ctx context.Context) ([]doauth.VerificationFile, error) {
+    defer m.observe("ListVerificationFiles", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    out := make([]doauth.VerificationFile, 0, len(m.verify))
+    for _, f := range m.verify {
+        out = append(out, f)
+    }
+    return out, nil
+}
+
+func (m *Memory) DeleteVerificationFile(ctx context.Context, path string) error {
+    defer m.observe("DeleteVerificationFile", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if _, ok := m.verify[path]; !ok {
+        return doauth.ErrNotFound
+    }
+    delete(m.verify, path)
+    return m.flushLocked()
+}
+
+func (m *Memory) SaveSession(ctx context.Context, s doauth.Session) error {
+    defer m.observe("SaveSession", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.sessions == nil {
+        m.sessions = map[string]doauth.Session{}
+    }
+    m.sessions[s.ID] = s
+    return m.flushLocked()
+}
+
+func (m *Memory) GetSession(ctx context.Context, id string) (doauth.Session, error) {
+    defer m.observe("GetSession", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    s, ok := m.sessions[id]
+    if !ok {
+        return doauth.Session{}, doauth.ErrNotFound
+    }
+    return s, nil
+}
+
+func (m *Memory) DeleteSession(ctx context.Context, id string) error {
+    defer m.observe("DeleteSession", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if _, ok := m.sessions[id]; !ok {
+        return nil
+    }
+    delete(m.sessions, id)
+    return m.flushLocked()
+}
+
+// ActiveSessions counts the sessions that have not expired at now.
+func (m *Memory) ActiveSessions(now time.Time) int {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    n := 0
+    for _, s := range m.sessions {
+        if now.Before(s.ExpiresAt) {
+            n++
+        }
+    }
+    return n
+}
+
+func (m *Memory) SaveUser(ctx context.Context, u doauth.User) error {
+    defer m.observe("SaveUser", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.users == nil {
+        m.users = map[string]doauth.User{}
+    }
+    m.users[u.ID] = u
+    return m.flushLocked()
+}
+
+func (m *Memory) GetUser(ctx context.Context, id string) (doauth.User, error) {
+    defer m.observe("GetUser", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    u, ok := m.users[id]
+    if !ok {
+        return doauth.User{}, doauth.ErrNotFound
+    }
+    return u, nil
+}
+
+func (m *Memory) SaveConnection(ctx context.Context, c doauth.Connection) error {
+    defer m.observe("SaveConnection", time.Now())
     m.mu.Lock()
     defer m.mu.Unlock()
-    m.token = t
-    return nil
+    if m.conns == nil {
+        m.conns = map[string]doauth.Connection{}
+    }
+    m.conns[c.ID] = c
+    return m.flushLocked()
 }
 
+func (m *Memory) GetConnection(ctx context.Context, id string) (doauth.Connection, error) {
+    defer m.observe("GetConnection", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    c, ok := m.conns[id]
+    if !ok {
+        return doauth.Connection{}, doauth.ErrNotFound
+    }
+    return c, nil
+}
+
+func (m *Memory) ConnectionFor(ctx context.Context, provider, subject string) (doauth.Connection, error) {
+    defer m.observe("ConnectionFor", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    for _, c := range m.conns {
+        if c.Provider == provider && c.Subject == subject {
+            return c, nil
+        }
+    }
+    return doauth.Connection{}, doauth.ErrNotFound
+}
+
+func (m *Memory) ListConnections(ctx context.Context, userID string) ([]doauth.Connection, error) {
+    defer m.observe("ListConnections", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    out := []doauth.Connection{}
+    for _, c := range m.conns {
+        if c.UserID == userID {
+            out = append(out, c)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+    return out, nil
+}
+
+func (m *Memory) DeleteConnection(ctx context.Context, id string) error {
+    defer m.observe("DeleteConnection", time.Now())
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if _, ok := m.conns[id]; !ok {
+        return doauth.ErrNotFound
+    }
+    delete(m.conns, id)
+    return m.flushLocked()
+}
+
+// flushLocked writes the snapshot atomically (0600, it holds tokens);
+// callers hold m.mu.
+func (m *Memory) flushLocked() error {
+    if m.path == "" {
+        return nil
+    }
+    b, err := json.Marshal(snapshot{
+        Tokens:    m.tokens,
+        Publishes: m.publishes,
+        Scheduled: m.scheduled,
+        States:    m.states,
+        Sessions:  m.sessions,
+        Users:     m.users,
+        Conns:     m.conns,
+        AppCodes:  m.appCodes,
+        Devices:   m.devices,
+        QRLogins:  m.qrLogins,
+        Legal:     m.legal,
+        Verify:    m.verify,
+    })
+    if err != nil {
+        return err
+    }
+    tmp, err := os.CreateTemp(filepath.Dir(m.path), filepath.Base(m.path)+".*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+    if _, err := tmp.Write(b); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), m.path)
+}
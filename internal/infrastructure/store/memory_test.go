@@ -0,0 +1,201 @@
+package store
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sync"
+    "testing"
+    "time"
+
+    doauth "tiktok-oauth/internal/domain/oauth"
+)
+
+func TestMemory_CancelRacesClaim(t *testing.T) {
+    ctx := context.Background()
+    now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+    m := &Memory{}
+    for i := 0; i < 200; i++ {
+        id := fmt.Sprintf("p%d", i)
+        p := doauth.ScheduledPost{ID: id, IdempotencyKey: id, OpenID: "alice", State: doauth.ScheduleScheduled, ScheduledAt: now}
+        if _, _, err := m.CreateScheduled(ctx, p); err != nil {
+            t.Fatal(err)
+        }
+
+        var (
+            wg        sync.WaitGroup
+            claimed   []doauth.ScheduledPost
+            cancelErr error
+        )
+        wg.Add(2)
+        go func() {
+            defer wg.Done()
+            claimed, _ = m.ClaimDueScheduled(ctx, now, time.Minute, 5)
+        }()
+        go func() {
+            defer wg.Done()
+            _, cancelErr = m.CancelScheduled(ctx, id, "alice", now)
+        }()
+        wg.Wait()
+
+        want := doauth.ScheduleCanceled
+        if len(claimed) == 1 {
+            want = doauth.SchedulePublished
+            if !errors.Is(cancelErr, doauth.ErrNotCancelable) {
+                t.Fatalf("%s: claimed and canceled (cancel err %v)", id, cancelErr)
+            }
+            run := claimed[0]
+            run.State = doauth.SchedulePublished
+            if err := m.FinishScheduled(ctx, run); err != nil {
+                t.Fatalf("%s: finish: %v", id, err)
+            }
+        } else if cancelErr != nil {
+            t.Fatalf("%s: neither claimed nor canceled: %v", id, cancelErr)
+        }
+        if got, _ := m.GetScheduled(ctx, id); got.State != want {
+            t.Fatalf("%s: state %s, want %s", id, got.State, want)
+        }
+    }
+}
+
+func TestMemory_ClaimCountsAttempts(t *testing.T) {
+    ctx := context.Background()
+    now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+    m := &Memory{}
+    p := doauth.ScheduledPost{ID: "p1", IdempotencyKey: "k", OpenID: "alice", State: doauth.ScheduleScheduled, ScheduledAt: now}
+    if _, _, err := m.CreateScheduled(ctx, p); err != nil {
+        t.Fatal(err)
+    }
+
+    // Each run dies without finishing; its lease expires and the post is
+    // claimed again until the attempts are used up.
+    var first doauth.ScheduledPost
+    for i := 1; i <= 2; i++ {
+        claimed, err := m.ClaimDueScheduled(ctx, now, time.Minute, 2)
+        if err != nil || len(claimed) != 1 || claimed[0].Attempts != i {
+            t.Fatalf("claim %d: %v %#v", i, err, claimed)
+        }
+        if i == 1 {
+            first = claimed[0]
+        }
+        now = now.Add(2 * time.Minute)
+    }
+    if err := m.FinishScheduled(ctx, first); !errors.Is(err, doauth.ErrClaimLost) {
+        t.Fatalf("stale run finished: %v", err)
+    }
+    if claimed, _ := m.ClaimDueScheduled(ctx, now, time.Minute, 2); len(claimed) != 0 {
+        t.Fatalf("claimed past the attempt limit: %#v", claimed)
+    }
+    if got, _ := m.GetScheduled(ctx, "p1"); got.State != doauth.ScheduleFailed {
+        t.Fatalf("state %s, want failed", got.State)
+    }
+}
+
+func TestMemory_DevicePollRacesApproval(t *testing.T) {
+    ctx := context.Background()
+    now := time.Now()
+    m := &Memory{}
+    for i := 0; i < 100; i++ {
+        code := fmt.Sprintf("d%d", i)
+        g := doauth.DeviceGrant{DeviceCode: code, UserCode: code, ClientID: "cli", Status: doauth.DevicePending, Interval: time.Second, ExpiresAt: now.Add(time.Minute)}
+        if err := m.SaveDeviceGrant(ctx, g); err != nil {
+            t.Fatal(err)
+        }
+
+        var wg sync.WaitGroup
+        wg.Add(3)
+        go func() {
+            defer wg.Done()
+            if err := m.ResolveDeviceGrant(ctx, code, doauth.DeviceApproved, "sid", now); err != nil {
+                t.Errorf("approve: %v", err)
+            }
+        }()
+        for j := 0; j < 2; j++ {
+            go func() {
+                defer wg.Done()
+                _, _, _ = m.PollDeviceGrant(ctx, "cli", code, now, time.Second)
+            }()
+        }
+        wg.Wait()
+
+        // A poll must not undo the approval, and only one poll gets it.
+        var (
+            mu    sync.Mutex
+            taken int
+        )
+        wg.Add(4)
+        for j := 0; j < 4; j++ {
+            go func() {
+                defer wg.Done()
+                got, err := m.TakeApprovedDeviceGrant(ctx, code)
+                if err == nil {
+                    if got.SessionID != "sid" {
+                        t.Errorf("%s: unexpected grant %#v", code, got)
+                    }
+                    mu.Lock()
+                    taken++
+                    mu.Unlock()
+                } else if !errors.Is(err, doauth.ErrNotFound) {
+                    t.Errorf("take: %v", err)
+                }
+            }()
+        }
+        wg.Wait()
+        if taken != 1 {
+            t.Fatalf("%s: approved grant taken %d times", code, taken)
+        }
+    }
+}
+
+func TestMemory_ResolveDeviceGrantOnce(t *testing.T) {
+    ctx := context.Background()
+    now := time.Now()
+    m := &Memory{}
+    g := doauth.DeviceGrant{DeviceCode: "d", UserCode: "U", ClientID: "cli", Status: doauth.DevicePending, ExpiresAt: now.Add(time.Minute)}
+    if err := m.SaveDeviceGrant(ctx, g); err != nil {
+        t.Fatal(err)
+    }
+    if err := m.ResolveDeviceGrant(ctx, "d", doauth.DeviceApproved, "sid", now); err != nil {
+        t.Fatal(err)
+    }
+    if err := m.ResolveDeviceGrant(ctx, "d", doauth.DeviceDenied, "", now); !errors.Is(err, doauth.ErrInvalidUserCode) {
+        t.Fatalf("expected ErrInvalidUserCode, got %v", err)
+    }
+    if _, _, err := m.PollDeviceGrant(ctx, "other", "d", now, time.Second); !errors.Is(err, doauth.ErrNotFound) {
+        t.Fatalf("another client must not poll the grant, got %v", err)
+    }
+}
+
+func TestMemory_QRScanRacesApproval(t *testing.T) {
+    ctx := context.Background()
+    now := time.Now()
+    m := &Memory{}
+    for i := 0; i < 100; i++ {
+        id := fmt.Sprintf("q%d", i)
+        if err := m.SaveQRLogin(ctx, doauth.QRLogin{ID: id, Status: doauth.QRScanned, ExpiresAt: now.Add(time.Minute)}); err != nil {
+            t.Fatal(err)
+        }
+        var wg sync.WaitGroup
+        wg.Add(2)
+        go func() {
+            defer wg.Done()
+            if err := m.SetQRLoginStatus(ctx, id, []doauth.QRStatus{doauth.QRScanned}, doauth.QRApproved, "sid", now); err != nil {
+                t.Errorf("approve: %v", err)
+            }
+        }()
+        go func() {
+            defer wg.Done()
+            // A second scan from the phone; it may not undo the approval.
+            _ = m.SetQRLoginStatus(ctx, id, []doauth.QRStatus{doauth.QRPending, doauth.QRScanned}, doauth.QRScanned, "", now)
+        }()
+        wg.Wait()
+
+        l, err := m.TakeApprovedQRLogin(ctx, id)
+        if err != nil || l.SessionID != "sid" {
+            t.Fatalf("%s: approval lost: %#v err=%v", id, l, err)
+        }
+        if _, err := m.TakeApprovedQRLogin(ctx, id); !errors.Is(err, doauth.ErrNotFound) {
+            t.Fatalf("%s: approved login taken twice, got %v", id, err)
+        }
+    }
+}
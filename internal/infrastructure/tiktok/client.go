@@ -16,15 +16,23 @@ import (
 )
 
 const (
-    AuthEndpoint  = "https://www.tiktok.com/v2/auth/authorize/"
-    TokenEndpoint = "https://open.tiktokapis.com/v2/oauth/token/"
-    UserInfoURL   = "https://open.tiktokapis.com/v2/user/info/"
+    AuthEndpoint   = "https://www.tiktok.com/v2/auth/authorize/"
+    TokenEndpoint  = "https://open.tiktokapis.com/v2/oauth/token/"
+    RevokeEndpoint = "https://open.tiktokapis.com/v2/oauth/revoke/"
+    UserInfoURL    = "https://open.tiktokapis.com/v2/user/info/"
 )
 
+// profileFields are requested by UserInfo to build a Profile.
+var profileFields = []string{"open_id", "union_id", "display_name", "avatar_url"}
+
 type Client struct {
     ClientKey    string
     ClientSecret string
     HTTP         *http.Client
+    // Uploader sends FILE_UPLOAD chunks; nil uses a default Uploader.
+    Uploader     *Uploader
+    // Observer, when set, is told the latency and outcome of each call.
+    Observer     CallObserver
 }
 
 func defaultHTTPClient(c *http.Client) *http.Client {
@@ -34,36 +42,105 @@ func defaultHTTPClient(c *http.Client) *http.Client {
     return &http.Client{Timeout: 10 * time.Second}
 }
 
+// Name implements oauth.Provider.
+func (c *Client) Name() string { return doauth.ProviderTikTok }
+
 // AuthURL builds TikTok v2 authorization URL.
-func (c *Client) AuthURL(state, redirectURI, scope string) string {
+func (c *Client) AuthURL(p doauth.AuthParams) string {
     v := url.Values{}
     v.Set("client_key", c.ClientKey)
     v.Set("response_type", "code")
-    if scope != "" {
-        v.Set("scope", scope)
+    if p.Scope != "" {
+        v.Set("scope", p.Scope)
+    }
+    v.Set("redirect_uri", p.RedirectURI)
+    if p.State != "" {
+        v.Set("state", p.State)
     }
-    v.Set("redirect_uri", redirectURI)
-    if state != "" {
-        v.Set("state", state)
+    if p.CodeChallenge != "" {
+        v.Set("code_challenge", p.CodeChallenge)
+        v.Set("code_challenge_method", "S256")
     }
     return AuthEndpoint + "?" + v.Encode()
 }
 
 // Exchange exchanges authorization code for tokens using x-www-form-urlencoded.
-func (c *Client) Exchange(ctx context.Context, code, redirectURI string) (doauth.Token, error) {
+func (c *Client) Exchange(ctx context.Context, p doauth.ExchangeParams) (doauth.Token, error) {
     form := url.Values{}
     form.Set("client_key", c.ClientKey)
     form.Set("client_secret", c.ClientSecret)
-    form.Set("code", code)
+    form.Set("code", p.Code)
     form.Set("grant_type", "authorization_code")
     // Important: include redirect_uri in body (must match auth request)
-    form.Set("redirect_uri", redirectURI)
+    form.Set("redirect_uri", p.RedirectURI)
+    if p.CodeVerifier != "" {
+        form.Set("code_verifier", p.CodeVerifier)
+    }
+    return c.tokenRequest(ctx, form)
+}
+
+// Revoke invalidates an access token and the authorization behind it.
+func (c *Client) Revoke(ctx context.Context, token string) (err error) {
+    form := url.Values{}
+    form.Set("client_key", c.ClientKey)
+    form.Set("client_secret", c.ClientSecret)
+    form.Set("token", token)
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, RevokeEndpoint, strings.NewReader(form.Encode()))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    call := startCall(c.Observer, req)
+    defer func() { call.done(err) }()
+    resp, err := defaultHTTPClient(c.HTTP).Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    call.response(resp)
+    body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+    if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+        return fmt.Errorf("revoke failed: status=%d body=%s", resp.StatusCode, trunc(body, 2048))
+    }
+    return nil
+}
 
+// UserInfo implements oauth.Provider on top of GetUserInfo.
+func (c *Client) UserInfo(ctx context.Context, accessToken string) (doauth.Profile, error) {
+    raw, err := c.GetUserInfo(ctx, accessToken, profileFields)
+    if err != nil {
+        return doauth.Profile{}, err
+    }
+    user := userFromInfo(raw)
+    return doauth.Profile{
+        Provider:    doauth.ProviderTikTok,
+        Subject:     strVal(user["open_id"]),
+        DisplayName: strVal(user["display_name"]),
+        AvatarURL:   strVal(user["avatar_url"]),
+        Raw:         user,
+    }, nil
+}
+
+// Refresh obtains a new access token with a refresh token.
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (doauth.Token, error) {
+    form := url.Values{}
+    form.Set("client_key", c.ClientKey)
+    form.Set("client_secret", c.ClientSecret)
+    form.Set("grant_type", "refresh_token")
+    form.Set("refresh_token", refreshToken)
+    return c.tokenRequest(ctx, form)
+}
+
+// tokenRequest posts form to the token endpoint and parses the token.
+func (c *Client) tokenRequest(ctx context.Context, form url.Values) (_ doauth.Token, err error) {
     req, err := http.NewRequestWithContext(ctx, http.MethodPost, TokenEndpoint, strings.NewReader(form.Encode()))
     if err != nil {
         return doauth.Token{}, err
     }
     req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    call := startCall(c.Observer, req)
+    defer func() { call.done(err) }()
 
     httpClient := defaultHTTPClient(c.HTTP)
     resp, err := httpClient.Do(req)
@@ -71,10 +148,11 @@ func (c *Client) Exchange(ctx context.Context, code, redirectURI string) (doauth
         return doauth.Token{}, err
     }
     defer resp.Body.Close()
+    call.response(resp)
 
     body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
     if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-        return doauth.Token{}, fmt.Errorf("token exchange failed: status=%d body=%s", resp.StatusCode, string(body))
+        return doauth.Token{}, fmt.Errorf("token request failed: status=%d body=%s", resp.StatusCode, string(body))
     }
 
     // TikTok v2 typically wraps in { "data": { ... } }
@@ -82,10 +160,12 @@ func (c *Client) Exchange(ctx context.Context, code, redirectURI string) (doauth
         Data map[string]any `json:"data"`
         Error string        `json:"error"`
         Message string      `json:"message"`
+        LogID string        `json:"log_id"`
     }
     if err := json.Unmarshal(body, &wrapped); err != nil {
         return doauth.Token{}, fmt.Errorf("decode token response: %w", err)
     }
+    call.logID(wrapped.LogID)
 
     var data map[string]any
     switch {
@@ -111,12 +191,13 @@ func (c *Client) Exchange(ctx context.Context, code, redirectURI string) (doauth
     }
     if v, ok := numToInt64(data["expires_in"]); ok {
         token.ExpiresIn = v
+        token.ExpiresAt = time.Now().Add(time.Duration(v) * time.Second)
     }
     return token, nil
 }
 
 // GetUserInfo fetches user info with given fields using Bearer token.
-func (c *Client) GetUserInfo(ctx context.Context, accessToken string, fields []string) (map[string]any, error) {
+func (c *Client) GetUserInfo(ctx context.Context, accessToken string, fields []string) (_ map[string]any, err error) {
     if accessToken == "" {
         return nil, errors.New("missing access token")
     }
@@ -134,6 +215,8 @@ func (c *Client) GetUserInfo(ctx context.Context, accessToken string, fields []s
         return nil, err
     }
     req.Header.Set("Authorization", "Bearer "+accessToken)
+    call := startCall(c.Observer, req)
+    defer func() { call.done(err) }()
 
     httpClient := defaultHTTPClient(c.HTTP)
     resp, err := httpClient.Do(req)
@@ -141,6 +224,7 @@ func (c *Client) GetUserInfo(ctx context.Context, accessToken string, fields []s
         return nil, err
     }
     defer resp.Body.Close()
+    call.response(resp)
     body, _ := io.ReadAll(io.LimitReader(resp.Body, 2<<20))
     if resp.StatusCode < 200 || resp.StatusCode >= 300 {
         return nil, fmt.Errorf("user info failed: status=%d body=%s", resp.StatusCode, trunc(body, 2048))
@@ -149,6 +233,9 @@ func (c *Client) GetUserInfo(ctx context.Context, accessToken string, fields []s
     if err := json.Unmarshal(body, &out); err != nil {
         return nil, fmt.Errorf("decode user info: %w", err)
     }
+    if e, ok := out["error"].(map[string]any); ok {
+        call.logID(strVal(e["log_id"]))
+    }
     return out, nil
 }
 
@@ -182,3 +269,22 @@ func trunc(b []byte, n int) string {
     return string(b[:n]) + "..."
 }
 
+// userFromInfo pulls the user object out of a user info response.
+func userFromInfo(m map[string]any) map[string]any {
+    // Expected shapes:
+    // m = { "data": { "user": { "avatar_url": "", "display_name": "" } }, ... }
+    // or sometimes m = { "data": { "data": { "user": { ... } } } }
+    if dm, ok := m["data"].(map[string]any); ok {
+        // direct user
+        if u, ok := dm["user"].(map[string]any); ok {
+            return u
+        }
+        // nested data.user
+        if inner, ok := dm["data"].(map[string]any); ok {
+            if u, ok := inner["user"].(map[string]any); ok {
+                return u
+            }
+        }
+    }
+    return map[string]any{}
+}
@@ -0,0 +1,173 @@
+package tiktok
+
+import (
+    "context"
+    "errors"
+    "log/slog"
+    "net"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/propagation"
+    semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+    "go.opentelemetry.io/otel/trace"
+
+    "tiktok-oauth/internal/pkg/logging"
+)
+
+// CallObserver receives the outcome of every TikTok API call. endpoint is
+// the API path without the version ("oauth/token", "post/publish/video/init")
+// or "upload" for FILE_UPLOAD chunks, and class one of the Class values,
+// so both stay low-cardinality.
+type CallObserver interface {
+    ObserveCall(endpoint string, d time.Duration, class string)
+}
+
+// Error classes of a TikTok API call.
+const (
+    ClassOK          = "ok"
+    ClassTimeout     = "timeout"
+    ClassCanceled    = "canceled"
+    ClassNetwork     = "network"
+    ClassRateLimited = "rate_limited"
+    ClassAuth        = "auth"
+    ClassClientError = "client_error"
+    ClassServerError = "server_error"
+    ClassAPIError    = "api_error"
+)
+
+// tracer names the client spans of TikTok API calls.
+var tracer = otel.Tracer("tiktok-oauth/internal/infrastructure/tiktok")
+
+// propagator sends TikTok the trace context only. The global propagator
+// also carries baggage, which callers set for our own services and which
+// must not leak to a third party.
+var propagator = propagation.TraceContext{}
+
+// call observes one request: it times it for the CallObserver, wraps it
+// in a client span, whose trace context it sends along with the request,
+// and logs it through the logger of the request context.
+type call struct {
+    ctx      context.Context
+    obs      CallObserver
+    endpoint string
+    start    time.Time
+    status   int
+    tikTokID string
+    span     trace.Span
+}
+
+func startCall(obs CallObserver, req *http.Request) *call {
+    endpoint := endpointOf(req.URL.String())
+    ctx, span := tracer.Start(req.Context(), "tiktok "+endpoint,
+        trace.WithSpanKind(trace.SpanKindClient),
+        trace.WithAttributes(
+            semconv.HTTPRequestMethodKey.String(req.Method),
+            semconv.ServerAddress(req.URL.Hostname()),
+            attribute.String("tiktok.endpoint", endpoint),
+        ))
+    propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+    return &call{ctx: ctx, obs: obs, endpoint: endpoint, start: time.Now(), span: span}
+}
+
+// response records the status and the log_id TikTok returns in the
+// X-Tt-Logid header.
+func (c *call) response(resp *http.Response) {
+    c.status = resp.StatusCode
+    c.span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+    c.logID(resp.Header.Get("X-Tt-Logid"))
+}
+
+// logID records the log_id TikTok support asks for; empty ones are
+// ignored, so the body's copy can follow the header's.
+func (c *call) logID(id string) {
+    if id != "" {
+        c.tikTokID = id
+        c.span.SetAttributes(attribute.String("tiktok.log_id", id))
+    }
+}
+
+// done ends the call with the error the API method returns. Failures are
+// logged at Warn, since callers decide whether they are errors;
+// successful calls at Debug.
+func (c *call) done(err error) {
+    d := time.Since(c.start)
+    class := classify(c.status, err)
+    c.span.SetAttributes(attribute.String("tiktok.error_class", class))
+    if err != nil {
+        c.span.RecordError(err)
+        c.span.SetStatus(codes.Error, class)
+    }
+    c.span.End()
+    if c.obs != nil {
+        c.obs.ObserveCall(c.endpoint, d, class)
+    }
+
+    attrs := []slog.Attr{
+        slog.String("endpoint", c.endpoint),
+        slog.Int("status", c.status),
+        slog.String("class", class),
+        slog.Duration("duration", d),
+    }
+    if c.tikTokID != "" {
+        attrs = append(attrs, slog.String("log_id", c.tikTokID))
+    }
+    level := slog.LevelDebug
+    if err != nil {
+        level = slog.LevelWarn
+        attrs = append(attrs, slog.String("err", err.Error()))
+    }
+    logging.FromContext(c.ctx).LogAttrs(c.ctx, level, "tiktok api call", attrs...)
+}
+
+// endpointOf turns an open.tiktokapis.com URL into its endpoint label.
+// Upload URLs carry per-upload tokens and all map to "upload".
+func endpointOf(rawURL string) string {
+    u, err := url.Parse(rawURL)
+    if err != nil || !strings.HasPrefix(u.Path, "/v2/") {
+        return "upload"
+    }
+    return strings.Trim(strings.TrimPrefix(u.Path, "/v2/"), "/")
+}
+
+// classify derives the error class from the HTTP status (0 when no
+// response arrived) and the error of a call.
+func classify(status int, err error) string {
+    if err == nil {
+        return ClassOK
+    }
+    var apiErr *APIError
+    if errors.As(err, &apiErr) {
+        switch apiErr.Code {
+        case "rate_limit_exceeded", "spam_risk_too_many_posts", "spam_risk_too_many_pending_share":
+            return ClassRateLimited
+        case "access_token_invalid", "scope_not_authorized", "scope_permission_missed":
+            return ClassAuth
+        }
+    }
+    var netErr net.Error
+    switch {
+    case status == 0 && errors.Is(err, context.Canceled):
+        return ClassCanceled
+    case status == 0 && (errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()):
+        return ClassTimeout
+    case status == 0:
+        return ClassNetwork
+    case status == http.StatusTooManyRequests:
+        return ClassRateLimited
+    case status == http.StatusUnauthorized || status == http.StatusForbidden:
+        return ClassAuth
+    case status >= 500:
+        return ClassServerError
+    case status >= 400:
+        return ClassClientError
+    default:
+        // A 2xx reply carrying an error or one that could not be decoded.
+        return ClassAPIError
+    }
+}
@@ -0,0 +1,119 @@
+package tiktok
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/baggage"
+    "go.opentelemetry.io/otel/propagation"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/sdk/trace/tracetest"
+    "go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestEndpointOf(t *testing.T) {
+    for raw, want := range map[string]string{
+        TokenEndpoint: "oauth/token",
+        UserInfoURL:   "user/info",
+        VideoInitURL:  "post/publish/video/init",
+        "https://open-upload.tiktokapis.com/video/?upload_id=1&upload_token=x": "upload",
+    } {
+        if got := endpointOf(raw); got != want {
+            t.Errorf("endpointOf(%s) = %s, want %s", raw, got, want)
+        }
+    }
+}
+
+func TestClassify(t *testing.T) {
+    for _, tc := range []struct {
+        status int
+        err    error
+        want   string
+    }{
+        {200, nil, ClassOK},
+        {0, context.Canceled, ClassCanceled},
+        {0, fmt.Errorf("post: %w", context.DeadlineExceeded), ClassTimeout},
+        {0, errors.New("connection refused"), ClassNetwork},
+        {429, errors.New("too many"), ClassRateLimited},
+        {200, &APIError{Code: "rate_limit_exceeded"}, ClassRateLimited},
+        {401, &APIError{Code: "access_token_invalid"}, ClassAuth},
+        {400, &APIError{Code: "invalid_params"}, ClassClientError},
+        {503, errors.New("unavailable"), ClassServerError},
+        {200, errors.New("decode response"), ClassAPIError},
+    } {
+        if got := classify(tc.status, tc.err); got != tc.want {
+            t.Errorf("classify(%d, %v) = %s, want %s", tc.status, tc.err, got, tc.want)
+        }
+    }
+}
+
+func TestClientObservesCalls(t *testing.T) {
+    obs := &recordingObserver{}
+    c := &Client{HTTP: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+        return nil, errors.New("offline")
+    })}, Observer: obs}
+    if _, err := c.QueryCreatorInfo(context.Background(), "act"); err == nil {
+        t.Fatal("expected an error")
+    }
+    if len(obs.calls) != 1 || obs.calls[0] != "post/publish/creator_info/query "+ClassNetwork {
+        t.Fatalf("unexpected calls %v", obs.calls)
+    }
+}
+
+func TestClientTracesCalls(t *testing.T) {
+    rec := tracetest.NewSpanRecorder()
+    otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+    // The propagator of tracing.Setup, which carries baggage as well.
+    otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+    defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+    var traceparent, sentBaggage string
+    c := &Client{HTTP: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+        traceparent = r.Header.Get("traceparent")
+        sentBaggage = r.Header.Get("baggage")
+        body := `{"data":{"status":"PUBLISH_COMPLETE"},"error":{"code":"ok","log_id":"202510010000"}}`
+        return &http.Response{StatusCode: 200, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}, nil
+    })}}
+    member, _ := baggage.NewMember("tenant", "internal-42")
+    bag, _ := baggage.New(member)
+    ctx, parent := otel.Tracer("test").Start(baggage.ContextWithBaggage(context.Background(), bag), "handler")
+    if _, err := c.FetchPublishStatus(ctx, "act", "p1"); err != nil {
+        t.Fatal(err)
+    }
+    parent.End()
+
+    span := rec.Ended()[0]
+    if span.Name() != "tiktok post/publish/status/fetch" || span.Parent().SpanID() != parent.SpanContext().SpanID() {
+        t.Fatalf("unexpected span %s", span.Name())
+    }
+    if !strings.Contains(traceparent, span.SpanContext().SpanID().String()) {
+        t.Fatalf("traceparent %q does not carry the client span", traceparent)
+    }
+    if sentBaggage != "" {
+        t.Fatalf("baggage %q sent to TikTok", sentBaggage)
+    }
+    attrs := map[string]string{}
+    for _, kv := range span.Attributes() {
+        attrs[string(kv.Key)] = kv.Value.Emit()
+    }
+    if attrs["tiktok.log_id"] != "202510010000" || attrs["tiktok.error_class"] != ClassOK || attrs["http.response.status_code"] != "200" {
+        t.Fatalf("unexpected attributes %v", attrs)
+    }
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+type recordingObserver struct{ calls []string }
+
+func (o *recordingObserver) ObserveCall(endpoint string, d time.Duration, class string) {
+    o.calls = append(o.calls, endpoint+" "+class)
+}
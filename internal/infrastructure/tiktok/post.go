@@ -0,0 +1,194 @@
+package tiktok
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+
+    doauth "tiktok-oauth/internal/domain/oauth"
+)
+
+const (
+    CreatorInfoURL   = "https://open.tiktokapis.com/v2/post/publish/creator_info/query/"
+    VideoInitURL     = "https://open.tiktokapis.com/v2/post/publish/video/init/"
+    PublishStatusURL = "https://open.tiktokapis.com/v2/post/publish/status/fetch/"
+    ContentInitURL   = "https://open.tiktokapis.com/v2/post/publish/content/init/"
+)
+
+// APIError is the error envelope returned by open.tiktokapis.com.
+type APIError struct {
+    HTTPStatus int    `json:"-"`
+    Code       string `json:"code"`
+    Message    string `json:"message"`
+    LogID      string `json:"log_id"`
+}
+
+func (e *APIError) Error() string {
+    return fmt.Sprintf("tiktok api error: status=%d code=%s message=%s log_id=%s", e.HTTPStatus, e.Code, e.Message, e.LogID)
+}
+
+// TikTokLogID returns the log_id TikTok support asks for.
+func (e *APIError) TikTokLogID() string { return e.LogID }
+
+// Is makes scope failures match oauth.ErrInsufficientScope.
+func (e *APIError) Is(target error) bool {
+    return target == doauth.ErrInsufficientScope && (e.Code == "scope_not_authorized" || e.Code == "scope_permission_missed")
+}
+
+// QueryCreatorInfo returns the posting limits of the authorized creator.
+func (c *Client) QueryCreatorInfo(ctx context.Context, accessToken string) (doauth.CreatorInfo, error) {
+    var out doauth.CreatorInfo
+    if err := c.postJSON(ctx, accessToken, CreatorInfoURL, struct{}{}, &out); err != nil {
+        return doauth.CreatorInfo{}, err
+    }
+    return out, nil
+}
+
+// InitVideoPost initializes a direct video post. For FILE_UPLOAD without
+// explicit chunking the plan is computed by PlanChunks, and a size it
+// cannot plan is an ErrInvalidPost; the returned PostInit carries the
+// declared plan for UploadVideo.
+func (c *Client) InitVideoPost(ctx context.Context, accessToken string, info doauth.PostInfo, src doauth.VideoSource) (doauth.PostInit, error) {
+    if src.Source == doauth.SourceFileUpload && (src.ChunkSize == 0 || src.TotalChunkCount == 0) {
+        plan, err := PlanChunks(src.VideoSize, src.ChunkSize)
+        if err != nil {
+            return doauth.PostInit{}, fmt.Errorf("%w: %v", doauth.ErrInvalidPost, err)
+        }
+        src.ChunkSize, src.TotalChunkCount = plan.ChunkSize, plan.TotalChunkCount
+    }
+    body := struct {
+        PostInfo   doauth.PostInfo    `json:"post_info"`
+        SourceInfo doauth.VideoSource `json:"source_info"`
+    }{PostInfo: info, SourceInfo: src}
+    var out doauth.PostInit
+    if err := c.postJSON(ctx, accessToken, VideoInitURL, body, &out); err != nil {
+        return doauth.PostInit{}, err
+    }
+    if src.Source == doauth.SourceFileUpload {
+        out.ChunkSize, out.TotalChunkCount = src.ChunkSize, src.TotalChunkCount
+    }
+    return out, nil
+}
+
+// InitPhotoPost initializes a direct photo post pulled from image URLs.
+func (c *Client) InitPhotoPost(ctx context.Context, accessToken string, post doauth.PhotoPost) (doauth.PostInit, error) {
+    type photoPostInfo struct {
+        Title          string `json:"title,omitempty"`
+        Description    string `json:"description,omitempty"`
+        PrivacyLevel   string `json:"privacy_level"`
+        DisableComment bool   `json:"disable_comment"`
+        AutoAddMusic   bool   `json:"auto_add_music"`
+    }
+    type photoSourceInfo struct {
+        Source          string   `json:"source"`
+        PhotoCoverIndex int      `json:"photo_cover_index"`
+        PhotoImages     []string `json:"photo_images"`
+    }
+    body := struct {
+        PostInfo   photoPostInfo   `json:"post_info"`
+        SourceInfo photoSourceInfo `json:"source_info"`
+        PostMode   string          `json:"post_mode"`
+        MediaType  string          `json:"media_type"`
+    }{
+        PostInfo: photoPostInfo{
+            Title:          post.Title,
+            Description:    post.Description,
+            PrivacyLevel:   post.PrivacyLevel,
+            DisableComment: post.DisableComment,
+            AutoAddMusic:   post.AutoAddMusic,
+        },
+        SourceInfo: photoSourceInfo{
+            Source:          doauth.SourcePullFromURL,
+            PhotoCoverIndex: post.PhotoCoverIndex,
+            PhotoImages:     post.PhotoImages,
+        },
+        PostMode:  "DIRECT_POST",
+        MediaType: "PHOTO",
+    }
+    var out doauth.PostInit
+    if err := c.postJSON(ctx, accessToken, ContentInitURL, body, &out); err != nil {
+        return doauth.PostInit{}, err
+    }
+    return out, nil
+}
+
+// FetchPublishStatus returns the processing state of a post.
+func (c *Client) FetchPublishStatus(ctx context.Context, accessToken, publishID string) (doauth.PublishStatus, error) {
+    body := map[string]string{"publish_id": publishID}
+    var out struct {
+        Status          string   `json:"status"`
+        FailReason      string   `json:"fail_reason"`
+        PostIDs         []string `json:"publicaly_available_post_id"`
+        UploadedBytes   int64    `json:"uploaded_bytes"`
+        DownloadedBytes int64    `json:"downloaded_bytes"`
+    }
+    if err := c.postJSON(ctx, accessToken, PublishStatusURL, body, &out); err != nil {
+        return doauth.PublishStatus{}, err
+    }
+    return doauth.PublishStatus{
+        PublishID:       publishID,
+        Status:          out.Status,
+        FailReason:      out.FailReason,
+        PostIDs:         out.PostIDs,
+        UploadedBytes:   out.UploadedBytes,
+        DownloadedBytes: out.DownloadedBytes,
+    }, nil
+}
+
+// postJSON sends a JSON body with a Bearer token and decodes the
+// {"data": ..., "error": {...}} envelope into out.
+func (c *Client) postJSON(ctx context.Context, accessToken, endpoint string, in, out any) (err error) {
+    if accessToken == "" {
+        return errors.New("missing access token")
+    }
+    payload, err := json.Marshal(in)
+    if err != nil {
+        return err
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Authorization", "Bearer "+accessToken)
+    req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+    call := startCall(c.Observer, req)
+    defer func() { call.done(err) }()
+
+    httpClient := defaultHTTPClient(c.HTTP)
+    resp, err := httpClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    call.response(resp)
+    body, _ := io.ReadAll(io.LimitReader(resp.Body, 2<<20))
+
+    var wrapped struct {
+        Data  json.RawMessage `json:"data"`
+        Error *APIError       `json:"error"`
+    }
+    if err := json.Unmarshal(body, &wrapped); err != nil {
+        return fmt.Errorf("decode response: status=%d body=%s", resp.StatusCode, trunc(body, 2048))
+    }
+    if wrapped.Error != nil {
+        call.logID(wrapped.Error.LogID)
+    }
+    if wrapped.Error != nil && wrapped.Error.Code != "" && wrapped.Error.Code != "ok" {
+        wrapped.Error.HTTPStatus = resp.StatusCode
+        return wrapped.Error
+    }
+    if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+        return &APIError{HTTPStatus: resp.StatusCode, Message: trunc(body, 2048)}
+    }
+    if out == nil || len(wrapped.Data) == 0 {
+        return nil
+    }
+    if err := json.Unmarshal(wrapped.Data, out); err != nil {
+        return fmt.Errorf("decode response data: %w", err)
+    }
+    return nil
+}
@@ -0,0 +1,273 @@
+package tiktok
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    doauth "tiktok-oauth/internal/domain/oauth"
+)
+
+// Chunk limits of the FILE_UPLOAD source.
+// See https://developers.tiktok.com/doc/content-posting-api-media-transfer-guide
+const (
+    MinChunkSize      int64 = 5 << 20
+    MaxChunkSize      int64 = 64 << 20
+    MaxFinalChunkSize int64 = 128 << 20
+    MaxChunkCount           = 1000
+    DefaultChunkSize  int64 = 10 << 20
+)
+
+const defaultUploadAttempts = 3
+
+// ChunkPlan describes how a video is split for FILE_UPLOAD.
+// The trailing bytes that do not fill a whole chunk are merged into the
+// last chunk, so TotalChunkCount is floor(VideoSize / ChunkSize).
+type ChunkPlan struct {
+    VideoSize       int64 `json:"video_size"`
+    ChunkSize       int64 `json:"chunk_size"`
+    TotalChunkCount int   `json:"total_chunk_count"`
+}
+
+// PlanChunks computes a valid chunk plan for a video of size bytes.
+// preferred is used as chunk size when it is within limits; 0 selects
+// DefaultChunkSize. Videos smaller than MinChunkSize are sent whole.
+func PlanChunks(size, preferred int64) (ChunkPlan, error) {
+    if size <= 0 {
+        return ChunkPlan{}, errors.New("video size must be positive")
+    }
+    if size < MinChunkSize {
+        return ChunkPlan{VideoSize: size, ChunkSize: size, TotalChunkCount: 1}, nil
+    }
+    chunk := preferred
+    if chunk == 0 {
+        chunk = DefaultChunkSize
+    }
+    if chunk < MinChunkSize || chunk > MaxChunkSize {
+        return ChunkPlan{}, fmt.Errorf("chunk size %d out of range [%d, %d]", chunk, MinChunkSize, MaxChunkSize)
+    }
+    // Grow the chunk until the count fits TikTok's limit.
+    for size/chunk > MaxChunkCount && chunk < MaxChunkSize {
+        chunk *= 2
+        if chunk > MaxChunkSize {
+            chunk = MaxChunkSize
+        }
+    }
+    count := size / chunk
+    if count > MaxChunkCount {
+        return ChunkPlan{}, fmt.Errorf("video too large: %d bytes", size)
+    }
+    if size <= chunk {
+        return ChunkPlan{VideoSize: size, ChunkSize: size, TotalChunkCount: 1}, nil
+    }
+    // The final chunk is ChunkSize plus a remainder below ChunkSize, which
+    // keeps it under MaxFinalChunkSize.
+    return ChunkPlan{VideoSize: size, ChunkSize: chunk, TotalChunkCount: int(count)}, nil
+}
+
+// Range returns the inclusive byte range of chunk i.
+func (p ChunkPlan) Range(i int) (first, last int64) {
+    first = int64(i) * p.ChunkSize
+    last = first + p.ChunkSize - 1
+    if i == p.TotalChunkCount-1 {
+        last = p.VideoSize - 1
+    }
+    return first, last
+}
+
+// UploadState is everything needed to continue an upload after a restart.
+type UploadState struct {
+    PublishID   string    `json:"publish_id"`
+    UploadURL   string    `json:"upload_url"`
+    ContentType string    `json:"content_type"`
+    Plan        ChunkPlan `json:"plan"`
+    // NextChunk is the index of the first chunk not yet acknowledged.
+    NextChunk int `json:"next_chunk"`
+}
+
+// Done reports whether every chunk has been acknowledged.
+func (s UploadState) Done() bool { return s.NextChunk >= s.Plan.TotalChunkCount }
+
+// UploadProgress is reported after each acknowledged chunk.
+type UploadProgress struct {
+    PublishID   string
+    Chunk       int
+    TotalChunks int
+    SentBytes   int64
+    TotalBytes  int64
+}
+
+// Uploader PUTs video chunks to a FILE_UPLOAD upload_url.
+type Uploader struct {
+    HTTP *http.Client
+    // MaxAttempts per chunk; defaults to 3.
+    MaxAttempts int
+    // Backoff before the first retry, doubled on each further attempt.
+    Backoff time.Duration
+    // OnProgress is called after each acknowledged chunk.
+    OnProgress func(UploadProgress)
+    // OnCheckpoint is called with the updated state after each
+    // acknowledged chunk; returning an error aborts the upload.
+    OnCheckpoint func(UploadState) error
+    // Observer, when set, is told the latency and outcome of each chunk.
+    Observer CallObserver
+}
+
+// Upload sends the chunks of st starting at st.NextChunk and returns the
+// final state. r must expose the whole video.
+func (u *Uploader) Upload(ctx context.Context, st UploadState, r io.ReaderAt) (UploadState, error) {
+    if st.UploadURL == "" {
+        return st, errors.New("missing upload_url")
+    }
+    if st.ContentType == "" {
+        st.ContentType = "video/mp4"
+    }
+    for !st.Done() {
+        if err := u.putChunkWithRetry(ctx, st, r); err != nil {
+            return st, fmt.Errorf("chunk %d/%d: %w", st.NextChunk+1, st.Plan.TotalChunkCount, err)
+        }
+        _, last := st.Plan.Range(st.NextChunk)
+        st.NextChunk++
+        if u.OnCheckpoint != nil {
+            if err := u.OnCheckpoint(st); err != nil {
+                return st, fmt.Errorf("save checkpoint: %w", err)
+            }
+        }
+        if u.OnProgress != nil {
+            u.OnProgress(UploadProgress{
+                PublishID:   st.PublishID,
+                Chunk:       st.NextChunk,
+                TotalChunks: st.Plan.TotalChunkCount,
+                SentBytes:   last + 1,
+                TotalBytes:  st.Plan.VideoSize,
+            })
+        }
+    }
+    return st, nil
+}
+
+func (u *Uploader) putChunkWithRetry(ctx context.Context, st UploadState, r io.ReaderAt) error {
+    attempts := u.MaxAttempts
+    if attempts <= 0 {
+        attempts = defaultUploadAttempts
+    }
+    backoff := u.Backoff
+    if backoff <= 0 {
+        backoff = time.Second
+    }
+    var err error
+    for i := 0; i < attempts; i++ {
+        if i > 0 {
+            select {
+            case <-ctx.Done():
+                return ctx.Err()
+            case <-time.After(backoff):
+            }
+            backoff *= 2
+        }
+        var retry bool
+        retry, err = u.putChunk(ctx, st, r)
+        if err == nil || !retry {
+            return err
+        }
+    }
+    return err
+}
+
+// putChunk uploads one chunk; the bool tells whether a failure is retryable.
+func (u *Uploader) putChunk(ctx context.Context, st UploadState, r io.ReaderAt) (_ bool, err error) {
+    first, last := st.Plan.Range(st.NextChunk)
+    section := io.NewSectionReader(r, first, last-first+1)
+    req, err := http.NewRequestWithContext(ctx, http.MethodPut, st.UploadURL, section)
+    if err != nil {
+        return false, err
+    }
+    req.ContentLength = last - first + 1
+    req.Header.Set("Content-Type", st.ContentType)
+    req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, st.Plan.VideoSize))
+    call := startCall(u.Observer, req)
+    defer func() { call.done(err) }()
+
+    resp, err := defaultUploadHTTPClient(u.HTTP).Do(req)
+    if err != nil {
+        return ctx.Err() == nil, err
+    }
+    defer resp.Body.Close()
+    call.response(resp)
+    body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+    if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+        return false, nil
+    }
+    retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+    return retry, fmt.Errorf("upload failed: status=%d body=%s", resp.StatusCode, trunc(body, 1024))
+}
+
+func defaultUploadHTTPClient(c *http.Client) *http.Client {
+    if c != nil {
+        return c
+    }
+    return &http.Client{Timeout: 5 * time.Minute}
+}
+
+// UploadVideo uploads a FILE_UPLOAD video to init.UploadURL with
+// c.Uploader (or a default Uploader). Chunking follows the plan declared
+// by InitVideoPost, never a fresh one: TikTok rejects chunks that do not
+// match it.
+func (c *Client) UploadVideo(ctx context.Context, init doauth.PostInit, src doauth.VideoSource, r io.ReaderAt) error {
+    plan := ChunkPlan{VideoSize: src.VideoSize, ChunkSize: init.ChunkSize, TotalChunkCount: init.TotalChunkCount}
+    if plan.ChunkSize == 0 || plan.TotalChunkCount == 0 {
+        return errors.New("post init carries no chunk plan")
+    }
+    up := c.Uploader
+    if up == nil {
+        up = &Uploader{Observer: c.Observer}
+    }
+    _, err := up.Upload(ctx, UploadState{PublishID: init.PublishID, UploadURL: init.UploadURL, Plan: plan}, r)
+    return err
+}
+
+// ContentTypeFor guesses the upload Content-Type from a file name.
+func ContentTypeFor(name string) string {
+    switch strings.ToLower(filepath.Ext(name)) {
+    case ".mov":
+        return "video/quicktime"
+    case ".webm":
+        return "video/webm"
+    default:
+        return "video/mp4"
+    }
+}
+
+// LoadCheckpoint reads an UploadState saved by SaveCheckpoint.
+// A missing file returns os.ErrNotExist.
+func LoadCheckpoint(path string) (UploadState, error) {
+    b, err := os.ReadFile(path)
+    if err != nil {
+        return UploadState{}, err
+    }
+    var st UploadState
+    if err := json.Unmarshal(b, &st); err != nil {
+        return UploadState{}, fmt.Errorf("decode checkpoint: %w", err)
+    }
+    return st, nil
+}
+
+// SaveCheckpoint atomically writes st to path.
+func SaveCheckpoint(path string, st UploadState) error {
+    b, err := json.MarshalIndent(st, "", "  ")
+    if err != nil {
+        return err
+    }
+    tmp := path + ".tmp"
+    if err := os.WriteFile(tmp, b, 0o600); err != nil {
+        return err
+    }
+    return os.Rename(tmp, path)
+}
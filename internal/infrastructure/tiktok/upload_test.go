@@ -0,0 +1,170 @@
+package tiktok
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "strings"
+    "time"
+
+    doauth "tiktok-oauth/internal/domain/oauth"
+)
+
+func TestPlanChunks(t *testing.T) {
+    cases := []struct {
+        size, preferred int64
+        chunk           int64
+        count           int
+    }{
+        {size: 1 << 20, chunk: 1 << 20, count: 1},
+        {size: 7 << 20, chunk: 7 << 20, count: 1},
+        {size: 25 << 20, chunk: 10 << 20, count: 2},
+        {size: 25 << 20, preferred: 5 << 20, chunk: 5 << 20, count: 5},
+        {size: 20000 << 20, chunk: 20 << 20, count: 1000},
+    }
+    for _, tc := range cases {
+        p, err := PlanChunks(tc.size, tc.preferred)
+        if err != nil {
+            t.Fatalf("size=%d: unexpected error: %v", tc.size, err)
+        }
+        if p.ChunkSize != tc.chunk || p.TotalChunkCount != tc.count {
+            t.Errorf("size=%d: got chunk=%d count=%d, want chunk=%d count=%d", tc.size, p.ChunkSize, p.TotalChunkCount, tc.chunk, tc.count)
+        }
+        if _, last := p.Range(p.TotalChunkCount - 1); last != tc.size-1 {
+            t.Errorf("size=%d: last chunk ends at %d", tc.size, last)
+        }
+    }
+    if _, err := PlanChunks(25<<20, 1<<20); err == nil {
+        t.Errorf("expected error for chunk below minimum")
+    }
+}
+
+// chunkServer records Content-Range headers and fails the first attempt
+// of the chunks listed in flaky.
+type chunkServer struct {
+    mu     sync.Mutex
+    ranges []string
+    flaky  map[string]bool
+}
+
+func (s *chunkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    _, _ = io.Copy(io.Discard, r.Body)
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    cr := r.Header.Get("Content-Range")
+    if s.flaky[cr] {
+        delete(s.flaky, cr)
+        w.WriteHeader(http.StatusServiceUnavailable)
+        return
+    }
+    s.ranges = append(s.ranges, cr)
+    w.WriteHeader(http.StatusPartialContent)
+}
+
+func TestUploader_RetryAndResume(t *testing.T) {
+    plan := ChunkPlan{VideoSize: 25, ChunkSize: 10, TotalChunkCount: 2}
+    srv := &chunkServer{flaky: map[string]bool{"bytes 10-24/25": true}}
+    ts := httptest.NewServer(srv)
+    defer ts.Close()
+
+    var checkpoints []int
+    up := &Uploader{
+        Backoff: time.Millisecond,
+        OnCheckpoint: func(st UploadState) error {
+            checkpoints = append(checkpoints, st.NextChunk)
+            return nil
+        },
+    }
+    video := bytes.NewReader(make([]byte, 25))
+
+    // Resume after the first chunk was already acknowledged.
+    st, err := up.Upload(context.Background(), UploadState{UploadURL: ts.URL, Plan: plan, NextChunk: 1}, video)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if !st.Done() {
+        t.Fatalf("upload not done: %#v", st)
+    }
+    if want := []string{"bytes 10-24/25"}; fmt.Sprint(srv.ranges) != fmt.Sprint(want) {
+        t.Fatalf("unexpected ranges: %v", srv.ranges)
+    }
+    if fmt.Sprint(checkpoints) != "[2]" {
+        t.Fatalf("unexpected checkpoints: %v", checkpoints)
+    }
+}
+
+func TestUploader_NonRetryableFailure(t *testing.T) {
+    calls := 0
+    ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        calls++
+        w.WriteHeader(http.StatusBadRequest)
+    }))
+    defer ts.Close()
+
+    up := &Uploader{Backoff: time.Millisecond}
+    plan := ChunkPlan{VideoSize: 5, ChunkSize: 5, TotalChunkCount: 1}
+    st, err := up.Upload(context.Background(), UploadState{UploadURL: ts.URL, Plan: plan}, bytes.NewReader(make([]byte, 5)))
+    if err == nil {
+        t.Fatalf("expected error")
+    }
+    if calls != 1 || st.NextChunk != 0 {
+        t.Fatalf("calls=%d next=%d", calls, st.NextChunk)
+    }
+}
+
+func TestUploadVideo_FollowsInitPlan(t *testing.T) {
+    const size = 25 << 20
+    var declared int
+    var puts []string
+    rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+        body := `{"data":{"publish_id":"p1","upload_url":"https://upload.example/u"},"error":{"code":"ok"}}`
+        if r.Method == http.MethodPut {
+            puts = append(puts, r.Header.Get("Content-Range"))
+            body = ""
+        } else {
+            var in struct {
+                SourceInfo doauth.VideoSource `json:"source_info"`
+            }
+            if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+                return nil, err
+            }
+            declared = in.SourceInfo.TotalChunkCount
+        }
+        return &http.Response{StatusCode: 200, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}, nil
+    })
+    httpc := &http.Client{Transport: rt}
+    c := &Client{HTTP: httpc, Uploader: &Uploader{HTTP: httpc}}
+
+    // A chunk size without a count: the upload must use the plan sent at
+    // init (4 chunks of 6 MiB), not the default 10 MiB one.
+    src := doauth.VideoSource{Source: doauth.SourceFileUpload, VideoSize: size, ChunkSize: 6 << 20}
+    init, err := c.InitVideoPost(context.Background(), "act", doauth.PostInfo{}, src)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := c.UploadVideo(context.Background(), init, src, bytes.NewReader(make([]byte, size))); err != nil {
+        t.Fatal(err)
+    }
+    if declared != 4 || len(puts) != declared {
+        t.Fatalf("declared %d chunks, uploaded %v", declared, puts)
+    }
+}
+
+func TestInitVideoPost_InvalidChunkSize(t *testing.T) {
+    rt := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+        t.Fatalf("unexpected request to %s", r.URL)
+        return nil, nil
+    })
+    c := &Client{HTTP: &http.Client{Transport: rt}}
+    src := doauth.VideoSource{Source: doauth.SourceFileUpload, VideoSize: 25 << 20, ChunkSize: 1 << 20}
+    if _, err := c.InitVideoPost(context.Background(), "act", doauth.PostInfo{}, src); !errors.Is(err, doauth.ErrInvalidPost) {
+        t.Fatalf("expected ErrInvalidPost, got %v", err)
+    }
+}
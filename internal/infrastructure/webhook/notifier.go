@@ -0,0 +1,107 @@
+package webhook
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "slices"
+    "strconv"
+    "time"
+
+    doauth "tiktok-oauth/internal/domain/oauth"
+)
+
+// Headers set on every outbound callback.
+const (
+    HeaderSignature = "X-Signature"
+    HeaderTimestamp = "X-Signature-Timestamp"
+    HeaderEvent     = "X-Event"
+)
+
+// Notifier POSTs publish events as JSON to a list of URLs. Each request
+// is signed with HMAC-SHA256 over "<timestamp>.<body>" using Secret and
+// sent as "X-Signature: sha256=<hex>", so receivers can verify origin and
+// reject replays by checking X-Signature-Timestamp.
+type Notifier struct {
+    URLs   []string
+    Secret string
+    HTTP   *http.Client
+}
+
+// Validate rejects a notifier without a secret, whose signatures anyone
+// could forge.
+func (n *Notifier) Validate() error {
+    if len(n.URLs) > 0 && n.Secret == "" {
+        return errors.New("a signing secret is required with webhook URLs")
+    }
+    return nil
+}
+
+// Notify delivers ev to every URL not in delivered and returns the URLs
+// that have it now. It fails if any delivery fails so the tracker retries
+// on the next poll, without sending duplicates to the others.
+func (n *Notifier) Notify(ctx context.Context, ev doauth.PublishEvent, delivered []string) ([]string, error) {
+    if err := n.Validate(); err != nil {
+        return delivered, err
+    }
+    body, err := json.Marshal(ev)
+    if err != nil {
+        return delivered, err
+    }
+    done := append([]string(nil), delivered...)
+    var errs []error
+    for _, u := range n.URLs {
+        if slices.Contains(delivered, u) {
+            continue
+        }
+        if err := n.post(ctx, u, ev.Event, body); err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", u, err))
+            continue
+        }
+        done = append(done, u)
+    }
+    return done, errors.Join(errs...)
+}
+
+func (n *Notifier) post(ctx context.Context, url, event string, body []byte) error {
+    ts := strconv.FormatInt(time.Now().Unix(), 10)
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set(HeaderEvent, event)
+    req.Header.Set(HeaderTimestamp, ts)
+    req.Header.Set(HeaderSignature, "sha256="+Sign(n.Secret, ts, body))
+
+    httpClient := n.HTTP
+    if httpClient == nil {
+        httpClient = &http.Client{Timeout: 10 * time.Second}
+    }
+    resp, err := httpClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    _, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+    if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+        return fmt.Errorf("callback failed: status=%d", resp.StatusCode)
+    }
+    return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>".
+func Sign(secret, timestamp string, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(timestamp))
+    mac.Write([]byte("."))
+    mac.Write(body)
+    return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,49 @@
+package webhook
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    doauth "tiktok-oauth/internal/domain/oauth"
+)
+
+func TestNotify_RetriesOnlyFailedURLs(t *testing.T) {
+    hits := map[string]int{}
+    down := true
+    ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        hits[r.URL.Path]++
+        if r.URL.Path == "/flaky" && down {
+            w.WriteHeader(http.StatusServiceUnavailable)
+            return
+        }
+        if r.Header.Get(HeaderSignature) == "" {
+            t.Errorf("%s: unsigned request", r.URL.Path)
+        }
+    }))
+    defer ts.Close()
+
+    n := &Notifier{URLs: []string{ts.URL + "/ok", ts.URL + "/flaky"}, Secret: "s3cret"}
+    ev := doauth.PublishEvent{Event: "publish.completed", PublishID: "p1"}
+    delivered, err := n.Notify(context.Background(), ev, nil)
+    if err == nil {
+        t.Fatal("expected an error for the failing URL")
+    }
+    down = false
+    if delivered, err = n.Notify(context.Background(), ev, delivered); err != nil {
+        t.Fatal(err)
+    }
+    if hits["/ok"] != 1 || hits["/flaky"] != 2 || len(delivered) != 2 {
+        t.Fatalf("hits %v, delivered %v", hits, delivered)
+    }
+}
+
+func TestValidate(t *testing.T) {
+    if err := (&Notifier{URLs: []string{"https://hooks.example/x"}}).Validate(); err == nil {
+        t.Fatal("expected an error without a secret")
+    }
+    if err := (&Notifier{}).Validate(); err != nil {
+        t.Fatalf("no URLs: %v", err)
+    }
+}
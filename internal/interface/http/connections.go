@@ -0,0 +1,103 @@
+package httpiface
+
+import (
+    "errors"
+    "net/http"
+
+    "github.com/labstack/echo/v4"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
+
+    "tiktok-oauth/internal/domain/oauth"
+    "tiktok-oauth/internal/pkg/httpx"
+)
+
+// connKey and connTokenKey are the echo.Context keys of the
+// oauth.Connection and oauth.Token resolved by RequireConnection.
+const (
+    connKey      = "connection"
+    connTokenKey = "connection_token"
+)
+
+// Link handles GET /auth/:provider/link: it starts the OAuth flow to add
+// another account to the signed-in user, or to grant more scopes (?scope=)
+// to one already linked. The provider redirects back to the usual
+// callback.
+func (h *Handler) Link(c echo.Context) error {
+    provider := providerParam(c)
+    opts := beginOptions(c)
+    if opts.Mode == oauth.LoginModePopup && !h.Popup.Enabled() {
+        return httpx.Error(c, http.StatusBadRequest, "popup_disabled", nil)
+    }
+    url, err := h.Auth.BeginLink(c.Request().Context(), sessionID(c), provider, opts)
+    if err != nil {
+        return h.beginError(c, provider, err)
+    }
+    return c.Redirect(http.StatusFound, url)
+}
+
+// ListConnections handles GET /api/connections.
+func (h *Handler) ListConnections(c echo.Context) error {
+    _, conns, err := h.Auth.User(c.Request().Context(), sessionID(c))
+    if err != nil {
+        return h.accountError(c, err)
+    }
+    return c.JSON(http.StatusOK, connectionsResponse{Connections: conns})
+}
+
+type connectionsResponse struct {
+    Connections []oauth.Connection `json:"connections"`
+}
+
+// Unlink handles DELETE /api/connections/:connection_id. With
+// ?revoke=true the provider token is revoked as well.
+func (h *Handler) Unlink(c echo.Context) error {
+    err := h.Auth.Unlink(c.Request().Context(), sessionID(c), c.Param("connection_id"), c.QueryParam("revoke") == "true")
+    if err != nil {
+        return h.accountError(c, err)
+    }
+    return c.NoContent(http.StatusNoContent)
+}
+
+// RequireConnection resolves :connection_id of the signed-in user to the
+// connection and a fresh TikTok access token for the posting handlers
+// behind it.
+func (h *Handler) RequireConnection(next echo.HandlerFunc) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        ctx := c.Request().Context()
+        conn, err := h.Auth.Connection(ctx, sessionID(c), c.Param("connection_id"))
+        if err != nil {
+            return h.accountError(c, err)
+        }
+        if conn.Provider != oauth.ProviderTikTok {
+            return httpx.Error(c, http.StatusBadRequest, "not_a_tiktok_connection", nil)
+        }
+        trace.SpanFromContext(ctx).SetAttributes(attribute.String("connection_id", conn.ID), attribute.String("open_id", conn.Subject))
+        httpx.LogWith(c, "open_id", conn.Subject)
+        tok, err := h.UC.FreshToken(c.Request().Context(), conn.Subject)
+        if err != nil {
+            httpx.Log(c).Error("token for connection", "connection_id", conn.ID, "err", err)
+            return httpx.Error(c, http.StatusBadGateway, "token_refresh_failed", nil)
+        }
+        c.Set(connKey, conn)
+        c.Set(connTokenKey, tok)
+        return next(c)
+    }
+}
+
+func (h *Handler) accountError(c echo.Context, err error) error {
+    switch {
+    case errors.Is(err, oauth.ErrNotSignedIn):
+        return httpx.Error(c, http.StatusUnauthorized, "not_signed_in", nil)
+    case errors.Is(err, oauth.ErrNotFound):
+        return httpx.Error(c, http.StatusNotFound, "connection_not_found", nil)
+    case errors.Is(err, oauth.ErrLastConnection):
+        return httpx.Error(c, http.StatusConflict, "last_connection", nil)
+    case errors.Is(err, oauth.ErrRevokeFailed):
+        httpx.Log(c).Error("accounts", "err", err)
+        return httpx.Error(c, http.StatusBadGateway, "revoke_failed", nil)
+    default:
+        httpx.Log(c).Error("accounts", "err", err)
+        return httpx.Error(c, http.StatusInternalServerError, "store_error", nil)
+    }
+}
@@ -0,0 +1,126 @@
+package httpiface
+
+import (
+    "errors"
+    "net/http"
+    "net/url"
+    "time"
+
+    "github.com/labstack/echo/v4"
+    "github.com/labstack/echo/v4/middleware"
+
+    "tiktok-oauth/internal/domain/oauth"
+    "tiktok-oauth/internal/pkg/httpx"
+)
+
+// deviceCodeGrant is the RFC 8628 grant type for device token requests.
+const deviceCodeGrant = "urn:ietf:params:oauth:grant-type:device_code"
+
+// deviceSubmitRate and deviceSubmitBurst bound how many user codes one
+// client can try at /device: a burst of 5, then one every 6 seconds.
+const (
+    deviceSubmitRate  = 1.0 / 6
+    deviceSubmitBurst = 5
+)
+
+// DeviceAuthorization handles POST /oauth2/device_authorization: a
+// headless client gets a device code to poll /oauth2/token with and a
+// user code for the user to enter at /device.
+func (h *Handler) DeviceAuthorization(c echo.Context) error {
+    c.Response().Header().Set("Cache-Control", "no-store")
+    var req deviceAuthorizationRequest
+    if err := c.Bind(&req); err != nil {
+        return tokenError(c, http.StatusBadRequest, "invalid_request", "")
+    }
+    g, err := h.Auth.StartDevice(c.Request().Context(), req.ClientID, oauth.ParseScopes(req.Scope))
+    switch {
+    case errors.Is(err, oauth.ErrInvalidClient):
+        return tokenError(c, http.StatusUnauthorized, "invalid_client", "")
+    case errors.Is(err, oauth.ErrInvalidScope):
+        return tokenError(c, http.StatusBadRequest, "invalid_scope", err.Error())
+    case err != nil:
+        httpx.Log(c).Error("device authorization", "err", err)
+        return tokenError(c, http.StatusInternalServerError, "server_error", "")
+    }
+    verify := h.publicURL("/device")
+    return c.JSON(http.StatusOK, deviceAuthorizationResponse{
+        DeviceCode:              g.DeviceCode,
+        UserCode:                g.DisplayUserCode(),
+        VerificationURI:         verify,
+        VerificationURIComplete: verify + "?" + url.Values{"user_code": {g.DisplayUserCode()}}.Encode(),
+        ExpiresIn:               int64(time.Until(g.ExpiresAt).Seconds()),
+        Interval:                int64(g.Interval.Seconds()),
+    })
+}
+
+// deviceAuthorizationRequest is the form of POST
+// /oauth2/device_authorization.
+type deviceAuthorizationRequest struct {
+    ClientID string `form:"client_id"`
+    Scope    string `form:"scope"`
+}
+
+// deviceAuthorizationResponse is the RFC 8628 section 3.2 response.
+type deviceAuthorizationResponse struct {
+    DeviceCode              string `json:"device_code"`
+    UserCode                string `json:"user_code"`
+    VerificationURI         string `json:"verification_uri"`
+    VerificationURIComplete string `json:"verification_uri_complete"`
+    ExpiresIn               int64  `json:"expires_in"`
+    Interval                int64  `json:"interval"`
+}
+
+// DevicePage handles GET /device, the form the user enters the code in.
+// ?user_code= (from verification_uri_complete) pre-fills it.
+func (h *Handler) DevicePage(c echo.Context) error {
+    return h.renderDevice(c, http.StatusOK, devicePage{UserCode: c.QueryParam("user_code")})
+}
+
+// DeviceSubmit handles POST /device and starts the TikTok login that
+// approves the device.
+func (h *Handler) DeviceSubmit(c echo.Context) error {
+    // The form only makes sense from our own page; refuse cross-site posts
+    // that would make a signed-in TikTok user approve someone's device.
+    if origin := c.Request().Header.Get("Origin"); origin != "" && origin != c.Scheme()+"://"+c.Request().Host {
+        return h.renderDevice(c, http.StatusForbidden, devicePage{Error: "device.error.cross_site"})
+    }
+    userCode := c.FormValue("user_code")
+    url, err := h.Auth.BeginDevice(c.Request().Context(), userCode)
+    switch {
+    case errors.Is(err, oauth.ErrInvalidUserCode):
+        return h.renderDevice(c, http.StatusBadRequest, devicePage{UserCode: userCode, Error: "device.error.invalid_code"})
+    case err != nil:
+        httpx.Log(c).Error("device login", "err", err)
+        return h.renderDevice(c, http.StatusInternalServerError, devicePage{UserCode: userCode, Error: "device.error.start_failed"})
+    }
+    return c.Redirect(http.StatusFound, url)
+}
+
+// deviceSubmitLimit rate-limits POST /device per client IP, so user codes
+// cannot be guessed by trying many of them.
+func (h *Handler) deviceSubmitLimit() echo.MiddlewareFunc {
+    return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+        Store: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+            Rate:      deviceSubmitRate,
+            Burst:     deviceSubmitBurst,
+            ExpiresIn: 10 * time.Minute,
+        }),
+        DenyHandler: func(c echo.Context, _ string, _ error) error {
+            httpx.Log(c).Warn("device code attempts rate-limited")
+            return h.renderDevice(c, http.StatusTooManyRequests, devicePage{Error: "device.error.too_many_attempts"})
+        },
+    })
+}
+
+// devicePage is the data of contents/device.html. Status is "" (code
+// form), "approved" or "denied"; Error is a message catalog key.
+type devicePage struct {
+    Status   string
+    UserCode string
+    Error    string
+}
+
+func (h *Handler) renderDevice(c echo.Context, status int, p devicePage) error {
+    c.Response().Header().Set("Cache-Control", "no-store")
+    return render(c, status, "device", p)
+}
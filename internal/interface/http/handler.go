@@ -1,13 +1,11 @@
 package httpiface
 
 import (
-    "crypto/rand"
-    "encoding/hex"
+    "errors"
     "net/http"
+    "net/url"
     "strings"
-    "fmt"
-    "html/template"
-    "path/filepath"
+    "time"
 
     "github.com/labstack/echo/v4"
 
@@ -16,62 +14,205 @@ import (
 )
 
 type Handler struct {
-    UC          *oauth.UseCase
-    RedirectURI string
+    UC            *oauth.UseCase
+    Auth          *oauth.Auth
+    // Tracker follows posts in the background; nil disables tracking.
+    Tracker       *oauth.PublishTracker
+    Scheduler     *oauth.Scheduler
+    // Popup configures ?mode=popup logins; disabled when empty.
+    Popup         PopupConfig
+    // Legal holds the terms of service and privacy policy versions.
+    Legal         *oauth.LegalLibrary
+    // Verification keeps uploaded domain-verification files.
+    Verification  *oauth.VerificationFiles
+    // AdminToken guards the /admin API; empty disables it.
+    AdminToken    string
+    // SecureCookies marks cookies Secure. It comes from configuration
+    // rather than the request, which is plain HTTP behind a proxy that
+    // terminates TLS.
+    SecureCookies bool
+    // PublicBaseURL is the URL clients reach the server at. URLs handed to
+    // other devices, such as the device verification URI and the QR code,
+    // are built from it rather than from the request's Host header.
+    PublicBaseURL string
 }
 
+// sessionCookie holds the session ID issued by Callback.
+const sessionCookie = "sid"
+
+// sessionScheme is the Authorization scheme apps send the session issued
+// by /oauth2/token with. It is not Bearer so that a session can never be
+// mistaken for another kind of token, such as ADMIN_TOKEN.
+const sessionScheme = "Session"
+
+// Login handles GET /auth/:provider/login (and /auth/login for TikTok).
+// ?scope= asks for scopes beyond the configured ones, ?return_to= is
+// where the browser is sent after the callback and ?mode=popup (with an
+// optional ?nonce=) answers the callback with a postMessage page.
 func (h *Handler) Login(c echo.Context) error {
-    state := randomHex(16)
-    url := h.UC.LoginURL(state, h.RedirectURI)
-    c.Logger().Infof("redirecting to TikTok auth: state_generated")
+    provider := providerParam(c)
+    opts := beginOptions(c)
+    if opts.Mode == oauth.LoginModePopup && !h.Popup.Enabled() {
+        return httpx.Error(c, http.StatusBadRequest, "popup_disabled", nil)
+    }
+    url, err := h.Auth.Begin(c.Request().Context(), provider, opts)
+    if err != nil {
+        return h.beginError(c, provider, err)
+    }
+    httpx.Log(c).Info("redirecting to auth: state_generated", "provider", provider)
     return c.Redirect(http.StatusFound, url)
 }
 
+// beginError maps errors of Auth.Begin and Auth.BeginLink.
+func (h *Handler) beginError(c echo.Context, provider string, err error) error {
+    switch {
+    case errors.Is(err, oauth.ErrUnknownProvider):
+        return httpx.Error(c, http.StatusNotFound, "unknown_provider", provider)
+    case errors.Is(err, oauth.ErrInvalidScope):
+        return httpx.Error(c, http.StatusBadRequest, "invalid_scope", err.Error())
+    case errors.Is(err, oauth.ErrInvalidReturnTo):
+        return httpx.Error(c, http.StatusBadRequest, "invalid_return_to", nil)
+    case errors.Is(err, oauth.ErrInvalidLoginRequest):
+        return httpx.Error(c, http.StatusBadRequest, "invalid_login_request", err.Error())
+    case errors.Is(err, oauth.ErrInvalidClient):
+        return httpx.Error(c, http.StatusBadRequest, "invalid_client", err.Error())
+    case errors.Is(err, oauth.ErrNotSignedIn):
+        return h.accountError(c, err)
+    default:
+        httpx.Log(c).Error("begin login", "err", err)
+        return httpx.Error(c, http.StatusInternalServerError, "store_error", nil)
+    }
+}
+
+// Callback handles GET /auth/:provider/callback (and /auth/callback for
+// TikTok): it completes the login, sets the session cookie and, when the
+// login was started with return_to, redirects there. Popup logins get a
+// page that posts the result to the opener instead.
 func (h *Handler) Callback(c echo.Context) error {
+    provider := providerParam(c)
     if e := c.QueryParam("error"); e != "" {
-        c.Logger().Errorf("oauth error on callback: %s", e)
-        return httpx.JSONError(c, http.StatusBadRequest, "oauth_error", map[string]string{"error": e})
+        httpx.Log(c).Error("oauth error on callback", "error", e)
+        // Send the browser back to where it started, with the error.
+        if st, err := h.Auth.Abort(c.Request().Context(), provider, c.QueryParam("state")); err == nil {
+            if st.Mode == oauth.LoginModePopup {
+                return h.popupError(c, st, e)
+            }
+            if st.App != nil {
+                return c.Redirect(http.StatusFound, oauth.AppRedirect(st.App, url.Values{"error": {e}}))
+            }
+            if st.Mode == oauth.LoginModeDevice {
+                return h.renderDevice(c, http.StatusOK, devicePage{Status: "denied"})
+            }
+            if st.Mode == oauth.LoginModeQR {
+                return h.renderQR(c, http.StatusOK, qrPage{View: "denied"})
+            }
+            if st.ReturnTo != "" && !wantsJSON(c) {
+                return c.Redirect(http.StatusFound, withQuery(st.ReturnTo, "error", e))
+            }
+        }
+        return httpx.Error(c, http.StatusBadRequest, "oauth_error", map[string]string{"error": e})
     }
     code := c.QueryParam("code")
     if code == "" {
-        return httpx.JSONError(c, http.StatusBadRequest, "missing_code", nil)
+        return httpx.Error(c, http.StatusBadRequest, "missing_code", nil)
     }
 
-    ctx := c.Request().Context()
-    tok, err := h.UC.Callback(ctx, code, h.RedirectURI)
-    if err != nil {
-        c.Logger().Errorf("token exchange failed: %v", err)
-        return httpx.JSONError(c, http.StatusBadGateway, "token_exchange_failed", nil)
+    res, err := h.Auth.Complete(c.Request().Context(), provider, c.QueryParam("state"), code)
+    if err != nil && res.Request.Mode == oauth.LoginModePopup {
+        httpx.Log(c).Error("popup login failed", "err", err)
+        code := "token_exchange_failed"
+        if errors.Is(err, oauth.ErrAlreadyLinked) {
+            code = "already_linked"
+        }
+        return h.popupError(c, res.Request, code)
+    }
+    if err != nil && res.Request.App != nil {
+        httpx.Log(c).Error("app login failed", "err", err)
+        return c.Redirect(http.StatusFound, oauth.AppRedirect(res.Request.App, url.Values{"error": {"server_error"}}))
+    }
+    if err != nil && res.Request.Mode == oauth.LoginModeDevice {
+        httpx.Log(c).Error("device login failed", "err", err)
+        return h.renderDevice(c, http.StatusBadGateway, devicePage{Error: "device.error.login_failed"})
+    }
+    if err != nil && res.Request.Mode == oauth.LoginModeQR {
+        httpx.Log(c).Error("qr login failed", "err", err)
+        return h.qrError(c, err)
+    }
+    switch {
+    case errors.Is(err, oauth.ErrUnknownProvider):
+        return httpx.Error(c, http.StatusNotFound, "unknown_provider", provider)
+    case errors.Is(err, oauth.ErrInvalidState):
+        return httpx.Error(c, http.StatusBadRequest, "invalid_state", nil)
+    case errors.Is(err, oauth.ErrAlreadyLinked):
+        return httpx.Error(c, http.StatusConflict, "already_linked", nil)
+    case err != nil:
+        httpx.Log(c).Error("token exchange failed", "err", err)
+        return httpx.Error(c, http.StatusBadGateway, "token_exchange_failed", nil)
+    }
+    if res.Token.OpenID != "" {
+        httpx.LogWith(c, "open_id", res.Token.OpenID)
+    }
+    if len(res.DeniedScopes) > 0 {
+        httpx.Log(c).Info("login: scopes not granted", "provider", provider, "denied_scopes", res.DeniedScopes)
+    }
+    if res.AppRedirect != "" {
+        // The app gets the session by exchanging the code; the browser
+        // that ran the login is left signed out.
+        return c.Redirect(http.StatusFound, res.AppRedirect)
+    }
+    if res.Request.Mode == oauth.LoginModeDevice {
+        // Likewise the device picks up the session at /oauth2/token.
+        return h.renderDevice(c, http.StatusOK, devicePage{Status: "approved"})
+    }
+    if res.Request.Mode == oauth.LoginModeQR {
+        // The screen that showed the QR code picks up the session.
+        return h.renderQR(c, http.StatusOK, qrPage{View: "approved"})
+    }
+    if !res.Linked {
+        h.setSessionCookie(c, res.Session)
+    }
+    tok := res.Token
+    if res.Request.Mode == oauth.LoginModePopup {
+        if res.ProfileErr != nil {
+            httpx.Log(c).Error("user info fetch failed", "err", res.ProfileErr)
+        }
+        return h.popupSuccess(c, res)
     }
 
-    // Fetch user info
-    fields := []string{"open_id", "display_name", "avatar_url"}
-    user, err := h.UC.GetUserInfo(ctx, tok.AccessToken, fields)
-    if err != nil {
-        c.Logger().Errorf("user info fetch failed: %v", err)
+    if res.ProfileErr != nil {
+        httpx.Log(c).Error("user info fetch failed", "err", res.ProfileErr)
         // Still return token with user error
-        return c.JSON(http.StatusOK, map[string]any{
-            "token": tokenToMap(tok),
-            "user":  map[string]any{"data": nil, "error": err.Error()},
+        msg := res.ProfileErr.Error()
+        return c.JSON(http.StatusOK, callbackResponse{
+            Token: newTokenBody(tok),
+            User:  callbackUser{Error: &msg},
         })
     }
 
     // If client explicitly requests JSON, keep existing JSON response
-    if strings.Contains(c.Request().Header.Get("Accept"), "application/json") || c.QueryParam("format") == "json" {
-        return c.JSON(http.StatusOK, map[string]any{
-            "token": tokenToMap(tok),
-            "user":  map[string]any{"data": user, "error": nil},
+    if wantsJSON(c) {
+        return c.JSON(http.StatusOK, callbackResponse{
+            Token: newTokenBody(tok),
+            User:  callbackUser{Data: res.Profile.Raw},
+            callbackLogin: &callbackLogin{
+                Profile:      res.Profile,
+                Connection:   res.Connection,
+                Linked:       res.Linked,
+                DeniedScopes: res.DeniedScopes,
+                ReturnTo:     res.Request.ReturnTo,
+                LegalPending: nonNil(res.LegalPending),
+            },
         })
     }
-
-    avatarURL, displayName := extractUserProfile(user)
-    // Render HTML using a template file under contents/callback.html
-    tplPath := filepath.Join("contents", "callback.html")
-    t, err := template.ParseFiles(tplPath)
-    if err != nil {
-        c.Logger().Errorf("failed to parse callback template: %v", err)
-        return c.String(http.StatusInternalServerError, "callback template not found")
+    if len(res.LegalPending) > 0 {
+        // A newer version of the terms is in effect: accept it first.
+        return c.Redirect(http.StatusFound, legalRedirect(res.Request.ReturnTo))
+    }
+    if res.Request.ReturnTo != "" {
+        return c.Redirect(http.StatusFound, res.Request.ReturnTo)
     }
+
+    // Render HTML using contents/callback.html
     data := struct {
         AccessToken  string
         RefreshToken string
@@ -80,64 +221,160 @@ func (h *Handler) Callback(c echo.Context) error {
     }{
         AccessToken:  tok.AccessToken,
         RefreshToken: tok.RefreshToken,
-        AvatarURL:    avatarURL,
-        DisplayName:  displayName,
+        AvatarURL:    res.Profile.AvatarURL,
+        DisplayName:  res.Profile.DisplayName,
     }
-    c.Response().Header().Set(echo.HeaderContentType, "text/html; charset=utf-8")
-    c.Response().WriteHeader(http.StatusOK)
-    if err := t.Execute(c.Response().Writer, data); err != nil {
-        c.Logger().Errorf("failed to execute callback template: %v", err)
-        return c.String(http.StatusInternalServerError, "failed to render template")
+    return render(c, http.StatusOK, "callback", data)
+}
+
+// Logout handles POST /auth/logout. With ?revoke=true the provider token
+// is revoked and deleted as well, canceling its scheduled posts.
+func (h *Handler) Logout(c echo.Context) error {
+    sid := sessionID(c)
+    h.clearSessionCookie(c)
+    err := h.Auth.Logout(c.Request().Context(), sid, c.QueryParam("revoke") == "true")
+    if err != nil && !errors.Is(err, oauth.ErrNotSignedIn) {
+        return h.accountError(c, err)
     }
-    return nil
+    return c.NoContent(http.StatusNoContent)
 }
 
-func randomHex(n int) string {
-    b := make([]byte, n)
-    if _, err := rand.Read(b); err != nil {
-        // Should not happen; fall back to timestamp-like pseudo
-        return hex.EncodeToString([]byte("fallbackstateseed"))
+// Me handles GET /api/me and returns the signed-in user, the profile used
+// to sign in and the user's connections.
+func (h *Handler) Me(c echo.Context) error {
+    ctx := c.Request().Context()
+    s, err := h.Auth.Session(ctx, sessionID(c))
+    if err != nil {
+        return h.accountError(c, err)
+    }
+    u, conns, err := h.Auth.User(ctx, s.ID)
+    if err != nil {
+        return h.accountError(c, err)
     }
-    return hex.EncodeToString(b)
+    return c.JSON(http.StatusOK, meResponse{User: u, Profile: s.Profile, Connections: conns, ExpiresAt: s.ExpiresAt})
+}
+
+// Providers handles GET /auth/providers.
+func (h *Handler) Providers(c echo.Context) error {
+    return c.JSON(http.StatusOK, providersResponse{Providers: h.Auth.Providers()})
+}
+
+// wantsJSON reports whether the client asked for JSON instead of HTML.
+func wantsJSON(c echo.Context) bool {
+    return strings.Contains(c.Request().Header.Get("Accept"), "application/json") || c.QueryParam("format") == "json"
 }
 
-func tokenToMap(t oauth.Token) map[string]any {
-    return map[string]any{
-        "access_token":  t.AccessToken,
-        "refresh_token": t.RefreshToken,
-        "expires_in":    t.ExpiresIn,
-        "open_id":       t.OpenID,
-        "scope":         t.Scope,
-        "token_type":    t.TokenType,
+// withQuery returns target with key=value added to its query.
+func withQuery(target, key, value string) string {
+    u, err := url.Parse(target)
+    if err != nil {
+        return target
     }
+    q := u.Query()
+    q.Set(key, value)
+    u.RawQuery = q.Encode()
+    return u.String()
 }
 
-// extractUserProfile attempts to pull avatar_url and display_name
-// from TikTok user info response structure.
-func extractUserProfile(m map[string]any) (avatarURL, displayName string) {
-    // Expected shapes:
-    // m = { "data": { "user": { "avatar_url": "", "display_name": "" } }, ... }
-    // or sometimes m = { "data": { "data": { "user": { ... } } } }
-    getStr := func(v any) string {
-        if v == nil { return "" }
-        if s, ok := v.(string); ok { return s }
-        return fmt.Sprint(v)
+// providerParam returns the :provider path segment; the legacy
+// /auth/login and /auth/callback routes mean TikTok.
+func providerParam(c echo.Context) string {
+    if p := c.Param("provider"); p != "" {
+        return p
     }
-    var data any
-    if v, ok := m["data"]; ok {
-        data = v
+    return oauth.ProviderTikTok
+}
+
+// sessionID reads the session cookie or, for apps that exchanged a code at
+// /oauth2/token, the "Authorization: Session" header.
+func sessionID(c echo.Context) string {
+    if ck, err := c.Cookie(sessionCookie); err == nil {
+        return ck.Value
     }
-    if dm, ok := data.(map[string]any); ok {
-        // direct user
-        if u, ok := dm["user"].(map[string]any); ok {
-            return getStr(u["avatar_url"]), getStr(u["display_name"])
-        }
-        // nested data.user
-        if inner, ok := dm["data"].(map[string]any); ok {
-            if u, ok := inner["user"].(map[string]any); ok {
-                return getStr(u["avatar_url"]), getStr(u["display_name"])
-            }
-        }
+    return authCredentials(c, sessionScheme)
+}
+
+// publicURL returns the absolute URL of path as clients reach it.
+func (h *Handler) publicURL(path string) string {
+    return strings.TrimSuffix(h.PublicBaseURL, "/") + path
+}
+
+func (h *Handler) setSessionCookie(c echo.Context, s oauth.Session) {
+    c.SetCookie(&http.Cookie{
+        Name:     sessionCookie,
+        Value:    s.ID,
+        Path:     "/",
+        Expires:  s.ExpiresAt,
+        HttpOnly: true,
+        Secure:   h.SecureCookies,
+        SameSite: http.SameSiteLaxMode,
+    })
+}
+
+func (h *Handler) clearSessionCookie(c echo.Context) {
+    c.SetCookie(&http.Cookie{
+        Name:     sessionCookie,
+        Value:    "",
+        Path:     "/",
+        MaxAge:   -1,
+        HttpOnly: true,
+        Secure:   h.SecureCookies,
+        SameSite: http.SameSiteLaxMode,
+    })
+}
+
+// callbackResponse is the JSON answer of Callback. When the profile could
+// not be fetched only the token and the error are returned.
+type callbackResponse struct {
+    Token tokenBody    `json:"token"`
+    User  callbackUser `json:"user"`
+    *callbackLogin
+}
+
+// callbackUser carries the provider's raw user info, or why it is missing.
+type callbackUser struct {
+    Data  map[string]any `json:"data"`
+    Error *string        `json:"error"`
+}
+
+type callbackLogin struct {
+    Profile      oauth.Profile         `json:"profile"`
+    Connection   oauth.Connection      `json:"connection"`
+    Linked       bool                  `json:"linked"`
+    DeniedScopes []string              `json:"denied_scopes"`
+    ReturnTo     string                `json:"return_to"`
+    LegalPending []oauth.LegalDocument `json:"legal_pending"`
+}
+
+// tokenBody is the provider token as the callback shows it.
+type tokenBody struct {
+    AccessToken  string `json:"access_token"`
+    RefreshToken string `json:"refresh_token"`
+    ExpiresIn    int64  `json:"expires_in"`
+    OpenID       string `json:"open_id"`
+    Scope        string `json:"scope"`
+    TokenType    string `json:"token_type"`
+}
+
+func newTokenBody(t oauth.Token) tokenBody {
+    return tokenBody{
+        AccessToken:  t.AccessToken,
+        RefreshToken: t.RefreshToken,
+        ExpiresIn:    t.ExpiresIn,
+        OpenID:       t.OpenID,
+        Scope:        t.Scope,
+        TokenType:    t.TokenType,
     }
-    return "", ""
+}
+
+// meResponse is the JSON answer of Me.
+type meResponse struct {
+    User        oauth.User         `json:"user"`
+    Profile     oauth.Profile      `json:"profile"`
+    Connections []oauth.Connection `json:"connections"`
+    ExpiresAt   time.Time          `json:"expires_at"`
+}
+
+type providersResponse struct {
+    Providers []string `json:"providers"`
 }
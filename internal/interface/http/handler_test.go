@@ -0,0 +1,384 @@
+package httpiface
+
+import (
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "io"
+    "maps"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+    "testing/fstest"
+
+    "github.com/labstack/echo/v4"
+
+    "tiktok-oauth/internal/domain/oauth"
+    "tiktok-oauth/internal/infrastructure/store"
+)
+
+// login signs in through the TikTok callback and returns the response.
+func login(t *testing.T, e *echo.Echo) *httptest.ResponseRecorder {
+    t.Helper()
+    rec := httptest.NewRecorder()
+    e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+    loc, _ := url.Parse(rec.Header().Get(echo.HeaderLocation))
+    req := httptest.NewRequest(http.MethodGet, "/auth/callback?"+url.Values{"code": {"c"}, "state": {loc.Query().Get("state")}}.Encode(), nil)
+    req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+    rec = httptest.NewRecorder()
+    e.ServeHTTP(rec, req)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("callback: %d %s", rec.Code, rec.Body.String())
+    }
+    return rec
+}
+
+func TestSessionCookie_SecureFromConfig(t *testing.T) {
+    // The request is plain HTTP, as behind a proxy that terminates TLS.
+    e := newTestServer(t, func(h *Handler) { h.SecureCookies = true })
+    rec := login(t, e)
+    for _, ck := range rec.Result().Cookies() {
+        if ck.Name == sessionCookie {
+            if !ck.Secure {
+                t.Fatal("session cookie is not Secure")
+            }
+            return
+        }
+    }
+    t.Fatal("no session cookie")
+}
+
+func TestSessionID_SessionScheme(t *testing.T) {
+    e := newTestServer(t)
+    var sid string
+    for _, ck := range login(t, e).Result().Cookies() {
+        if ck.Name == sessionCookie {
+            sid = ck.Value
+        }
+    }
+    if sid == "" {
+        t.Fatal("no session cookie")
+    }
+    for _, tc := range []struct {
+        auth string
+        want int
+    }{
+        {"Session " + sid, http.StatusOK},
+        {"session " + sid, http.StatusOK},
+        // Bearer is reserved for other tokens, such as ADMIN_TOKEN.
+        {"Bearer " + sid, http.StatusUnauthorized},
+    } {
+        req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+        req.Header.Set(echo.HeaderAuthorization, tc.auth)
+        rec := httptest.NewRecorder()
+        e.ServeHTTP(rec, req)
+        if rec.Code != tc.want {
+            t.Errorf("%s: expected %d, got %d", strings.Fields(tc.auth)[0], tc.want, rec.Code)
+        }
+    }
+}
+
+func TestDeviceSubmit_RateLimited(t *testing.T) {
+    e := newTestServer(t)
+    var codes []int
+    for i := 0; i <= deviceSubmitBurst; i++ {
+        req := httptest.NewRequest(http.MethodPost, "/device", strings.NewReader("user_code=BCDF-GHJK"))
+        req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+        rec := httptest.NewRecorder()
+        e.ServeHTTP(rec, req)
+        codes = append(codes, rec.Code)
+    }
+    for i, code := range codes[:deviceSubmitBurst] {
+        if code != http.StatusBadRequest {
+            t.Fatalf("attempt %d: expected 400, got %d", i+1, code)
+        }
+    }
+    if last := codes[deviceSubmitBurst]; last != http.StatusTooManyRequests {
+        t.Fatalf("expected 429 after %d attempts, got %d", deviceSubmitBurst, last)
+    }
+}
+
+func TestQRSecretCookie_SecureFromConfig(t *testing.T) {
+    e := newTestServer(t, func(h *Handler) {
+        h.SecureCookies = true
+        mem, err := store.Open("")
+        if err != nil {
+            t.Fatal(err)
+        }
+        h.Auth.SetQRLoginStore(mem)
+    })
+    rec := httptest.NewRecorder()
+    e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/qr", nil))
+    for _, ck := range rec.Result().Cookies() {
+        if ck.Name == qrSecretCookie {
+            if !ck.Secure {
+                t.Fatal("qr secret cookie is not Secure")
+            }
+            return
+        }
+    }
+    t.Fatalf("no qr secret cookie: %d %s", rec.Code, rec.Body.String())
+}
+
+func TestQRStatus_SeenApproved(t *testing.T) {
+    e := newTestServer(t, func(h *Handler) {
+        mem, err := store.Open("")
+        if err != nil {
+            t.Fatal(err)
+        }
+        h.Auth.SetQRLoginStore(mem)
+    })
+    rec := httptest.NewRecorder()
+    e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/qr", nil))
+    var secret *http.Cookie
+    for _, ck := range rec.Result().Cookies() {
+        if ck.Name == qrSecretCookie {
+            secret = ck
+        }
+    }
+    if secret == nil {
+        t.Fatalf("no qr login: %d %s", rec.Code, rec.Body.String())
+    }
+    rec = httptest.NewRecorder()
+    e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, secret.Path+"/scan", nil))
+    loc, _ := url.Parse(rec.Header().Get(echo.HeaderLocation))
+    rec = httptest.NewRecorder()
+    e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/callback?"+url.Values{"code": {"c"}, "state": {loc.Query().Get("state")}}.Encode(), nil))
+    if rec.Code != http.StatusOK {
+        t.Fatalf("callback: %d %s", rec.Code, rec.Body.String())
+    }
+
+    poll := func(seen string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodGet, secret.Path+"/status?seen="+seen, nil)
+        req.AddCookie(secret)
+        rec := httptest.NewRecorder()
+        e.ServeHTTP(rec, req)
+        return rec
+    }
+    for i := 0; i < 2; i++ {
+        rec := poll("approved")
+        if rec.Code != http.StatusBadRequest || len(rec.Result().Cookies()) > 0 {
+            t.Fatalf("poll %d with seen=approved: %d, cookies %v", i+1, rec.Code, rec.Result().Cookies())
+        }
+    }
+    if rec := poll("scanned"); rec.Code != http.StatusOK || len(rec.Result().Cookies()) != 1 {
+        t.Fatalf("pick-up: %d %s", rec.Code, rec.Body.String())
+    }
+    if rec := poll("scanned"); rec.Code != http.StatusForbidden || len(rec.Result().Cookies()) > 0 {
+        t.Fatalf("second pick-up: %d %s", rec.Code, rec.Body.String())
+    }
+}
+
+func TestRequireLegal_EveryLoginFlow(t *testing.T) {
+    v1 := fstest.MapFS{
+        "legal/terms/2025-10-01.txt":   {Data: []byte("Terms v1\n")},
+        "legal/privacy/2025-10-01.txt": {Data: []byte("Privacy v1\n")},
+    }
+    lib, err := oauth.LoadLegalDocuments(v1, "legal")
+    if err != nil {
+        t.Fatal(err)
+    }
+    var (
+        h   *Handler
+        mem *store.Memory
+    )
+    e := newTestServer(t, func(hh *Handler) {
+        h = hh
+        if mem, err = store.Open(""); err != nil {
+            t.Fatal(err)
+        }
+        h.Auth.SetLegal(lib, mem)
+        h.Auth.SetAppClients([]oauth.AppClient{
+            {ID: "app", RedirectURIs: []string{"myapp://oauth"}},
+            {ID: "tv", DeviceFlow: true},
+        }, mem)
+        h.Auth.SetDeviceStore(mem)
+        h.Auth.SetQRLoginStore(mem)
+        h.Popup = PopupConfig{TargetOrigin: "https://dash.example.com", Secret: "s"}
+    })
+    do := func(method, target, form string, hdr ...string) *httptest.ResponseRecorder {
+        t.Helper()
+        var body io.Reader
+        if form != "" {
+            body = strings.NewReader(form)
+        }
+        req := httptest.NewRequest(method, target, body)
+        if form != "" {
+            req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+        }
+        for i := 0; i+1 < len(hdr); i += 2 {
+            req.Header.Add(hdr[i], hdr[i+1])
+        }
+        rec := httptest.NewRecorder()
+        e.ServeHTTP(rec, req)
+        return rec
+    }
+    // callback finishes the TikTok login started by a redirect.
+    callback := func(rec *httptest.ResponseRecorder) *httptest.ResponseRecorder {
+        t.Helper()
+        loc, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+        if err != nil || loc.Query().Get("state") == "" {
+            t.Fatalf("no login redirect: %d %s", rec.Code, rec.Body.String())
+        }
+        return do(http.MethodGet, "/auth/callback?"+url.Values{"code": {"c"}, "state": {loc.Query().Get("state")}}.Encode(), "")
+    }
+    cookie := func(rec *httptest.ResponseRecorder) string {
+        t.Helper()
+        for _, ck := range rec.Result().Cookies() {
+            if ck.Name == sessionCookie {
+                return sessionScheme + " " + ck.Value
+            }
+        }
+        t.Fatalf("no session cookie: %d %s", rec.Code, rec.Body.String())
+        return ""
+    }
+    token := func(form string) string {
+        t.Helper()
+        rec := do(http.MethodPost, "/oauth2/token", form)
+        var tok tokenResponse
+        if err := json.Unmarshal(rec.Body.Bytes(), &tok); err != nil || tok.AccessToken == "" {
+            t.Fatalf("token: %d %s", rec.Code, rec.Body.String())
+        }
+        return tok.TokenType + " " + tok.AccessToken
+    }
+
+    logins := map[string]string{}
+    logins["json"] = cookie(login(t, e))
+    logins["popup"] = cookie(callback(do(http.MethodGet, "/auth/login?mode=popup&nonce=n", "")))
+
+    verifier := "app-verifier-0123456789-0123456789-0123456789"
+    rec := callback(do(http.MethodGet, "/auth/login?"+url.Values{
+        "client_id":             {"app"},
+        "redirect_uri":          {"myapp://oauth"},
+        "code_challenge":        {challengeS256(verifier)},
+        "code_challenge_method": {"S256"},
+    }.Encode(), ""))
+    loc, _ := url.Parse(rec.Header().Get(echo.HeaderLocation))
+    logins["app"] = token(url.Values{
+        "grant_type":    {"authorization_code"},
+        "client_id":     {"app"},
+        "code":          {loc.Query().Get("code")},
+        "redirect_uri":  {"myapp://oauth"},
+        "code_verifier": {verifier},
+    }.Encode())
+
+    rec = do(http.MethodPost, "/oauth2/device_authorization", "client_id=tv")
+    var dev deviceAuthorizationResponse
+    if err := json.Unmarshal(rec.Body.Bytes(), &dev); err != nil {
+        t.Fatalf("device authorization: %d %s", rec.Code, rec.Body.String())
+    }
+    callback(do(http.MethodPost, "/device", url.Values{"user_code": {dev.UserCode}}.Encode()))
+    logins["device"] = token(url.Values{"grant_type": {deviceCodeGrant}, "client_id": {"tv"}, "device_code": {dev.DeviceCode}}.Encode())
+
+    rec = do(http.MethodGet, "/auth/qr", "")
+    var secret *http.Cookie
+    for _, ck := range rec.Result().Cookies() {
+        if ck.Name == qrSecretCookie {
+            secret = ck
+        }
+    }
+    if secret == nil {
+        t.Fatalf("no qr login: %d %s", rec.Code, rec.Body.String())
+    }
+    callback(do(http.MethodPost, secret.Path+"/scan", ""))
+    logins["qr"] = cookie(do(http.MethodGet, secret.Path+"/status?seen=scanned", "", "Cookie", secret.Name+"="+secret.Value))
+
+    for flow, auth := range logins {
+        if rec := do(http.MethodGet, "/api/me", "", echo.HeaderAuthorization, auth); rec.Code != http.StatusOK {
+            t.Fatalf("%s: /api/me before the update: %d %s", flow, rec.Code, rec.Body.String())
+        }
+    }
+
+    // New terms take effect while the sessions are alive.
+    v2 := fstest.MapFS{"legal/terms/2026-04-01.txt": {Data: []byte("Terms v2\n")}}
+    maps.Copy(v2, v1)
+    if lib, err = oauth.LoadLegalDocuments(v2, "legal"); err != nil {
+        t.Fatal(err)
+    }
+    h.Auth.SetLegal(lib, mem)
+
+    for flow, auth := range logins {
+        for _, target := range []string{"/api/me", "/api/connections"} {
+            rec := do(http.MethodGet, target, "", echo.HeaderAuthorization, auth)
+            if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "legal_acceptance_required") {
+                t.Fatalf("%s: %s with terms pending: %d %s", flow, target, rec.Code, rec.Body.String())
+            }
+        }
+        if rec := do(http.MethodGet, "/api/me/legal", "", echo.HeaderAuthorization, auth); rec.Code != http.StatusOK {
+            t.Fatalf("%s: legal status: %d %s", flow, rec.Code, rec.Body.String())
+        }
+    }
+    auth := logins["device"]
+    req := httptest.NewRequest(http.MethodPost, "/api/me/legal", strings.NewReader(`{"versions":{"terms":"2026-04-01"}}`))
+    req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+    req.Header.Set(echo.HeaderAuthorization, auth)
+    rec = httptest.NewRecorder()
+    e.ServeHTTP(rec, req)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("accept: %d %s", rec.Code, rec.Body.String())
+    }
+    if rec := do(http.MethodGet, "/api/me", "", echo.HeaderAuthorization, auth); rec.Code != http.StatusOK {
+        t.Fatalf("/api/me after accepting: %d %s", rec.Code, rec.Body.String())
+    }
+    if rec := do(http.MethodGet, "/api/me", ""); rec.Code != http.StatusUnauthorized {
+        t.Fatalf("/api/me signed out: %d", rec.Code)
+    }
+}
+
+// challengeS256 is the PKCE S256 challenge of verifier.
+func challengeS256(verifier string) string {
+    sum := sha256.Sum256([]byte(verifier))
+    return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestDeviceAuthorization_PublicURL(t *testing.T) {
+    e := newTestServer(t, func(h *Handler) {
+        mem, err := store.Open("")
+        if err != nil {
+            t.Fatal(err)
+        }
+        h.Auth.SetAppClients([]oauth.AppClient{{ID: "tv", DeviceFlow: true}}, mem)
+        h.Auth.SetDeviceStore(mem)
+        h.PublicBaseURL = "https://auth.example.com"
+    })
+    req := httptest.NewRequest(http.MethodPost, "/oauth2/device_authorization", strings.NewReader("client_id=tv"))
+    req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+    // The Host header is the client's to choose, or internal behind a proxy.
+    req.Host = "attacker.example"
+    rec := httptest.NewRecorder()
+    e.ServeHTTP(rec, req)
+    var dev deviceAuthorizationResponse
+    if err := json.Unmarshal(rec.Body.Bytes(), &dev); err != nil {
+        t.Fatalf("device authorization: %d %s", rec.Code, rec.Body.String())
+    }
+    if dev.VerificationURI != "https://auth.example.com/device" || !strings.HasPrefix(dev.VerificationURIComplete, "https://auth.example.com/device?user_code=") {
+        t.Fatalf("verification URIs not on the public URL: %q %q", dev.VerificationURI, dev.VerificationURIComplete)
+    }
+}
+
+func TestRequireScopes_NarrowerRegrant(t *testing.T) {
+    h := &Handler{}
+    next := h.RequireScopes(oauth.ScopeVideoPublish)(func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+    serve := func(conn oauth.Connection, tok oauth.Token) int {
+        c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+        c.Set(connKey, conn)
+        c.Set(connTokenKey, tok)
+        if err := next(c); err != nil {
+            t.Fatal(err)
+        }
+        return c.Response().Status
+    }
+
+    // A re-grant that left video.publish unticked: the connection still
+    // holds it from the first authorization, and denied_scopes said so.
+    conn := oauth.Connection{Scopes: []string{oauth.ScopeUserInfoBasic, oauth.ScopeVideoPublish}}
+    if got := serve(conn, oauth.Token{Scope: oauth.ScopeUserInfoBasic}); got != http.StatusNoContent {
+        t.Fatalf("narrower re-grant: %d", got)
+    }
+    conn.Scopes = []string{oauth.ScopeUserInfoBasic}
+    if got := serve(conn, oauth.Token{Scope: oauth.ScopeUserInfoBasic}); got != http.StatusForbidden {
+        t.Fatalf("connection without video.publish: %d", got)
+    }
+}
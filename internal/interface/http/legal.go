@@ -0,0 +1,232 @@
+package httpiface
+
+import (
+    "errors"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+
+    "github.com/labstack/echo/v4"
+
+    "tiktok-oauth/internal/domain/oauth"
+    "tiktok-oauth/internal/pkg/httpx"
+)
+
+// legalAcceptPath is the re-acceptance page logins are sent to when a
+// newer version of a legal document is in effect.
+const legalAcceptPath = "/legal/accept"
+
+// LegalDocument handles GET /terms-of-service and /privacy-policy (the
+// version in effect) and /terms-of-service/:version (any published
+// version) for the document kind. Browsers get HTML; ?format=text or an
+// Accept header preferring text/plain gets the text as published, and
+// ?format=json the metadata and the list of versions.
+func (h *Handler) LegalDocument(kind string) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        var (
+            doc oauth.LegalDocument
+            err error
+        )
+        if v := c.Param("version"); v != "" {
+            doc, err = h.Legal.Version(kind, v)
+        } else {
+            doc, err = h.Legal.Current(kind, time.Now())
+        }
+        if err != nil {
+            return httpx.Error(c, http.StatusNotFound, "document_not_found", nil)
+        }
+        c.Response().Header().Set("Cache-Control", "no-cache")
+        switch {
+        case wantsJSON(c):
+            return c.JSON(http.StatusOK, legalDocumentResponse{Document: doc, Versions: h.Legal.Versions(kind)})
+        case wantsText(c):
+            return c.Blob(http.StatusOK, echo.MIMETextPlainCharsetUTF8, []byte(doc.Text))
+        }
+        return render(c, http.StatusOK, "legal", legalPage{Document: doc, Upcoming: time.Now().Before(doc.EffectiveAt)})
+    }
+}
+
+// LegalStatus handles GET /api/me/legal: the versions in effect, what the
+// signed-in user accepted and what they still have to accept.
+func (h *Handler) LegalStatus(c echo.Context) error {
+    accepted, pending, err := h.Auth.LegalStatus(c.Request().Context(), sessionID(c))
+    if err != nil {
+        return h.accountError(c, err)
+    }
+    return c.JSON(http.StatusOK, legalStatusResponse{
+        Current:  nonNil(h.Auth.CurrentLegal()),
+        Accepted: accepted,
+        Pending:  nonNil(pending),
+    })
+}
+
+// AcceptLegalAPI handles POST /api/me/legal with {"versions": {"terms":
+// "2025-10-01"}}, for clients that show the documents themselves.
+func (h *Handler) AcceptLegalAPI(c echo.Context) error {
+    var req acceptLegalRequest
+    if err := c.Bind(&req); err != nil || len(req.Versions) == 0 {
+        return httpx.Error(c, http.StatusBadRequest, "invalid_body", nil)
+    }
+    err := h.Auth.AcceptLegal(c.Request().Context(), sessionID(c), req.Versions)
+    if errors.Is(err, oauth.ErrLegalVersionMismatch) {
+        return httpx.Error(c, http.StatusConflict, "legal_version_mismatch", err.Error())
+    }
+    if err != nil {
+        return h.accountError(c, err)
+    }
+    return h.LegalStatus(c)
+}
+
+// LegalAcceptPage handles GET /legal/accept, the interstitial listing the
+// documents the signed-in user has to accept again. ?return_to= is where
+// the browser goes afterwards.
+func (h *Handler) LegalAcceptPage(c echo.Context) error {
+    _, pending, err := h.Auth.LegalStatus(c.Request().Context(), sessionID(c))
+    if errors.Is(err, oauth.ErrNotSignedIn) {
+        return c.Redirect(http.StatusFound, "/")
+    }
+    if err != nil {
+        return h.accountError(c, err)
+    }
+    next := h.legalReturnTo(c.QueryParam("return_to"))
+    if len(pending) == 0 {
+        return c.Redirect(http.StatusFound, next)
+    }
+    return h.renderLegalAccept(c, http.StatusOK, legalAcceptPage{Documents: pending, ReturnTo: next})
+}
+
+// LegalAccept handles POST /legal/accept: the form carries the version of
+// each document shown, so a version published in the meantime is not
+// accepted unseen.
+func (h *Handler) LegalAccept(c echo.Context) error {
+    if origin := c.Request().Header.Get("Origin"); origin != "" && origin != c.Scheme()+"://"+c.Request().Host {
+        return h.renderLegalAccept(c, http.StatusForbidden, legalAcceptPage{Error: "legal.error.cross_site"})
+    }
+    form, err := c.FormParams()
+    if err != nil {
+        return httpx.Error(c, http.StatusBadRequest, "invalid_body", nil)
+    }
+    versions := map[string]string{}
+    for _, kind := range form["kind"] {
+        versions[kind] = form.Get("version_" + kind)
+    }
+    next := h.legalReturnTo(form.Get("return_to"))
+    ctx := c.Request().Context()
+    err = h.Auth.AcceptLegal(ctx, sessionID(c), versions)
+    switch {
+    case errors.Is(err, oauth.ErrNotSignedIn):
+        return c.Redirect(http.StatusFound, "/")
+    case errors.Is(err, oauth.ErrLegalVersionMismatch):
+        _, pending, err := h.Auth.LegalStatus(ctx, sessionID(c))
+        if err != nil {
+            return h.accountError(c, err)
+        }
+        return h.renderLegalAccept(c, http.StatusConflict, legalAcceptPage{Documents: pending, ReturnTo: next, Error: "legal.error.changed"})
+    case err != nil:
+        return h.accountError(c, err)
+    }
+    // Documents left unchecked are shown again.
+    if _, pending, err := h.Auth.LegalStatus(ctx, sessionID(c)); err == nil && len(pending) > 0 {
+        return h.renderLegalAccept(c, http.StatusOK, legalAcceptPage{Documents: pending, ReturnTo: next})
+    }
+    return c.Redirect(http.StatusSeeOther, next)
+}
+
+// RequireLegal refuses requests of a signed-in user who has a newer
+// version of a legal document to accept. App, device, QR, popup and JSON
+// logins never show the interstitial, so the check guards the routes
+// rather than the login. Requests without a session go through; the
+// handler answers them.
+func (h *Handler) RequireLegal(next echo.HandlerFunc) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        _, pending, err := h.Auth.LegalStatus(c.Request().Context(), sessionID(c))
+        if errors.Is(err, oauth.ErrNotSignedIn) {
+            return next(c)
+        }
+        if err != nil {
+            return h.accountError(c, err)
+        }
+        if len(pending) == 0 {
+            return next(c)
+        }
+        docs := make([]string, len(pending))
+        for i, d := range pending {
+            docs[i] = d.Kind + " " + d.Version
+        }
+        return httpx.Error(c, http.StatusForbidden, "legal_acceptance_required", strings.Join(docs, ", "))
+    }
+}
+
+// legalRedirect returns the interstitial URL for a login that has legal
+// documents pending, continuing to returnTo.
+func legalRedirect(returnTo string) string {
+    if returnTo == "" {
+        return legalAcceptPath
+    }
+    return legalAcceptPath + "?" + url.Values{"return_to": {returnTo}}.Encode()
+}
+
+// legalReturnTo falls back to the top page for targets outside the
+// return_to allow-list.
+func (h *Handler) legalReturnTo(target string) string {
+    if target, err := h.Auth.CheckReturnTo(target); err == nil {
+        return target
+    }
+    return "/"
+}
+
+type legalDocumentResponse struct {
+    Document oauth.LegalDocument   `json:"document"`
+    Versions []oauth.LegalDocument `json:"versions"`
+}
+
+// legalStatusResponse is the JSON answer of LegalStatus.
+type legalStatusResponse struct {
+    Current  []oauth.LegalDocument   `json:"current"`
+    Accepted []oauth.LegalAcceptance `json:"accepted"`
+    Pending  []oauth.LegalDocument   `json:"pending"`
+}
+
+// acceptLegalRequest maps document kinds to the versions accepted.
+type acceptLegalRequest struct {
+    Versions map[string]string `json:"versions"`
+}
+
+// legalPage is the data of contents/legal.html. Upcoming marks a version
+// published ahead of its effective date.
+type legalPage struct {
+    Document oauth.LegalDocument
+    Upcoming bool
+}
+
+// legalAcceptPage is the data of contents/legal_accept.html; Error is a
+// message catalog key.
+type legalAcceptPage struct {
+    Documents []oauth.LegalDocument
+    ReturnTo  string
+    Error     string
+}
+
+func (h *Handler) renderLegalAccept(c echo.Context, status int, p legalAcceptPage) error {
+    c.Response().Header().Set("Cache-Control", "no-store")
+    return render(c, status, "legal_accept", p)
+}
+
+// wantsText reports whether the client asked for plain text rather than
+// HTML.
+func wantsText(c echo.Context) bool {
+    if c.QueryParam("format") == "text" {
+        return true
+    }
+    accept := c.Request().Header.Get("Accept")
+    return strings.HasPrefix(accept, "text/plain") && !strings.Contains(accept, "text/html")
+}
+
+// nonNil keeps empty lists as [] rather than null in JSON.
+func nonNil[T any](s []T) []T {
+    if s == nil {
+        return []T{}
+    }
+    return s
+}
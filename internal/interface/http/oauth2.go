@@ -0,0 +1,96 @@
+package httpiface
+
+import (
+    "errors"
+    "net/http"
+    "time"
+
+    "github.com/labstack/echo/v4"
+
+    "tiktok-oauth/internal/domain/oauth"
+    "tiktok-oauth/internal/pkg/httpx"
+)
+
+// oauth2Error is the RFC 6749 section 5.2 error body.
+type oauth2Error struct {
+    Error       string `json:"error"`
+    Description string `json:"error_description,omitempty"`
+}
+
+// tokenRequest is the form of POST /oauth2/token for both grants.
+type tokenRequest struct {
+    GrantType    string `form:"grant_type"`
+    ClientID     string `form:"client_id"`
+    Code         string `form:"code"`
+    RedirectURI  string `form:"redirect_uri"`
+    CodeVerifier string `form:"code_verifier"`
+    DeviceCode   string `form:"device_code"`
+}
+
+// tokenResponse carries our session; token_type names the Authorization
+// scheme to send it with.
+type tokenResponse struct {
+    AccessToken string `json:"access_token"`
+    TokenType   string `json:"token_type"`
+    ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Token handles POST /oauth2/token. Apps redeem the one-time code from an
+// app login (grant_type=authorization_code) with their PKCE verifier, and
+// devices poll with their device code; both get our session, sent back as
+// "Authorization: Session <access_token>". TikTok tokens never leave the
+// server.
+func (h *Handler) Token(c echo.Context) error {
+    c.Response().Header().Set("Cache-Control", "no-store")
+    c.Response().Header().Set("Pragma", "no-cache")
+    var req tokenRequest
+    if err := c.Bind(&req); err != nil {
+        return tokenError(c, http.StatusBadRequest, "invalid_request", "")
+    }
+    var (
+        s   oauth.Session
+        err error
+    )
+    switch req.GrantType {
+    case "authorization_code":
+        if req.Code == "" || req.CodeVerifier == "" {
+            return tokenError(c, http.StatusBadRequest, "invalid_request", "code and code_verifier are required")
+        }
+        s, err = h.Auth.ExchangeAppCode(c.Request().Context(), req.ClientID, req.Code, req.RedirectURI, req.CodeVerifier)
+    case deviceCodeGrant:
+        if req.DeviceCode == "" {
+            return tokenError(c, http.StatusBadRequest, "invalid_request", "device_code is required")
+        }
+        s, err = h.Auth.PollDevice(c.Request().Context(), req.ClientID, req.DeviceCode)
+    case "":
+        return tokenError(c, http.StatusBadRequest, "invalid_request", "grant_type is required")
+    default:
+        return tokenError(c, http.StatusBadRequest, "unsupported_grant_type", "")
+    }
+    switch {
+    case errors.Is(err, oauth.ErrInvalidClient):
+        return tokenError(c, http.StatusUnauthorized, "invalid_client", "")
+    case errors.Is(err, oauth.ErrInvalidGrant):
+        return tokenError(c, http.StatusBadRequest, "invalid_grant", "")
+    case errors.Is(err, oauth.ErrAuthorizationPending):
+        return tokenError(c, http.StatusBadRequest, "authorization_pending", "")
+    case errors.Is(err, oauth.ErrSlowDown):
+        return tokenError(c, http.StatusBadRequest, "slow_down", "")
+    case errors.Is(err, oauth.ErrAccessDenied):
+        return tokenError(c, http.StatusBadRequest, "access_denied", "")
+    case errors.Is(err, oauth.ErrExpiredToken):
+        return tokenError(c, http.StatusBadRequest, "expired_token", "")
+    case err != nil:
+        httpx.Log(c).Error("token endpoint", "err", err)
+        return tokenError(c, http.StatusInternalServerError, "server_error", "")
+    }
+    return c.JSON(http.StatusOK, tokenResponse{
+        AccessToken: s.ID,
+        TokenType:   sessionScheme,
+        ExpiresIn:   int64(time.Until(s.ExpiresAt).Seconds()),
+    })
+}
+
+func tokenError(c echo.Context, status int, code, desc string) error {
+    return c.JSON(status, oauth2Error{Error: code, Description: desc})
+}
@@ -0,0 +1,268 @@
+package httpiface
+
+import (
+    "encoding/json"
+    "net/http"
+    "sort"
+
+    "github.com/labstack/echo/v4"
+
+    "tiktok-oauth/internal/domain/oauth"
+    "tiktok-oauth/internal/pkg/httpx"
+    "tiktok-oauth/internal/pkg/openapi"
+    "tiktok-oauth/internal/pkg/static"
+)
+
+// Security schemes of the API document.
+const (
+    securitySession     = "session"
+    securitySessionAuth = "sessionToken"
+    securityAdmin       = "adminToken"
+)
+
+// Media types the document uses beyond the openapi package's.
+const (
+    mimePNG = "image/png"
+    mimeSVG = "image/svg+xml"
+)
+
+// APIDocument describes every route: those of Handler.Routes and the
+// site routes main registers. Request and response bodies are the types
+// the handlers bind and encode, so the document follows the code.
+func APIDocument() *openapi.Document {
+    s := openapi.New(openapi.Info{
+        Title:       "TikTok OAuth",
+        Version:     "1.0.0",
+        Description: "Sign in with TikTok and other OAuth providers, and post to TikTok through the Content Posting API. Errors are RFC 7807 problem details.",
+    })
+    s.SecurityScheme(securitySession, openapi.SecurityScheme{Type: "apiKey", In: "cookie", Name: sessionCookie, Description: "Session cookie set by the login callback."})
+    s.SecurityScheme(securitySessionAuth, openapi.SecurityScheme{Type: "http", Scheme: "session", Description: "Session issued to apps and devices by POST /oauth2/token, sent as \"Authorization: Session <access_token>\"."})
+    s.SecurityScheme(securityAdmin, openapi.SecurityScheme{Type: "http", Scheme: "bearer", Description: "ADMIN_TOKEN."})
+    add := func(r openapi.Route) {
+        // Any route can fail with a problem; browsers get it as a page.
+        r.Responses = append(r.Responses,
+            openapi.Reply{Description: "Problem details (an HTML page for browsers)", Type: httpx.ProblemContentType, Body: httpx.Problem{}},
+            openapi.Reply{Type: openapi.HTML},
+        )
+        s.Add(r)
+    }
+    session := []string{securitySession, securitySessionAuth}
+    found := openapi.Reply{Status: http.StatusFound, Description: "Redirect"}
+    html := func(status int) openapi.Reply { return openapi.Reply{Status: status, Type: openapi.HTML} }
+    tokenErrors := []openapi.Reply{
+        {Status: http.StatusBadRequest, Description: "RFC 6749 error", Body: oauth2Error{}},
+        {Status: http.StatusUnauthorized, Description: "RFC 6749 error", Body: oauth2Error{}},
+        {Status: http.StatusInternalServerError, Description: "RFC 6749 error", Body: oauth2Error{}},
+    }
+    loginQuery := []openapi.Param{
+        {Name: "scope", Description: "Scopes requested on top of the configured ones, comma or space separated."},
+        {Name: "return_to", Description: "Where the browser goes after the callback; must pass RETURN_TO_ALLOWLIST."},
+        {Name: "mode", Description: `"popup" answers the callback with a postMessage page.`},
+        {Name: "nonce", Description: "Echoed back in popup results."},
+    }
+    appQuery := []openapi.Param{
+        {Name: "client_id", Description: "App client of OAUTH_CLIENTS; starts an app login."},
+        {Name: "redirect_uri"},
+        {Name: "state"},
+        {Name: "code_challenge", Description: "PKCE S256 challenge."},
+        {Name: "code_challenge_method"},
+    }
+
+    // Site.
+    add(openapi.Route{Method: http.MethodGet, Path: "/", Summary: "Top page", Tags: []string{"site"}, Responses: []openapi.Reply{html(http.StatusOK)}})
+    add(openapi.Route{Method: http.MethodGet, Path: "/healthz", Summary: "Health check", Tags: []string{"site"},
+        Responses: []openapi.Reply{{Status: http.StatusOK, Type: openapi.Text}}})
+    add(openapi.Route{Method: http.MethodGet, Path: "/metrics", Summary: "Prometheus metrics", Tags: []string{"site"},
+        Responses: []openapi.Reply{{Status: http.StatusOK, Type: openapi.Text}}})
+    add(openapi.Route{Method: http.MethodGet, Path: "/openapi.json", Summary: "This document", Tags: []string{"site"},
+        Responses: []openapi.Reply{{Status: http.StatusOK, Body: map[string]any{}}, {Status: http.StatusNotModified}}})
+    add(openapi.Route{Method: http.MethodGet, Path: "/problems/:code", Summary: "Description of an error code", Tags: []string{"site"},
+        Query:     []openapi.Param{{Name: "format", Description: `"json" for JSON.`}},
+        Responses: []openapi.Reply{{Status: http.StatusOK, Body: problemTypeResponse{}}, html(http.StatusOK)}})
+    add(openapi.Route{Method: http.MethodGet, Path: "/*", Summary: "Domain-verification files",
+        Description: "Answers paths no other route matches: files uploaded through the admin API, then the deployed ones.", Tags: []string{"site"},
+        Responses: []openapi.Reply{{Status: http.StatusOK, Type: openapi.Text}, html(http.StatusOK), {Status: http.StatusOK, Type: openapi.JSON}, {Status: http.StatusNotModified}}})
+
+    // Insights.
+    add(openapi.Route{Method: http.MethodGet, Path: "/insights", Summary: "Insights dashboard (static demo)", Tags: []string{"insights"}, Responses: []openapi.Reply{html(http.StatusOK)}})
+    add(openapi.Route{Method: http.MethodGet, Path: "/docs/*", Summary: "Mock TikTok API responses used by the insights demo", Tags: []string{"insights"},
+        Responses: []openapi.Reply{{Status: http.StatusOK, Type: openapi.JSON}, {Status: http.StatusNotModified}}})
+
+    // Sign-in.
+    for _, path := range []string{"/auth/login", "/auth/:provider/login"} {
+        add(openapi.Route{Method: http.MethodGet, Path: path, Summary: "Start a login", Tags: []string{"auth"},
+            Description: "/auth/login is the TikTok login.",
+            Query:       append(append([]openapi.Param{}, loginQuery...), appQuery...),
+            Responses:   []openapi.Reply{{Status: http.StatusFound, Description: "Redirect to the provider"}}})
+    }
+    for _, path := range []string{"/auth/callback", "/auth/:provider/callback"} {
+        add(openapi.Route{Method: http.MethodGet, Path: path, Summary: "Finish a login", Tags: []string{"auth"},
+            Description: "Sets the session cookie. JSON with Accept: application/json or ?format=json; redirects to return_to, the app or /legal/accept; otherwise an HTML page.",
+            Query:       []openapi.Param{{Name: "code"}, {Name: "state"}, {Name: "error"}, {Name: "format"}},
+            Responses:   []openapi.Reply{{Status: http.StatusOK, Body: callbackResponse{}}, html(http.StatusOK), found}})
+    }
+    add(openapi.Route{Method: http.MethodGet, Path: "/auth/providers", Summary: "Registered providers", Tags: []string{"auth"},
+        Responses: []openapi.Reply{{Status: http.StatusOK, Body: providersResponse{}}}})
+    add(openapi.Route{Method: http.MethodGet, Path: "/auth/:provider/link", Summary: "Link another account, or grant more scopes", Tags: []string{"auth"},
+        Security: session, Query: loginQuery,
+        Responses: []openapi.Reply{{Status: http.StatusFound, Description: "Redirect to the provider"}}})
+    add(openapi.Route{Method: http.MethodPost, Path: "/auth/logout", Summary: "Sign out", Tags: []string{"auth"}, Security: session,
+        Query:     []openapi.Param{{Name: "revoke", Description: `"true" revokes the provider token as well.`}},
+        Responses: []openapi.Reply{{Status: http.StatusNoContent}}})
+    add(openapi.Route{Method: http.MethodPost, Path: "/oauth2/token", Summary: "Exchange an app code or a device code for a session", Tags: []string{"auth"},
+        Body: tokenRequest{}, BodyType: openapi.Form,
+        Responses: append([]openapi.Reply{{Status: http.StatusOK, Body: tokenResponse{}}}, tokenErrors...)})
+    add(openapi.Route{Method: http.MethodPost, Path: "/oauth2/device_authorization", Summary: "Start a device login (RFC 8628)", Tags: []string{"auth"},
+        Body: deviceAuthorizationRequest{}, BodyType: openapi.Form,
+        Responses: append([]openapi.Reply{{Status: http.StatusOK, Body: deviceAuthorizationResponse{}}}, tokenErrors...)})
+    add(openapi.Route{Method: http.MethodGet, Path: "/device", Summary: "User code form", Tags: []string{"auth"},
+        Query: []openapi.Param{{Name: "user_code"}}, Responses: []openapi.Reply{html(http.StatusOK)}})
+    add(openapi.Route{Method: http.MethodPost, Path: "/device", Summary: "Approve a device", Tags: []string{"auth"},
+        Body: struct {
+            UserCode string `form:"user_code"`
+        }{}, BodyType: openapi.Form,
+        Responses: []openapi.Reply{{Status: http.StatusFound, Description: "Redirect to the TikTok login"}, html(http.StatusTooManyRequests)}})
+    add(openapi.Route{Method: http.MethodGet, Path: "/auth/qr", Summary: "Show a QR code login", Tags: []string{"auth"}, Responses: []openapi.Reply{html(http.StatusOK)}})
+    add(openapi.Route{Method: http.MethodGet, Path: "/auth/qr/:id/qr.png", Summary: "QR code image", Tags: []string{"auth"},
+        Responses: []openapi.Reply{{Status: http.StatusOK, Type: mimePNG}}})
+    add(openapi.Route{Method: http.MethodGet, Path: "/auth/qr/:id/qr.svg", Summary: "QR code image", Tags: []string{"auth"},
+        Responses: []openapi.Reply{{Status: http.StatusOK, Type: mimeSVG}}})
+    add(openapi.Route{Method: http.MethodGet, Path: "/auth/qr/:id/scan", Summary: "Confirmation page on the phone", Tags: []string{"auth"}, Responses: []openapi.Reply{html(http.StatusOK)}})
+    add(openapi.Route{Method: http.MethodPost, Path: "/auth/qr/:id/scan", Summary: "Start the phone's login", Tags: []string{"auth"},
+        Responses: []openapi.Reply{{Status: http.StatusFound, Description: "Redirect to the TikTok login"}}})
+    add(openapi.Route{Method: http.MethodGet, Path: "/auth/qr/:id/status", Summary: "Long-poll a QR login", Tags: []string{"auth"},
+        Description: "Sets the session cookie once approved.",
+        Query:       []openapi.Param{{Name: "seen", Description: "The status the page last saw."}},
+        Responses: []openapi.Reply{
+            {Status: http.StatusOK, Body: qrStatusResponse{}},
+            {Status: http.StatusBadRequest, Description: "seen is neither pending nor scanned", Body: qrStatusResponse{}},
+            {Status: http.StatusForbidden, Body: qrStatusResponse{}},
+            {Status: http.StatusInternalServerError, Body: qrStatusResponse{}},
+        }})
+
+    // Legal documents.
+    for _, doc := range []struct{ kind, path string }{
+        {oauth.LegalTerms, "/terms-of-service"},
+        {oauth.LegalPrivacy, "/privacy-policy"},
+    } {
+        for _, p := range []string{doc.path, doc.path + "/:version"} {
+            add(openapi.Route{Method: http.MethodGet, Path: p, Summary: "Legal document (" + doc.kind + ")", Tags: []string{"legal"},
+                Query: []openapi.Param{{Name: "format", Description: `"text" or "json".`}},
+                Responses: []openapi.Reply{
+                    html(http.StatusOK),
+                    {Status: http.StatusOK, Type: openapi.Text},
+                    {Status: http.StatusOK, Body: legalDocumentResponse{}},
+                }})
+        }
+    }
+    add(openapi.Route{Method: http.MethodGet, Path: legalAcceptPath, Summary: "Re-acceptance page", Tags: []string{"legal"}, Security: session,
+        Query: []openapi.Param{{Name: "return_to"}}, Responses: []openapi.Reply{html(http.StatusOK), found}})
+    add(openapi.Route{Method: http.MethodPost, Path: legalAcceptPath, Summary: "Accept legal documents", Tags: []string{"legal"}, Security: session,
+        Description: "Send version_<kind> with the version shown for each kind.",
+        Body: struct {
+            Kind     []string `form:"kind"`
+            ReturnTo string   `form:"return_to"`
+        }{}, BodyType: openapi.Form,
+        Responses: []openapi.Reply{html(http.StatusOK), {Status: http.StatusSeeOther, Description: "Redirect to return_to"}, found}})
+    add(openapi.Route{Method: http.MethodGet, Path: "/api/me/legal", Summary: "Legal acceptance status", Tags: []string{"legal"}, Security: session,
+        Responses: []openapi.Reply{{Status: http.StatusOK, Body: legalStatusResponse{}}}})
+    add(openapi.Route{Method: http.MethodPost, Path: "/api/me/legal", Summary: "Accept legal documents", Tags: []string{"legal"}, Security: session,
+        Body:      acceptLegalRequest{},
+        Responses: []openapi.Reply{{Status: http.StatusOK, Body: legalStatusResponse{}}}})
+
+    // Account.
+    add(openapi.Route{Method: http.MethodGet, Path: "/api/me", Summary: "Signed-in user", Tags: []string{"account"}, Security: session,
+        Responses: []openapi.Reply{{Status: http.StatusOK, Body: meResponse{}}}})
+    add(openapi.Route{Method: http.MethodGet, Path: "/api/connections", Summary: "Linked accounts", Tags: []string{"account"}, Security: session,
+        Responses: []openapi.Reply{{Status: http.StatusOK, Body: connectionsResponse{}}}})
+    add(openapi.Route{Method: http.MethodDelete, Path: "/api/connections/:connection_id", Summary: "Unlink an account", Tags: []string{"account"}, Security: session,
+        Query:     []openapi.Param{{Name: "revoke", Description: `"true" revokes the provider token as well.`}},
+        Responses: []openapi.Reply{{Status: http.StatusNoContent}}})
+
+    // Posting for a linked account.
+    posting := func(method, path, summary string, body any, bodyType string, replies ...openapi.Reply) {
+        add(openapi.Route{Method: method, Path: "/api/connections/:connection_id" + path, Summary: summary, Tags: []string{"posting"},
+            Security: session, Body: body, BodyType: bodyType, Responses: replies})
+    }
+    settled := []openapi.Reply{
+        {Status: http.StatusOK, Description: "The post settled", Body: oauth.PublishStatus{}},
+        {Status: http.StatusAccepted, Description: "Still processing", Body: acceptedPost{}},
+    }
+    posting(http.MethodGet, "/creator-info", "Creator info", nil, "", openapi.Reply{Status: http.StatusOK, Body: oauth.CreatorInfo{}})
+    posting(http.MethodPost, "/posts", "Post a video", createPostRequest{}, "", settled...)
+    posting(http.MethodPost, "/posts/upload", "Upload and post a video file (multipart, file in \"video\")", uploadPostForm{}, openapi.Multipart, settled...)
+    posting(http.MethodPost, "/posts/photo", "Post photos", oauth.PhotoPost{}, "", settled...)
+    posting(http.MethodGet, "/posts/:publish_id", "Post status", nil, "", openapi.Reply{Status: http.StatusOK, Body: oauth.PublishStatus{}})
+    posting(http.MethodGet, "/posts/:publish_id/events", "Status transitions recorded by the tracker", nil, "", openapi.Reply{Status: http.StatusOK, Body: postEventsResponse{}})
+    posting(http.MethodPost, "/scheduled-posts", "Schedule a post (Idempotency-Key header supported)", oauth.ScheduledPost{}, "",
+        openapi.Reply{Status: http.StatusCreated, Body: oauth.ScheduledPost{}},
+        openapi.Reply{Status: http.StatusOK, Description: "Existing post for the idempotency key", Body: oauth.ScheduledPost{}})
+    posting(http.MethodGet, "/scheduled-posts", "Scheduled posts", nil, "", openapi.Reply{Status: http.StatusOK, Body: scheduledPostsResponse{}})
+    posting(http.MethodGet, "/scheduled-posts/:id", "Scheduled post", nil, "", openapi.Reply{Status: http.StatusOK, Body: oauth.ScheduledPost{}})
+    posting(http.MethodDelete, "/scheduled-posts/:id", "Cancel a scheduled post", nil, "", openapi.Reply{Status: http.StatusOK, Body: oauth.ScheduledPost{}})
+
+    // Admin.
+    admin := []string{securityAdmin}
+    add(openapi.Route{Method: http.MethodGet, Path: "/admin/verification-files", Summary: "Uploaded verification files", Tags: []string{"admin"}, Security: admin,
+        Responses: []openapi.Reply{{Status: http.StatusOK, Body: verificationFilesResponse{}}}})
+    add(openapi.Route{Method: http.MethodPut, Path: "/admin/verification-files/*", Summary: "Upload a verification file served at /<path>", Tags: []string{"admin"}, Security: admin,
+        Body: "", BodyType: openapi.Text,
+        Responses: []openapi.Reply{{Status: http.StatusOK, Body: oauth.VerificationFile{}}}})
+    add(openapi.Route{Method: http.MethodDelete, Path: "/admin/verification-files/*", Summary: "Delete a verification file", Tags: []string{"admin"}, Security: admin,
+        Responses: []openapi.Reply{{Status: http.StatusNoContent}}})
+    return s.Document()
+}
+
+// OpenAPI serves doc at GET /openapi.json.
+func OpenAPI(doc *openapi.Document) (echo.HandlerFunc, error) {
+    b, err := json.MarshalIndent(doc, "", "  ")
+    if err != nil {
+        return nil, err
+    }
+    a := static.NewAsset("openapi.json", echo.MIMEApplicationJSONCharsetUTF8, b)
+    return func(c echo.Context) error {
+        return static.ServeAsset(c, a, "no-cache")
+    }, nil
+}
+
+// Undocumented lists the routes of e that doc does not describe, so a
+// route added without documentation fails at startup and in tests.
+func Undocumented(doc *openapi.Document, routes []*echo.Route) []string {
+    var missing []string
+    for _, r := range routes {
+        method, ok := routeMethod(r)
+        if ok && !doc.Has(method, r.Path) {
+            missing = append(missing, r.Method+" "+r.Path)
+        }
+    }
+    sort.Strings(missing)
+    return missing
+}
+
+// Unrouted lists the operations of doc that no route serves, so a route
+// removed without its documentation fails as well.
+func Unrouted(doc *openapi.Document, routes []*echo.Route) []string {
+    served := map[string]bool{}
+    for _, r := range routes {
+        if method, ok := routeMethod(r); ok {
+            served[openapi.OperationKey(method, r.Path)] = true
+        }
+    }
+    var stale []string
+    for _, op := range doc.Operations() {
+        if !served[op] {
+            stale = append(stale, op)
+        }
+    }
+    return stale
+}
+
+// routeMethod returns the method a route is documented under: the
+// catch-all not-found route is a GET, and the not-found handlers groups
+// register for themselves are not documented at all.
+func routeMethod(r *echo.Route) (string, bool) {
+    if r.Method != echo.RouteNotFound {
+        return r.Method, true
+    }
+    return http.MethodGet, r.Path == "/*"
+}
@@ -0,0 +1,263 @@
+package httpiface
+
+import (
+    "context"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/labstack/echo/v4"
+    "github.com/labstack/echo/v4/middleware"
+
+    site "tiktok-oauth"
+    "tiktok-oauth/internal/domain/oauth"
+    "tiktok-oauth/internal/infrastructure/store"
+    "tiktok-oauth/internal/pkg/httpx"
+    "tiktok-oauth/internal/pkg/i18n"
+    "tiktok-oauth/internal/pkg/openapi"
+    "tiktok-oauth/internal/pkg/static"
+)
+
+// fakeTikTok is the TikTok provider and Content Posting API.
+type fakeTikTok struct{}
+
+func (fakeTikTok) Name() string { return oauth.ProviderTikTok }
+
+func (fakeTikTok) AuthURL(p oauth.AuthParams) string {
+    return "https://tiktok.example/auth?" + url.Values{"state": {p.State}}.Encode()
+}
+
+func (f fakeTikTok) Exchange(ctx context.Context, p oauth.ExchangeParams) (oauth.Token, error) {
+    return f.Refresh(ctx, "")
+}
+
+func (fakeTikTok) Refresh(ctx context.Context, refreshToken string) (oauth.Token, error) {
+    return oauth.Token{
+        AccessToken:  "act.1",
+        RefreshToken: "rft.1",
+        ExpiresIn:    86400,
+        TokenType:    "Bearer",
+        Scope:        "user.info.basic,video.publish",
+        OpenID:       "open-1",
+        Provider:     oauth.ProviderTikTok,
+    }, nil
+}
+
+func (fakeTikTok) Revoke(ctx context.Context, token string) error { return nil }
+
+func (fakeTikTok) UserInfo(ctx context.Context, accessToken string) (oauth.Profile, error) {
+    return oauth.Profile{Provider: oauth.ProviderTikTok, Subject: "open-1", DisplayName: "Alice", Raw: map[string]any{"open_id": "open-1"}}, nil
+}
+
+func (fakeTikTok) QueryCreatorInfo(ctx context.Context, accessToken string) (oauth.CreatorInfo, error) {
+    return oauth.CreatorInfo{Username: "alice", PrivacyLevelOptions: []string{"SELF_ONLY"}, MaxVideoPostDurationSec: 600}, nil
+}
+
+func (fakeTikTok) InitVideoPost(ctx context.Context, accessToken string, info oauth.PostInfo, src oauth.VideoSource) (oauth.PostInit, error) {
+    if src.Source == oauth.SourceFileUpload {
+        return oauth.PostInit{PublishID: "p-1", UploadURL: "https://upload.example/p-1", ChunkSize: src.ChunkSize, TotalChunkCount: src.TotalChunkCount}, nil
+    }
+    return oauth.PostInit{PublishID: "p-1"}, nil
+}
+
+func (fakeTikTok) FetchPublishStatus(ctx context.Context, accessToken, publishID string) (oauth.PublishStatus, error) {
+    return oauth.PublishStatus{PublishID: publishID, Status: oauth.StatusPublishComplete, PostIDs: []string{"1"}}, nil
+}
+
+func (fakeTikTok) UploadVideo(ctx context.Context, init oauth.PostInit, src oauth.VideoSource, r io.ReaderAt) error {
+    return nil
+}
+
+func (fakeTikTok) InitPhotoPost(ctx context.Context, accessToken string, post oauth.PhotoPost) (oauth.PostInit, error) {
+    return oauth.PostInit{PublishID: "p-2"}, nil
+}
+
+// newTestServer wires the handlers like main, on an in-memory store;
+// opts adjust the handler before its routes are registered.
+func newTestServer(t *testing.T, opts ...func(*Handler)) *echo.Echo {
+    t.Helper()
+    files := static.New(site.Files, "")
+    catalog, err := i18n.Load(files.FS(), "contents/i18n", "ja")
+    if err != nil {
+        t.Fatal(err)
+    }
+    views, err := NewTemplates(files.FS(), "contents", catalog)
+    if err != nil {
+        t.Fatal(err)
+    }
+    legal, err := oauth.LoadLegalDocuments(files.FS(), "contents/legal")
+    if err != nil {
+        t.Fatal(err)
+    }
+    mem, err := store.Open("")
+    if err != nil {
+        t.Fatal(err)
+    }
+    tt := fakeTikTok{}
+    uc := oauth.NewUseCase(tt, mem)
+    auth := oauth.NewAuth(oauth.NewRegistry(oauth.Registration{Provider: tt, RedirectURI: "http://example.com/auth/callback", Scope: "user.info.basic,video.publish", ScopeSep: ","}), mem, mem, mem, mem)
+    auth.SetLegal(legal, mem)
+    tracker := oauth.NewPublishTracker(tt, mem, nil)
+    h := &Handler{
+        UC:            uc,
+        Auth:          auth,
+        Tracker:       tracker,
+        Scheduler:     oauth.NewScheduler(uc, mem, tracker),
+        Legal:         legal,
+        Verification:  oauth.NewVerificationFiles(mem),
+        AdminToken:    "admin-secret",
+        PublicBaseURL: "http://example.com",
+    }
+    for _, opt := range opts {
+        opt(h)
+    }
+
+    e := echo.New()
+    e.Use(middleware.RequestID())
+    e.HTTPErrorHandler = httpx.ErrorHandler
+    e.Use(catalog.Middleware(false))
+    e.Renderer = views
+    e.GET("/problems/:code", ProblemType)
+    h.Routes(e)
+    e.RouteNotFound("/*", h.VerificationFile(files, "contents/signature"))
+    return e
+}
+
+func TestAPIDocument_CoversRoutes(t *testing.T) {
+    e := newTestServer(t)
+    // The site routes main registers besides Handler.Routes.
+    for _, path := range []string{"/", "/healthz", "/metrics", "/insights", "/docs/*", "/openapi.json"} {
+        e.GET(path, func(c echo.Context) error { return nil })
+    }
+    doc := APIDocument()
+    if missing := Undocumented(doc, e.Routes()); len(missing) > 0 {
+        t.Fatalf("routes missing from the OpenAPI document: %v", missing)
+    }
+    if stale := Unrouted(doc, e.Routes()); len(stale) > 0 {
+        t.Fatalf("documented operations without a route: %v", stale)
+    }
+}
+
+// TestAPIDocument_Responses drives the API through a login and a post and
+// checks every response against the document.
+func TestAPIDocument_Responses(t *testing.T) {
+    e := newTestServer(t)
+    doc := APIDocument()
+    var cookie *http.Cookie
+    call := func(method, target, contentType, body string, hdr ...string) *httptest.ResponseRecorder {
+        t.Helper()
+        req := httptest.NewRequest(method, target, strings.NewReader(body))
+        if contentType != "" {
+            req.Header.Set(echo.HeaderContentType, contentType)
+        }
+        for i := 0; i+1 < len(hdr); i += 2 {
+            req.Header.Set(hdr[i], hdr[i+1])
+        }
+        if cookie != nil {
+            req.AddCookie(cookie)
+        }
+        rec := httptest.NewRecorder()
+        e.ServeHTTP(rec, req)
+        if err := doc.ValidateResponse(method, req.URL.Path, rec.Code, rec.Header().Get(echo.HeaderContentType), rec.Body.Bytes()); err != nil {
+            t.Errorf("%v\n%s", err, rec.Body.String())
+        }
+        return rec
+    }
+    expect := func(rec *httptest.ResponseRecorder, status int) {
+        t.Helper()
+        if rec.Code != status {
+            t.Fatalf("expected %d, got %d: %s", status, rec.Code, rec.Body.String())
+        }
+    }
+
+    // Sign in.
+    rec := call(http.MethodGet, "/auth/login", "", "")
+    expect(rec, http.StatusFound)
+    loc, _ := url.Parse(rec.Header().Get(echo.HeaderLocation))
+    rec = call(http.MethodGet, "/auth/callback?"+url.Values{"code": {"c"}, "state": {loc.Query().Get("state")}}.Encode(), "", "", echo.HeaderAccept, echo.MIMEApplicationJSON)
+    expect(rec, http.StatusOK)
+    for _, ck := range rec.Result().Cookies() {
+        if ck.Name == sessionCookie {
+            cookie = ck
+        }
+    }
+    if cookie == nil {
+        t.Fatal("no session cookie")
+    }
+    expect(call(http.MethodGet, "/auth/providers", "", ""), http.StatusOK)
+    expect(call(http.MethodGet, "/api/me", "", ""), http.StatusOK)
+    expect(call(http.MethodGet, "/api/me/legal", "", ""), http.StatusOK)
+    rec = call(http.MethodGet, "/api/connections", "", "")
+    expect(rec, http.StatusOK)
+    var conns connectionsResponse
+    if err := json.Unmarshal(rec.Body.Bytes(), &conns); err != nil || len(conns.Connections) != 1 {
+        t.Fatalf("unexpected connections %s", rec.Body.String())
+    }
+    connPath := "/api/connections/" + conns.Connections[0].ID
+
+    // Post for the connection.
+    expect(call(http.MethodGet, connPath+"/creator-info", "", ""), http.StatusOK)
+    expect(call(http.MethodPost, connPath+"/posts", echo.MIMEApplicationJSON, `{"privacy_level":"SELF_ONLY","source":"PULL_FROM_URL","video_url":"https://example.com/v.mp4"}`), http.StatusOK)
+    rec = call(http.MethodPost, connPath+"/posts", echo.MIMEApplicationJSON, `{"privacy_level":"SELF_ONLY","source":"FILE_UPLOAD","video_size":1024,"chunk_size":1024,"total_chunk_count":1}`)
+    expect(rec, http.StatusAccepted)
+    var accepted acceptedPost
+    if err := json.Unmarshal(rec.Body.Bytes(), &accepted); err != nil || accepted.ChunkSize != 1024 || accepted.TotalChunkCount != 1 {
+        t.Fatalf("no chunk plan in %s", rec.Body.String())
+    }
+    expect(call(http.MethodPost, connPath+"/posts", echo.MIMEApplicationJSON, `{"privacy_level":"SELF_ONLY","source":"FILE_UPLOAD","video_size":1024,"chunk_size":-1}`), http.StatusBadRequest)
+    expect(call(http.MethodPost, connPath+"/posts", echo.MIMEApplicationJSON, `{"privacy_level":"PUBLIC","source":"PULL_FROM_URL","video_url":"https://example.com/v.mp4"}`), http.StatusBadRequest)
+    expect(call(http.MethodGet, connPath+"/posts/p-1", "", ""), http.StatusOK)
+    expect(call(http.MethodGet, connPath+"/posts/p-1/events", "", ""), http.StatusOK)
+    at := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+    rec = call(http.MethodPost, connPath+"/scheduled-posts", echo.MIMEApplicationJSON, `{"video":{"privacy_level":"SELF_ONLY","video_url":"https://example.com/v.mp4"},"scheduled_at":"`+at+`"}`, "Idempotency-Key", "k-1")
+    expect(rec, http.StatusCreated)
+    var sp oauth.ScheduledPost
+    if err := json.Unmarshal(rec.Body.Bytes(), &sp); err != nil {
+        t.Fatal(err)
+    }
+    expect(call(http.MethodGet, connPath+"/scheduled-posts", "", ""), http.StatusOK)
+    expect(call(http.MethodDelete, connPath+"/scheduled-posts/"+sp.ID, "", ""), http.StatusOK)
+    expect(call(http.MethodGet, connPath+"/scheduled-posts/nope", "", ""), http.StatusNotFound)
+
+    // Admin.
+    admin := []string{echo.HeaderAuthorization, "Bearer admin-secret"}
+    expect(call(http.MethodPut, "/admin/verification-files/tiktokABC.txt", echo.MIMETextPlain, "tiktok-developers-site-verification=ABC", admin...), http.StatusOK)
+    expect(call(http.MethodGet, "/admin/verification-files", "", "", admin...), http.StatusOK)
+    expect(call(http.MethodGet, "/admin/verification-files", "", ""), http.StatusUnauthorized)
+    expect(call(http.MethodGet, "/tiktokABC.txt", "", ""), http.StatusOK)
+
+    // Errors in both formats.
+    expect(call(http.MethodPost, "/oauth2/token", echo.MIMEApplicationForm, "grant_type=password"), http.StatusBadRequest)
+    expect(call(http.MethodPost, "/oauth2/device_authorization", echo.MIMEApplicationForm, "client_id=nope"), http.StatusUnauthorized)
+    expect(call(http.MethodGet, "/auth/qr/nope/status", "", ""), http.StatusForbidden)
+    expect(call(http.MethodGet, "/problems/invalid_state?format=json", "", ""), http.StatusOK)
+    expect(call(http.MethodGet, "/no/such/page", "", ""), http.StatusNotFound)
+    expect(call(http.MethodPost, "/auth/logout", "", ""), http.StatusNoContent)
+    expect(call(http.MethodGet, "/api/me", "", ""), http.StatusUnauthorized)
+    expect(call(http.MethodGet, "/terms-of-service?format=json", "", ""), http.StatusOK)
+    expect(call(http.MethodGet, "/terms-of-service", "", ""), http.StatusOK)
+}
+
+func TestOpenAPI(t *testing.T) {
+    doc := APIDocument()
+    h, err := OpenAPI(doc)
+    if err != nil {
+        t.Fatal(err)
+    }
+    e := echo.New()
+    e.GET("/openapi.json", h)
+    rec := httptest.NewRecorder()
+    e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+    var got openapi.Document
+    if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+        t.Fatal(err)
+    }
+    if got.OpenAPI != openapi.Version || len(got.Paths) != len(doc.Paths) || rec.Header().Get("ETag") == "" {
+        t.Fatalf("unexpected document %d paths, headers %v", len(got.Paths), rec.Header())
+    }
+}
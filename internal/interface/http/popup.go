@@ -0,0 +1,130 @@
+package httpiface
+
+import (
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strconv"
+    "time"
+
+    "github.com/labstack/echo/v4"
+
+    "tiktok-oauth/internal/domain/oauth"
+)
+
+// PopupConfig enables the popup login mode. The result is posted only to
+// TargetOrigin and signed with Secret.
+type PopupConfig struct {
+    TargetOrigin string
+    Secret       string
+}
+
+// Enabled reports whether popup logins are configured.
+func (p PopupConfig) Enabled() bool { return p.TargetOrigin != "" && p.Secret != "" }
+
+// Validate checks that TargetOrigin and Secret are set together and that
+// TargetOrigin is a bare http(s) origin, as postMessage requires.
+func (p PopupConfig) Validate() error {
+    switch {
+    case p.TargetOrigin == "" && p.Secret == "":
+        return nil
+    case p.TargetOrigin == "":
+        return errors.New("popup signing secret is set without a target origin")
+    case p.Secret == "":
+        return errors.New("popup target origin is set without a signing secret")
+    }
+    u, err := url.Parse(p.TargetOrigin)
+    if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+        return fmt.Errorf("popup target origin %q must look like https://host[:port]", p.TargetOrigin)
+    }
+    return nil
+}
+
+// popupResult is the signed part of a popup message. It never carries
+// tokens: a successful login is visible to the opener through the session
+// cookie (GET /api/me).
+type popupResult struct {
+    Status       string `json:"status"`
+    Error        string `json:"error,omitempty"`
+    Provider     string `json:"provider"`
+    Nonce        string `json:"nonce,omitempty"`
+    UserID       string `json:"user_id,omitempty"`
+    ConnectionID string `json:"connection_id,omitempty"`
+    Linked       bool   `json:"linked,omitempty"`
+}
+
+// popupMessage is posted to window.opener. Signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + payload)), the
+// same scheme as the publish webhooks.
+type popupMessage struct {
+    Type      string `json:"type"`
+    Payload   string `json:"payload"`
+    Timestamp string `json:"timestamp"`
+    Signature string `json:"signature"`
+}
+
+// popupSuccess renders the popup page for a completed login.
+func (h *Handler) popupSuccess(c echo.Context, res oauth.LoginResult) error {
+    r := popupResult{
+        Status:       "success",
+        Provider:     res.Request.Provider,
+        Nonce:        res.Request.Nonce,
+        UserID:       res.Connection.UserID,
+        ConnectionID: res.Connection.ID,
+        Linked:       res.Linked,
+    }
+    return h.renderPopup(c, r)
+}
+
+// popupError renders the popup page for a failed login.
+func (h *Handler) popupError(c echo.Context, st oauth.AuthState, code string) error {
+    return h.renderPopup(c, popupResult{Status: "error", Error: code, Provider: st.Provider, Nonce: st.Nonce})
+}
+
+func (h *Handler) renderPopup(c echo.Context, r popupResult) error {
+    payload, err := json.Marshal(r)
+    if err != nil {
+        return err
+    }
+    ts := strconv.FormatInt(time.Now().Unix(), 10)
+    mac := hmac.New(sha256.New, []byte(h.Popup.Secret))
+    mac.Write([]byte(ts + "." + string(payload)))
+
+    scriptNonce := randomNonce()
+    data := struct {
+        Status       string
+        Error        string
+        Message      popupMessage
+        TargetOrigin string
+        ScriptNonce  string
+    }{
+        Status: r.Status,
+        Error:  r.Error,
+        Message: popupMessage{
+            Type:      "oauth_result",
+            Payload:   string(payload),
+            Timestamp: ts,
+            Signature: "sha256=" + hex.EncodeToString(mac.Sum(nil)),
+        },
+        TargetOrigin: h.Popup.TargetOrigin,
+        ScriptNonce:  scriptNonce,
+    }
+    hdr := c.Response().Header()
+    hdr.Set("Content-Security-Policy", "default-src 'none'; script-src 'nonce-"+scriptNonce+"'")
+    hdr.Set("Cache-Control", "no-store")
+    hdr.Set("Referrer-Policy", "no-referrer")
+    return render(c, http.StatusOK, "popup", data)
+}
+
+func randomNonce() string {
+    b := make([]byte, 16)
+    _, _ = rand.Read(b)
+    return base64.RawStdEncoding.EncodeToString(b)
+}
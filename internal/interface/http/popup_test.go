@@ -0,0 +1,95 @@
+package httpiface
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "regexp"
+    "testing"
+
+    "github.com/labstack/echo/v4"
+)
+
+func TestPopupConfig_Validate(t *testing.T) {
+    for _, tc := range []struct {
+        name string
+        cfg  PopupConfig
+        ok   bool
+    }{
+        {"disabled", PopupConfig{}, true},
+        {"configured", PopupConfig{TargetOrigin: "https://dash.example.com", Secret: "s"}, true},
+        {"with port", PopupConfig{TargetOrigin: "http://localhost:3000", Secret: "s"}, true},
+        {"origin without secret", PopupConfig{TargetOrigin: "https://dash.example.com"}, false},
+        {"secret without origin", PopupConfig{Secret: "s"}, false},
+        {"path", PopupConfig{TargetOrigin: "https://dash.example.com/app", Secret: "s"}, false},
+        {"query", PopupConfig{TargetOrigin: "https://dash.example.com?x=1", Secret: "s"}, false},
+        {"scheme", PopupConfig{TargetOrigin: "javascript://dash.example.com", Secret: "s"}, false},
+        {"no host", PopupConfig{TargetOrigin: "https://", Secret: "s"}, false},
+    } {
+        if err := tc.cfg.Validate(); (err == nil) != tc.ok {
+            t.Errorf("%s: Validate() = %v", tc.name, err)
+        }
+    }
+}
+
+// popupMessageRe extracts the message the popup page posts to its opener.
+var popupMessageRe = regexp.MustCompile(`var message = (\{.*\});`)
+
+// verifyPopup checks a popup message the way the opener is told to.
+func verifyPopup(secret string, m popupMessage) bool {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(m.Timestamp + "." + m.Payload))
+    return hmac.Equal([]byte(m.Signature), []byte("sha256="+hex.EncodeToString(mac.Sum(nil))))
+}
+
+func TestPopup_SignedResult(t *testing.T) {
+    const secret = "popup-secret"
+    e := newTestServer(t, func(h *Handler) {
+        h.Popup = PopupConfig{TargetOrigin: "https://dash.example.com", Secret: secret}
+    })
+    rec := httptest.NewRecorder()
+    e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/login?mode=popup&nonce=n-1", nil))
+    loc, _ := url.Parse(rec.Header().Get(echo.HeaderLocation))
+    rec = httptest.NewRecorder()
+    e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/callback?"+url.Values{"code": {"c"}, "state": {loc.Query().Get("state")}}.Encode(), nil))
+    if rec.Code != http.StatusOK {
+        t.Fatalf("callback: %d %s", rec.Code, rec.Body.String())
+    }
+
+    m := popupMessageRe.FindStringSubmatch(rec.Body.String())
+    if m == nil {
+        t.Fatalf("no message in popup page:\n%s", rec.Body.String())
+    }
+    var msg popupMessage
+    if err := json.Unmarshal([]byte(m[1]), &msg); err != nil {
+        t.Fatalf("decode message: %v", err)
+    }
+    if !verifyPopup(secret, msg) {
+        t.Fatalf("signature does not verify: %#v", msg)
+    }
+    var r popupResult
+    if err := json.Unmarshal([]byte(msg.Payload), &r); err != nil {
+        t.Fatal(err)
+    }
+    if r.Status != "success" || r.Nonce != "n-1" || r.UserID == "" {
+        t.Fatalf("unexpected result: %#v", r)
+    }
+
+    if verifyPopup("other-secret", msg) {
+        t.Fatal("signature verifies with another secret")
+    }
+    tampered := msg
+    tampered.Payload = `{"status":"success","provider":"tiktok","nonce":"n-2"}`
+    if verifyPopup(secret, tampered) {
+        t.Fatal("signature verifies a tampered payload")
+    }
+    tampered = msg
+    tampered.Timestamp = "0"
+    if verifyPopup(secret, tampered) {
+        t.Fatal("signature verifies a replaced timestamp")
+    }
+}
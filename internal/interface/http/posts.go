@@ -0,0 +1,330 @@
+package httpiface
+
+import (
+    "context"
+    "crypto/subtle"
+    "errors"
+    "io"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/labstack/echo/v4"
+
+    "tiktok-oauth/internal/domain/oauth"
+    "tiktok-oauth/internal/pkg/httpx"
+)
+
+// publishWait bounds how long POST .../posts waits for a post to settle
+// before answering 202 with the last observed status.
+const publishWait = 25 * time.Second
+
+type createPostRequest struct {
+    oauth.PostInfo
+    oauth.VideoSource
+}
+
+// uploadPostForm is the non-file part of POST .../posts/upload.
+type uploadPostForm struct {
+    Title                 string `form:"title"`
+    PrivacyLevel          string `form:"privacy_level"`
+    DisableDuet           bool   `form:"disable_duet"`
+    DisableComment        bool   `form:"disable_comment"`
+    DisableStitch         bool   `form:"disable_stitch"`
+    VideoCoverTimestampMs int64  `form:"video_cover_timestamp_ms"`
+}
+
+// acceptedPost is the 202 answer of the posting handlers: the last known
+// status and, for FILE_UPLOAD, where to send the video and the chunking
+// declared to TikTok, which the upload must follow.
+type acceptedPost struct {
+    oauth.PublishStatus
+    UploadURL       string `json:"upload_url,omitempty"`
+    ChunkSize       int64  `json:"chunk_size,omitempty"`
+    TotalChunkCount int    `json:"total_chunk_count,omitempty"`
+}
+
+// postEventsResponse is a publish record without the owner's token.
+type postEventsResponse struct {
+    PublishID   string                   `json:"publish_id"`
+    MediaType   string                   `json:"media_type"`
+    Status      string                   `json:"status"`
+    FailReason  string                   `json:"fail_reason"`
+    PostIDs     []string                 `json:"post_ids"`
+    Transitions []oauth.StatusTransition `json:"transitions"`
+    Notified    bool                     `json:"notified"`
+    // NotifyFailed is set once delivery of the event was given up.
+    NotifyFailed bool      `json:"notify_failed"`
+    CreatedAt    time.Time `json:"created_at"`
+    UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// CreatorInfo handles GET /api/connections/:connection_id/creator-info.
+func (h *Handler) CreatorInfo(c echo.Context) error {
+    token := accessToken(c)
+    if token == "" {
+        return httpx.Error(c, http.StatusUnauthorized, "missing_access_token", nil)
+    }
+    info, err := h.UC.CreatorInfo(c.Request().Context(), token)
+    if errors.Is(err, oauth.ErrInsufficientScope) {
+        return insufficientScope(c, oauth.ScopeVideoPublish)
+    }
+    if err != nil {
+        httpx.Log(c).Error("creator info query failed", "err", err)
+        p := httpx.NewProblem(c, http.StatusBadGateway, "creator_info_failed", nil)
+        p.LogID = httpx.LogID(err)
+        return httpx.WriteProblem(c, p)
+    }
+    return c.JSON(http.StatusOK, info)
+}
+
+// CreatePost handles POST /api/connections/:connection_id/posts. For
+// PULL_FROM_URL it waits until the post settles (bounded by publishWait);
+// FILE_UPLOAD returns the upload_url immediately since nothing happens
+// until the bytes are uploaded.
+func (h *Handler) CreatePost(c echo.Context) error {
+    token := accessToken(c)
+    if token == "" {
+        return httpx.Error(c, http.StatusUnauthorized, "missing_access_token", nil)
+    }
+    var req createPostRequest
+    if err := c.Bind(&req); err != nil {
+        return httpx.Error(c, http.StatusBadRequest, "invalid_body", err.Error())
+    }
+
+    ctx := c.Request().Context()
+    init, err := h.UC.PublishVideo(ctx, token, req.PostInfo, req.VideoSource)
+    if err != nil {
+        if errors.Is(err, oauth.ErrInvalidPost) {
+            return httpx.Error(c, http.StatusBadRequest, "invalid_post", err.Error())
+        }
+        if errors.Is(err, oauth.ErrInsufficientScope) {
+            return insufficientScope(c, oauth.ScopeVideoPublish)
+        }
+        httpx.Log(c).Error("post init failed", "err", err)
+        p := httpx.NewProblem(c, http.StatusBadGateway, "post_init_failed", nil)
+        p.LogID = httpx.LogID(err)
+        return httpx.WriteProblem(c, p)
+    }
+    h.track(c, oauth.MediaTypeVideo, init)
+    if req.Source == oauth.SourceFileUpload {
+        return c.JSON(http.StatusAccepted, acceptedPost{
+            PublishStatus:   oauth.PublishStatus{PublishID: init.PublishID, Status: oauth.StatusProcessingUpload},
+            UploadURL:       init.UploadURL,
+            ChunkSize:       init.ChunkSize,
+            TotalChunkCount: init.TotalChunkCount,
+        })
+    }
+
+    return h.waitSettled(c, token, init.PublishID)
+}
+
+// CreatePhotoPost handles POST /api/connections/:connection_id/posts/photo
+// and waits for the post to settle like CreatePost.
+func (h *Handler) CreatePhotoPost(c echo.Context) error {
+    token := accessToken(c)
+    if token == "" {
+        return httpx.Error(c, http.StatusUnauthorized, "missing_access_token", nil)
+    }
+    var req oauth.PhotoPost
+    if err := c.Bind(&req); err != nil {
+        return httpx.Error(c, http.StatusBadRequest, "invalid_body", err.Error())
+    }
+    init, err := h.UC.PublishPhotos(c.Request().Context(), token, req)
+    if err != nil {
+        if errors.Is(err, oauth.ErrInvalidPost) {
+            return httpx.Error(c, http.StatusBadRequest, "invalid_post", err.Error())
+        }
+        if errors.Is(err, oauth.ErrInsufficientScope) {
+            return insufficientScope(c, oauth.ScopeVideoPublish)
+        }
+        httpx.Log(c).Error("photo post init failed", "err", err)
+        p := httpx.NewProblem(c, http.StatusBadGateway, "post_init_failed", nil)
+        p.LogID = httpx.LogID(err)
+        return httpx.WriteProblem(c, p)
+    }
+    h.track(c, oauth.MediaTypePhoto, init)
+    return h.waitSettled(c, token, init.PublishID)
+}
+
+// UploadPost handles POST /api/connections/:connection_id/posts/upload: a
+// multipart form with the video in "video" and the post settings as form
+// fields. The file is spooled to disk and pushed to TikTok in chunks
+// before waiting for the post to settle.
+func (h *Handler) UploadPost(c echo.Context) error {
+    token := accessToken(c)
+    if token == "" {
+        return httpx.Error(c, http.StatusUnauthorized, "missing_access_token", nil)
+    }
+    var form uploadPostForm
+    if err := c.Bind(&form); err != nil {
+        return httpx.Error(c, http.StatusBadRequest, "invalid_body", err.Error())
+    }
+    info := oauth.PostInfo(form)
+    fh, err := c.FormFile("video")
+    if err != nil {
+        return httpx.Error(c, http.StatusBadRequest, "missing_video", err.Error())
+    }
+    src, err := fh.Open()
+    if err != nil {
+        return httpx.Error(c, http.StatusBadRequest, "invalid_video", err.Error())
+    }
+    defer src.Close()
+
+    tmp, err := os.CreateTemp("", "tiktok-upload-*"+filepath.Ext(fh.Filename))
+    if err != nil {
+        httpx.Log(c).Error("create upload spool file", "err", err)
+        return httpx.Error(c, http.StatusInternalServerError, "upload_spool_failed", nil)
+    }
+    defer os.Remove(tmp.Name())
+    defer tmp.Close()
+    size, err := io.Copy(tmp, src)
+    if err != nil {
+        httpx.Log(c).Error("spool upload", "err", err)
+        return httpx.Error(c, http.StatusInternalServerError, "upload_spool_failed", nil)
+    }
+
+    init, err := h.UC.UploadVideo(c.Request().Context(), token, info, tmp, size)
+    if init.PublishID != "" {
+        h.track(c, oauth.MediaTypeVideo, init)
+    }
+    if err != nil {
+        if errors.Is(err, oauth.ErrInvalidPost) {
+            return httpx.Error(c, http.StatusBadRequest, "invalid_post", err.Error())
+        }
+        if errors.Is(err, oauth.ErrInsufficientScope) {
+            return insufficientScope(c, oauth.ScopeVideoPublish)
+        }
+        httpx.Log(c).Error("video upload failed", "publish_id", init.PublishID, "err", err)
+        p := httpx.NewProblem(c, http.StatusBadGateway, "video_upload_failed", map[string]string{"publish_id": init.PublishID})
+        p.LogID = httpx.LogID(err)
+        return httpx.WriteProblem(c, p)
+    }
+    return h.waitSettled(c, token, init.PublishID)
+}
+
+// PostStatus handles GET /api/connections/:connection_id/posts/:publish_id.
+func (h *Handler) PostStatus(c echo.Context) error {
+    token := accessToken(c)
+    if token == "" {
+        return httpx.Error(c, http.StatusUnauthorized, "missing_access_token", nil)
+    }
+    st, err := h.UC.PublishStatus(c.Request().Context(), token, c.Param("publish_id"))
+    if errors.Is(err, oauth.ErrInsufficientScope) {
+        return insufficientScope(c, oauth.ScopeVideoPublish)
+    }
+    if err != nil {
+        httpx.Log(c).Error("publish status fetch failed", "err", err)
+        p := httpx.NewProblem(c, http.StatusBadGateway, "publish_status_failed", nil)
+        p.LogID = httpx.LogID(err)
+        return httpx.WriteProblem(c, p)
+    }
+    return c.JSON(http.StatusOK, st)
+}
+
+// PostEvents handles GET
+// /api/connections/:connection_id/posts/:publish_id/events and returns the
+// status transitions recorded by the background tracker.
+func (h *Handler) PostEvents(c echo.Context) error {
+    if h.Tracker == nil {
+        return httpx.Error(c, http.StatusNotFound, "tracking_disabled", nil)
+    }
+    rec, err := h.Tracker.Get(c.Request().Context(), c.Param("publish_id"))
+    if errors.Is(err, oauth.ErrNotFound) {
+        return httpx.Error(c, http.StatusNotFound, "publish_not_tracked", nil)
+    }
+    if err != nil {
+        httpx.Log(c).Error("load publish record", "err", err)
+        return httpx.Error(c, http.StatusInternalServerError, "store_error", nil)
+    }
+    if !ownsPublish(c, rec) {
+        return httpx.Error(c, http.StatusNotFound, "publish_not_tracked", nil)
+    }
+    return c.JSON(http.StatusOK, postEventsResponse{
+        PublishID:    rec.PublishID,
+        MediaType:    rec.MediaType,
+        Status:       rec.Status,
+        FailReason:   rec.FailReason,
+        PostIDs:      rec.PostIDs,
+        Transitions:  rec.Transitions,
+        Notified:     rec.Notified,
+        NotifyFailed: rec.NotifyFailed,
+        CreatedAt:    rec.CreatedAt,
+        UpdatedAt:    rec.UpdatedAt,
+    })
+}
+
+// ownsPublish reports whether the tracked post belongs to the connection
+// of the request. Records tracked before the open_id was kept only match
+// the access token they were created with.
+func ownsPublish(c echo.Context, rec oauth.PublishRecord) bool {
+    tok, ok := c.Get(connTokenKey).(oauth.Token)
+    switch {
+    case !ok:
+        return false
+    case rec.OpenID != "":
+        return rec.OpenID == tok.OpenID
+    default:
+        return tok.AccessToken != "" && subtle.ConstantTimeCompare([]byte(tok.AccessToken), []byte(rec.AccessToken)) == 1
+    }
+}
+
+// track registers a post with the background tracker; failures are only
+// logged since the post itself was created.
+func (h *Handler) track(c echo.Context, mediaType string, init oauth.PostInit) {
+    tok, ok := c.Get(connTokenKey).(oauth.Token)
+    if h.Tracker == nil || !ok {
+        return
+    }
+    if err := h.Tracker.Track(c.Request().Context(), tok, mediaType, init); err != nil {
+        httpx.Log(c).Error("track publish", "publish_id", init.PublishID, "err", err)
+    }
+}
+
+// waitSettled answers with the post status once it settles, or 202 with
+// the last observed status after publishWait.
+func (h *Handler) waitSettled(c echo.Context, token, publishID string) error {
+    ctx, cancel := context.WithTimeout(c.Request().Context(), publishWait)
+    defer cancel()
+    st, err := h.UC.WaitPublishStatus(ctx, token, publishID)
+    switch {
+    case err == nil:
+        return c.JSON(http.StatusOK, st)
+    case errors.Is(err, context.DeadlineExceeded):
+        st.PublishID = publishID
+        return c.JSON(http.StatusAccepted, acceptedPost{PublishStatus: st})
+    case errors.Is(err, oauth.ErrInsufficientScope):
+        return insufficientScope(c, oauth.ScopeVideoPublish)
+    default:
+        httpx.Log(c).Error("publish status fetch failed", "err", err)
+        p := httpx.NewProblem(c, http.StatusBadGateway, "publish_status_failed", map[string]string{"publish_id": publishID})
+        p.LogID = httpx.LogID(err)
+        return httpx.WriteProblem(c, p)
+    }
+}
+
+// accessToken returns the TikTok access token of the connection resolved
+// by RequireConnection.
+func accessToken(c echo.Context) string {
+    if t, ok := c.Get(connTokenKey).(oauth.Token); ok {
+        return t.AccessToken
+    }
+    return ""
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(c echo.Context) string {
+    return authCredentials(c, "Bearer")
+}
+
+// authCredentials returns the credentials of an Authorization header
+// that uses scheme.
+func authCredentials(c echo.Context, scheme string) string {
+    auth := c.Request().Header.Get(echo.HeaderAuthorization)
+    if len(auth) > len(scheme)+1 && strings.EqualFold(auth[:len(scheme)+1], scheme+" ") {
+        return strings.TrimSpace(auth[len(scheme)+1:])
+    }
+    return ""
+}
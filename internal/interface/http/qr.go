@@ -0,0 +1,177 @@
+package httpiface
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/labstack/echo/v4"
+    qrcode "github.com/skip2/go-qrcode"
+
+    "tiktok-oauth/internal/domain/oauth"
+    "tiktok-oauth/internal/pkg/httpx"
+)
+
+const (
+    // qrSecretCookie binds a QR login to the browser that displays it.
+    qrSecretCookie = "qr_login"
+    // qrWait bounds one long-poll request, below common proxy timeouts.
+    qrWait = 25 * time.Second
+)
+
+// QRLoginPage handles GET /auth/qr: it creates a QR login and shows its
+// code, then long-polls /auth/qr/:id/status until the phone finishes.
+func (h *Handler) QRLoginPage(c echo.Context) error {
+    l, secret, err := h.Auth.StartQRLogin(c.Request().Context())
+    if err != nil {
+        httpx.Log(c).Error("qr login", "err", err)
+        return h.renderQR(c, http.StatusInternalServerError, qrPage{Error: "qr.error.create_failed"})
+    }
+    c.SetCookie(&http.Cookie{
+        Name:     qrSecretCookie,
+        Value:    secret,
+        Path:     "/auth/qr/" + l.ID,
+        Expires:  l.ExpiresAt,
+        HttpOnly: true,
+        Secure:   h.SecureCookies,
+        SameSite: http.SameSiteStrictMode,
+    })
+    return h.renderQR(c, http.StatusOK, qrPage{View: "show", ID: l.ID})
+}
+
+// QRCodeImage handles GET /auth/qr/:id/qr.png and /qr.svg. The code holds
+// the URL of the phone's confirmation page.
+func (h *Handler) QRCodeImage(c echo.Context) error {
+    id := c.Param("id")
+    if _, err := h.Auth.QRLogin(c.Request().Context(), id); err != nil {
+        return c.NoContent(http.StatusNotFound)
+    }
+    q, err := qrcode.New(h.publicURL("/auth/qr/"+id+"/scan"), qrcode.Medium)
+    if err != nil {
+        return err
+    }
+    c.Response().Header().Set("Cache-Control", "no-store")
+    if strings.HasSuffix(c.Path(), ".svg") {
+        return c.Blob(http.StatusOK, "image/svg+xml", qrSVG(q.Bitmap()))
+    }
+    png, err := q.PNG(256)
+    if err != nil {
+        return err
+    }
+    return c.Blob(http.StatusOK, "image/png", png)
+}
+
+// qrSVG draws a QR bitmap (quiet zone included) as one SVG path.
+func qrSVG(bits [][]bool) []byte {
+    var b strings.Builder
+    fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, len(bits), len(bits))
+    fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, len(bits), len(bits))
+    for y, row := range bits {
+        for x, on := range row {
+            if on {
+                fmt.Fprintf(&b, "M%d %dh1v1h-1z", x, y)
+            }
+        }
+    }
+    b.WriteString(`"/></svg>`)
+    return []byte(b.String())
+}
+
+// QRScanPage handles GET /auth/qr/:id/scan on the phone. It asks for
+// confirmation first, so link previews do not start logins and users see
+// that they are signing in another screen.
+func (h *Handler) QRScanPage(c echo.Context) error {
+    id := c.Param("id")
+    if _, err := h.Auth.QRLogin(c.Request().Context(), id); err != nil {
+        return h.qrError(c, err)
+    }
+    return h.renderQR(c, http.StatusOK, qrPage{View: "confirm", ID: id})
+}
+
+// QRScan handles POST /auth/qr/:id/scan and starts the phone's login.
+func (h *Handler) QRScan(c echo.Context) error {
+    if origin := c.Request().Header.Get("Origin"); origin != "" && origin != c.Scheme()+"://"+c.Request().Host {
+        return h.renderQR(c, http.StatusForbidden, qrPage{Error: "qr.error.cross_site"})
+    }
+    url, err := h.Auth.BeginQRLogin(c.Request().Context(), c.Param("id"))
+    if err != nil {
+        return h.qrError(c, err)
+    }
+    return c.Redirect(http.StatusFound, url)
+}
+
+// QRStatus handles GET /auth/qr/:id/status?seen=<status>, the long poll of
+// the displaying browser. Once approved it sets the session cookie.
+func (h *Handler) QRStatus(c echo.Context) error {
+    ck, err := c.Cookie(qrSecretCookie)
+    if err != nil {
+        return c.JSON(http.StatusForbidden, qrStatusResponse{Status: "invalid"})
+    }
+    seen := oauth.QRStatus(c.QueryParam("seen"))
+    if seen == "" {
+        seen = oauth.QRPending
+    }
+    ctx, cancel := context.WithTimeout(c.Request().Context(), qrWait)
+    defer cancel()
+    l, err := h.Auth.WaitQRLogin(ctx, c.Param("id"), ck.Value, seen)
+    switch {
+    case errors.Is(err, oauth.ErrInvalidQRSeen):
+        return c.JSON(http.StatusBadRequest, qrStatusResponse{Status: "invalid"})
+    case errors.Is(err, oauth.ErrQRLoginExpired):
+        return c.JSON(http.StatusOK, qrStatusResponse{Status: "expired"})
+    case errors.Is(err, oauth.ErrInvalidQRLogin):
+        return c.JSON(http.StatusForbidden, qrStatusResponse{Status: "invalid"})
+    case err != nil:
+        httpx.Log(c).Error("qr login status", "err", err)
+        return c.JSON(http.StatusInternalServerError, qrStatusResponse{Status: "error"})
+    }
+    if l.Status == oauth.QRApproved {
+        s, err := h.Auth.Session(c.Request().Context(), l.SessionID)
+        if err != nil {
+            return h.accountError(c, err)
+        }
+        h.setSessionCookie(c, s)
+    }
+    c.Response().Header().Set("Cache-Control", "no-store")
+    return c.JSON(http.StatusOK, qrStatusResponse{Status: string(l.Status)})
+}
+
+// qrStatusResponse is the long-poll answer: an oauth.QRStatus, or
+// "expired", "invalid" or "error".
+type qrStatusResponse struct {
+    Status string `json:"status"`
+}
+
+func (h *Handler) qrError(c echo.Context, err error) error {
+    switch {
+    case errors.Is(err, oauth.ErrQRLoginExpired):
+        return h.renderQR(c, http.StatusGone, qrPage{Error: "qr.error.expired"})
+    case errors.Is(err, oauth.ErrInvalidQRLogin):
+        return h.renderQR(c, http.StatusNotFound, qrPage{Error: "qr.error.invalid"})
+    default:
+        httpx.Log(c).Error("qr login", "err", err)
+        return h.renderQR(c, http.StatusInternalServerError, qrPage{Error: "qr.error.start_failed"})
+    }
+}
+
+// qrPage is the data of contents/qr.html. View is "show" (the QR code),
+// "confirm" (phone), "approved", "denied" or "" for an error, whose text
+// is the message catalog key in Error.
+type qrPage struct {
+    View        string
+    ID          string
+    Error       string
+    ScriptNonce string
+}
+
+func (h *Handler) renderQR(c echo.Context, status int, p qrPage) error {
+    p.ScriptNonce = randomNonce()
+    hdr := c.Response().Header()
+    hdr.Set("Content-Security-Policy", "default-src 'self'; script-src 'nonce-"+p.ScriptNonce+"'")
+    hdr.Set("Cache-Control", "no-store")
+    hdr.Set("Referrer-Policy", "no-referrer")
+    return render(c, status, "qr", p)
+}
@@ -0,0 +1,62 @@
+package httpiface
+
+import (
+    "github.com/labstack/echo/v4"
+
+    "tiktok-oauth/internal/domain/oauth"
+)
+
+// Routes registers the handlers on e. Every route is described in the
+// OpenAPI document built by APIDocument.
+func (h *Handler) Routes(e *echo.Echo) {
+    e.GET("/auth/login", h.Login)
+    e.GET("/auth/callback", h.Callback)
+    e.GET("/auth/providers", h.Providers)
+    e.GET("/auth/:provider/login", h.Login)
+    e.GET("/auth/:provider/callback", h.Callback)
+    e.GET("/auth/:provider/link", h.Link, h.RequireLegal)
+    e.POST("/auth/logout", h.Logout)
+    e.POST("/oauth2/token", h.Token)
+    e.POST("/oauth2/device_authorization", h.DeviceAuthorization)
+    e.GET("/device", h.DevicePage)
+    e.POST("/device", h.DeviceSubmit, h.deviceSubmitLimit())
+    e.GET("/auth/qr", h.QRLoginPage)
+    e.GET("/auth/qr/:id/qr.png", h.QRCodeImage)
+    e.GET("/auth/qr/:id/qr.svg", h.QRCodeImage)
+    e.GET("/auth/qr/:id/scan", h.QRScanPage)
+    e.POST("/auth/qr/:id/scan", h.QRScan)
+    e.GET("/auth/qr/:id/status", h.QRStatus)
+    e.GET("/terms-of-service", h.LegalDocument(oauth.LegalTerms))
+    e.GET("/terms-of-service/:version", h.LegalDocument(oauth.LegalTerms))
+    e.GET("/privacy-policy", h.LegalDocument(oauth.LegalPrivacy))
+    e.GET("/privacy-policy/:version", h.LegalDocument(oauth.LegalPrivacy))
+    e.GET("/legal/accept", h.LegalAcceptPage)
+    e.POST("/legal/accept", h.LegalAccept)
+    admin := e.Group("/admin", h.RequireAdmin)
+    admin.GET("/verification-files", h.ListVerificationFiles)
+    admin.PUT("/verification-files/*", h.PutVerificationFile)
+    admin.DELETE("/verification-files/*", h.DeleteVerificationFile)
+    // Session routes other than logout and the legal ones need the legal
+    // documents in effect accepted.
+    e.GET("/api/me", h.Me, h.RequireLegal)
+    e.GET("/api/me/legal", h.LegalStatus)
+    e.POST("/api/me/legal", h.AcceptLegalAPI)
+
+    // Linked accounts (session cookie). The Content Posting API is served
+    // per connection, so one login can act for several TikTok accounts;
+    // each route declares the TikTok scopes it needs.
+    publish := h.RequireScopes(oauth.ScopeVideoPublish)
+    e.GET("/api/connections", h.ListConnections, h.RequireLegal)
+    e.DELETE("/api/connections/:connection_id", h.Unlink, h.RequireLegal)
+    conn := e.Group("/api/connections/:connection_id", h.RequireLegal, h.RequireConnection)
+    conn.GET("/creator-info", h.CreatorInfo, publish)
+    conn.POST("/posts", h.CreatePost, publish)
+    conn.POST("/posts/upload", h.UploadPost, publish)
+    conn.POST("/posts/photo", h.CreatePhotoPost, publish)
+    conn.GET("/posts/:publish_id", h.PostStatus, publish)
+    conn.GET("/posts/:publish_id/events", h.PostEvents)
+    conn.POST("/scheduled-posts", h.CreateScheduledPost, publish)
+    conn.GET("/scheduled-posts", h.ListScheduledPosts)
+    conn.GET("/scheduled-posts/:id", h.GetScheduledPost)
+    conn.DELETE("/scheduled-posts/:id", h.CancelScheduledPost)
+}
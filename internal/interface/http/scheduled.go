@@ -0,0 +1,98 @@
+package httpiface
+
+import (
+    "errors"
+    "net/http"
+
+    "github.com/labstack/echo/v4"
+
+    "tiktok-oauth/internal/domain/oauth"
+    "tiktok-oauth/internal/pkg/httpx"
+)
+
+// CreateScheduledPost handles POST
+// /api/connections/:connection_id/scheduled-posts. The idempotency key
+// comes from the body or the Idempotency-Key header; repeating a request
+// with the same key returns the existing post with 200.
+func (h *Handler) CreateScheduledPost(c echo.Context) error {
+    token := accessToken(c)
+    if token == "" {
+        return httpx.Error(c, http.StatusUnauthorized, "missing_access_token", nil)
+    }
+    var req oauth.ScheduledPost
+    if err := c.Bind(&req); err != nil {
+        return httpx.Error(c, http.StatusBadRequest, "invalid_body", err.Error())
+    }
+    if k := c.Request().Header.Get("Idempotency-Key"); k != "" {
+        req.IdempotencyKey = k
+    }
+    p, created, err := h.Scheduler.Schedule(c.Request().Context(), token, req)
+    if err != nil {
+        return h.scheduleError(c, err)
+    }
+    if !created {
+        return c.JSON(http.StatusOK, p)
+    }
+    return c.JSON(http.StatusCreated, p)
+}
+
+// ListScheduledPosts handles GET /api/connections/:connection_id/scheduled-posts.
+func (h *Handler) ListScheduledPosts(c echo.Context) error {
+    token := accessToken(c)
+    if token == "" {
+        return httpx.Error(c, http.StatusUnauthorized, "missing_access_token", nil)
+    }
+    posts, err := h.Scheduler.List(c.Request().Context(), token)
+    if err != nil {
+        return h.scheduleError(c, err)
+    }
+    return c.JSON(http.StatusOK, scheduledPostsResponse{ScheduledPosts: posts})
+}
+
+type scheduledPostsResponse struct {
+    ScheduledPosts []oauth.ScheduledPost `json:"scheduled_posts"`
+}
+
+// GetScheduledPost handles GET
+// /api/connections/:connection_id/scheduled-posts/:id.
+func (h *Handler) GetScheduledPost(c echo.Context) error {
+    token := accessToken(c)
+    if token == "" {
+        return httpx.Error(c, http.StatusUnauthorized, "missing_access_token", nil)
+    }
+    p, err := h.Scheduler.Get(c.Request().Context(), token, c.Param("id"))
+    if err != nil {
+        return h.scheduleError(c, err)
+    }
+    return c.JSON(http.StatusOK, p)
+}
+
+// CancelScheduledPost handles DELETE
+// /api/connections/:connection_id/scheduled-posts/:id.
+func (h *Handler) CancelScheduledPost(c echo.Context) error {
+    token := accessToken(c)
+    if token == "" {
+        return httpx.Error(c, http.StatusUnauthorized, "missing_access_token", nil)
+    }
+    p, err := h.Scheduler.Cancel(c.Request().Context(), token, c.Param("id"))
+    if err != nil {
+        return h.scheduleError(c, err)
+    }
+    return c.JSON(http.StatusOK, p)
+}
+
+func (h *Handler) scheduleError(c echo.Context, err error) error {
+    switch {
+    case errors.Is(err, oauth.ErrInvalidPost):
+        return httpx.Error(c, http.StatusBadRequest, "invalid_post", err.Error())
+    case errors.Is(err, oauth.ErrUnknownToken):
+        return httpx.Error(c, http.StatusUnauthorized, "unknown_access_token", "sign in through /auth/login first")
+    case errors.Is(err, oauth.ErrNotCancelable):
+        return httpx.Error(c, http.StatusConflict, "not_cancelable", nil)
+    case errors.Is(err, oauth.ErrNotFound):
+        return httpx.Error(c, http.StatusNotFound, "not_found", nil)
+    default:
+        httpx.Log(c).Error("scheduled posts", "err", err)
+        return httpx.Error(c, http.StatusInternalServerError, "store_error", nil)
+    }
+}
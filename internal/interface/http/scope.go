@@ -0,0 +1,72 @@
+package httpiface
+
+import (
+    "net/http"
+    "net/url"
+    "strings"
+
+    "github.com/labstack/echo/v4"
+
+    "tiktok-oauth/internal/domain/oauth"
+    "tiktok-oauth/internal/pkg/httpx"
+)
+
+// insufficientScopeDetail is the detail of an insufficient_scope error.
+type insufficientScopeDetail struct {
+    RequiredScopes []string `json:"required_scopes"`
+    // UpgradeURL re-runs the authorization asking for the missing scopes.
+    UpgradeURL string `json:"upgrade_url"`
+}
+
+// RequireScopes rejects requests whose connection lacks any of scopes
+// with insufficient_scope, before TikTok would answer
+// scope_not_authorized. It checks the scopes merged into the connection
+// across authorizations, the same set denied_scopes is reported against.
+// It runs behind RequireConnection; connections without a recorded scope
+// are let through for TikTok to decide.
+func (h *Handler) RequireScopes(scopes ...string) echo.MiddlewareFunc {
+    return func(next echo.HandlerFunc) echo.HandlerFunc {
+        return func(c echo.Context) error {
+            conn, ok := c.Get(connKey).(oauth.Connection)
+            if !ok || len(conn.Scopes) == 0 {
+                return next(c)
+            }
+            if missing := oauth.NewScopeSet(conn.Scopes...).Missing(scopes...); len(missing) > 0 {
+                return insufficientScope(c, missing...)
+            }
+            return next(c)
+        }
+    }
+}
+
+// beginOptions reads ?scope= (comma or space separated), ?return_to=,
+// ?mode= and ?nonce= of a login or link request. Apps add client_id,
+// redirect_uri, state and an S256 code_challenge.
+func beginOptions(c echo.Context) oauth.BeginOptions {
+    opts := oauth.BeginOptions{
+        Scopes:   oauth.ParseScopes(c.QueryParam("scope")),
+        ReturnTo: c.QueryParam("return_to"),
+        Mode:     oauth.LoginMode(c.QueryParam("mode")),
+        Nonce:    c.QueryParam("nonce"),
+    }
+    if id := c.QueryParam("client_id"); id != "" {
+        opts.App = &oauth.AppRequest{
+            ClientID:            id,
+            RedirectURI:         c.QueryParam("redirect_uri"),
+            State:               c.QueryParam("state"),
+            CodeChallenge:       c.QueryParam("code_challenge"),
+            CodeChallengeMethod: c.QueryParam("code_challenge_method"),
+        }
+    }
+    return opts
+}
+
+// insufficientScope answers 403 with the scopes the endpoint needs and a
+// URL that requests them, upgrading the connection through the link flow.
+// The caller authenticated with its session, not a bearer token, so no
+// WWW-Authenticate challenge is sent.
+func insufficientScope(c echo.Context, scopes ...string) error {
+    q := url.Values{"scope": {strings.Join(scopes, ",")}}
+    upgrade := "/auth/" + oauth.ProviderTikTok + "/link?" + q.Encode()
+    return httpx.Error(c, http.StatusForbidden, "insufficient_scope", insufficientScopeDetail{RequiredScopes: scopes, UpgradeURL: upgrade})
+}
@@ -0,0 +1,243 @@
+package httpiface
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "html/template"
+    "io"
+    "io/fs"
+    "net/http"
+    "path"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/labstack/echo/v4"
+
+    "tiktok-oauth/internal/pkg/httpx"
+    "tiktok-oauth/internal/pkg/i18n"
+    "tiktok-oauth/internal/pkg/static"
+)
+
+// layoutTemplate is the shared page skeleton; every other template under
+// the directory defines "title", "content" and optionally "head".
+const layoutTemplate = "layout.html"
+
+// Templates parses the HTML templates of a directory once per language and
+// renders them by name ("callback" for callback.html) in the language of
+// the request. It implements echo.Renderer.
+//
+// Templates translate with {{t "key"}} (or {{t "key" "name" value}} for
+// placeholders) and read the language with {{lang}}.
+type Templates struct {
+    fsys fs.FS
+    dir  string
+    cat  *i18n.Catalog
+
+    mu     sync.RWMutex
+    pages  map[string]map[string]*template.Template // language, name
+    assets map[string]*static.Asset                 // language + "/" + name, see Page
+}
+
+// NewTemplates parses every template below dir of fsys and fails if any
+// of them is broken.
+func NewTemplates(fsys fs.FS, dir string, cat *i18n.Catalog) (*Templates, error) {
+    t := &Templates{fsys: fsys, dir: dir, cat: cat}
+    if err := t.Reload(); err != nil {
+        return nil, err
+    }
+    return t, nil
+}
+
+// Reload re-parses all templates. The previous set stays in use if any
+// template fails to parse.
+func (t *Templates) Reload() error {
+    pages := map[string]map[string]*template.Template{}
+    for _, lang := range t.cat.Languages() {
+        set, err := t.parse(lang)
+        if err != nil {
+            return err
+        }
+        pages[lang] = set
+    }
+    t.mu.Lock()
+    t.pages = pages
+    t.assets = map[string]*static.Asset{}
+    t.mu.Unlock()
+    return nil
+}
+
+// parse builds the pages of one language; the catalog lookups are bound
+// at parse time so executing a page needs no request state.
+func (t *Templates) parse(lang string) (map[string]*template.Template, error) {
+    funcs := template.FuncMap{
+        "t": func(key string, args ...string) string {
+            return t.cat.T(lang, key, args...)
+        },
+        "lang": func() string { return lang },
+    }
+    layout, err := template.New(layoutTemplate).Funcs(funcs).ParseFS(t.fsys, path.Join(t.dir, layoutTemplate))
+    if err != nil {
+        return nil, err
+    }
+    names, err := fs.Glob(t.fsys, path.Join(t.dir, "*.html"))
+    if err != nil {
+        return nil, err
+    }
+    pages := map[string]*template.Template{}
+    for _, name := range names {
+        base := path.Base(name)
+        if base == layoutTemplate {
+            continue
+        }
+        page, err := template.Must(layout.Clone()).ParseFS(t.fsys, name)
+        if err != nil {
+            return nil, err
+        }
+        if page.Lookup("content") == nil {
+            return nil, fmt.Errorf("template %s does not define \"content\"", name)
+        }
+        pages[strings.TrimSuffix(base, ".html")] = page
+    }
+    return pages, nil
+}
+
+// Render executes a page into w, buffered so a failing template does not
+// leave a half-written response.
+func (t *Templates) Render(w io.Writer, name string, data any, c echo.Context) error {
+    t.mu.RLock()
+    _, page, err := t.lookupLocked(i18n.Lang(c), name)
+    t.mu.RUnlock()
+    if err != nil {
+        return err
+    }
+    var buf bytes.Buffer
+    if err := page.ExecuteTemplate(&buf, layoutTemplate, data); err != nil {
+        return err
+    }
+    _, err = buf.WriteTo(w)
+    return err
+}
+
+// lookupLocked returns a page in lang, or in the default language when
+// lang has no templates, along with the language it is in.
+func (t *Templates) lookupLocked(lang, name string) (string, *template.Template, error) {
+    set, ok := t.pages[lang]
+    if !ok {
+        lang = t.cat.Default()
+        set = t.pages[lang]
+    }
+    page, ok := set[name]
+    if !ok {
+        return "", nil, fmt.Errorf("template %q not found", name)
+    }
+    return lang, page, nil
+}
+
+// render writes a page through the echo.Renderer, answering 500 if the
+// template fails.
+func render(c echo.Context, status int, name string, data any) error {
+    if err := c.Render(status, name, data); err != nil {
+        httpx.Log(c).Error("failed to render template", "template", name, "err", err)
+        return httpx.Error(c, http.StatusInternalServerError, "render_failed", nil)
+    }
+    return nil
+}
+
+// Page serves a template that needs no data, such as the top page. It is
+// rendered once per language and served like an embedded file, with an
+// ETag and precompressed representations, until the templates reload.
+func (t *Templates) Page(name string) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        a, err := t.pageAsset(i18n.Lang(c), name)
+        if err != nil {
+            httpx.Log(c).Error("failed to render template", "template", name, "err", err)
+            return httpx.Error(c, http.StatusInternalServerError, "render_failed", nil)
+        }
+        return static.ServeAsset(c, a, "no-cache")
+    }
+}
+
+// pageAsset returns the rendered page, rendering it on first use. The
+// result goes into the cache of the templates it was rendered from, so a
+// concurrent Reload never serves it.
+func (t *Templates) pageAsset(lang, name string) (*static.Asset, error) {
+    t.mu.RLock()
+    lang, page, err := t.lookupLocked(lang, name)
+    assets := t.assets
+    a, ok := assets[lang+"/"+name]
+    t.mu.RUnlock()
+    if err != nil || ok {
+        return a, err
+    }
+    var buf bytes.Buffer
+    if err := page.ExecuteTemplate(&buf, layoutTemplate, nil); err != nil {
+        return nil, err
+    }
+    a = static.NewCompressedAsset(name+".html", echo.MIMETextHTMLCharsetUTF8, buf.Bytes())
+    t.mu.Lock()
+    assets[lang+"/"+name] = a
+    t.mu.Unlock()
+    return a, nil
+}
+
+// Watch re-parses the templates whenever a file below the directory
+// changes, until ctx is done. It is meant for development, where fsys is
+// a directory on disk; errors are reported and the old templates kept.
+func (t *Templates) Watch(ctx context.Context, interval time.Duration, onErr func(error)) {
+    last := t.modified()
+    tick := time.NewTicker(interval)
+    defer tick.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-tick.C:
+        }
+        if m := t.modified(); m != last {
+            last = m
+            if err := t.Reload(); err != nil {
+                onErr(err)
+            }
+        }
+    }
+}
+
+// modified fingerprints the templates by name, size and modification time.
+func (t *Templates) modified() string {
+    var b strings.Builder
+    names, _ := fs.Glob(t.fsys, path.Join(t.dir, "*.html"))
+    for _, name := range names {
+        if fi, err := fs.Stat(t.fsys, name); err == nil {
+            fmt.Fprintf(&b, "%s:%d:%d;", name, fi.Size(), fi.ModTime().UnixNano())
+        }
+    }
+    return b.String()
+}
+
+// ProblemType handles GET /problems/:code, the page the type URI of a
+// problem points to. The page depends on the Accept header and the
+// language cookie, so only the browser may cache it.
+func ProblemType(c echo.Context) error {
+    code := c.Param("code")
+    if !i18n.Has(c, "error."+code) {
+        return httpx.Error(c, http.StatusNotFound, "not_found", nil)
+    }
+    p := httpx.NewProblem(c, http.StatusOK, code, nil)
+    p.Status, p.Instance, p.RequestID = 0, "", ""
+    hdr := c.Response().Header()
+    hdr.Set("Cache-Control", "private, max-age=3600")
+    hdr.Add("Vary", echo.HeaderAccept+", "+echo.HeaderCookie)
+    if wantsJSON(c) {
+        return c.JSON(http.StatusOK, problemTypeResponse{Type: p.Type, Title: p.Title, Code: p.Code})
+    }
+    return render(c, http.StatusOK, "error", p)
+}
+
+// problemTypeResponse describes an error code in JSON.
+type problemTypeResponse struct {
+    Type  string `json:"type"`
+    Title string `json:"title"`
+    Code  string `json:"code"`
+}
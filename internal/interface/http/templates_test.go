@@ -0,0 +1,98 @@
+package httpiface
+
+import (
+    "compress/gzip"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "slices"
+    "strings"
+    "testing"
+
+    "github.com/labstack/echo/v4"
+
+    site "tiktok-oauth"
+    "tiktok-oauth/internal/pkg/i18n"
+    "tiktok-oauth/internal/pkg/static"
+)
+
+func TestTemplates_PageCached(t *testing.T) {
+    files := static.New(site.Files, "")
+    catalog, err := i18n.Load(files.FS(), "contents/i18n", "ja")
+    if err != nil {
+        t.Fatal(err)
+    }
+    views, err := NewTemplates(files.FS(), "contents", catalog)
+    if err != nil {
+        t.Fatal(err)
+    }
+    e := echo.New()
+    e.Use(catalog.Middleware(false))
+    e.GET("/", views.Page("index"))
+
+    req := httptest.NewRequest(http.MethodGet, "/", nil)
+    req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+    rec := httptest.NewRecorder()
+    e.ServeHTTP(rec, req)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("GET /: %d %s", rec.Code, rec.Body.String())
+    }
+    etag := rec.Header().Get("ETag")
+    if etag == "" {
+        t.Fatal("no ETag")
+    }
+    if got := rec.Header().Get(echo.HeaderContentEncoding); got != "gzip" {
+        t.Fatalf("Content-Encoding = %q", got)
+    }
+    if got := rec.Header().Get(echo.HeaderContentType); got != echo.MIMETextHTMLCharsetUTF8 {
+        t.Fatalf("Content-Type = %q", got)
+    }
+    zr, err := gzip.NewReader(rec.Body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    body, err := io.ReadAll(zr)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(string(body), "<html") {
+        t.Fatalf("not a page:\n%s", body)
+    }
+
+    req = httptest.NewRequest(http.MethodGet, "/", nil)
+    req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+    req.Header.Set("If-None-Match", etag)
+    rec = httptest.NewRecorder()
+    e.ServeHTTP(rec, req)
+    if rec.Code != http.StatusNotModified {
+        t.Fatalf("revalidate: %d", rec.Code)
+    }
+
+    req = httptest.NewRequest(http.MethodGet, "/", nil)
+    req.Header.Set("Accept-Language", "en")
+    rec = httptest.NewRecorder()
+    e.ServeHTTP(rec, req)
+    if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+        t.Fatalf("en page: %d, ETag %q", rec.Code, rec.Header().Get("ETag"))
+    }
+}
+
+func TestProblemType_CachedPrivately(t *testing.T) {
+    e := newTestServer(t)
+    req := httptest.NewRequest(http.MethodGet, "/problems/invalid_state", nil)
+    req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+    rec := httptest.NewRecorder()
+    e.ServeHTTP(rec, req)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("GET /problems/invalid_state: %d %s", rec.Code, rec.Body.String())
+    }
+    if got := rec.Header().Get("Cache-Control"); !strings.HasPrefix(got, "private") {
+        t.Fatalf("Cache-Control = %q", got)
+    }
+    vary := strings.Split(strings.Join(rec.Header().Values("Vary"), ", "), ", ")
+    for _, h := range []string{echo.HeaderAccept, echo.HeaderCookie, "Accept-Language"} {
+        if !slices.Contains(vary, h) {
+            t.Errorf("Vary %q lacks %s", vary, h)
+        }
+    }
+}
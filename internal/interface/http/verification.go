@@ -0,0 +1,106 @@
+package httpiface
+
+import (
+    "crypto/subtle"
+    "errors"
+    "io"
+    "net/http"
+    "path"
+    "strings"
+
+    "github.com/labstack/echo/v4"
+
+    "tiktok-oauth/internal/domain/oauth"
+    "tiktok-oauth/internal/pkg/httpx"
+    "tiktok-oauth/internal/pkg/static"
+)
+
+// verificationCacheControl lets verifiers cache files briefly, so a
+// replaced file is picked up within minutes.
+const verificationCacheControl = "public, max-age=300"
+
+// RequireAdmin admits requests carrying the admin token as a bearer
+// token. Without a configured token the admin API is disabled.
+func (h *Handler) RequireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        if h.AdminToken == "" {
+            return httpx.Error(c, http.StatusNotFound, "admin_disabled", nil)
+        }
+        if subtle.ConstantTimeCompare([]byte(bearerToken(c)), []byte(h.AdminToken)) != 1 {
+            c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="admin"`)
+            return httpx.Error(c, http.StatusUnauthorized, "invalid_admin_token", nil)
+        }
+        return next(c)
+    }
+}
+
+// ListVerificationFiles handles GET /admin/verification-files.
+func (h *Handler) ListVerificationFiles(c echo.Context) error {
+    files, err := h.Verification.List(c.Request().Context())
+    if err != nil {
+        httpx.Log(c).Error("verification files", "err", err)
+        return httpx.Error(c, http.StatusInternalServerError, "store_error", nil)
+    }
+    return c.JSON(http.StatusOK, verificationFilesResponse{VerificationFiles: files})
+}
+
+type verificationFilesResponse struct {
+    VerificationFiles []oauth.VerificationFile `json:"verification_files"`
+}
+
+// PutVerificationFile handles PUT /admin/verification-files/<path>: the
+// request body is the file content, served at /<path> from then on.
+func (h *Handler) PutVerificationFile(c echo.Context) error {
+    body, err := io.ReadAll(io.LimitReader(c.Request().Body, 1<<20))
+    if err != nil {
+        return httpx.Error(c, http.StatusBadRequest, "invalid_body", err.Error())
+    }
+    f, err := h.Verification.Put(c.Request().Context(), "/"+c.Param("*"), string(body))
+    switch {
+    case errors.Is(err, oauth.ErrInvalidVerificationFile):
+        return httpx.Error(c, http.StatusBadRequest, "invalid_verification_file", err.Error())
+    case err != nil:
+        httpx.Log(c).Error("verification files", "err", err)
+        return httpx.Error(c, http.StatusInternalServerError, "store_error", nil)
+    }
+    return c.JSON(http.StatusOK, f)
+}
+
+// DeleteVerificationFile handles DELETE /admin/verification-files/<path>.
+func (h *Handler) DeleteVerificationFile(c echo.Context) error {
+    err := h.Verification.Delete(c.Request().Context(), "/"+c.Param("*"))
+    switch {
+    case errors.Is(err, oauth.ErrNotFound):
+        return httpx.Error(c, http.StatusNotFound, "not_found", nil)
+    case err != nil:
+        httpx.Log(c).Error("verification files", "err", err)
+        return httpx.Error(c, http.StatusInternalServerError, "store_error", nil)
+    }
+    return c.NoContent(http.StatusNoContent)
+}
+
+// VerificationFile answers requests no route matched: files uploaded
+// through the admin API first, then the ones deployed under dir (the
+// signature files of earlier releases). It is registered as the
+// not-found handler so it never shadows a real route.
+func (h *Handler) VerificationFile(files *static.Files, dir string) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        if m := c.Request().Method; m != http.MethodGet && m != http.MethodHead {
+            return echo.ErrNotFound
+        }
+        p := c.Request().URL.Path
+        f, err := h.Verification.Get(c.Request().Context(), p)
+        if err == nil {
+            return static.ServeAsset(c, static.NewAsset(p, f.ContentType, []byte(f.Content)), verificationCacheControl)
+        }
+        if !errors.Is(err, oauth.ErrNotFound) {
+            httpx.Log(c).Error("verification files", "err", err)
+            return httpx.Error(c, http.StatusInternalServerError, "store_error", nil)
+        }
+        name := strings.TrimPrefix(p, "/")
+        if name == "" || strings.Contains(name, "/") {
+            return echo.ErrNotFound
+        }
+        return files.Serve(c, path.Join(dir, name), verificationCacheControl)
+    }
+}
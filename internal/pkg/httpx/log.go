@@ -0,0 +1,41 @@
+package httpx
+
+import (
+    "log/slog"
+
+    "github.com/labstack/echo/v4"
+    "go.opentelemetry.io/otel/trace"
+
+    "tiktok-oauth/internal/pkg/logging"
+)
+
+// Logger puts base, tagged with the request ID, in the context of every
+// request. Handlers log through Log(c); the use case and the TikTok client
+// pick the same logger up with logging.FromContext. Register it after
+// middleware.RequestID and the tracing middleware, whose trace ID is
+// added too.
+func Logger(base *slog.Logger) echo.MiddlewareFunc {
+    return func(next echo.HandlerFunc) echo.HandlerFunc {
+        return func(c echo.Context) error {
+            req := c.Request()
+            l := base.With("request_id", RequestID(c))
+            if sc := trace.SpanContextFromContext(req.Context()); sc.IsValid() {
+                l = l.With("trace_id", sc.TraceID().String())
+            }
+            c.SetRequest(req.WithContext(logging.NewContext(req.Context(), l)))
+            return next(c)
+        }
+    }
+}
+
+// Log returns the logger of the request.
+func Log(c echo.Context) *slog.Logger {
+    return logging.FromContext(c.Request().Context())
+}
+
+// LogWith adds args to the logger of the rest of the request, e.g. the
+// open_id once the account is known.
+func LogWith(c echo.Context, args ...any) {
+    req := c.Request()
+    c.SetRequest(req.WithContext(logging.With(req.Context(), args...)))
+}
@@ -0,0 +1,37 @@
+package httpx
+
+import (
+    "bytes"
+    "encoding/json"
+    "log/slog"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/labstack/echo/v4"
+
+    "tiktok-oauth/internal/pkg/logging"
+)
+
+func TestLogger(t *testing.T) {
+    var buf bytes.Buffer
+    e := echo.New()
+    e.Use(Logger(slog.New(slog.NewJSONHandler(&buf, nil))))
+    e.GET("/x", func(c echo.Context) error {
+        LogWith(c, "open_id", "open-1")
+        // Code below the handler sees the same logger through the context.
+        logging.FromContext(c.Request().Context()).Info("done")
+        return c.NoContent(http.StatusNoContent)
+    })
+    req := httptest.NewRequest(http.MethodGet, "/x", nil)
+    req.Header.Set(echo.HeaderXRequestID, "req-1")
+    e.ServeHTTP(httptest.NewRecorder(), req)
+
+    var got map[string]any
+    if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+        t.Fatalf("decode %q: %v", buf.String(), err)
+    }
+    if got["request_id"] != "req-1" || got["open_id"] != "open-1" || got["msg"] != "done" {
+        t.Fatalf("log = %v", got)
+    }
+}
@@ -0,0 +1,202 @@
+// Package httpx holds HTTP helpers shared by the handlers.
+package httpx
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "strings"
+
+    "github.com/labstack/echo/v4"
+
+    "tiktok-oauth/internal/pkg/i18n"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// problemTemplate is the HTML page browsers get instead of JSON.
+const problemTemplate = "error"
+
+// Problem is an RFC 7807 problem details object. Code is the stable
+// snake_case error code clients switch on; Type is derived from it.
+// Extensions become additional members of the JSON object; the tags
+// document the members MarshalJSON writes.
+type Problem struct {
+    Type       string         `json:"type"`
+    Title      string         `json:"title"`
+    Status     int            `json:"status"`
+    Detail     string         `json:"detail,omitempty"`
+    Instance   string         `json:"instance,omitempty"`
+    Code       string         `json:"code"`
+    RequestID  string         `json:"request_id,omitempty"`
+    LogID      string         `json:"log_id,omitempty"`
+    Extensions map[string]any `json:"-" openapi:"additional"`
+}
+
+// MarshalJSON flattens Extensions into the object, as RFC 7807 section 3.2
+// describes.
+func (p Problem) MarshalJSON() ([]byte, error) {
+    m := make(map[string]any, len(p.Extensions)+8)
+    for k, v := range p.Extensions {
+        m[k] = v
+    }
+    m["type"] = p.Type
+    m["title"] = p.Title
+    m["status"] = p.Status
+    m["code"] = p.Code
+    for k, v := range map[string]string{"detail": p.Detail, "instance": p.Instance, "request_id": p.RequestID, "log_id": p.LogID} {
+        if v != "" {
+            m[k] = v
+        }
+    }
+    return json.Marshal(m)
+}
+
+// logIDCarrier is implemented by upstream errors that carry the TikTok
+// log_id of the failed call.
+type logIDCarrier interface {
+    TikTokLogID() string
+}
+
+// LogID returns the TikTok log_id carried by err, if any.
+func LogID(err error) string {
+    var lc logIDCarrier
+    if errors.As(err, &lc) {
+        return lc.TikTokLogID()
+    }
+    return ""
+}
+
+// NewProblem builds the problem for code. detail may be a string, an
+// error (whose TikTok log_id is picked up), or a struct or map whose
+// fields become extension members. The title is the localized
+// "error.<code>" message, or the status text.
+func NewProblem(c echo.Context, status int, code string, detail any) Problem {
+    p := Problem{
+        Type:      "/problems/" + code,
+        Title:     http.StatusText(status),
+        Status:    status,
+        Instance:  c.Request().URL.Path,
+        Code:      code,
+        RequestID: RequestID(c),
+    }
+    if key := "error." + code; i18n.Has(c, key) {
+        p.Title = i18n.T(c, key)
+    }
+    switch d := detail.(type) {
+    case nil:
+    case string:
+        p.Detail = d
+    case error:
+        p.Detail = d.Error()
+        p.LogID = LogID(d)
+    default:
+        // Structs and maps: their JSON members are the extensions.
+        b, err := json.Marshal(d)
+        if err == nil && json.Unmarshal(b, &p.Extensions) == nil {
+            break
+        }
+        p.Extensions = map[string]any{"detail_data": d}
+    }
+    return p
+}
+
+// Error writes a problem for code: application/problem+json for API
+// clients, the error page for browsers.
+func Error(c echo.Context, status int, code string, detail any) error {
+    return WriteProblem(c, NewProblem(c, status, code, detail))
+}
+
+// WriteProblem writes p, as HTML when the client is a browser and the
+// error template renders.
+func WriteProblem(c echo.Context, p Problem) error {
+    if c.Request().Method == http.MethodHead {
+        return c.NoContent(p.Status)
+    }
+    if wantsHTML(c) && c.Echo().Renderer != nil {
+        if err := c.Render(p.Status, problemTemplate, p); err == nil {
+            return nil
+        } else if c.Response().Committed {
+            return err
+        }
+    }
+    b, err := json.Marshal(p)
+    if err != nil {
+        return err
+    }
+    return c.Blob(p.Status, ProblemContentType, b)
+}
+
+// ErrorHandler is the echo.HTTPErrorHandler: errors returned by handlers
+// and middleware become problems too. Errors other than *echo.HTTPError
+// are logged and answered with a bare internal_error.
+func ErrorHandler(err error, c echo.Context) {
+    if c.Response().Committed {
+        return
+    }
+    status, code, detail := http.StatusInternalServerError, "internal_error", ""
+    var he *echo.HTTPError
+    if errors.As(err, &he) {
+        status, code = he.Code, statusCode(he.Code)
+        if msg, ok := he.Message.(string); ok && msg != http.StatusText(he.Code) {
+            detail = msg
+        }
+        if he.Internal != nil && status >= http.StatusInternalServerError {
+            Log(c).Error("unhandled error", "method", c.Request().Method, "path", c.Request().URL.Path, "err", he.Internal)
+        }
+    } else {
+        Log(c).Error("unhandled error", "method", c.Request().Method, "path", c.Request().URL.Path, "err", err)
+    }
+    if err := Error(c, status, code, detail); err != nil {
+        Log(c).Error("write problem", "err", err)
+    }
+}
+
+// Status returns the status a request ended with: the one written, or
+// the one ErrorHandler answers err with when nothing was.
+func Status(c echo.Context, err error) int {
+    if c.Response().Committed {
+        return c.Response().Status
+    }
+    var he *echo.HTTPError
+    switch {
+    case err == nil:
+        return http.StatusOK
+    case errors.As(err, &he):
+        return he.Code
+    default:
+        return http.StatusInternalServerError
+    }
+}
+
+// statusCode derives a code from a status ("Not Found" -> "not_found").
+func statusCode(status int) string {
+    if status == http.StatusInternalServerError {
+        return "internal_error"
+    }
+    text := http.StatusText(status)
+    if text == "" {
+        return "error"
+    }
+    return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
+
+// RequestID returns the X-Request-Id of the request, as set by the
+// RequestID middleware.
+func RequestID(c echo.Context) string {
+    if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+        return id
+    }
+    return c.Request().Header.Get(echo.HeaderXRequestID)
+}
+
+// wantsHTML reports whether the request comes from a browser navigation
+// rather than an API client.
+func wantsHTML(c echo.Context) bool {
+    if c.QueryParam("format") == "json" {
+        return false
+    }
+    accept := c.Request().Header.Get(echo.HeaderAccept)
+    return strings.Contains(accept, "text/html") && !strings.Contains(accept, "application/json")
+}
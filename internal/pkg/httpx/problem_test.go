@@ -0,0 +1,107 @@
+package httpx
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/labstack/echo/v4"
+)
+
+type upstreamError struct{ logID string }
+
+func (e *upstreamError) Error() string       { return "upstream failed" }
+func (e *upstreamError) TikTokLogID() string { return e.logID }
+
+func serve(t *testing.T, h echo.HandlerFunc) (*httptest.ResponseRecorder, map[string]any) {
+    t.Helper()
+    e := echo.New()
+    e.HTTPErrorHandler = ErrorHandler
+    e.GET("/x", h)
+    req := httptest.NewRequest(http.MethodGet, "/x?token=secret", nil)
+    req.Header.Set(echo.HeaderXRequestID, "req-1")
+    rec := httptest.NewRecorder()
+    e.ServeHTTP(rec, req)
+    var body map[string]any
+    if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+        t.Fatalf("decode %q: %v", rec.Body.String(), err)
+    }
+    return rec, body
+}
+
+func TestError(t *testing.T) {
+    err := fmt.Errorf("init: %w", &upstreamError{logID: "log-42"})
+    rec, body := serve(t, func(c echo.Context) error {
+        return Error(c, http.StatusBadGateway, "post_init_failed", err)
+    })
+    if ct := rec.Header().Get(echo.HeaderContentType); ct != ProblemContentType {
+        t.Fatalf("content type %q", ct)
+    }
+    want := map[string]any{
+        "type":       "/problems/post_init_failed",
+        "title":      "Bad Gateway",
+        "status":     float64(http.StatusBadGateway),
+        "detail":     "init: upstream failed",
+        "instance":   "/x",
+        "code":       "post_init_failed",
+        "request_id": "req-1",
+        "log_id":     "log-42",
+    }
+    for k, v := range want {
+        if body[k] != v {
+            t.Errorf("%s = %v, want %v", k, body[k], v)
+        }
+    }
+
+    _, body = serve(t, func(c echo.Context) error {
+        return Error(c, http.StatusForbidden, "insufficient_scope", struct {
+            RequiredScopes []string `json:"required_scopes"`
+        }{[]string{"video.publish"}})
+    })
+    if scopes, _ := body["required_scopes"].([]any); len(scopes) != 1 || body["detail"] != nil {
+        t.Fatalf("struct details must become extension members: %v", body)
+    }
+}
+
+func TestErrorHandler(t *testing.T) {
+    rec, body := serve(t, func(c echo.Context) error { return echo.ErrNotFound })
+    if rec.Code != http.StatusNotFound || body["code"] != "not_found" || body["detail"] != nil {
+        t.Fatalf("unexpected not found problem %d %v", rec.Code, body)
+    }
+    rec, body = serve(t, func(c echo.Context) error { return errors.New("db is down") })
+    if rec.Code != http.StatusInternalServerError || body["code"] != "internal_error" || body["detail"] != nil {
+        t.Fatalf("internal errors must not leak: %d %v", rec.Code, body)
+    }
+    rec, body = serve(t, func(c echo.Context) error {
+        return echo.NewHTTPError(http.StatusBadRequest, "missing field")
+    })
+    if rec.Code != http.StatusBadRequest || body["code"] != "bad_request" || body["detail"] != "missing field" {
+        t.Fatalf("unexpected bad request problem %d %v", rec.Code, body)
+    }
+}
+
+func TestStatus(t *testing.T) {
+    for _, tc := range []struct {
+        name string
+        h    echo.HandlerFunc
+        want int
+    }{
+        {"ok", func(c echo.Context) error { return nil }, http.StatusOK},
+        {"http error", func(c echo.Context) error { return echo.ErrNotFound }, http.StatusNotFound},
+        {"other error", func(c echo.Context) error { return errors.New("boom") }, http.StatusInternalServerError},
+        {"written", func(c echo.Context) error { return c.NoContent(http.StatusAccepted) }, http.StatusAccepted},
+        {"written then failed", func(c echo.Context) error {
+            c.NoContent(http.StatusCreated)
+            return errors.New("late")
+        }, http.StatusCreated},
+    } {
+        e := echo.New()
+        c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+        if got := Status(c, tc.h(c)); got != tc.want {
+            t.Errorf("%s: Status = %d, want %d", tc.name, got, tc.want)
+        }
+    }
+}
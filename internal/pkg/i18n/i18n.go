@@ -0,0 +1,186 @@
+// Package i18n holds the message catalogs and picks the language of each
+// request.
+package i18n
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/fs"
+    "net/http"
+    "path"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/labstack/echo/v4"
+    "golang.org/x/text/language"
+)
+
+const (
+    // langCookie remembers a language chosen with ?lang=.
+    langCookie = "lang"
+    langKey    = "i18n.lang"
+    catalogKey = "i18n.catalog"
+)
+
+// Catalog maps message keys to text per language. Lookups fall back from
+// the requested language to its base language, then to the default
+// language, and finally to the key itself.
+type Catalog struct {
+    def     string
+    langs   []string
+    msgs    map[string]map[string]string
+    matcher language.Matcher
+}
+
+// Load reads one flat JSON object per language from dir ("ja.json",
+// "en.json"). def must be one of them.
+func Load(fsys fs.FS, dir, def string) (*Catalog, error) {
+    names, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+    if err != nil {
+        return nil, err
+    }
+    c := &Catalog{def: def, msgs: map[string]map[string]string{}}
+    for _, name := range names {
+        lang := strings.TrimSuffix(path.Base(name), ".json")
+        if _, err := language.Parse(lang); err != nil {
+            return nil, fmt.Errorf("catalog %s: %w", name, err)
+        }
+        b, err := fs.ReadFile(fsys, name)
+        if err != nil {
+            return nil, err
+        }
+        var msgs map[string]string
+        if err := json.Unmarshal(b, &msgs); err != nil {
+            return nil, fmt.Errorf("catalog %s: %w", name, err)
+        }
+        c.msgs[lang] = msgs
+        c.langs = append(c.langs, lang)
+    }
+    if _, ok := c.msgs[def]; !ok {
+        return nil, fmt.Errorf("no catalog for the default language %q in %s", def, dir)
+    }
+    // The default language comes first so the matcher falls back to it.
+    sort.Slice(c.langs, func(i, j int) bool { return c.langs[i] == def || (c.langs[j] != def && c.langs[i] < c.langs[j]) })
+    tags := make([]language.Tag, len(c.langs))
+    for i, l := range c.langs {
+        tags[i] = language.Make(l)
+    }
+    c.matcher = language.NewMatcher(tags)
+    return c, nil
+}
+
+// Languages lists the supported languages, the default first.
+func (c *Catalog) Languages() []string { return c.langs }
+
+// Default returns the default language.
+func (c *Catalog) Default() string { return c.def }
+
+// T returns the text of key in lang, following the fallback chain. args
+// are name/value pairs replacing "{name}" placeholders in the text.
+func (c *Catalog) T(lang, key string, args ...string) string {
+    s, ok := c.lookup(lang, key)
+    if !ok {
+        return key
+    }
+    for i := 0; i+1 < len(args); i += 2 {
+        s = strings.ReplaceAll(s, "{"+args[i]+"}", args[i+1])
+    }
+    return s
+}
+
+// Has reports whether key exists in any language of the chain.
+func (c *Catalog) Has(lang, key string) bool {
+    _, ok := c.lookup(lang, key)
+    return ok
+}
+
+func (c *Catalog) lookup(lang, key string) (string, bool) {
+    for _, l := range c.chain(lang) {
+        if s, ok := c.msgs[l][key]; ok {
+            return s, true
+        }
+    }
+    return "", false
+}
+
+func (c *Catalog) chain(lang string) []string {
+    out := []string{lang}
+    if base, _, ok := strings.Cut(lang, "-"); ok {
+        out = append(out, base)
+    }
+    return append(out, c.def)
+}
+
+// Match picks the supported language for an explicit choice (?lang= or
+// the cookie) or, failing that, an Accept-Language header.
+func (c *Catalog) Match(choice, acceptLanguage string) string {
+    if choice != "" {
+        if _, ok := c.msgs[choice]; ok {
+            return choice
+        }
+    }
+    tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+    if err != nil || len(tags) == 0 {
+        return c.def
+    }
+    _, i, conf := c.matcher.Match(tags...)
+    if conf == language.No {
+        return c.def
+    }
+    return c.langs[i]
+}
+
+// Middleware negotiates the language of every request from ?lang=, the
+// lang cookie and Accept-Language, in that order. A valid ?lang= is
+// remembered in the cookie, which is Secure when secureCookie is set;
+// behind a TLS-terminating proxy the request itself is plain HTTP.
+func (c *Catalog) Middleware(secureCookie bool) echo.MiddlewareFunc {
+    return func(next echo.HandlerFunc) echo.HandlerFunc {
+        return func(ctx echo.Context) error {
+            choice := ctx.QueryParam("lang")
+            if _, ok := c.msgs[choice]; ok {
+                ctx.SetCookie(&http.Cookie{
+                    Name:     langCookie,
+                    Value:    choice,
+                    Path:     "/",
+                    MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+                    HttpOnly: true,
+                    Secure:   secureCookie,
+                    SameSite: http.SameSiteLaxMode,
+                })
+            } else if ck, err := ctx.Cookie(langCookie); err == nil {
+                choice = ck.Value
+            }
+            lang := c.Match(choice, ctx.Request().Header.Get("Accept-Language"))
+            ctx.Set(langKey, lang)
+            ctx.Set(catalogKey, c)
+            hdr := ctx.Response().Header()
+            hdr.Set("Content-Language", lang)
+            hdr.Add("Vary", "Accept-Language")
+            return next(ctx)
+        }
+    }
+}
+
+// Lang returns the language negotiated for a request, or "" without the
+// middleware.
+func Lang(c echo.Context) string {
+    lang, _ := c.Get(langKey).(string)
+    return lang
+}
+
+// T translates key for a request; without the middleware it returns key.
+func T(c echo.Context, key string, args ...string) string {
+    cat, ok := c.Get(catalogKey).(*Catalog)
+    if !ok {
+        return key
+    }
+    return cat.T(Lang(c), key, args...)
+}
+
+// Has reports whether key can be translated for a request.
+func Has(c echo.Context, key string) bool {
+    cat, ok := c.Get(catalogKey).(*Catalog)
+    return ok && cat.Has(Lang(c), key)
+}
@@ -0,0 +1,104 @@
+package i18n
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "testing/fstest"
+
+    "github.com/labstack/echo/v4"
+)
+
+func testCatalog(t *testing.T) *Catalog {
+    t.Helper()
+    fsys := fstest.MapFS{
+        "i18n/ja.json": {Data: []byte(`{"hello": "こんにちは", "only.ja": "日本語のみ", "greet": "{name} さん"}`)},
+        "i18n/en.json": {Data: []byte(`{"hello": "Hello", "greet": "Hi {name}"}`)},
+    }
+    cat, err := Load(fsys, "i18n", "ja")
+    if err != nil {
+        t.Fatalf("load: %v", err)
+    }
+    return cat
+}
+
+func TestCatalog_T(t *testing.T) {
+    cat := testCatalog(t)
+    if got := cat.Languages(); len(got) != 2 || got[0] != "ja" {
+        t.Fatalf("languages = %v, want the default first", got)
+    }
+    cases := []struct{ lang, key, want string }{
+        {"en", "hello", "Hello"},
+        {"en-GB", "hello", "Hello"},          // base language
+        {"en", "only.ja", "日本語のみ"},           // default language
+        {"fr", "hello", "こんにちは"},             // unsupported language
+        {"en", "missing.key", "missing.key"}, // the key itself
+    }
+    for _, tc := range cases {
+        if got := cat.T(tc.lang, tc.key); got != tc.want {
+            t.Errorf("T(%q, %q) = %q, want %q", tc.lang, tc.key, got, tc.want)
+        }
+    }
+    if got := cat.T("en", "greet", "name", "Ann"); got != "Hi Ann" {
+        t.Errorf("placeholder: got %q", got)
+    }
+    if cat.Has("en", "missing.key") || !cat.Has("en", "only.ja") {
+        t.Errorf("Has does not follow the fallback chain")
+    }
+}
+
+func TestCatalog_Match(t *testing.T) {
+    cat := testCatalog(t)
+    cases := []struct{ choice, accept, want string }{
+        {"en", "ja", "en"},
+        {"xx", "en-US,en;q=0.9", "en"},
+        {"", "fr-FR, ja;q=0.5", "ja"},
+        {"", "de", "ja"},
+        {"", "", "ja"},
+        {"", "not a header;;", "ja"},
+    }
+    for _, tc := range cases {
+        if got := cat.Match(tc.choice, tc.accept); got != tc.want {
+            t.Errorf("Match(%q, %q) = %q, want %q", tc.choice, tc.accept, got, tc.want)
+        }
+    }
+}
+
+func TestCatalog_Middleware(t *testing.T) {
+    cat := testCatalog(t)
+    e := echo.New()
+    e.Use(cat.Middleware(true))
+    e.GET("/", func(c echo.Context) error { return c.String(http.StatusOK, T(c, "hello")) })
+
+    do := func(target string, header http.Header) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodGet, target, nil)
+        for k, v := range header {
+            req.Header[k] = v
+        }
+        rec := httptest.NewRecorder()
+        e.ServeHTTP(rec, req)
+        return rec
+    }
+
+    rec := do("/", http.Header{"Accept-Language": {"en-US,en;q=0.8"}})
+    if rec.Body.String() != "Hello" || rec.Header().Get("Content-Language") != "en" {
+        t.Fatalf("Accept-Language: body=%q lang=%q", rec.Body.String(), rec.Header().Get("Content-Language"))
+    }
+
+    rec = do("/?lang=ja", http.Header{"Accept-Language": {"en"}})
+    if rec.Body.String() != "こんにちは" {
+        t.Fatalf("?lang=: body=%q", rec.Body.String())
+    }
+    cookies := rec.Result().Cookies()
+    if len(cookies) != 1 || cookies[0].Name != langCookie || cookies[0].Value != "ja" {
+        t.Fatalf("expected the choice to be remembered, got %v", cookies)
+    }
+    if !cookies[0].Secure {
+        t.Fatal("lang cookie is not Secure although configured so over plain HTTP")
+    }
+
+    rec = do("/", http.Header{"Accept-Language": {"en"}, "Cookie": {"lang=ja"}})
+    if rec.Body.String() != "こんにちは" {
+        t.Fatalf("cookie: body=%q", rec.Body.String())
+    }
+}
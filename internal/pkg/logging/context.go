@@ -0,0 +1,28 @@
+package logging
+
+import (
+    "context"
+    "log/slog"
+)
+
+type ctxKey struct{}
+
+// NewContext returns ctx carrying l.
+func NewContext(ctx context.Context, l *slog.Logger) context.Context {
+    return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger of ctx, or slog.Default() when it has
+// none, so callers never need to check.
+func FromContext(ctx context.Context) *slog.Logger {
+    if l, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+        return l
+    }
+    return slog.Default()
+}
+
+// With returns ctx carrying its logger with args added, e.g.
+// With(ctx, "open_id", id) once the account of a request is known.
+func With(ctx context.Context, args ...any) context.Context {
+    return NewContext(ctx, FromContext(ctx).With(args...))
+}
@@ -0,0 +1,111 @@
+package logging
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "log/slog"
+    "os"
+    "sort"
+
+    glog "github.com/labstack/gommon/log"
+)
+
+// EchoLogger implements echo.Logger on top of slog, for Echo's own
+// messages and middleware that log through c.Logger(). Request handlers
+// log through the logger of the request context instead, which carries
+// the request ID. It satisfies echo.Logger without importing echo here.
+type EchoLogger struct {
+    l      *slog.Logger
+    out    io.Writer
+    prefix string
+    level  glog.Lvl
+}
+
+// NewEchoLogger adapts l; Output reports out.
+func NewEchoLogger(l *slog.Logger, out io.Writer) *EchoLogger {
+    return &EchoLogger{l: l, out: out, level: glog.INFO}
+}
+
+func (l *EchoLogger) Output() io.Writer     { return l.out }
+func (l *EchoLogger) SetOutput(w io.Writer) { l.out = w }
+func (l *EchoLogger) Prefix() string        { return l.prefix }
+func (l *EchoLogger) SetPrefix(p string)    { l.prefix = p }
+
+// Level and SetLevel are kept for the interface; the slog handler's level
+// decides what is written.
+func (l *EchoLogger) Level() glog.Lvl     { return l.level }
+func (l *EchoLogger) SetLevel(v glog.Lvl) { l.level = v }
+func (l *EchoLogger) SetHeader(h string)  {}
+
+func (l *EchoLogger) Print(i ...interface{}) { l.l.Info(fmt.Sprint(i...)) }
+func (l *EchoLogger) Printf(format string, args ...interface{}) {
+    l.l.Info(fmt.Sprintf(format, args...))
+}
+func (l *EchoLogger) Printj(j glog.JSON) { l.logj(slog.LevelInfo, j) }
+
+func (l *EchoLogger) Debug(i ...interface{}) { l.l.Debug(fmt.Sprint(i...)) }
+func (l *EchoLogger) Debugf(format string, args ...interface{}) {
+    l.l.Debug(fmt.Sprintf(format, args...))
+}
+func (l *EchoLogger) Debugj(j glog.JSON) { l.logj(slog.LevelDebug, j) }
+
+func (l *EchoLogger) Info(i ...interface{}) { l.l.Info(fmt.Sprint(i...)) }
+func (l *EchoLogger) Infof(format string, args ...interface{}) {
+    l.l.Info(fmt.Sprintf(format, args...))
+}
+func (l *EchoLogger) Infoj(j glog.JSON) { l.logj(slog.LevelInfo, j) }
+
+func (l *EchoLogger) Warn(i ...interface{}) { l.l.Warn(fmt.Sprint(i...)) }
+func (l *EchoLogger) Warnf(format string, args ...interface{}) {
+    l.l.Warn(fmt.Sprintf(format, args...))
+}
+func (l *EchoLogger) Warnj(j glog.JSON) { l.logj(slog.LevelWarn, j) }
+
+func (l *EchoLogger) Error(i ...interface{}) { l.l.Error(fmt.Sprint(i...)) }
+func (l *EchoLogger) Errorf(format string, args ...interface{}) {
+    l.l.Error(fmt.Sprintf(format, args...))
+}
+func (l *EchoLogger) Errorj(j glog.JSON) { l.logj(slog.LevelError, j) }
+
+func (l *EchoLogger) Fatal(i ...interface{}) {
+    l.l.Error(fmt.Sprint(i...))
+    os.Exit(1)
+}
+func (l *EchoLogger) Fatalf(format string, args ...interface{}) {
+    l.l.Error(fmt.Sprintf(format, args...))
+    os.Exit(1)
+}
+func (l *EchoLogger) Fatalj(j glog.JSON) {
+    l.logj(slog.LevelError, j)
+    os.Exit(1)
+}
+
+func (l *EchoLogger) Panic(i ...interface{}) {
+    msg := fmt.Sprint(i...)
+    l.l.Error(msg)
+    panic(msg)
+}
+func (l *EchoLogger) Panicf(format string, args ...interface{}) {
+    msg := fmt.Sprintf(format, args...)
+    l.l.Error(msg)
+    panic(msg)
+}
+func (l *EchoLogger) Panicj(j glog.JSON) {
+    l.logj(slog.LevelError, j)
+    panic(j)
+}
+
+// logj writes the members of j as attributes, in key order.
+func (l *EchoLogger) logj(level slog.Level, j glog.JSON) {
+    keys := make([]string, 0, len(j))
+    for k := range j {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    attrs := make([]slog.Attr, 0, len(keys))
+    for _, k := range keys {
+        attrs = append(attrs, slog.Any(k, j[k]))
+    }
+    l.l.LogAttrs(context.Background(), level, "", attrs...)
+}
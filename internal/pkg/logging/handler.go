@@ -0,0 +1,48 @@
+// Package logging provides the server's log/slog setup: JSON lines split
+// between stdout and stderr by level, loggers carried in a
+// context.Context, and an echo.Logger backed by slog.
+package logging
+
+import (
+    "context"
+    "io"
+    "log/slog"
+    "os"
+)
+
+// SplitHandler writes records below Error to one writer and Error and
+// above to another, both as JSON lines. Hosting platforms such as Render
+// classify everything on stderr as errors, so only real errors go there.
+type SplitHandler struct {
+    out slog.Handler
+    err slog.Handler
+}
+
+// NewSplitHandler returns a handler writing to out and errw with opts.
+func NewSplitHandler(out, errw io.Writer, opts *slog.HandlerOptions) *SplitHandler {
+    return &SplitHandler{out: slog.NewJSONHandler(out, opts), err: slog.NewJSONHandler(errw, opts)}
+}
+
+// New returns a logger writing to stdout and, from Error up, stderr.
+func New(level slog.Leveler) *slog.Logger {
+    return slog.New(NewSplitHandler(os.Stdout, os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+func (h *SplitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+    return h.out.Enabled(ctx, level)
+}
+
+func (h *SplitHandler) Handle(ctx context.Context, r slog.Record) error {
+    if r.Level >= slog.LevelError {
+        return h.err.Handle(ctx, r)
+    }
+    return h.out.Handle(ctx, r)
+}
+
+func (h *SplitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+    return &SplitHandler{out: h.out.WithAttrs(attrs), err: h.err.WithAttrs(attrs)}
+}
+
+func (h *SplitHandler) WithGroup(name string) slog.Handler {
+    return &SplitHandler{out: h.out.WithGroup(name), err: h.err.WithGroup(name)}
+}
@@ -0,0 +1,64 @@
+package logging
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "log/slog"
+    "strings"
+    "testing"
+)
+
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+    t.Helper()
+    var out []map[string]any
+    for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+        if line == "" {
+            continue
+        }
+        var m map[string]any
+        if err := json.Unmarshal([]byte(line), &m); err != nil {
+            t.Fatalf("decode %q: %v", line, err)
+        }
+        out = append(out, m)
+    }
+    return out
+}
+
+func TestSplitHandler(t *testing.T) {
+    var out, errw bytes.Buffer
+    l := slog.New(NewSplitHandler(&out, &errw, &slog.HandlerOptions{Level: slog.LevelInfo})).With("request_id", "req-1")
+    l.Debug("hidden")
+    l.Info("started")
+    l.Warn("slow")
+    l.Error("failed", "err", "boom")
+
+    got := lines(t, &out)
+    if len(got) != 2 || got[0]["msg"] != "started" || got[1]["msg"] != "slow" {
+        t.Fatalf("stdout = %v, want started and slow", got)
+    }
+    bad := lines(t, &errw)
+    if len(bad) != 1 || bad[0]["msg"] != "failed" || bad[0]["err"] != "boom" {
+        t.Fatalf("stderr = %v, want failed", bad)
+    }
+    for _, m := range append(got, bad...) {
+        if m["request_id"] != "req-1" {
+            t.Errorf("%v: request_id missing", m)
+        }
+    }
+}
+
+func TestContext(t *testing.T) {
+    if FromContext(context.Background()) != slog.Default() {
+        t.Fatal("FromContext without a logger should return slog.Default()")
+    }
+    var out bytes.Buffer
+    l := slog.New(NewSplitHandler(&out, &out, nil))
+    ctx := With(NewContext(context.Background(), l), "open_id", "open-1")
+    FromContext(ctx).Info("refreshed")
+
+    got := lines(t, &out)
+    if len(got) != 1 || got[0]["open_id"] != "open-1" {
+        t.Fatalf("log = %v, want open_id", got)
+    }
+}
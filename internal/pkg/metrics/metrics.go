@@ -0,0 +1,159 @@
+// Package metrics exposes Prometheus metrics of the server: HTTP
+// requests, TikTok API calls, token refreshes, sessions and store
+// operations. Labels only take values from bounded sets (route templates,
+// status codes, endpoint and operation names) to keep cardinality low.
+package metrics
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/labstack/echo/v4"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/collectors"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+
+    "tiktok-oauth/internal/pkg/httpx"
+)
+
+const namespace = "tiktok_oauth"
+
+// methods are the request methods labelled as such; clients can send any
+// token as a method, so the others are counted as "OTHER".
+var methods = map[string]bool{
+    http.MethodGet:     true,
+    http.MethodHead:    true,
+    http.MethodPost:    true,
+    http.MethodPut:     true,
+    http.MethodPatch:   true,
+    http.MethodDelete:  true,
+    http.MethodConnect: true,
+    http.MethodOptions: true,
+    http.MethodTrace:   true,
+}
+
+// Metrics holds the collectors; its methods implement the observers of
+// the use case (oauth.RefreshObserver), the TikTok client
+// (tiktok.CallObserver) and the store (store.Observer).
+type Metrics struct {
+    registry        *prometheus.Registry
+    requests        *prometheus.CounterVec
+    requestDuration *prometheus.HistogramVec
+    tiktokCalls     *prometheus.CounterVec
+    tiktokDuration  *prometheus.HistogramVec
+    refreshes       *prometheus.CounterVec
+    storeDuration   *prometheus.HistogramVec
+}
+
+// New registers the collectors, plus the Go runtime and process ones, in
+// a registry of their own.
+func New() *Metrics {
+    m := &Metrics{
+        registry: prometheus.NewRegistry(),
+        requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Namespace: namespace,
+            Name:      "http_requests_total",
+            Help:      "HTTP requests by method, route template and status.",
+        }, []string{"method", "route", "status"}),
+        requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+            Namespace: namespace,
+            Name:      "http_request_duration_seconds",
+            Help:      "HTTP request latency by method, route template and status.",
+            Buckets:   prometheus.DefBuckets,
+        }, []string{"method", "route", "status"}),
+        tiktokCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Namespace: namespace,
+            Name:      "tiktok_api_calls_total",
+            Help:      "TikTok API calls by endpoint and error class (ok on success).",
+        }, []string{"endpoint", "class"}),
+        tiktokDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+            Namespace: namespace,
+            Name:      "tiktok_api_call_duration_seconds",
+            Help:      "TikTok API call latency by endpoint.",
+            Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+        }, []string{"endpoint"}),
+        refreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Namespace: namespace,
+            Name:      "token_refreshes_total",
+            Help:      "Refreshes of expired TikTok access tokens by outcome.",
+        }, []string{"outcome"}),
+        storeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+            Namespace: namespace,
+            Name:      "store_operation_duration_seconds",
+            Help:      "Store operation latency by operation.",
+            Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+        }, []string{"op"}),
+    }
+    m.registry.MustRegister(
+        collectors.NewGoCollector(),
+        collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+        m.requests, m.requestDuration,
+        m.tiktokCalls, m.tiktokDuration,
+        m.refreshes, m.storeDuration,
+    )
+    return m
+}
+
+// ActiveSessions registers a gauge read from count at every scrape.
+func (m *Metrics) ActiveSessions(count func() int) {
+    m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+        Namespace: namespace,
+        Name:      "active_sessions",
+        Help:      "Login sessions that have not expired.",
+    }, func() float64 { return float64(count()) }))
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() echo.HandlerFunc {
+    return echo.WrapHandler(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// Middleware counts and times every request under its route template
+// (c.Path()), never the raw URL, and its method or "OTHER". Errors are
+// rendered here so the status of the problem response is the one
+// recorded; the error handler skips committed responses, so returning
+// the error afterwards is harmless.
+func (m *Metrics) Middleware() echo.MiddlewareFunc {
+    return func(next echo.HandlerFunc) echo.HandlerFunc {
+        return func(c echo.Context) error {
+            start := time.Now()
+            err := next(c)
+            if err != nil {
+                c.Error(err)
+            }
+            route := c.Path()
+            if route == "" {
+                route = "unmatched"
+            }
+            method := c.Request().Method
+            if !methods[method] {
+                method = "OTHER"
+            }
+            labels := prometheus.Labels{
+                "method": method,
+                "route":  route,
+                "status": strconv.Itoa(httpx.Status(c, err)),
+            }
+            m.requests.With(labels).Inc()
+            m.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+            return err
+        }
+    }
+}
+
+// ObserveCall implements tiktok.CallObserver.
+func (m *Metrics) ObserveCall(endpoint string, d time.Duration, class string) {
+    m.tiktokCalls.WithLabelValues(endpoint, class).Inc()
+    m.tiktokDuration.WithLabelValues(endpoint).Observe(d.Seconds())
+}
+
+// ObserveRefresh implements oauth.RefreshObserver.
+func (m *Metrics) ObserveRefresh(outcome string) {
+    m.refreshes.WithLabelValues(outcome).Inc()
+}
+
+// ObserveStore implements store.Observer.
+func (m *Metrics) ObserveStore(op string, d time.Duration) {
+    m.storeDuration.WithLabelValues(op).Observe(d.Seconds())
+}
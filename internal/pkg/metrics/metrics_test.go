@@ -0,0 +1,68 @@
+package metrics
+
+import (
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/labstack/echo/v4"
+)
+
+func TestMetrics(t *testing.T) {
+    m := New()
+    m.ActiveSessions(func() int { return 3 })
+    e := echo.New()
+    e.Use(m.Middleware())
+    e.GET("/items/:id", func(c echo.Context) error {
+        if c.Param("id") == "missing" {
+            return echo.NewHTTPError(http.StatusNotFound)
+        }
+        if c.Param("id") == "broken" {
+            return errors.New("boom")
+        }
+        return c.String(http.StatusOK, "ok")
+    })
+    e.GET("/metrics", m.Handler())
+    for _, path := range []string{"/items/1", "/items/2", "/items/missing", "/items/broken"} {
+        e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+    }
+    for _, method := range []string{"PROPFIND", "X-RANDOM-1", "X-RANDOM-2"} {
+        e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/items/1", nil))
+    }
+    m.ObserveCall("oauth/token", 120*time.Millisecond, "ok")
+    m.ObserveCall("oauth/token", time.Second, "timeout")
+    m.ObserveRefresh("ok")
+    m.ObserveStore("GetSession", time.Millisecond)
+
+    rec := httptest.NewRecorder()
+    e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+    if rec.Code != http.StatusOK {
+        t.Fatalf("unexpected status %d", rec.Code)
+    }
+    body := rec.Body.String()
+    for _, want := range []string{
+        `tiktok_oauth_http_requests_total{method="GET",route="/items/:id",status="200"} 2`,
+        `tiktok_oauth_http_requests_total{method="GET",route="/items/:id",status="404"} 1`,
+        `tiktok_oauth_http_requests_total{method="GET",route="/items/:id",status="500"} 1`,
+        `tiktok_oauth_http_request_duration_seconds_count{method="GET",route="/items/:id",status="200"} 2`,
+        `tiktok_oauth_http_requests_total{method="OTHER",route="/items/:id",status="405"} 3`,
+        `tiktok_oauth_tiktok_api_calls_total{class="timeout",endpoint="oauth/token"} 1`,
+        `tiktok_oauth_tiktok_api_call_duration_seconds_count{endpoint="oauth/token"} 2`,
+        `tiktok_oauth_token_refreshes_total{outcome="ok"} 1`,
+        `tiktok_oauth_store_operation_duration_seconds_count{op="GetSession"} 1`,
+        `tiktok_oauth_active_sessions 3`,
+    } {
+        if !strings.Contains(body, want) {
+            t.Errorf("missing %s", want)
+        }
+    }
+    if strings.Contains(body, "/items/1") {
+        t.Errorf("raw request paths must not become labels")
+    }
+    if strings.Contains(body, "X-RANDOM") {
+        t.Errorf("unknown methods must not become labels")
+    }
+}
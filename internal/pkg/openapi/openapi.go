@@ -0,0 +1,319 @@
+// Package openapi builds an OpenAPI 3 document from Go types, so the
+// published API description follows the structs the handlers encode, and
+// checks responses against it in tests.
+package openapi
+
+import (
+    "net/http"
+    "reflect"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Version is the OpenAPI version of the documents built here.
+const Version = "3.0.3"
+
+// Document is the subset of an OpenAPI 3 document this package emits.
+type Document struct {
+    OpenAPI    string              `json:"openapi"`
+    Info       Info                `json:"info"`
+    Paths      map[string]PathItem `json:"paths"`
+    Components Components          `json:"components"`
+
+    // wildcards holds the paths whose last parameter matches the rest of
+    // the path (Echo's "*").
+    wildcards map[string]bool
+}
+
+type Info struct {
+    Title       string `json:"title"`
+    Version     string `json:"version"`
+    Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lower-case HTTP methods to operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+    OperationID string                `json:"operationId,omitempty"`
+    Summary     string                `json:"summary,omitempty"`
+    Description string                `json:"description,omitempty"`
+    Tags        []string              `json:"tags,omitempty"`
+    Parameters  []Parameter           `json:"parameters,omitempty"`
+    RequestBody *RequestBody          `json:"requestBody,omitempty"`
+    Responses   map[string]*Response  `json:"responses"`
+    Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+    Name        string  `json:"name"`
+    In          string  `json:"in"`
+    Description string  `json:"description,omitempty"`
+    Required    bool    `json:"required,omitempty"`
+    Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+    Required bool                 `json:"required,omitempty"`
+    Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+    Description string               `json:"description"`
+    Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+    Schema *Schema `json:"schema,omitempty"`
+}
+
+type Components struct {
+    Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+    SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+    Type        string `json:"type"`
+    Scheme      string `json:"scheme,omitempty"`
+    In          string `json:"in,omitempty"`
+    Name        string `json:"name,omitempty"`
+    Description string `json:"description,omitempty"`
+}
+
+// Schema is a JSON schema as OpenAPI 3.0 defines it. An empty schema
+// accepts any value.
+type Schema struct {
+    Ref                  string             `json:"$ref,omitempty"`
+    Type                 string             `json:"type,omitempty"`
+    Format               string             `json:"format,omitempty"`
+    Description          string             `json:"description,omitempty"`
+    Nullable             bool               `json:"nullable,omitempty"`
+    Properties           map[string]*Schema `json:"properties,omitempty"`
+    Required             []string           `json:"required,omitempty"`
+    AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+    Items                *Schema            `json:"items,omitempty"`
+    AllOf                []*Schema          `json:"allOf,omitempty"`
+}
+
+// Route describes one operation. Bodies are example values of the Go
+// types encoded on the wire; their schemas are derived by reflection.
+type Route struct {
+    // Method and Path as registered with Echo: ":name" parameters and a
+    // trailing "*" matching the rest of the path.
+    Method      string
+    Path        string
+    Summary     string
+    Description string
+    Tags        []string
+    // Security names the security schemes, any one of which is accepted.
+    Security []string
+    Query    []Param
+    // Body is the request body, encoded as BodyType (JSON by default).
+    // Form bodies are read through the struct's form tags.
+    Body      any
+    BodyType  string
+    Responses []Reply
+}
+
+// Param is a string query parameter.
+type Param struct {
+    Name        string
+    Description string
+    Required    bool
+}
+
+// Reply is one possible response of a Route. Status 0 is the default
+// response; replies sharing a status are alternative media types, and the
+// first one's description is used.
+type Reply struct {
+    Status      int
+    Description string
+    // Type is the media type; it defaults to JSON when Body is set.
+    Type string
+    Body any
+}
+
+// Media types of request and response bodies.
+const (
+    JSON      = "application/json"
+    Form      = "application/x-www-form-urlencoded"
+    Multipart = "multipart/form-data"
+    HTML      = "text/html"
+    Text      = "text/plain"
+)
+
+// Spec accumulates routes into a Document.
+type Spec struct {
+    doc   Document
+    names map[reflect.Type]string
+}
+
+func New(info Info) *Spec {
+    return &Spec{
+        doc: Document{
+            OpenAPI:    Version,
+            Info:       info,
+            Paths:      map[string]PathItem{},
+            Components: Components{Schemas: map[string]*Schema{}},
+            wildcards:  map[string]bool{},
+        },
+        names: map[reflect.Type]string{},
+    }
+}
+
+// SecurityScheme declares a scheme routes can name in Route.Security.
+func (s *Spec) SecurityScheme(name string, scheme SecurityScheme) {
+    if s.doc.Components.SecuritySchemes == nil {
+        s.doc.Components.SecuritySchemes = map[string]SecurityScheme{}
+    }
+    s.doc.Components.SecuritySchemes[name] = scheme
+}
+
+// Add documents r. Adding the same method and path twice replaces the
+// earlier operation.
+func (s *Spec) Add(r Route) {
+    path, params, wildcard := convertPath(r.Path)
+    op := &Operation{
+        OperationID: operationID(r.Method, path),
+        Summary:     r.Summary,
+        Description: r.Description,
+        Tags:        r.Tags,
+        Responses:   map[string]*Response{},
+    }
+    for _, p := range params {
+        op.Parameters = append(op.Parameters, Parameter{Name: p, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+    }
+    for _, q := range r.Query {
+        op.Parameters = append(op.Parameters, Parameter{Name: q.Name, In: "query", Description: q.Description, Required: q.Required, Schema: &Schema{Type: "string"}})
+    }
+    if r.Body != nil {
+        typ := r.BodyType
+        if typ == "" {
+            typ = JSON
+        }
+        op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{typ: {Schema: s.bodySchema(typ, r.Body)}}}
+    }
+    for _, name := range r.Security {
+        op.Security = append(op.Security, map[string][]string{name: {}})
+    }
+    for _, res := range r.Responses {
+        key := "default"
+        if res.Status != 0 {
+            key = strconv.Itoa(res.Status)
+        }
+        out := op.Responses[key]
+        if out == nil {
+            desc := res.Description
+            if desc == "" {
+                desc = http.StatusText(res.Status)
+            }
+            out = &Response{Description: desc}
+            op.Responses[key] = out
+        }
+        typ := res.Type
+        if typ == "" && res.Body != nil {
+            typ = JSON
+        }
+        if typ == "" {
+            continue
+        }
+        sch := &Schema{Type: "string"}
+        if res.Body != nil {
+            sch = s.bodySchema(typ, res.Body)
+        }
+        if out.Content == nil {
+            out.Content = map[string]MediaType{}
+        }
+        out.Content[typ] = MediaType{Schema: sch}
+    }
+    item := s.doc.Paths[path]
+    if item == nil {
+        item = PathItem{}
+        s.doc.Paths[path] = item
+    }
+    item[strings.ToLower(r.Method)] = op
+    if wildcard {
+        s.doc.wildcards[path] = true
+    }
+}
+
+// Document returns the document built so far.
+func (s *Spec) Document() *Document { return &s.doc }
+
+// bodySchema derives the schema of a body: JSON bodies reference named
+// types as components, form bodies are inlined from their form tags.
+func (s *Spec) bodySchema(typ string, body any) *Schema {
+    if typ == Form || typ == Multipart {
+        return s.schema(reflect.TypeOf(body), "form")
+    }
+    return s.SchemaOf(body)
+}
+
+// Has reports whether an operation is documented for the Echo route.
+func (d *Document) Has(method, echoPath string) bool {
+    path, _, _ := convertPath(echoPath)
+    _, ok := d.Paths[path][strings.ToLower(method)]
+    return ok
+}
+
+// Operations lists the documented operations as "METHOD /path", with
+// OpenAPI path templates ("GET /items/{id}"), sorted.
+func (d *Document) Operations() []string {
+    var ops []string
+    for path, item := range d.Paths {
+        for method := range item {
+            ops = append(ops, strings.ToUpper(method)+" "+path)
+        }
+    }
+    sort.Strings(ops)
+    return ops
+}
+
+// OperationKey returns the entry of Operations for an Echo route.
+func OperationKey(method, echoPath string) string {
+    path, _, _ := convertPath(echoPath)
+    return strings.ToUpper(method) + " " + path
+}
+
+// convertPath turns an Echo path into an OpenAPI template and its
+// parameter names; a trailing "*" becomes {path}.
+func convertPath(p string) (string, []string, bool) {
+    segs := strings.Split(p, "/")
+    var params []string
+    wildcard := false
+    for i, seg := range segs {
+        switch {
+        case strings.HasPrefix(seg, ":"):
+            params = append(params, seg[1:])
+            segs[i] = "{" + seg[1:] + "}"
+        case seg == "*" && i == len(segs)-1:
+            params = append(params, "path")
+            segs[i] = "{path}"
+            wildcard = true
+        }
+    }
+    return strings.Join(segs, "/"), params, wildcard
+}
+
+// operationID derives a stable camelCase ID such as getApiPostsPublishId.
+func operationID(method, path string) string {
+    var b strings.Builder
+    b.WriteString(strings.ToLower(method))
+    upper := true
+    for _, r := range path {
+        if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+            if upper && r >= 'a' && r <= 'z' {
+                r -= 'a' - 'A'
+            }
+            b.WriteRune(r)
+            upper = false
+            continue
+        }
+        upper = true
+    }
+    if b.Len() == len(method) {
+        b.WriteString("Root")
+    }
+    return b.String()
+}
@@ -0,0 +1,143 @@
+package openapi
+
+import (
+    "encoding/json"
+    "net/http"
+    "slices"
+    "strings"
+    "testing"
+    "time"
+)
+
+type base struct {
+    ID string `json:"id"`
+}
+
+type item struct {
+    base
+    Name    string            `json:"name"`
+    Note    string            `json:"note,omitempty"`
+    Tags    []string          `json:"tags"`
+    Parent  *item             `json:"parent,omitempty"`
+    Labels  map[string]int    `json:"labels,omitempty"`
+    At      time.Time         `json:"at"`
+    Secret  string            `json:"-"`
+    Extra   map[string]string `json:"-" openapi:"additional"`
+    private int
+}
+
+type page struct {
+    Next string `json:"next"`
+}
+
+type listing struct {
+    Items []item `json:"items"`
+    *page
+}
+
+type createForm struct {
+    Name string `form:"name"`
+}
+
+func newTestSpec() *Spec {
+    s := New(Info{Title: "test", Version: "1"})
+    s.Add(Route{
+        Method:    http.MethodGet,
+        Path:      "/items",
+        Responses: []Reply{{Status: http.StatusOK, Body: listing{}}},
+    })
+    s.Add(Route{
+        Method:   http.MethodPost,
+        Path:     "/items/:id/files/*",
+        Body:     createForm{},
+        BodyType: Form,
+        Responses: []Reply{
+            {Status: http.StatusCreated, Body: item{}},
+            {Status: http.StatusFound, Description: "Redirect"},
+            {Description: "Error", Type: "application/problem+json", Body: map[string]any{}},
+        },
+    })
+    return s
+}
+
+func TestSchemaOf(t *testing.T) {
+    doc := newTestSpec().Document()
+    it := doc.Components.Schemas["Item"]
+    if it == nil {
+        t.Fatalf("named structs must become components: %v", doc.Components.Schemas)
+    }
+    if strings.Join(it.Required, ",") != "id,name,tags,at" {
+        t.Fatalf("unexpected required %v", it.Required)
+    }
+    if len(it.Properties) != 7 || it.Properties["secret"] != nil || it.Properties["Secret"] != nil {
+        t.Fatalf("unexpected properties %v", it.Properties)
+    }
+    if !it.Properties["tags"].Nullable || it.Properties["labels"].Nullable {
+        t.Fatalf("only required slices and maps are nullable")
+    }
+    if it.Properties["parent"].Ref != "#/components/schemas/Item" {
+        t.Fatalf("recursive reference expected, got %#v", it.Properties["parent"])
+    }
+    if f := it.Properties["at"]; f.Type != "string" || f.Format != "date-time" {
+        t.Fatalf("time.Time must be a date-time string, got %#v", f)
+    }
+    if it.AdditionalProperties == nil || it.AdditionalProperties.Type != "string" {
+        t.Fatalf("openapi:\"additional\" must allow extension members")
+    }
+
+    if l := doc.Components.Schemas["Listing"]; l.Properties["next"] == nil || len(l.Required) != 1 {
+        t.Fatalf("fields of embedded pointers are optional, got %#v", l)
+    }
+
+    op := doc.Paths["/items/{id}/files/{path}"]["post"]
+    if op == nil || op.OperationID != "postItemsIdFilesPath" || len(op.Parameters) != 2 {
+        t.Fatalf("unexpected operation %#v", op)
+    }
+    form := op.RequestBody.Content[Form].Schema
+    if form.Ref != "" || form.Properties["name"] == nil {
+        t.Fatalf("form bodies are inlined from form tags, got %#v", form)
+    }
+    if !doc.Has(http.MethodPost, "/items/:id/files/*") || doc.Has(http.MethodGet, "/items/:id") {
+        t.Fatalf("Has does not match the Echo routes")
+    }
+    if op := OperationKey(http.MethodPost, "/items/:id/files/*"); !slices.Contains(doc.Operations(), op) {
+        t.Fatalf("%s not in %v", op, doc.Operations())
+    }
+    if _, err := json.Marshal(doc); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestValidateResponse(t *testing.T) {
+    doc := newTestSpec().Document()
+    ok := `{"items":[{"id":"1","name":"a","tags":null,"at":"2025-10-01T00:00:00Z","x":"y"}]}`
+    if err := doc.ValidateResponse(http.MethodGet, "/items", 200, "application/json; charset=UTF-8", []byte(ok)); err != nil {
+        t.Fatal(err)
+    }
+    if err := doc.ValidateResponse(http.MethodPost, "/items/1/files/a/b.txt", 302, "", nil); err != nil {
+        t.Fatalf("wildcard paths and empty responses: %v", err)
+    }
+    if err := doc.ValidateResponse(http.MethodPost, "/items/1/files/a", 500, "application/problem+json", []byte(`{"code":"x"}`)); err != nil {
+        t.Fatalf("default responses: %v", err)
+    }
+
+    for _, tc := range []struct {
+        method, path string
+        status       int
+        body         string
+        want         string
+    }{
+        {"GET", "/nope", 200, `{}`, "not documented"},
+        {"GET", "/items", 404, `{}`, "status 404"},
+        {"GET", "/items", 200, `{"items":[{"id":"1","tags":[],"at":"2025-10-01T00:00:00Z"}]}`, `missing required property "name"`},
+        {"GET", "/items", 200, `{"items":[{"id":1,"name":"a","tags":[],"at":"2025-10-01T00:00:00Z"}]}`, "$.items[0].id: expected string"},
+        {"GET", "/items", 200, `{"items":[{"id":"1","name":"a","tags":[],"at":"yesterday"}]}`, "not a date-time"},
+        {"GET", "/items", 200, `{"items":[],"total":1}`, `undocumented property "total"`},
+        {"GET", "/items", 200, `{"items":[{"id":"1","name":"a","tags":[],"at":"2025-10-01T00:00:00Z","labels":{"a":1.5}}]}`, "expected integer"},
+    } {
+        err := doc.ValidateResponse(tc.method, tc.path, tc.status, "application/json", []byte(tc.body))
+        if err == nil || !strings.Contains(err.Error(), tc.want) {
+            t.Errorf("%s %s %s: expected error containing %q, got %v", tc.method, tc.path, tc.body, tc.want, err)
+        }
+    }
+}
@@ -0,0 +1,154 @@
+package openapi
+
+import (
+    "path"
+    "reflect"
+    "strings"
+    "time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaOf returns the schema of v's type as encoding/json writes it.
+// Named structs become components referenced by $ref.
+//
+// Struct fields follow their json tags: omitempty fields are optional,
+// the others required, and pointers, slices and maps without omitempty
+// are nullable since Go encodes nil ones as null. Fields of an embedded
+// struct pointer are optional, as a nil one is left out. A map field tagged
+// openapi:"additional" documents members a MarshalJSON method merges into
+// the object.
+func (s *Spec) SchemaOf(v any) *Schema {
+    return s.schema(reflect.TypeOf(v), "json")
+}
+
+func (s *Spec) schema(t reflect.Type, tag string) *Schema {
+    if t == nil {
+        return &Schema{}
+    }
+    for t.Kind() == reflect.Pointer {
+        t = t.Elem()
+    }
+    switch {
+    case t == timeType:
+        return &Schema{Type: "string", Format: "date-time"}
+    case t.Kind() == reflect.Struct && t.Name() != "" && tag == "json":
+        return &Schema{Ref: "#/components/schemas/" + s.component(t)}
+    }
+    switch t.Kind() {
+    case reflect.Bool:
+        return &Schema{Type: "boolean"}
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+        return &Schema{Type: "integer", Format: "int32"}
+    case reflect.Int64, reflect.Uint64:
+        return &Schema{Type: "integer", Format: "int64"}
+    case reflect.Float32, reflect.Float64:
+        return &Schema{Type: "number"}
+    case reflect.String:
+        return &Schema{Type: "string"}
+    case reflect.Slice, reflect.Array:
+        if t.Elem().Kind() == reflect.Uint8 {
+            return &Schema{Type: "string", Format: "byte"}
+        }
+        return &Schema{Type: "array", Items: s.schema(t.Elem(), tag)}
+    case reflect.Map:
+        return &Schema{Type: "object", AdditionalProperties: s.schema(t.Elem(), tag)}
+    case reflect.Struct:
+        return s.object(t, tag)
+    default:
+        // Interfaces and anything else may hold any value.
+        return &Schema{}
+    }
+}
+
+// component registers the named struct t and returns its component name.
+// The name is registered before the fields are walked, so recursive types
+// terminate.
+func (s *Spec) component(t reflect.Type) string {
+    if name, ok := s.names[t]; ok {
+        return name
+    }
+    // Unexported response types are published capitalized.
+    name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+    if _, taken := s.doc.Components.Schemas[name]; taken {
+        // Same name in another package: qualify it.
+        pkg := path.Base(t.PkgPath())
+        name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+    }
+    s.names[t] = name
+    s.doc.Components.Schemas[name] = &Schema{}
+    *s.doc.Components.Schemas[name] = *s.object(t, "json")
+    return name
+}
+
+// object builds the schema of a struct, flattening embedded structs the
+// way encoding/json does.
+func (s *Spec) object(t reflect.Type, tag string) *Schema {
+    sch := &Schema{Type: "object", Properties: map[string]*Schema{}}
+    s.fields(t, tag, sch, false)
+    return sch
+}
+
+func (s *Spec) fields(t reflect.Type, tag string, sch *Schema, optional bool) {
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        if f.Tag.Get("openapi") == "additional" {
+            sch.AdditionalProperties = s.schema(f.Type.Elem(), tag)
+            continue
+        }
+        name, opts, _ := strings.Cut(f.Tag.Get(tag), ",")
+        if name == "-" && opts == "" {
+            continue
+        }
+        if f.Anonymous && name == "" {
+            ft, ptr := f.Type, f.Type.Kind() == reflect.Pointer
+            if ptr {
+                ft = ft.Elem()
+            }
+            if ft.Kind() == reflect.Struct {
+                s.fields(ft, tag, sch, optional || ptr)
+                continue
+            }
+        }
+        if !f.IsExported() {
+            continue
+        }
+        if name == "" {
+            name = f.Name
+        }
+        fs := s.schema(f.Type, tag)
+        if !hasOption(opts, "omitempty") {
+            if !optional {
+                sch.Required = append(sch.Required, name)
+            }
+            switch f.Type.Kind() {
+            case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+                fs = nullable(fs)
+            }
+        }
+        sch.Properties[name] = fs
+    }
+}
+
+// nullable lets s also be null; a $ref cannot carry siblings in OpenAPI
+// 3.0, so references are wrapped in allOf.
+func nullable(s *Schema) *Schema {
+    if s.Ref != "" {
+        return &Schema{AllOf: []*Schema{s}, Nullable: true}
+    }
+    if s.Type == "" {
+        return s
+    }
+    c := *s
+    c.Nullable = true
+    return &c
+}
+
+func hasOption(opts, name string) bool {
+    for _, o := range strings.Split(opts, ",") {
+        if o == name {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,212 @@
+package openapi
+
+import (
+    "encoding/json"
+    "fmt"
+    "math"
+    "mime"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// ValidateResponse checks a response to method and path (a concrete
+// request path) against the document: the operation must exist, document
+// the status (or a default response) and the media type, and a JSON body
+// must match the schema.
+func (d *Document) ValidateResponse(method, path string, status int, contentType string, body []byte) error {
+    op, tmpl := d.operation(method, path)
+    if op == nil {
+        return fmt.Errorf("%s %s is not documented", method, path)
+    }
+    res := op.Responses[strconv.Itoa(status)]
+    if res == nil {
+        res = op.Responses["default"]
+    }
+    if res == nil {
+        return fmt.Errorf("%s %s: status %d is not documented", method, tmpl, status)
+    }
+    if len(res.Content) == 0 {
+        if len(body) > 0 && contentType != "" {
+            return fmt.Errorf("%s %s %d: undocumented %s body", method, tmpl, status, contentType)
+        }
+        return nil
+    }
+    mt, _, err := mime.ParseMediaType(contentType)
+    if err != nil {
+        return fmt.Errorf("%s %s %d: content type %q: %v", method, tmpl, status, contentType, err)
+    }
+    media, ok := res.Content[mt]
+    if !ok {
+        return fmt.Errorf("%s %s %d: media type %s is not documented", method, tmpl, status, mt)
+    }
+    if mt != JSON && !strings.HasSuffix(mt, "+json") {
+        return nil
+    }
+    var v any
+    if err := json.Unmarshal(body, &v); err != nil {
+        return fmt.Errorf("%s %s %d: %v", method, tmpl, status, err)
+    }
+    if err := d.Validate(media.Schema, v); err != nil {
+        return fmt.Errorf("%s %s %d: %w", method, tmpl, status, err)
+    }
+    return nil
+}
+
+// operation finds the operation serving path, preferring templates with
+// fewer parameters as routers do.
+func (d *Document) operation(method, path string) (*Operation, string) {
+    var (
+        best      *Operation
+        bestTmpl  string
+        bestScore = -1
+    )
+    for tmpl, item := range d.Paths {
+        op := item[strings.ToLower(method)]
+        if op == nil {
+            continue
+        }
+        score, ok := matchPath(tmpl, path, d.wildcards[tmpl])
+        if ok && (best == nil || score > bestScore) {
+            best, bestTmpl, bestScore = op, tmpl, score
+        }
+    }
+    return best, bestTmpl
+}
+
+// matchPath matches a concrete path against a template, scoring literal
+// segments so the most specific template wins.
+func matchPath(tmpl, path string, wildcard bool) (int, bool) {
+    ts, ps := strings.Split(tmpl, "/"), strings.Split(path, "/")
+    if len(ps) < len(ts) || len(ps) > len(ts) && !wildcard {
+        return 0, false
+    }
+    score := 0
+    for i, t := range ts {
+        switch {
+        case wildcard && i == len(ts)-1:
+        case strings.HasPrefix(t, "{"):
+            if ps[i] == "" {
+                return 0, false
+            }
+        case t == ps[i]:
+            score++
+        default:
+            return 0, false
+        }
+    }
+    return score, true
+}
+
+// Validate checks a decoded JSON value against s. Objects with declared
+// properties reject undeclared members unless additionalProperties
+// allows them, so fields added to a Go type but not to the document are
+// caught.
+func (d *Document) Validate(s *Schema, v any) error {
+    return d.validate(s, v, "$")
+}
+
+func (d *Document) validate(s *Schema, v any, at string) error {
+    if s == nil {
+        return nil
+    }
+    if s.Ref != "" {
+        name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+        ref, ok := d.Components.Schemas[name]
+        if !ok {
+            return fmt.Errorf("%s: unknown schema %s", at, s.Ref)
+        }
+        return d.validate(ref, v, at)
+    }
+    if v == nil {
+        if s.Nullable || s.Type == "" && len(s.AllOf) == 0 {
+            return nil
+        }
+        return fmt.Errorf("%s: null is not allowed", at)
+    }
+    for _, sub := range s.AllOf {
+        if err := d.validate(sub, v, at); err != nil {
+            return err
+        }
+    }
+    switch s.Type {
+    case "":
+        return nil
+    case "object":
+        m, ok := v.(map[string]any)
+        if !ok {
+            return typeError(at, "object", v)
+        }
+        return d.validateObject(s, m, at)
+    case "array":
+        a, ok := v.([]any)
+        if !ok {
+            return typeError(at, "array", v)
+        }
+        for i, e := range a {
+            if err := d.validate(s.Items, e, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+                return err
+            }
+        }
+    case "string":
+        str, ok := v.(string)
+        if !ok {
+            return typeError(at, "string", v)
+        }
+        if s.Format == "date-time" {
+            if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+                return fmt.Errorf("%s: %q is not a date-time", at, str)
+            }
+        }
+    case "integer":
+        n, ok := v.(float64)
+        if !ok || n != math.Trunc(n) {
+            return typeError(at, "integer", v)
+        }
+    case "number":
+        if _, ok := v.(float64); !ok {
+            return typeError(at, "number", v)
+        }
+    case "boolean":
+        if _, ok := v.(bool); !ok {
+            return typeError(at, "boolean", v)
+        }
+    default:
+        return fmt.Errorf("%s: unsupported schema type %s", at, s.Type)
+    }
+    return nil
+}
+
+func (d *Document) validateObject(s *Schema, m map[string]any, at string) error {
+    for _, name := range s.Required {
+        if _, ok := m[name]; !ok {
+            return fmt.Errorf("%s: missing required property %q", at, name)
+        }
+    }
+    keys := make([]string, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    for _, k := range keys {
+        sub, ok := s.Properties[k]
+        switch {
+        case ok:
+        case s.AdditionalProperties != nil:
+            sub = s.AdditionalProperties
+        case len(s.Properties) > 0:
+            return fmt.Errorf("%s: undocumented property %q", at, k)
+        default:
+            continue
+        }
+        if err := d.validate(sub, m[k], at+"."+k); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func typeError(at, want string, v any) error {
+    return fmt.Errorf("%s: expected %s, got %T", at, want, v)
+}
@@ -0,0 +1,256 @@
+// Package static serves files from an embedded filesystem or, in local
+// development, from a directory on disk.
+package static
+
+import (
+    "bytes"
+    "compress/gzip"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "io/fs"
+    "mime"
+    "net/http"
+    "os"
+    "path"
+    "strings"
+    "sync"
+
+    "github.com/andybalholm/brotli"
+    "github.com/labstack/echo/v4"
+)
+
+// Asset is a file with its precomputed representations.
+type Asset struct {
+    Name        string
+    ContentType string
+    Body        []byte
+    ETag        string
+    // Gzip and Brotli are nil when compression does not pay off.
+    Gzip   []byte
+    Brotli []byte
+}
+
+// Files serves assets. Embedded assets are loaded and compressed once;
+// assets from an override directory are re-read on every request so edits
+// show up without a restart.
+type Files struct {
+    fsys  fs.FS
+    dev   bool
+    mu    sync.Mutex
+    cache map[string]*Asset
+}
+
+// New serves embedded, or the directory dir when it is not empty.
+func New(embedded fs.FS, dir string) *Files {
+    if dir != "" {
+        return &Files{fsys: os.DirFS(dir), dev: true}
+    }
+    return &Files{fsys: embedded, cache: map[string]*Asset{}}
+}
+
+// Dev reports whether files come from the override directory.
+func (f *Files) Dev() bool { return f.dev }
+
+// FS returns the underlying filesystem.
+func (f *Files) FS() fs.FS { return f.fsys }
+
+// Preload loads and compresses every file below the given roots, so a
+// missing or unreadable file fails at startup rather than per request.
+func (f *Files) Preload(roots ...string) error {
+    for _, root := range roots {
+        err := fs.WalkDir(f.fsys, root, func(name string, d fs.DirEntry, err error) error {
+            if err != nil || d.IsDir() {
+                return err
+            }
+            _, err = f.Open(name)
+            return err
+        })
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Open returns the asset at name (slash separated, relative to the root).
+func (f *Files) Open(name string) (*Asset, error) {
+    if !fs.ValidPath(name) {
+        return nil, fs.ErrNotExist
+    }
+    if !f.dev {
+        f.mu.Lock()
+        a, ok := f.cache[name]
+        f.mu.Unlock()
+        if ok {
+            return a, nil
+        }
+    }
+    b, err := fs.ReadFile(f.fsys, name)
+    if err != nil {
+        return nil, err
+    }
+    a := newAsset(name, b, !f.dev)
+    if !f.dev {
+        f.mu.Lock()
+        f.cache[name] = a
+        f.mu.Unlock()
+    }
+    return a, nil
+}
+
+func newAsset(name string, b []byte, compress bool) *Asset {
+    sum := sha256.Sum256(b)
+    a := &Asset{
+        Name:        name,
+        ContentType: contentType(name),
+        Body:        b,
+        ETag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+    }
+    if compress && compressible(a.ContentType) {
+        var gz bytes.Buffer
+        w, _ := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+        w.Write(b)
+        w.Close()
+        if gz.Len() < len(b)*9/10 {
+            a.Gzip = gz.Bytes()
+        }
+        var br bytes.Buffer
+        bw := brotli.NewWriterLevel(&br, brotli.BestCompression)
+        bw.Write(b)
+        bw.Close()
+        if br.Len() < len(b)*9/10 {
+            a.Brotli = br.Bytes()
+        }
+    }
+    return a
+}
+
+func contentType(name string) string {
+    switch strings.ToLower(path.Ext(name)) {
+    case ".txt":
+        return "text/plain; charset=utf-8"
+    case ".html":
+        return "text/html; charset=utf-8"
+    case ".json":
+        return "application/json"
+    }
+    if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+        return ct
+    }
+    return "application/octet-stream"
+}
+
+func compressible(ct string) bool {
+    return strings.HasPrefix(ct, "text/") || strings.Contains(ct, "json") ||
+        strings.Contains(ct, "javascript") || strings.Contains(ct, "xml") || strings.Contains(ct, "svg")
+}
+
+// Serve writes the asset at name with its ETag and cacheControl, answers
+// matching If-None-Match with 304, and picks a precompressed
+// representation from Accept-Encoding. In dev mode responses are not
+// cached.
+func (f *Files) Serve(c echo.Context, name, cacheControl string) error {
+    a, err := f.Open(name)
+    if errors.Is(err, fs.ErrNotExist) {
+        return echo.ErrNotFound
+    }
+    if err != nil {
+        return err
+    }
+    return f.serveAsset(c, a, cacheControl)
+}
+
+func (f *Files) serveAsset(c echo.Context, a *Asset, cacheControl string) error {
+    if f.dev {
+        cacheControl = "no-cache"
+    }
+    return ServeAsset(c, a, cacheControl)
+}
+
+// NewAsset wraps content that does not come from the filesystem, such as
+// files kept in the store. It is served uncompressed.
+func NewAsset(name, contentType string, b []byte) *Asset {
+    a := newAsset(name, b, false)
+    a.ContentType = contentType
+    return a
+}
+
+// NewCompressedAsset is NewAsset for generated content served often, such
+// as a rendered page; it gets the precompressed representations of an
+// embedded file.
+func NewCompressedAsset(name, contentType string, b []byte) *Asset {
+    a := newAsset(name, b, true)
+    a.ContentType = contentType
+    return a
+}
+
+// ServeAsset is Serve for an asset obtained elsewhere, e.g. from NewAsset.
+func ServeAsset(c echo.Context, a *Asset, cacheControl string) error {
+    hdr := c.Response().Header()
+    body, etag := a.Body, a.ETag
+    if a.Gzip != nil || a.Brotli != nil {
+        hdr.Add("Vary", echo.HeaderAcceptEncoding)
+        accept := c.Request().Header.Get(echo.HeaderAcceptEncoding)
+        switch {
+        case a.Brotli != nil && acceptsEncoding(accept, "br"):
+            body, etag = a.Brotli, strings.TrimSuffix(a.ETag, `"`)+`-br"`
+            hdr.Set(echo.HeaderContentEncoding, "br")
+        case a.Gzip != nil && acceptsEncoding(accept, "gzip"):
+            body, etag = a.Gzip, strings.TrimSuffix(a.ETag, `"`)+`-gz"`
+            hdr.Set(echo.HeaderContentEncoding, "gzip")
+        }
+    }
+    hdr.Set("ETag", etag)
+    if cacheControl != "" {
+        hdr.Set("Cache-Control", cacheControl)
+    }
+    if etagMatches(c.Request().Header.Get("If-None-Match"), etag) {
+        return c.NoContent(http.StatusNotModified)
+    }
+    return c.Blob(http.StatusOK, a.ContentType, body)
+}
+
+// Handler serves one fixed file.
+func (f *Files) Handler(name, cacheControl string) echo.HandlerFunc {
+    return func(c echo.Context) error { return f.Serve(c, name, cacheControl) }
+}
+
+// DirHandler serves the files below dir for a route ending in "/*".
+func (f *Files) DirHandler(dir, cacheControl string) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        name := path.Join(dir, c.Param("*"))
+        if !strings.HasPrefix(name, dir+"/") {
+            return echo.ErrNotFound
+        }
+        return f.Serve(c, name, cacheControl)
+    }
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows coding
+// (an explicit q=0 refuses it).
+func acceptsEncoding(header, coding string) bool {
+    for _, part := range strings.Split(header, ",") {
+        name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+        if !strings.EqualFold(strings.TrimSpace(name), coding) {
+            continue
+        }
+        q := strings.ReplaceAll(params, " ", "")
+        return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+    }
+    return false
+}
+
+// etagMatches implements the weak comparison If-None-Match uses.
+func etagMatches(header, etag string) bool {
+    if header == "" {
+        return false
+    }
+    for _, t := range strings.Split(header, ",") {
+        t = strings.TrimSpace(t)
+        if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,59 @@
+package static
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "testing/fstest"
+
+    "github.com/labstack/echo/v4"
+)
+
+func TestFiles_Serve(t *testing.T) {
+    page := strings.Repeat("<p>hello</p>\n", 100)
+    f := New(fstest.MapFS{
+        "contents/index.html": {Data: []byte(page)},
+        "docs/a.json":         {Data: []byte(`{}`)},
+    }, "")
+    if err := f.Preload("contents", "docs"); err != nil {
+        t.Fatal(err)
+    }
+    e := echo.New()
+    e.GET("/", f.Handler("contents/index.html", "no-cache"))
+    e.GET("/docs/*", f.DirHandler("docs", "public, max-age=3600"))
+    get := func(target string, hdr ...string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodGet, target, nil)
+        for i := 0; i+1 < len(hdr); i += 2 {
+            req.Header.Set(hdr[i], hdr[i+1])
+        }
+        rec := httptest.NewRecorder()
+        e.ServeHTTP(rec, req)
+        return rec
+    }
+
+    rec := get("/")
+    etag := rec.Header().Get("ETag")
+    if rec.Code != http.StatusOK || rec.Body.String() != page || etag == "" || rec.Header().Get("Cache-Control") != "no-cache" {
+        t.Fatalf("unexpected response %d %v", rec.Code, rec.Header())
+    }
+    if rec := get("/", "If-None-Match", etag); rec.Code != http.StatusNotModified {
+        t.Fatalf("expected 304, got %d", rec.Code)
+    }
+
+    rec = get("/", "Accept-Encoding", "gzip, br;q=0")
+    if rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("ETag") == etag {
+        t.Fatalf("expected a gzip representation with its own ETag, got %v", rec.Header())
+    }
+    rec = get("/", "Accept-Encoding", "gzip, br")
+    if rec.Header().Get("Content-Encoding") != "br" || rec.Body.Len() >= len(page) {
+        t.Fatalf("expected brotli, got %v", rec.Header())
+    }
+
+    if rec := get("/docs/a.json"); rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != "" {
+        t.Fatalf("small files are served as is, got %d %v", rec.Code, rec.Header())
+    }
+    if rec := get("/docs/../contents/index.html"); rec.Code != http.StatusNotFound {
+        t.Fatalf("files outside docs must not be served, got %d", rec.Code)
+    }
+}
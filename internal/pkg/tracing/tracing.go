@@ -0,0 +1,123 @@
+// Package tracing sets up OpenTelemetry tracing: the exporter, W3C
+// trace-context propagation and the server span of every request.
+package tracing
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+
+    "github.com/labstack/echo/v4"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+    "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/sdk/resource"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+    "go.opentelemetry.io/otel/trace"
+
+    "tiktok-oauth/internal/pkg/httpx"
+)
+
+// ServiceName is reported when OTEL_SERVICE_NAME is not set.
+const ServiceName = "tiktok-oauth"
+
+// Exporters accepted by Setup.
+const (
+    ExporterNone   = "none"
+    ExporterOTLP   = "otlp"
+    ExporterStdout = "stdout"
+)
+
+const instrumentation = "tiktok-oauth/internal/pkg/tracing"
+
+// Setup installs the W3C trace-context propagator and, unless exporter is
+// empty or "none", a tracer provider sending spans to it:
+//
+//   - "otlp" exports over OTLP/HTTP, configured by the standard
+//     OTEL_EXPORTER_OTLP_* variables (endpoint, headers, TLS).
+//   - "stdout" writes each span as JSON to w, or to stderr when w is nil;
+//     stdout carries the JSON log stream.
+//
+// Without an exporter spans are not recorded, but incoming trace context
+// is still propagated to outgoing calls. The returned function flushes
+// pending spans and must be called before exit.
+func Setup(ctx context.Context, exporter string, w io.Writer) (func(context.Context) error, error) {
+    otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+    var (
+        exp sdktrace.SpanExporter
+        err error
+    )
+    switch exporter {
+    case "", ExporterNone:
+        return func(context.Context) error { return nil }, nil
+    case ExporterOTLP:
+        exp, err = otlptracehttp.New(ctx)
+    case ExporterStdout:
+        if w == nil {
+            w = os.Stderr
+        }
+        exp, err = stdouttrace.New(stdouttrace.WithWriter(w))
+    default:
+        return nil, fmt.Errorf("unknown trace exporter %q (want %s, %s or %s)", exporter, ExporterOTLP, ExporterStdout, ExporterNone)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("%s trace exporter: %w", exporter, err)
+    }
+    res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(ServiceName)))
+    if err != nil {
+        return nil, err
+    }
+    // OTEL_SERVICE_NAME, read by resource.Default, wins over ServiceName.
+    if res, err = resource.Merge(res, resource.Environment()); err != nil {
+        return nil, err
+    }
+    tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+    otel.SetTracerProvider(tp)
+    return tp.Shutdown, nil
+}
+
+// Middleware starts the server span of each request, continuing the trace
+// of an incoming traceparent header. Spans are named after the route
+// template and carry the request ID. Errors are rendered here, like in
+// the metrics middleware, so the span records the final status.
+func Middleware() echo.MiddlewareFunc {
+    tracer := otel.Tracer(instrumentation)
+    return func(next echo.HandlerFunc) echo.HandlerFunc {
+        return func(c echo.Context) error {
+            req := c.Request()
+            ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+            route := c.Path()
+            ctx, span := tracer.Start(ctx, req.Method+" "+route,
+                trace.WithSpanKind(trace.SpanKindServer),
+                trace.WithAttributes(
+                    semconv.HTTPRequestMethodKey.String(req.Method),
+                    semconv.HTTPRoute(route),
+                    semconv.URLPath(req.URL.Path),
+                    attribute.String("request_id", c.Response().Header().Get(echo.HeaderXRequestID)),
+                ))
+            defer span.End()
+            c.SetRequest(req.WithContext(ctx))
+
+            err := next(c)
+            if err != nil {
+                c.Error(err)
+            }
+            status := httpx.Status(c, err)
+            span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+            if status >= http.StatusInternalServerError {
+                span.SetStatus(codes.Error, http.StatusText(status))
+                if err != nil {
+                    span.RecordError(err)
+                }
+            }
+            return err
+        }
+    }
+}
@@ -0,0 +1,93 @@
+package tracing
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/labstack/echo/v4"
+    "github.com/labstack/echo/v4/middleware"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/sdk/trace/tracetest"
+    "go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware(t *testing.T) {
+    if _, err := Setup(context.Background(), ExporterNone, nil); err != nil {
+        t.Fatal(err)
+    }
+    rec := tracetest.NewSpanRecorder()
+    otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+
+    e := echo.New()
+    e.Use(middleware.RequestID(), Middleware())
+    var handlerTrace trace.TraceID
+    e.GET("/items/:id", func(c echo.Context) error {
+        handlerTrace = trace.SpanContextFromContext(c.Request().Context()).TraceID()
+        if c.Param("id") == "broken" {
+            return errors.New("boom")
+        }
+        return c.String(http.StatusOK, "ok")
+    })
+
+    req := httptest.NewRequest(http.MethodGet, "/items/1", nil)
+    req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+    e.ServeHTTP(httptest.NewRecorder(), req)
+    e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/broken", nil))
+
+    spans := rec.Ended()
+    if len(spans) != 2 {
+        t.Fatalf("expected 2 spans, got %d", len(spans))
+    }
+    ok, failed := spans[0], spans[1]
+    if ok.Name() != "GET /items/:id" || ok.SpanKind() != trace.SpanKindServer {
+        t.Fatalf("unexpected span %s (%v)", ok.Name(), ok.SpanKind())
+    }
+    if got := ok.Parent().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" || !ok.Parent().IsRemote() {
+        t.Fatalf("traceparent not continued: %s", got)
+    }
+    if failed.SpanContext().TraceID() != handlerTrace {
+        t.Fatalf("handlers must see the request span")
+    }
+    if attr(ok.Attributes(), "request_id") == "" || attr(ok.Attributes(), "http.route") != "/items/:id" {
+        t.Fatalf("unexpected attributes %v", ok.Attributes())
+    }
+    if failed.Status().Code != codes.Error || attr(failed.Attributes(), "http.response.status_code") != "500" {
+        t.Fatalf("failed requests must mark the span: %v %v", failed.Status(), failed.Attributes())
+    }
+}
+
+func TestSetup(t *testing.T) {
+    var out bytes.Buffer
+    shutdown, err := Setup(context.Background(), ExporterStdout, &out)
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, span := otel.Tracer("test").Start(context.Background(), "op")
+    span.End()
+    if err := shutdown(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(out.String(), `"Name":"op"`) || !strings.Contains(out.String(), ServiceName) {
+        t.Fatalf("span not exported: %s", out.String())
+    }
+    if _, err := Setup(context.Background(), "jaeger", nil); err == nil {
+        t.Fatal("unknown exporters must be rejected")
+    }
+}
+
+func attr(kvs []attribute.KeyValue, key string) string {
+    for _, kv := range kvs {
+        if string(kv.Key) == key {
+            return kv.Value.Emit()
+        }
+    }
+    return ""
+}